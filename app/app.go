@@ -7,23 +7,32 @@ import (
 
 	// Standard Library:
 	"fmt"
+	"log"
 
 	// Third-party:
 	"github.com/docopt/docopt-go"
 
 	// Kisipar:
 	"github.com/biztos/kisipar"
+	"github.com/biztos/kisipar/site"
 )
 
 // Options represents the standard set of command-line options, which are
 // parsed according to the usage specification provided to GetOpts.
 type Options struct {
 	SitePaths []string
+	Dev       bool
+	Build     bool
+	Check     bool
+	OutDir    string
 }
 
 // Run runs the application with the standard options and the provided name,
 // version, and binary name; and the default usage spec from Usage.  The first
-// error encountered is returned.
+// error encountered is returned; if the servers are shut down gracefully,
+// e.g. on SIGTERM, the result is nil.  With the build command, the site is
+// exported via Build instead of served, and with the check command, the
+// sites are checked via Check.
 //
 //  func main() {
 //      if err := kisipar.Run("Foobar Thingy","1.2.3","foobar"); err != nil
@@ -34,12 +43,18 @@ type Options struct {
 func Run(name, version, binary string) error {
 
 	opts := GetOpts(name+" "+version, Usage(name, version, binary))
+	if opts.Build {
+		return Build(opts.SitePaths[0], opts.OutDir)
+	}
+	if opts.Check {
+		return Check(opts.SitePaths...)
+	}
 	k, err := kisipar.Load(opts.SitePaths...)
 	if err != nil {
 		return err
 	}
-	k.Serve()
-	return nil
+	k.DevMode = opts.Dev
+	return k.Serve()
 }
 
 // GetOpts processes arguments, exiting if the result is not ready to serve.
@@ -72,11 +87,80 @@ func GetOpts(heading, usage string) *Options {
 		}
 	}
 
+	// Development mode is optional, as not all usage specs will have it.
+	if dev, ok := args["--dev"].(bool); ok {
+		opts.Dev = dev
+	}
+
+	// Likewise the build command and its output directory.
+	if build, ok := args["build"].(bool); ok {
+		opts.Build = build
+	}
+	if check, ok := args["check"].(bool); ok {
+		opts.Check = check
+	}
+	if dir, ok := args["<OUTDIR>"].(string); ok {
+		opts.OutDir = dir
+	}
+
 	// Further opts are TODO... MVP first!
 
 	return opts
 }
 
+// Build loads the site at path and exports it to the directory dir with
+// site.Export, logging a summary and any broken links found.  Broken links
+// are not errors.
+func Build(path, dir string) error {
+
+	s, err := site.Load(path)
+	if err != nil {
+		return fmt.Errorf("Site error at %s: %s", path, err)
+	}
+	report, err := s.Export(dir)
+	if err != nil {
+		return err
+	}
+	for _, b := range report.BrokenLinks {
+		log.Printf("%s: broken link on %s: %s", s.Name, b.Page, b.Link)
+	}
+	log.Printf("%s: exported to %s: %d written, %d unchanged, %d removed.",
+		s.Name, dir, len(report.Written), len(report.Unchanged),
+		len(report.Removed))
+	return nil
+
+}
+
+// Check checks the sites at paths with site.Check, logging every problem
+// found and a summary for each site.  An error is returned if any site has
+// problems or can not be checked, so that the exit status is useful for
+// continuous integration.
+func Check(paths ...string) error {
+
+	failed := 0
+	for _, path := range paths {
+		report, err := site.Check(path)
+		if err != nil {
+			return fmt.Errorf("Site error at %s: %s", path, err)
+		}
+		name := report.Site.Name
+		for _, p := range report.Problems {
+			log.Printf("%s: %s", name, p)
+		}
+		log.Printf("%s: checked %d pages: %d problems.", name, report.Pages,
+			len(report.Problems))
+		if !report.OK() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("Check failed for %d of %d sites.", failed,
+			len(paths))
+	}
+	return nil
+
+}
+
 // Usage returns the standard DocOpt-style usage specification with the given
 // name as the proper app name with version.
 func Usage(name, version, binary string) string {
@@ -84,6 +168,8 @@ func Usage(name, version, binary string) string {
 	f := `%s.
 
 Usage:
+  %s build <SITEPATH> <OUTDIR>
+  %s check <SITEPATH>...
   %s [options] <SITEPATH>...
   %s -h | --help
   %s -v | --version
@@ -91,6 +177,15 @@ Usage:
 Options:
   -h --help     Show this screen.
   -v --version  Show version.
+  --dev         Development mode: watch files, reload browsers on changes.
+                NOT FOR PRODUCTION: error details are shown to the public.
+
+Commands:
+  build         Export the site as static files to OUTDIR, writing only
+                what has changed, and report any broken internal links.
+  check         Check the sites: validate all page meta and redirects,
+                parse all templates and render all pages, reporting every
+                problem found.  The exit status is non-zero if there are any.
 
 Version:
   This is %s version %s.
@@ -98,6 +193,8 @@ Version:
 
 	return fmt.Sprintf(f,
 		name,    // heading
+		binary,  // usage: build
+		binary,  // usage: check
 		binary,  // usage
 		binary,  // usage: help
 		binary,  // usage: version
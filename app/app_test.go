@@ -7,8 +7,12 @@ package app_test
 
 import (
 	// Standard Library:
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"os"
+	"path/filepath"
 	"testing"
 
 	// Third Party:
@@ -51,6 +55,8 @@ func Test_Usage(t *testing.T) {
 	exp := `Foo Bar.
 
 Usage:
+  foobar build <SITEPATH> <OUTDIR>
+  foobar check <SITEPATH>...
   foobar [options] <SITEPATH>...
   foobar -h | --help
   foobar -v | --version
@@ -58,6 +64,15 @@ Usage:
 Options:
   -h --help     Show this screen.
   -v --version  Show version.
+  --dev         Development mode: watch files, reload browsers on changes.
+                NOT FOR PRODUCTION: error details are shown to the public.
+
+Commands:
+  build         Export the site as static files to OUTDIR, writing only
+                what has changed, and report any broken internal links.
+  check         Check the sites: validate all page meta and redirects,
+                parse all templates and render all pages, reporting every
+                problem found.  The exit status is non-zero if there are any.
 
 Version:
   This is Foo Bar version 3.2.1.
@@ -126,6 +141,108 @@ Options:
 		"multi path parsed")
 }
 
+func Test_GetOpts_Dev(t *testing.T) {
+
+	assert := assert.New(t)
+
+	usage := app.Usage("xxx", "1.0", "xxx")
+
+	os.Args = []string{"xxx", "path1"}
+	opts := app.GetOpts("xxx", usage)
+	assert.False(opts.Dev, "dev mode off by default")
+
+	os.Args = []string{"xxx", "--dev", "path1"}
+	opts = app.GetOpts("xxx", usage)
+	assert.True(opts.Dev, "dev mode on")
+	assert.Equal([]string{"path1"}, opts.SitePaths, "path parsed")
+}
+
+func Test_GetOpts_Build(t *testing.T) {
+
+	assert := assert.New(t)
+
+	usage := app.Usage("xxx", "1.0", "xxx")
+
+	os.Args = []string{"xxx", "path1", "path2"}
+	opts := app.GetOpts("xxx", usage)
+	assert.False(opts.Build, "build off by default")
+
+	os.Args = []string{"xxx", "build", "path1", "outdir"}
+	opts = app.GetOpts("xxx", usage)
+	assert.True(opts.Build, "build on")
+	assert.Equal([]string{"path1"}, opts.SitePaths, "path parsed")
+	assert.Equal("outdir", opts.OutDir, "output dir parsed")
+}
+
+func Test_GetOpts_Check(t *testing.T) {
+
+	assert := assert.New(t)
+
+	usage := app.Usage("xxx", "1.0", "xxx")
+
+	os.Args = []string{"xxx", "path1"}
+	opts := app.GetOpts("xxx", usage)
+	assert.False(opts.Check, "check off by default")
+
+	os.Args = []string{"xxx", "check", "path1", "path2"}
+	opts = app.GetOpts("xxx", usage)
+	assert.True(opts.Check, "check on")
+	assert.Equal([]string{"path1", "path2"}, opts.SitePaths, "paths parsed")
+}
+
+func Test_Build(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "kisipar-app-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	spath := filepath.Join(dir, "site")
+	out := filepath.Join(dir, "out")
+	for _, sub := range []string{"pages", "templates"} {
+		if err := os.MkdirAll(filepath.Join(spath, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{
+		"config.yaml":           "Name: Built",
+		"pages/index.md":        "# Home\n\n[Gone](/gone)",
+		"pages/hello.md":        "# Hello",
+		"templates/single.html": "{{ .Page.Title }}",
+		"templates/index.html":  "{{ .Page.Content }}",
+	} {
+		path := filepath.Join(spath, filepath.FromSlash(name))
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	os.Args = []string{"xxx", "build", spath, out}
+	if err := app.Run("XXX", "1.2.3", "xxx"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(buf.String(), "Built: broken link on /: /gone",
+		"broken link logged")
+	assert.Contains(buf.String(),
+		"Built: exported to "+out+": 8 written, 0 unchanged, 0 removed.",
+		"summary logged")
+	_, err = os.Stat(filepath.Join(out, "hello", "index.html"))
+	assert.NoError(err, "page exported")
+
+	err = app.Build("no-such-path-here-we-hope", dir)
+	if assert.Error(err, "error returned") {
+		assert.Regexp("^Site error at no-such-path-here-we-hope: ", err.Error(),
+			"error useful")
+	}
+
+}
+
 func Test_Run_PathError(t *testing.T) {
 
 	assert := assert.New(t)
@@ -138,3 +255,63 @@ func Test_Run_PathError(t *testing.T) {
 	}
 
 }
+
+func Test_Check(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "kisipar-app-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, sub := range []string{"pages", "templates"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{
+		"config.yaml": "Name: Checked\nMetaSchema:\n    /:\n" +
+			"        Required: [Created]\n        Strict: true\n",
+		"pages/hello.md":        "# Hello\n\n    Created: 2020-01-02\n",
+		"templates/single.html": "{{ .Page.Title }}",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	os.Args = []string{"xxx", "check", dir}
+	assert.Nil(app.Run("XXX", "1.2.3", "xxx"), "no error for good site")
+	assert.Contains(buf.String(), "Checked: checked 1 pages: 0 problems.",
+		"summary logged")
+	assert.NotContains(buf.String(), "Page", "no problems logged")
+
+	buf.Reset()
+	bad := filepath.Join(dir, "pages", "bad.md")
+	if err := ioutil.WriteFile(bad, []byte("# Bad\n\n    Craeted: 2020-01-02\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = app.Check(dir)
+	if assert.Error(err, "error for bad site") {
+		assert.Equal("Check failed for 1 of 1 sites.", err.Error(),
+			"error useful")
+	}
+	assert.Contains(buf.String(), "Checked: Page "+bad+
+		": meta Craeted: unknown key; did you mean Created?",
+		"problem logged")
+	assert.Contains(buf.String(), "Checked: checked 2 pages: 2 problems.",
+		"summary logged")
+
+	err = app.Check("no-such-path-here-we-hope")
+	if assert.Error(err, "error returned") {
+		assert.Regexp("^Site error at no-such-path-here-we-hope: ", err.Error(),
+			"error useful")
+	}
+
+}
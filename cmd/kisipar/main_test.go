@@ -103,3 +103,28 @@ func Test_Success(t *testing.T) {
 	r.AssertExitedWith(0)
 	r.AssertLoggedString("Test Site One: listening on port 8081.\n")
 }
+
+func Test_Check(t *testing.T) {
+
+	r := prepTestRecorder(t)
+
+	path := filepath.Join("test_data", "site_1")
+	os.Args = []string{"kisipar", "check", path}
+	main()
+
+	r.AssertExitedWith(0)
+	r.AssertLoggedRegexp("^Test Site One: checked \\d+ pages: 0 problems.\n$")
+
+}
+
+func Test_Check_BadPath(t *testing.T) {
+
+	r := prepTestRecorder(t)
+
+	os.Args = []string{"kisipar", "check", "no-such-path-here-we-assume"}
+	main()
+
+	r.AssertExitedWith(1)
+	r.AssertLoggedRegexp("^Site error.*no such file or directory")
+
+}
@@ -0,0 +1,332 @@
+// frostedmd/commonmark.go - the CommonMark engine, based on Goldmark.
+// -----------------------
+
+package frostedmd
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/russross/blackfriday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// CommonMark is the Engine based on Goldmark, which is CommonMark-compliant.
+// It supports the Blackfriday extensions and flags for tables, fenced code
+// (always on), autolinks, strikethrough, footnotes, definition lists, hard
+// line breaks, header IDs, XHTML, smartypants and skipping HTML.
+//
+// Raw HTML is rendered unless HTML_SKIP_HTML is set, as with Blackfriday,
+// and blocks are separated by empty lines as Blackfriday does.
+var CommonMark Engine = &commonMarkEngine{}
+
+// commonMarkEngine keeps a Goldmark converter for each combination of
+// extensions and flags, as they are somewhat expensive to set up.
+type commonMarkEngine struct {
+	converters sync.Map
+}
+
+type commonMarkKey struct {
+	extensions int
+	flags      int
+}
+
+// Render implements the Engine interface for CommonMark.
+func (e *commonMarkEngine) Render(p *Parser, input []byte) (*Rendering, error) {
+
+	md := e.converter(p.MarkdownExtensions, p.HtmlFlags)
+	doc := md.Parser().Parse(text.NewReader(input))
+	res := &Rendering{}
+
+	// The header title, if the document starts with one:
+	first := doc.FirstChild()
+	if h, ok := first.(*ast.Heading); ok {
+		buf := new(bytes.Buffer)
+		if err := md.Renderer().Render(buf, input, h); err != nil {
+			return nil, err
+		}
+		title := strings.TrimSpace(buf.String())
+		if i := strings.IndexByte(title, '>'); i >= 0 {
+			title = title[i+1:]
+		}
+		if i := strings.LastIndex(title, "</"); i >= 0 {
+			title = title[:i]
+		}
+		res.HeaderTitle = title
+		first = h.NextSibling()
+	}
+
+	// The meta block is the first code block, or the one right after the
+	// header title; or the last block, if the meta is at the end.
+	meta := first
+	if p.MetaAtEnd {
+		meta = doc.LastChild()
+	}
+	if p.NoMetaBlock {
+		meta = nil
+	}
+	if meta != nil && (meta.Kind() == ast.KindCodeBlock ||
+		meta.Kind() == ast.KindFencedCodeBlock) {
+		lines := meta.Lines()
+		if lines.Len() > 0 {
+			start := lines.At(0).Start
+			res.MetaLine = bytes.Count(input[:start], []byte("\n")) + 1
+		}
+		for i := 0; i < lines.Len(); i++ {
+			seg := lines.At(i)
+			res.MetaBlock = append(res.MetaBlock, seg.Value(input)...)
+		}
+		if fenced, ok := meta.(*ast.FencedCodeBlock); ok {
+			res.MetaLang = string(fenced.Language(input))
+		}
+		doc.RemoveChild(doc, meta)
+	}
+	spaceBlocks(doc)
+
+	buf := new(bytes.Buffer)
+	if err := md.Renderer().Render(buf, input, doc); err != nil {
+		return nil, err
+	}
+	res.Content = buf.Bytes()
+	return res, nil
+
+}
+
+// converter returns the Goldmark converter for the Blackfriday extensions
+// and HTML flags.
+func (e *commonMarkEngine) converter(extensions, flags int) goldmark.Markdown {
+
+	key := commonMarkKey{extensions, flags}
+	if md, ok := e.converters.Load(key); ok {
+		return md.(goldmark.Markdown)
+	}
+
+	exts := []goldmark.Extender{}
+	if extensions&blackfriday.EXTENSION_TABLES != 0 {
+		exts = append(exts, extension.Table)
+	}
+	if extensions&blackfriday.EXTENSION_AUTOLINK != 0 {
+		exts = append(exts, extension.Linkify)
+	}
+	if extensions&blackfriday.EXTENSION_STRIKETHROUGH != 0 {
+		exts = append(exts, extension.Strikethrough)
+	}
+	if extensions&blackfriday.EXTENSION_FOOTNOTES != 0 {
+		exts = append(exts, extension.Footnote)
+	}
+	if extensions&blackfriday.EXTENSION_DEFINITION_LISTS != 0 {
+		exts = append(exts, extension.DefinitionList)
+	}
+	if flags&blackfriday.HTML_USE_SMARTYPANTS != 0 {
+		exts = append(exts, extension.Typographer)
+	}
+
+	parserOpts := []parser.Option{}
+	if flags&blackfriday.HTML_USE_SMARTYPANTS != 0 {
+		fractions := &fractionParser{
+			generic: flags&blackfriday.HTML_SMARTYPANTS_FRACTIONS != 0,
+		}
+		parserOpts = append(parserOpts,
+			parser.WithInlineParsers(util.Prioritized(fractions, 9999)))
+	}
+	if extensions&blackfriday.EXTENSION_HEADER_IDS != 0 {
+		parserOpts = append(parserOpts, parser.WithHeadingAttribute())
+	}
+	if extensions&blackfriday.EXTENSION_AUTO_HEADER_IDS != 0 {
+		parserOpts = append(parserOpts, parser.WithAutoHeadingID())
+	}
+
+	rendererOpts := []renderer.Option{
+		renderer.WithNodeRenderers(util.Prioritized(&blockSpacer{}, 1)),
+	}
+	if extensions&blackfriday.EXTENSION_HARD_LINE_BREAK != 0 {
+		rendererOpts = append(rendererOpts, html.WithHardWraps())
+	}
+	if flags&blackfriday.HTML_USE_XHTML != 0 {
+		rendererOpts = append(rendererOpts, html.WithXHTML())
+	}
+	if flags&blackfriday.HTML_SKIP_HTML == 0 {
+		rendererOpts = append(rendererOpts, html.WithUnsafe())
+	}
+
+	md := goldmark.New(
+		goldmark.WithExtensions(exts...),
+		goldmark.WithParserOptions(parserOpts...),
+		goldmark.WithRendererOptions(rendererOpts...),
+	)
+	actual, _ := e.converters.LoadOrStore(key, md)
+	return actual.(goldmark.Markdown)
+
+}
+
+// kindBlankLine is the kind of the blankLine nodes.
+var kindBlankLine = ast.NewNodeKind("BlankLine")
+
+// A blankLine is rendered as an empty line between blocks, so the output is
+// spaced as Blackfriday's is.
+type blankLine struct {
+	ast.BaseBlock
+}
+
+// Kind implements the ast.Node interface.
+func (n *blankLine) Kind() ast.NodeKind {
+	return kindBlankLine
+}
+
+// Dump implements the ast.Node interface.
+func (n *blankLine) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// spaceBlocks inserts blankLines where Blackfriday has empty lines: between
+// the blocks of the document, of block quotes and of list items, except
+// after the text of tight list items; and between the rows of table bodies.
+func spaceBlocks(parent ast.Node) {
+
+	var prev ast.Node
+	for n := parent.FirstChild(); n != nil; {
+		next := n.NextSibling()
+		if n.Type() == ast.TypeBlock {
+			spaceBlocks(n)
+		}
+		if prev != nil && spacedBlocks(parent, prev, n) {
+			parent.InsertBefore(parent, n, &blankLine{})
+		}
+		prev = n
+		n = next
+	}
+
+}
+
+func spacedBlocks(parent, prev, n ast.Node) bool {
+	switch parent.Kind() {
+	case ast.KindDocument, ast.KindBlockquote, ast.KindListItem:
+		return prev.Kind() != ast.KindTextBlock
+	case extast.KindTable:
+		return prev.Kind() == extast.KindTableRow
+	}
+	return false
+}
+
+// blockSpacer renders the blankLines, and the table headers with an empty
+// line before the body, as Blackfriday does.
+type blockSpacer struct{}
+
+// RegisterFuncs implements the renderer.NodeRenderer interface.
+func (r *blockSpacer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindBlankLine, r.renderBlankLine)
+	reg.Register(extast.KindTableHeader, r.renderTableHeader)
+}
+
+func (r *blockSpacer) renderBlankLine(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_ = w.WriteByte('\n')
+	}
+	return ast.WalkContinue, nil
+}
+
+func (r *blockSpacer) renderTableHeader(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString("<thead")
+		if n.Attributes() != nil {
+			html.RenderAttributes(w, n, extension.TableHeaderAttributeFilter)
+		}
+		_, _ = w.WriteString(">\n<tr>\n")
+	} else {
+		_, _ = w.WriteString("</tr>\n</thead>\n")
+		if n.NextSibling() != nil {
+			_, _ = w.WriteString("\n<tbody>\n")
+		}
+	}
+	return ast.WalkContinue, nil
+}
+
+// fractionParser renders fractions as Blackfriday's smartypants does: as
+// "&frac12;" etc. for the common ones, or if generic, for any "1/23" as
+// "<sup>1</sup>&frasl;<sub>23</sub>".  Dates such as "1/23/2005" are left
+// alone.  Goldmark only tries inline parsers at spaces and punctuation, so
+// fractions are found after spaces and at the start of a line.
+type fractionParser struct {
+	generic bool
+}
+
+// Trigger implements the parser.InlineParser interface.
+func (p *fractionParser) Trigger() []byte {
+	return []byte{' '}
+}
+
+// Parse implements the parser.InlineParser interface.
+func (p *fractionParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+
+	line, _ := block.PeekLine()
+	lead := 0
+	if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+		lead = 1
+	} else if prev := block.PrecendingCharacter(); !wordBoundary(prev) {
+		return nil
+	}
+	prefix := string(line[:lead])
+	line = line[lead:]
+	numEnd := 0
+	for numEnd < len(line) && isDigit(line[numEnd]) {
+		numEnd++
+	}
+	if numEnd == 0 || numEnd >= len(line) || line[numEnd] != '/' {
+		return nil
+	}
+	denEnd := numEnd + 1
+	for denEnd < len(line) && isDigit(line[denEnd]) {
+		denEnd++
+	}
+	if denEnd == numEnd+1 {
+		return nil
+	}
+	if denEnd < len(line) &&
+		(line[denEnd] == '/' || !wordBoundary(rune(line[denEnd]))) {
+		return nil
+	}
+
+	num, den := string(line[:numEnd]), string(line[numEnd+1:denEnd])
+	var value string
+	if p.generic {
+		value = "<sup>" + num + "</sup>&frasl;<sub>" + den + "</sub>"
+	} else {
+		switch num + "/" + den {
+		case "1/2":
+			value = "&frac12;"
+		case "1/4":
+			value = "&frac14;"
+		case "3/4":
+			value = "&frac34;"
+		default:
+			return nil
+		}
+	}
+	block.Advance(lead + denEnd)
+	node := ast.NewString([]byte(prefix + value))
+	node.SetCode(true)
+	return node
+
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// wordBoundary follows Blackfriday: the start or end of the text, spaces,
+// and ASCII punctuation are word boundaries.
+func wordBoundary(r rune) bool {
+	return r == 0 || (r < utf8.RuneSelf &&
+		(unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)))
+}
@@ -0,0 +1,159 @@
+// frostedmd/commonmark_test.go - tests for the CommonMark engine.
+// ----------------------------
+
+package frostedmd_test
+
+import (
+	"github.com/biztos/kisipar/frostedmd"
+	"github.com/russross/blackfriday"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func commonMarkParser() *frostedmd.Parser {
+	parser := frostedmd.New()
+	parser.Engine = frostedmd.CommonMark
+	return parser
+}
+
+func Test_CommonMark_MetaFirst(t *testing.T) {
+
+	assert := assert.New(t)
+
+	input := "# Ima \"Title\"\n\n    # I'm a comment!\n    OldSchool: \"YAML\"\n\n" +
+		"Plus \"this.\""
+
+	res, err := commonMarkParser().Parse([]byte(input))
+	assert.Nil(err, "no error")
+	assert.Equal(map[string]interface{}{
+		"Title":     "Ima &ldquo;Title&rdquo;",
+		"OldSchool": "YAML",
+	}, res.Meta(), "meta map as expected")
+	assert.Equal("<h1>Ima &ldquo;Title&rdquo;</h1>\n\n<p>Plus &ldquo;this.&rdquo;</p>\n",
+		string(res.Content()), "content as expected")
+
+	input = "```json\n{\"foo\": \"Bar\"}\n```\n\nThere.\n\n# Elsewhere."
+	res, err = commonMarkParser().Parse([]byte(input))
+	assert.Nil(err, "no error")
+	assert.Equal(map[string]interface{}{"foo": "Bar"}, res.Meta(),
+		"JSON meta without header, late header ignored")
+	assert.Equal("<p>There.</p>\n\n<h1>Elsewhere.</h1>\n",
+		string(res.Content()), "content as expected")
+
+}
+
+func Test_CommonMark_LateMetaIgnored(t *testing.T) {
+
+	assert := assert.New(t)
+
+	input := "# Here\n\nThere!\n\n```yaml\nfoo: [1,true,3\n```\n"
+
+	res, err := commonMarkParser().Parse([]byte(input))
+	assert.Nil(err, "no error")
+	assert.Equal(map[string]interface{}{"Title": "Here"}, res.Meta(),
+		"meta map as expected")
+	assert.Equal("<h1>Here</h1>\n\n<p>There!</p>\n\n"+
+		"<pre><code class=\"language-yaml\">foo: [1,true,3\n</code></pre>\n",
+		string(res.Content()), "late code block kept")
+
+}
+
+func Test_CommonMark_MetaAtEnd(t *testing.T) {
+
+	assert := assert.New(t)
+
+	input := "# Ima Title\n\n    Not: meta\n\nSome block here.\n\n```yaml\n" +
+		"OldSchool: \"YAML\"\n```\n"
+
+	parser := commonMarkParser()
+	parser.MetaAtEnd = true
+	res, err := parser.Parse([]byte(input))
+	assert.Nil(err, "no error")
+	assert.Equal(map[string]interface{}{
+		"Title":     "Ima Title",
+		"OldSchool": "YAML",
+	}, res.Meta(), "meta map as expected")
+	assert.Equal("<h1>Ima Title</h1>\n\n<pre><code>Not: meta\n</code></pre>\n\n"+
+		"<p>Some block here.</p>\n", string(res.Content()),
+		"content as expected")
+
+	res, err = parser.Parse([]byte(input + "\n## Because of this.\n"))
+	assert.Nil(err, "no error")
+	assert.Equal(map[string]interface{}{"Title": "Ima Title"}, res.Meta(),
+		"no meta if not last")
+
+}
+
+func Test_CommonMark_Error(t *testing.T) {
+
+	assert := assert.New(t)
+
+	input := "```yaml\nfoo: [1,true,3\n```\n\nThere."
+
+	res, err := commonMarkParser().Parse([]byte(input))
+	assert.Error(err, "error for bad meta")
+	assert.Equal("<p>There.</p>\n", string(res.Content()),
+		"content returned anyway")
+
+}
+
+func Test_CommonMark_Fractions(t *testing.T) {
+
+	assert := assert.New(t)
+
+	input := []byte("1/2 of 3/4 is 3/8, on 1/23/2005 at 12/3rd.")
+
+	parser := commonMarkParser()
+	res, err := parser.Parse(input)
+	assert.Nil(err, "no error")
+	assert.Equal("<p><sup>1</sup>&frasl;<sub>2</sub> of "+
+		"<sup>3</sup>&frasl;<sub>4</sub> is <sup>3</sup>&frasl;<sub>8</sub>, "+
+		"on 1/23/2005 at 12/3rd.</p>\n", string(res.Content()),
+		"generic fractions")
+
+	parser.HtmlFlags = parser.HtmlFlags &^ blackfriday.HTML_SMARTYPANTS_FRACTIONS
+	res, err = parser.Parse(input)
+	assert.Nil(err, "no error")
+	assert.Equal("<p>&frac12; of &frac34; is 3/8, on 1/23/2005 at 12/3rd.</p>\n",
+		string(res.Content()), "common fractions")
+
+}
+
+func Test_CommonMark_Basic(t *testing.T) {
+
+	assert := assert.New(t)
+
+	parser := frostedmd.NewBasic()
+	parser.Engine = frostedmd.CommonMark
+	res, err := parser.Parse([]byte("# Hi\n\n\"Plain\" ~~text~~ -- 1/2 <b>x</b>"))
+	assert.Nil(err, "no error")
+	assert.Equal("<h1>Hi</h1>\n\n<p>&quot;Plain&quot; ~~text~~ -- 1/2 <b>x</b></p>\n",
+		string(res.Content()), "no extensions, raw HTML kept")
+
+	parser.HtmlFlags = blackfriday.HTML_SKIP_HTML
+	res, err = parser.Parse([]byte("<b>x</b>"))
+	assert.Nil(err, "no error")
+	assert.NotContains(string(res.Content()), "<b>", "HTML skipped")
+
+}
+
+func Test_EngineNamed(t *testing.T) {
+
+	assert := assert.New(t)
+
+	e, err := frostedmd.EngineNamed("")
+	assert.Nil(err, "no error for default")
+	assert.Equal(frostedmd.Blackfriday, e, "default engine")
+
+	e, err = frostedmd.EngineNamed("CommonMark")
+	assert.Nil(err, "no error for known engine")
+	assert.Equal(frostedmd.CommonMark, e, "named engine, case-insensitive")
+
+	_, err = frostedmd.EngineNamed("nonesuch")
+	if assert.Error(err, "error for unknown engine") {
+		assert.Equal(`Unknown Markdown engine "nonesuch"; `+
+			"known engines: blackfriday, commonmark.", err.Error(),
+			"error is useful")
+	}
+
+}
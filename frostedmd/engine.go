@@ -0,0 +1,101 @@
+// frostedmd/engine.go - pluggable Markdown engines for Frosted Markdown.
+// -------------------
+
+package frostedmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/russross/blackfriday"
+)
+
+// An Engine converts Markdown to HTML for a Parser, following the Parser's
+// MetaAtEnd, NoMetaBlock, MarkdownExtensions and HtmlFlags.  While rendering,
+// it must find the meta block and the header title according to the Frosted
+// Markdown rules (cf. the package documentation), and exclude the meta
+// block from the content.  The Parser does the rest, including the front
+// matter.
+//
+// The extensions and flags are given as Blackfriday constants whatever the
+// Engine; an Engine should support as many of them as it can, and ignore
+// the rest.
+type Engine interface {
+	Render(p *Parser, input []byte) (*Rendering, error)
+}
+
+// A Rendering is the result of an Engine's Render: the HTML Content, the
+// raw MetaBlock with its MetaLang and MetaLine (the line number in the
+// input where its content starts, or zero if unknown), if any, and the
+// HeaderTitle as HTML, if the Markdown starts with a header.
+type Rendering struct {
+	Content     []byte
+	MetaBlock   []byte
+	MetaLang    string
+	MetaLine    int
+	HeaderTitle string
+}
+
+// Blackfriday is the Engine based on Blackfriday, the original, and the
+// default for Parsers without an Engine.
+var Blackfriday Engine = &blackfridayEngine{}
+
+// ENGINES are the Engines available by name, e.g. for configuration.
+var ENGINES = map[string]Engine{
+	"blackfriday": Blackfriday,
+	"commonmark":  CommonMark,
+}
+
+// DEFAULT_ENGINE is the name of the Engine used by default.
+var DEFAULT_ENGINE = "blackfriday"
+
+// EngineNamed returns the Engine in ENGINES with the given name, matched
+// case-insensitively; if the name is empty, it returns the DEFAULT_ENGINE.
+// An error is returned if there is no such Engine.
+func EngineNamed(name string) (Engine, error) {
+
+	if name == "" {
+		name = DEFAULT_ENGINE
+	}
+	if e := ENGINES[strings.ToLower(name)]; e != nil {
+		return e, nil
+	}
+	names := make([]string, 0, len(ENGINES))
+	for n := range ENGINES {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("Unknown Markdown engine %q; known engines: %s.",
+		name, strings.Join(names, ", "))
+
+}
+
+type blackfridayEngine struct{}
+
+// Render implements the Engine interface for Blackfriday.
+func (e *blackfridayEngine) Render(p *Parser, input []byte) (*Rendering, error) {
+
+	// cf. renderer.go for the fmdRenderer definition
+	renderer := &fmdRenderer{
+		bfRenderer: blackfriday.HtmlRenderer(p.HtmlFlags,
+			"", // no title
+			"", // no css
+		),
+		metaAtEnd: p.MetaAtEnd,
+		noMeta:    p.NoMetaBlock,
+	}
+
+	content := blackfriday.MarkdownOptions(input, renderer,
+		blackfriday.Options{Extensions: p.MarkdownExtensions})
+
+	// Blackfriday does not keep track of positions, so we have to guess.
+	return &Rendering{
+		Content:     content,
+		MetaBlock:   renderer.metaBytes,
+		MetaLang:    renderer.metaLang,
+		MetaLine:    metaLine(input, renderer.metaBytes, p.MetaAtEnd),
+		HeaderTitle: renderer.headerTitle,
+	}, nil
+
+}
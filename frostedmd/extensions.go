@@ -0,0 +1,65 @@
+// frostedmd/extensions.go - Markdown extensions and HTML flags by name.
+// -----------------------
+
+package frostedmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/russross/blackfriday"
+)
+
+// EXTENSION_NAMES are the Blackfriday extensions available by name, e.g. for
+// configuration: the names are those of the EXTENSION_* constants, without
+// the prefix and in lower case.
+var EXTENSION_NAMES = map[string]int{
+	"no_intra_emphasis":          blackfriday.EXTENSION_NO_INTRA_EMPHASIS,
+	"tables":                     blackfriday.EXTENSION_TABLES,
+	"fenced_code":                blackfriday.EXTENSION_FENCED_CODE,
+	"autolink":                   blackfriday.EXTENSION_AUTOLINK,
+	"strikethrough":              blackfriday.EXTENSION_STRIKETHROUGH,
+	"lax_html_blocks":            blackfriday.EXTENSION_LAX_HTML_BLOCKS,
+	"space_headers":              blackfriday.EXTENSION_SPACE_HEADERS,
+	"hard_line_break":            blackfriday.EXTENSION_HARD_LINE_BREAK,
+	"tab_size_eight":             blackfriday.EXTENSION_TAB_SIZE_EIGHT,
+	"footnotes":                  blackfriday.EXTENSION_FOOTNOTES,
+	"no_empty_line_before_block": blackfriday.EXTENSION_NO_EMPTY_LINE_BEFORE_BLOCK,
+	"header_ids":                 blackfriday.EXTENSION_HEADER_IDS,
+	"titleblock":                 blackfriday.EXTENSION_TITLEBLOCK,
+	"auto_header_ids":            blackfriday.EXTENSION_AUTO_HEADER_IDS,
+	"backslash_line_break":       blackfriday.EXTENSION_BACKSLASH_LINE_BREAK,
+	"definition_lists":           blackfriday.EXTENSION_DEFINITION_LISTS,
+	"join_lines":                 blackfriday.EXTENSION_JOIN_LINES,
+}
+
+// SMARTYPANTS_FLAGS are the HTML flags for smartypants as in the common
+// set: smart punctuation, fractions and dashes.
+const SMARTYPANTS_FLAGS = 0 |
+	blackfriday.HTML_USE_SMARTYPANTS |
+	blackfriday.HTML_SMARTYPANTS_FRACTIONS |
+	blackfriday.HTML_SMARTYPANTS_DASHES |
+	blackfriday.HTML_SMARTYPANTS_LATEX_DASHES
+
+// HEADING_ID_EXTENSIONS are the extensions for heading IDs, both explicit
+// ("# Foo {#foo}") and automatic.
+const HEADING_ID_EXTENSIONS = 0 |
+	blackfriday.EXTENSION_HEADER_IDS |
+	blackfriday.EXTENSION_AUTO_HEADER_IDS
+
+// ExtensionsNamed returns the extensions in EXTENSION_NAMES with the given
+// names, matched case-insensitively, combined.  An error is returned for
+// the first unknown name.
+func ExtensionsNamed(names []string) (int, error) {
+
+	extensions := 0
+	for _, name := range names {
+		ext, ok := EXTENSION_NAMES[strings.ToLower(name)]
+		if !ok {
+			return 0, fmt.Errorf("Unknown Markdown extension %q.", name)
+		}
+		extensions |= ext
+	}
+	return extensions, nil
+
+}
@@ -0,0 +1,32 @@
+// frostedmd/extensions_test.go - tests for named extensions.
+// ----------------------------
+
+package frostedmd_test
+
+import (
+	"github.com/biztos/kisipar/frostedmd"
+	"github.com/russross/blackfriday"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_ExtensionsNamed(t *testing.T) {
+
+	assert := assert.New(t)
+
+	ext, err := frostedmd.ExtensionsNamed([]string{"tables", "Fenced_Code"})
+	assert.Nil(err, "no error for known names")
+	assert.Equal(blackfriday.EXTENSION_TABLES|blackfriday.EXTENSION_FENCED_CODE,
+		ext, "extensions combined, names case-insensitive")
+
+	ext, err = frostedmd.ExtensionsNamed([]string{})
+	assert.Nil(err, "no error for no names")
+	assert.Equal(0, ext, "no extensions")
+
+	_, err = frostedmd.ExtensionsNamed([]string{"tables", "nonesuch"})
+	if assert.Error(err, "error for unknown name") {
+		assert.Equal(`Unknown Markdown extension "nonesuch".`, err.Error(),
+			"error is useful")
+	}
+
+}
@@ -3,7 +3,8 @@
 
 // Package frostedmd implements Frosted Markdown: standard Markdown to HTML
 // conversion with a meta map and a default title. Parsing and rendering are
-// handled by the excellent Blackfriday package; the Meta map is extracted
+// handled by an Engine: by default the excellent Blackfriday package, or the
+// CommonMark-compliant Goldmark.  The Meta map is extracted
 // from the first code block encountered, but only if it is not preceded by
 // anything other than an optional header. The order can be reversed globally
 // by setting META_AT_END to true, or at the Parser level.  In reversed order
@@ -13,12 +14,22 @@
 // heading is used, if and only if that heading was not preceded by any
 // other block besides the Meta Block.
 //
-// Supported languages for the meta block are JSON and YAML (the default);
-// additional languages as well as custom parsers are planned for the future.
+// Supported languages for the meta block are JSON, YAML (the default) and
+// TOML; additional languages as well as custom parsers are planned for the
+// future.
 //
 // If an appropriate meta block is found it will be excluded from the rendered
 // HTML content.
 //
+// Alternatively the meta may be given as front matter at the very top of the
+// source, between "---" lines for YAML as in Jekyll, or "+++" lines for TOML
+// as in Hugo.  This is off by default, being controlled by FRONT_MATTER, or
+// at the Parser level.  If front matter is found, no other meta block is
+// looked for.
+//
+// Errors in the meta are returned as MetaErrors, with the line number in the
+// Markdown source.
+//
 // NOTE: This package will most likely be renamed, and might also be moved out
 // of kisipar.  "Greysunday" was pretty tempting but then the sun came out...
 package frostedmd
@@ -26,6 +37,7 @@ package frostedmd
 import (
 	"encoding/json"
 	"errors"
+	"github.com/BurntSushi/toml"
 	"github.com/russross/blackfriday"
 	"gopkg.in/yaml.v2"
 )
@@ -58,14 +70,18 @@ const COMMON_HTML_FLAGS = 0 |
 // It may be also be used to
 type Parser struct {
 	MetaAtEnd          bool
-	MarkdownExtensions int // uses blackfriday EXTENSION_* constants
-	HtmlFlags          int // uses blackfridy HTML_* constants
+	FrontMatter        bool   // accept front matter at the top
+	NoMetaBlock        bool   // do not look for a meta code block
+	MarkdownExtensions int    // uses blackfriday EXTENSION_* constants
+	HtmlFlags          int    // uses blackfridy HTML_* constants
+	Engine             Engine // if nil, Blackfriday
 }
 
 // New returns a new Parser with the common flags and extensions enabled.
 func New() *Parser {
 	return &Parser{
 		MetaAtEnd:          META_AT_END,
+		FrontMatter:        FRONT_MATTER,
 		MarkdownExtensions: COMMON_EXTENSIONS,
 		HtmlFlags:          COMMON_HTML_FLAGS,
 	}
@@ -98,41 +114,63 @@ func (r *ParseResult) Content() []byte {
 // Thus the caller may choose to handle meta errors without interrupting flow.
 func (p *Parser) Parse(input []byte) (*ParseResult, error) {
 
-	// cf. renderer.go for the fmdRenderer definition
-	renderer := &fmdRenderer{
-		bfRenderer: blackfriday.HtmlRenderer(p.HtmlFlags,
-			"", // no title
-			"", // no css
-		),
-		metaAtEnd: p.MetaAtEnd,
+	engine := p.Engine
+	if engine == nil {
+		engine = Blackfriday
 	}
 
-	content := blackfriday.MarkdownOptions(input, renderer,
-		blackfriday.Options{Extensions: p.MarkdownExtensions})
+	// Front matter, if any, replaces the meta block.
+	var front []byte
+	var frontLang string
+	rp := p
+	if p.FrontMatter {
+		var rest []byte
+		front, frontLang, rest = frontMatter(input)
+		if frontLang != "" {
+			input = rest
+			np := *p
+			np.NoMetaBlock = true
+			rp = &np
+		}
+	}
 
-	// Partial results are useful sometimes.
-	res := &ParseResult{content: content}
+	rendering, err := engine.Render(rp, input)
+	if err != nil {
+		return nil, err
+	}
 
-	mm, err := p.parseMeta(renderer.metaBytes, renderer.metaLang)
+	// Partial results are useful sometimes.
+	res := &ParseResult{content: rendering.Content}
+
+	var mm map[string]interface{}
+	if frontLang != "" {
+		// The front matter starts after the delimiter on the first line.
+		mm, err = p.parseMeta(front, frontLang, 2)
+	} else {
+		mm, err = p.parseMeta(rendering.MetaBlock, rendering.MetaLang,
+			rendering.MetaLine)
+	}
 	if err != nil {
 		return res, err
 	}
 	if mm["Title"] == nil && mm["TITLE"] == nil && mm["title"] == nil &&
-		renderer.headerTitle != "" {
-		mm["Title"] = renderer.headerTitle
+		rendering.HeaderTitle != "" {
+		mm["Title"] = rendering.HeaderTitle
 	}
 	res.meta = mm
 	return res, nil
 }
 
-func (p *Parser) parseMeta(input []byte, lang string) (map[string]interface{}, error) {
+// parseMeta parses the meta block in lang, which starts at line start of the
+// source, or zero if unknown; errors are returned as MetaErrors.
+func (p *Parser) parseMeta(input []byte, lang string, start int) (map[string]interface{}, error) {
 
 	mm := map[string]interface{}{}
 	if len(input) == 0 {
 		return mm, nil
 	}
 
-	// Right now we only support JSON and YAML, so it's pretty easy to choose.
+	// TOML is never guessed, so it's still pretty easy to choose.
 	if lang == "" {
 		// We expect the JSON decoder to bail out fast on bad formats, so:
 		if err := json.Unmarshal(input, mm); err == nil {
@@ -146,12 +184,17 @@ func (p *Parser) parseMeta(input []byte, lang string) (map[string]interface{}, e
 	case "json":
 		err := json.Unmarshal(input, &mm)
 		if err != nil {
-			return mm, err
+			return mm, metaError(err, input, lang, start)
 		}
 	case "yaml":
 		err := yaml.Unmarshal(input, &mm)
 		if err != nil {
-			return mm, err
+			return mm, metaError(err, input, lang, start)
+		}
+	case "toml":
+		err := toml.Unmarshal(input, &mm)
+		if err != nil {
+			return mm, metaError(err, input, lang, start)
 		}
 	default:
 		return mm, errors.New("Unsupported language for meta block: " + lang)
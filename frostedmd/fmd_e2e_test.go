@@ -10,6 +10,7 @@ import (
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -43,5 +44,35 @@ func Test_FilesEndToEnd_Common(t *testing.T) {
 	}
 }
 
+func Test_FilesEndToEnd_CommonMark(t *testing.T) {
+
+	assert := assert.New(t)
+
+	input := readTestFile("common.md")
+	expContent := readTestFile("common.html")
+	expYaml := readTestFile("common.yaml")
+
+	parser := frostedmd.New()
+	parser.Engine = frostedmd.CommonMark
+	res, error := parser.Parse(input)
+	assert.Nil(error, "no error from CommonMark")
+
+	// CommonMark differs from Blackfriday in one place: a list item that
+	// starts with a dash holds a nested list.
+	blackfriday := "<li>- dash</li>"
+	commonMark := "<li>\n<ul>\n<li>dash</li>\n</ul>\n</li>"
+	exp := string(expContent)
+	assert.Contains(exp, blackfriday, "fixture has the dash item")
+	exp = strings.Replace(exp, blackfriday, commonMark, 1)
+	assert.Equal(exp, string(res.Content()), "content as expected")
+	if assert.NotNil(res.Meta(), "Meta not nil") {
+		yaml, err := yaml.Marshal(res.Meta())
+		if assert.Nil(err, "Meta convertible to YAML") {
+			assert.Equal(string(expYaml), string(yaml),
+				"converted YAML as expected")
+		}
+	}
+}
+
 // TODO: test with all options on
 // TODO: test Basic too
@@ -0,0 +1,155 @@
+// frostedmd/meta.go - meta block languages, front matter and meta errors.
+// -----------------
+
+package frostedmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/BurntSushi/toml"
+)
+
+// If true, accept front matter at the top of the Markdown source by default.
+// It is off as "---" also makes a horizontal rule.
+var FRONT_MATTER = false
+
+// FRONT_MATTER_DELIMITERS map the delimiter lines of front matter to the
+// meta languages: "---" for YAML as in Jekyll, and "+++" for TOML as in Hugo.
+var FRONT_MATTER_DELIMITERS = map[string]string{
+	"---": "yaml",
+	"+++": "toml",
+}
+
+// A MetaError is an error in the meta block, at the given Line of the
+// Markdown source, or of the meta block itself if its position in the
+// source is not known.
+type MetaError struct {
+	Lang    string // the meta language, e.g. "yaml"
+	Line    int    // the line number, starting at 1
+	InBlock bool   // true if the Line is that of the meta block
+	Message string
+}
+
+// Error implements the error interface for MetaError, in the style of the
+// YAML errors: "yaml: line 4: did not find expected key".
+func (e *MetaError) Error() string {
+	where := "line"
+	if e.InBlock {
+		where = "meta block line"
+	}
+	return fmt.Sprintf("%s: %s %d: %s", e.Lang, where, e.Line, e.Message)
+}
+
+// yamlErrorRx matches the YAML package's errors, which may or may not have
+// a line number.
+var yamlErrorRx = regexp.MustCompile(`(?s)^yaml: (?:unmarshal errors:\s*)?(?:line (\d+): )?(.*)$`)
+
+// tomlPrefixRx matches the prefix of the TOML package's errors.
+var tomlPrefixRx = regexp.MustCompile(`^toml: line \d+(?: \(last key "[^"]*"\))?: `)
+
+// metaError returns a MetaError for the error from parsing the meta block
+// in lang, which starts at line start of the source, or zero if unknown.
+func metaError(err error, input []byte, lang string, start int) error {
+
+	line := 0
+	msg := err.Error()
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		line = lineAt(input, int(e.Offset))
+	case *json.UnmarshalTypeError:
+		line = lineAt(input, int(e.Offset))
+	case toml.ParseError:
+		// The TOML line is that after a newline found unexpectedly, so we
+		// go by the offset of the offending byte instead.
+		line = lineAt(input, e.Position.Start+1)
+		msg = tomlPrefixRx.ReplaceAllString(msg, "")
+	default:
+		if m := yamlErrorRx.FindStringSubmatch(msg); m != nil {
+			line, _ = strconv.Atoi(m[1])
+			msg = m[2]
+		}
+	}
+	if line < 1 {
+		line = 1
+	}
+
+	if start < 1 {
+		return &MetaError{Lang: lang, Line: line, InBlock: true, Message: msg}
+	}
+	return &MetaError{Lang: lang, Line: start + line - 1, Message: msg}
+
+}
+
+// lineAt returns the line number of the byte offset in the input, starting
+// at 1.
+func lineAt(input []byte, offset int) int {
+	if offset > len(input) {
+		offset = len(input)
+	}
+	if offset > 0 && input[offset-1] == '\n' {
+		// Errors at the start of a line are reported just after the newline.
+		offset--
+	}
+	return bytes.Count(input[:offset], []byte("\n")) + 1
+}
+
+// frontMatter splits off the front matter from the top of the input, if
+// there is any: a delimiter line from FRONT_MATTER_DELIMITERS, the meta and
+// the same delimiter line again.  It returns the meta, its language and the
+// rest of the input, or an empty lang if there is no front matter.
+func frontMatter(input []byte) (meta []byte, lang string, rest []byte) {
+
+	first, body := splitLine(input)
+	delim := string(bytes.TrimRight(first, " \t\r"))
+	lang = FRONT_MATTER_DELIMITERS[delim]
+	if lang == "" {
+		return nil, "", input
+	}
+	for pos := body; len(pos) > 0; {
+		line, next := splitLine(pos)
+		if string(bytes.TrimRight(line, " \t\r")) == delim {
+			meta = body[:len(body)-len(pos)]
+			return meta, lang, next
+		}
+		pos = next
+	}
+	return nil, "", input
+
+}
+
+// splitLine returns the first line of the input, without its newline, and
+// the rest.
+func splitLine(input []byte) (line, rest []byte) {
+	if i := bytes.IndexByte(input, '\n'); i >= 0 {
+		return input[:i], input[i+1:]
+	}
+	return input, nil
+}
+
+// metaLine returns the line number in the input at which the meta block
+// starts, judging by its first line, searching from the end if atEnd; or
+// zero if it can not be found.  This is for engines not keeping track of
+// positions.
+func metaLine(input, meta []byte, atEnd bool) int {
+
+	first, _ := splitLine(meta)
+	first = bytes.TrimSpace(first)
+	if len(first) == 0 {
+		return 0
+	}
+	found := 0
+	for n, line := range bytes.Split(input, []byte("\n")) {
+		if bytes.Equal(bytes.TrimSpace(line), first) {
+			found = n + 1
+			if !atEnd {
+				break
+			}
+		}
+	}
+	return found
+
+}
@@ -0,0 +1,164 @@
+// frostedmd/meta_test.go - tests for meta languages and front matter.
+// ----------------------
+
+package frostedmd_test
+
+import (
+	"github.com/biztos/kisipar/frostedmd"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Both engines must handle meta the same way.
+func parsers() map[string]*frostedmd.Parser {
+	return map[string]*frostedmd.Parser{
+		"blackfriday": frostedmd.New(),
+		"commonmark":  commonMarkParser(),
+	}
+}
+
+// frontMatterParsers returns the parsers with front matter accepted.
+func frontMatterParsers() map[string]*frostedmd.Parser {
+	pp := parsers()
+	for _, p := range pp {
+		p.FrontMatter = true
+	}
+	return pp
+}
+
+func Test_Parse_SimpleTOML(t *testing.T) {
+
+	assert := assert.New(t)
+
+	input := "# Here\n\n```toml\nfoo = \"bar\"\n[Author]\nName = \"Jo\"\n```\n\nThere."
+
+	for name, parser := range parsers() {
+		res, err := parser.Parse([]byte(input))
+		assert.Nil(err, "no error for %s", name)
+		assert.Equal(map[string]interface{}{
+			"Title":  "Here",
+			"foo":    "bar",
+			"Author": map[string]interface{}{"Name": "Jo"},
+		}, res.Meta(), "meta map as expected for %s", name)
+		assert.NotContains(string(res.Content()), "foo", "meta removed")
+	}
+
+}
+
+func Test_Parse_FrontMatter(t *testing.T) {
+
+	assert := assert.New(t)
+
+	for _, input := range []string{
+		"---\nfoo: bar\nTags: [a, b]\n---\n# Here\n\n    code: block\n\nThere.",
+		"+++\nfoo = \"bar\"\nTags = [\"a\", \"b\"]\n+++ \r\n# Here\n\n" +
+			"    code: block\n\nThere.",
+	} {
+		for name, parser := range frontMatterParsers() {
+			res, err := parser.Parse([]byte(input))
+			assert.Nil(err, "no error for %s", name)
+			assert.Equal(map[string]interface{}{
+				"Title": "Here",
+				"foo":   "bar",
+				"Tags":  []interface{}{"a", "b"},
+			}, res.Meta(), "meta from front matter for %s", name)
+			content := string(res.Content())
+			assert.Contains(content, "<h1", "header kept for %s", name)
+			assert.Contains(content, "<pre><code>code: block",
+				"code block not taken as meta for %s", name)
+			assert.NotContains(content, "foo", "front matter removed")
+		}
+	}
+
+}
+
+func Test_Parse_FrontMatterNotFound(t *testing.T) {
+
+	assert := assert.New(t)
+
+	parser := frostedmd.New()
+	parser.FrontMatter = true
+	res, err := parser.Parse([]byte("---\nfoo: bar\n"))
+	assert.Nil(err, "no error")
+	assert.Equal(map[string]interface{}{}, res.Meta(),
+		"unterminated front matter ignored")
+	assert.Contains(string(res.Content()), "foo: bar", "content kept")
+
+	res, err = frostedmd.New().Parse([]byte("---\nfoo: bar\n---\n"))
+	assert.Nil(err, "no error")
+	assert.Equal(map[string]interface{}{}, res.Meta(),
+		"front matter not accepted by default")
+	assert.Contains(string(res.Content()), "<hr", "rule kept by default")
+
+	res, err = frostedmd.NewBasic().Parse([]byte("+++\nfoo = 1\n+++\n"))
+	assert.Nil(err, "no error")
+	assert.Equal(map[string]interface{}{}, res.Meta(),
+		"front matter not accepted by basic parser")
+
+}
+
+func Test_Parse_MetaErrorLines(t *testing.T) {
+
+	assert := assert.New(t)
+
+	cases := []struct {
+		input, exp string
+		line       int
+	}{
+		{"# Here\n\n```yaml\nfoo: bar\n  baz: [1\n```\n\nThere.",
+			"yaml: line 5: ", 5},
+		{"# Here\n\n    foo: [1,true,3\n\nThere.",
+			"yaml: line 3: did not find expected ',' or ']'", 3},
+		{"# Here\n\n```json\n{\n  \"a\": 1,\n  b: 2\n}\n```\n",
+			"json: line 6: invalid character 'b'", 6},
+		{"# Here\n\n```toml\na = 1\nb = \n```\n",
+			"toml: line 5: ", 5},
+		{"---\nfoo: bar\nbar: [x\n---\n# Here",
+			"yaml: line ", 3},
+		{"+++\nfoo = \"bar\"\nbar = \n+++\n# Here",
+			"toml: line 3: ", 3},
+	}
+	for _, tc := range cases {
+		for name, parser := range frontMatterParsers() {
+			_, err := parser.Parse([]byte(tc.input))
+			if assert.Error(err, "error for %s with %s", tc.input, name) {
+				assert.Contains(err.Error(), tc.exp, "error useful")
+				if me, ok := err.(*frostedmd.MetaError); assert.True(ok) {
+					assert.Equal(tc.line, me.Line, "line for %q with %s",
+						tc.input, name)
+				}
+			}
+		}
+	}
+
+	parser := frostedmd.New()
+	parser.MetaAtEnd = true
+	_, err := parser.Parse([]byte("# Here\n\nThere.\n\n    foo: [1\n"))
+	if assert.Error(err, "error at end") {
+		assert.Equal("yaml: line 5: did not find expected ',' or ']'",
+			err.Error(), "line found at end")
+	}
+
+}
+
+type noLineEngine struct{}
+
+func (e *noLineEngine) Render(p *frostedmd.Parser, input []byte) (*frostedmd.Rendering, error) {
+	return &frostedmd.Rendering{MetaBlock: []byte("a: 1\nb: [\n")}, nil
+}
+
+func Test_MetaError_InBlock(t *testing.T) {
+
+	assert := assert.New(t)
+
+	parser := frostedmd.New()
+	parser.Engine = &noLineEngine{}
+	_, err := parser.Parse([]byte("whatever"))
+	if assert.Error(err, "error returned") {
+		me := err.(*frostedmd.MetaError)
+		assert.True(me.InBlock, "line in block")
+		assert.Regexp("^yaml: meta block line [0-9]+: ", err.Error(),
+			"error says so")
+	}
+
+}
@@ -9,6 +9,7 @@ import (
 type fmdRenderer struct {
 	blocks      int
 	metaAtEnd   bool
+	noMeta      bool
 	metaBuffer  bytes.Buffer
 	haveMeta    bool
 	metaBytes   []byte
@@ -44,6 +45,13 @@ func (r *fmdRenderer) incrementBlocks(out *bytes.Buffer) {
 // block-level callbacks
 func (r *fmdRenderer) BlockCode(out *bytes.Buffer, text []byte, lang string) {
 
+	// Maybe we are not looking at all.
+	if r.noMeta {
+		r.incrementBlocks(out)
+		r.bfRenderer.BlockCode(out, text, lang)
+		return
+	}
+
 	// If we are looking for the meta block at the end, any block could be it.
 	if r.metaAtEnd {
 		r.haveMeta = true
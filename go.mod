@@ -3,11 +3,12 @@ module github.com/biztos/kisipar
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/docopt/docopt-go v0.0.0-20180111231733-ee0de3bc6815
 	github.com/leekchan/gtf v0.0.0-20190214083521-5fba33c5b00b
 	github.com/olebedev/config v0.0.0-20220822221314-86fa169f9f99
 	github.com/russross/blackfriday v1.6.0
 	github.com/stretchr/testify v1.8.1
-	golang.org/x/tools v0.5.0
+	github.com/yuin/goldmark v1.7.4
 	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,160 @@
+// hosts.go - name-based virtual hosting for Kisipar.
+// --------
+
+package kisipar
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/biztos/kisipar/site"
+)
+
+// A portGroup is the set of Sites served on a single Port.  The first Site in
+// the group owns the Server, and if there are others then requests are routed
+// among them according to the Host header.
+type portGroup struct {
+	port  int
+	sites []*site.Site
+	live  []*site.LiveSite
+}
+
+// groupSites groups the sites by Port, in order of first appearance.
+func groupSites(sites []*site.Site) []*portGroup {
+
+	groups := []*portGroup{}
+	byPort := map[int]*portGroup{}
+	for _, s := range sites {
+		g := byPort[s.Port]
+		if g == nil {
+			g = &portGroup{port: s.Port}
+			byPort[s.Port] = g
+			groups = append(groups, g)
+		}
+		g.sites = append(g.sites, s)
+	}
+	return groups
+}
+
+// check returns an error if the Sites in the group can not share their Port:
+// all host names must be unique, there may be only one default Site, the
+// TLS and unknown-host settings must agree, and the shared Server must
+// accept the routing Handler.
+func (g *portGroup) check() error {
+
+	if err := g.checkServer(); err != nil {
+		return err
+	}
+	return g.checkSites()
+}
+
+// checkSites returns an error if the Sites in the group conflict, as per
+// check, regardless of their Servers.
+func (g *portGroup) checkSites() error {
+
+	hostPaths := map[string]string{}
+	defPath := ""
+	first := g.sites[0]
+	for _, s := range g.sites {
+		for _, host := range append([]string{s.Host}, s.Aliases...) {
+			host = strings.ToLower(host)
+			if hp := hostPaths[host]; hp != "" {
+				return fmt.Errorf("Duplicate Host %s on port %d: %s vs. %s",
+					host, g.port, hp, s.Path)
+			}
+			hostPaths[host] = s.Path
+		}
+		if s.DefaultSite {
+			if defPath != "" {
+				return fmt.Errorf("Multiple default sites on port %d: %s vs. %s",
+					g.port, defPath, s.Path)
+			}
+			defPath = s.Path
+		}
+		if s.ServeTLS != first.ServeTLS || s.CertFile != first.CertFile ||
+			s.KeyFile != first.KeyFile {
+			return fmt.Errorf("Conflicting TLS config on port %d: %s vs. %s",
+				g.port, first.Path, s.Path)
+		}
+	}
+
+	statusPath := ""
+	status := 0
+	for _, s := range g.sites {
+		if s.UnknownHostStatus == 0 {
+			continue
+		}
+		if status != 0 && s.UnknownHostStatus != status {
+			return fmt.Errorf(
+				"Conflicting UnknownHostStatus on port %d: %s vs. %s",
+				g.port, statusPath, s.Path)
+		}
+		status = s.UnknownHostStatus
+		statusPath = s.Path
+	}
+
+	return nil
+}
+
+// checkServer returns an error if the group is shared and the Server of its
+// first Site is not an http.Server, as only those can be given the Handler
+// routing requests by Host.
+func (g *portGroup) checkServer() error {
+
+	if len(g.sites) < 2 {
+		return nil
+	}
+	if _, ok := g.sites[0].Server.(*http.Server); !ok {
+		return fmt.Errorf("Shared port %d requires an http.Server: %s",
+			g.port, g.sites[0].Path)
+	}
+	return nil
+}
+
+// checkReload returns an error if the fresh version of the Site served by l
+// would conflict with the current versions of the other Sites in the group,
+// as per checkSites.
+func (g *portGroup) checkReload(l *site.LiveSite, fresh *site.Site) error {
+
+	sites := make([]*site.Site, len(g.live))
+	for i, gl := range g.live {
+		if gl == l {
+			sites[i] = fresh
+		} else {
+			sites[i] = gl.Site()
+		}
+	}
+	return (&portGroup{port: g.port, sites: sites}).checkSites()
+}
+
+// ServeHTTP serves the request with the current version of the Site matching
+// the request's Host, or else the default Site.  If there is no default,
+// the UnknownHostStatus is returned.
+func (g *portGroup) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	var def *site.LiveSite
+	status := 0
+	for _, l := range g.live {
+		s := l.Site()
+		if s.HasHost(r.Host) {
+			l.ServeHTTP(w, r)
+			return
+		}
+		if s.DefaultSite && def == nil {
+			def = l
+		}
+		if status == 0 {
+			status = s.UnknownHostStatus
+		}
+	}
+	if def != nil {
+		def.ServeHTTP(w, r)
+		return
+	}
+	if status == 0 {
+		status = site.DEFAULT_UNKNOWN_HOST_STATUS
+	}
+	http.Error(w, http.StatusText(status), status)
+
+}
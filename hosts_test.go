@@ -0,0 +1,249 @@
+package kisipar_test
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/biztos/kisipar"
+	"github.com/stretchr/testify/assert"
+)
+
+// hostSite creates a temp site with the given config and an index page
+// titled with its name.
+func hostSite(name, config string) string {
+
+	path := tmpSite("Name: " + name + "\n" + config)
+	ipath := filepath.Join(path, "pages", "index.md")
+	idata := []byte("# Index of " + name)
+	if err := ioutil.WriteFile(ipath, idata, os.ModePerm); err != nil {
+		panic(err)
+	}
+	return path
+}
+
+func hostGet(s http.Handler, host string) *httptest.ResponseRecorder {
+
+	req := httptest.NewRequest("GET", "http://"+host+"/", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func Test_Load_SharedPort(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path1 := hostSite("A", "Port: 1000\nHost: a.com")
+	defer os.RemoveAll(path1)
+	path2 := hostSite("B", "Port: 1000\nHost: b.com\nAliases: [www.b.com]")
+	defer os.RemoveAll(path2)
+	path3 := hostSite("C", "Port: 2000")
+	defer os.RemoveAll(path3)
+
+	k, err := kisipar.Load(path1, path2, path3)
+	if assert.Nil(err, "no error returned") {
+		assert.Equal(3, len(k.Sites), "three sites in Sites")
+	}
+}
+
+func Test_Load_SharedPortErrors(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path1 := hostSite("A", "Port: 1000\nHost: a.com\nDefaultSite: true")
+	defer os.RemoveAll(path1)
+
+	cases := []struct {
+		config string
+		exp    string
+	}{
+		{"Port: 1000\nHost: b.com\nAliases: [A.com]",
+			"Duplicate Host a.com on port 1000: "},
+		{"Port: 1000\nHost: b.com\nDefaultSite: true",
+			"Multiple default sites on port 1000: "},
+		{"Port: 1000\nHost: b.com\nCertFile: x\nKeyFile: y",
+			"Conflicting TLS config on port 1000: "},
+	}
+	for _, c := range cases {
+		path2 := hostSite("B", c.config)
+		defer os.RemoveAll(path2)
+		_, err := kisipar.Load(path1, path2)
+		if assert.Error(err, "error returned") {
+			assert.Equal(c.exp+path1+" vs. "+path2, err.Error(),
+				"error as expected")
+		}
+	}
+
+	path2 := hostSite("B", "Port: 1000\nHost: b.com\nUnknownHostStatus: 404")
+	defer os.RemoveAll(path2)
+	path3 := hostSite("C", "Port: 1000\nHost: c.com\nUnknownHostStatus: 421")
+	defer os.RemoveAll(path3)
+	_, err := kisipar.Load(path1, path2, path3)
+	if assert.Error(err, "error returned") {
+		assert.Equal("Conflicting UnknownHostStatus on port 1000: "+
+			path2+" vs. "+path3, err.Error(), "error as expected")
+	}
+}
+
+func Test_SharedPort_Routing(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path1 := hostSite("A", "Port: 1000\nHost: a.com")
+	defer os.RemoveAll(path1)
+	path2 := hostSite("B", "Port: 1000\nHost: b.com\nAliases: [www.b.com]")
+	defer os.RemoveAll(path2)
+	path3 := hostSite("C", "Port: 2000\nHost: c.com")
+	defer os.RemoveAll(path3)
+
+	k, err := kisipar.Load(path1, path2, path3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.CurrentSites() // wires up the routing
+	a, c := k.Sites[0], k.Sites[2]
+
+	assert.Regexp("Index of A", hostGet(a, "a.com").Body.String(),
+		"first site routed")
+	assert.Regexp("Index of B", hostGet(a, "b.com").Body.String(),
+		"second site routed")
+	assert.Regexp("Index of B", hostGet(a, "WWW.B.COM:1000").Body.String(),
+		"second site routed by alias")
+	assert.Equal(421, hostGet(a, "nonesuch.com").Code,
+		"unknown host misdirected")
+
+	// A site alone on its port serves everything.
+	assert.Regexp("Index of C", hostGet(c, "nonesuch.com").Body.String(),
+		"single site not routed")
+
+}
+
+func Test_SharedPort_DefaultSite(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path1 := hostSite("A", "Port: 1000\nHost: a.com\nUnknownHostStatus: 404")
+	defer os.RemoveAll(path1)
+	path2 := hostSite("B", "Port: 1000\nHost: b.com")
+	defer os.RemoveAll(path2)
+
+	k, err := kisipar.Load(path1, path2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.CurrentSites()
+	a := k.Sites[0]
+	assert.Equal(404, hostGet(a, "nonesuch.com").Code, "unknown host not found")
+
+	// The default is picked up on reload.
+	cpath := filepath.Join(path2, "config.yaml")
+	cdata := []byte("Name: B\nPort: 1000\nHost: b.com\nDefaultSite: true")
+	if err := ioutil.WriteFile(cpath, cdata, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	assert.Nil(k.Reload(), "no error")
+	assert.Regexp("Index of B", hostGet(a, "nonesuch.com").Body.String(),
+		"unknown host served by default site")
+
+}
+
+func Test_SharedPort_ReloadConflict(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path1 := hostSite("A", "Port: 1000\nHost: a.com\nDefaultSite: true")
+	defer os.RemoveAll(path1)
+	path2 := hostSite("B", "Port: 1000\nHost: b.com")
+	defer os.RemoveAll(path2)
+
+	k, err := kisipar.Load(path1, path2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.CurrentSites()
+	a, b := k.Sites[0], k.Sites[1]
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	cpath := filepath.Join(path2, "config.yaml")
+	for config, exp := range map[string]string{
+		"Name: B\nPort: 1000\nHost: a.com": "Duplicate Host a.com on port 1000",
+		"Name: B\nPort: 1000\nHost: b.com\nDefaultSite: true": "Multiple default sites on port 1000",
+	} {
+		if err := ioutil.WriteFile(cpath, []byte(config), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		err := k.Reload()
+		if assert.Error(err, "error for %q", config) {
+			assert.Contains(err.Error(), exp, "error useful")
+		}
+		assert.True(k.CurrentSites()[1] == b, "old site kept")
+		assert.Regexp("Index of B", hostGet(a, "b.com").Body.String(),
+			"old site served")
+	}
+
+}
+
+func Test_SharedPort_Serve(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path1 := hostSite("A", "Port: 8088\nHost: a.com")
+	defer os.RemoveAll(path1)
+	path2 := hostSite("B", "Port: 8088\nHost: b.com")
+	defer os.RemoveAll(path2)
+
+	k, err := kisipar.Load(path1, path2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The shared Server must be a real one, so it listens on any free port.
+	k.Sites[0].Server = &http.Server{
+		Addr:    "127.0.0.1:0",
+		Handler: k.Sites[0].NewServeMux(),
+	}
+	unused := NewBlockingServer()
+	k.Sites[1].Server = unused
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	done := make(chan error)
+	go func() { done <- k.Serve() }()
+	k.Stop()
+	assert.Nil(<-done, "no error from Serve")
+	assert.False(unused.ShutDown, "unused server not touched")
+
+}
+
+func Test_SharedPort_Serve_NotHTTPServer(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path1 := hostSite("A", "Port: 8088\nHost: a.com")
+	defer os.RemoveAll(path1)
+	path2 := hostSite("B", "Port: 8088\nHost: b.com")
+	defer os.RemoveAll(path2)
+
+	k, err := kisipar.Load(path1, path2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Sites[0].Server = NewBlockingServer()
+	k.Sites[1].Server = NewBlockingServer()
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	err = k.Serve()
+	if assert.Error(err, "error returned") {
+		assert.Regexp("^Shared port 8088 requires an http.Server: ",
+			err.Error(), "error is useful")
+	}
+
+}
@@ -42,9 +42,17 @@
 package kisipar
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/biztos/kisipar/site"
 )
@@ -55,47 +63,342 @@ var LAUNCH_SERVERS = true
 
 // Kisipar represents a set of one or more Sites to serve.
 type Kisipar struct {
+
+	// The Sites as originally loaded.  These keep their Servers while
+	// serving, but after a Reload the requests are handled by their
+	// replacements; cf. CurrentSites.
 	Sites []*site.Site
+
+	// ShutdownTimeout is the maximum time to wait for open connections to
+	// drain when shutting down.  Load sets it to the longest ShutdownTimeout
+	// of its Sites; if zero, site.DEFAULT_SHUTDOWN_TIMEOUT is used.
+	ShutdownTimeout time.Duration
+
+	// DevMode puts all Sites, including reloaded ones, into DevMode with
+	// file watching, regardless of their config.  It must be set before
+	// serving.  Cf. site.Site.DevMode.
+	DevMode bool
+
+	live       []*site.LiveSite
+	groups     []*portGroup
+	setupMutex sync.Mutex
+	stop       chan bool
+	initOnce   sync.Once
+	stopOnce   sync.Once
+
+	// Set once Shutdown is called, so Serve does not take the closing of
+	// the Servers for a failure.
+	shuttingDown int32
 }
 
 // Load initializes a Kisipar struct with sites loaded from the  directories
 // located at the given paths.  Each site must have its own config file.
+//
+// Sites may share a Port, in which case requests are routed to them by their
+// Host and Aliases; cf. site.Site.HasHost.  Such Sites must have distinct host
+// names, agree on their TLS config, and have at most one DefaultSite.
 func Load(paths ...string) (*Kisipar, error) {
 	if len(paths) == 0 {
 		return nil, errors.New("kisipar.Load requires at least one site path.")
 	}
-	portPaths := map[int]string{}
 	sites := make([]*site.Site, len(paths))
+	timeout := time.Duration(0)
 	for i, path := range paths {
 		site, err := site.Load(path)
 		if err != nil {
 			return nil, fmt.Errorf("Site error at %s: %s", path, err)
 		}
-		if pp := portPaths[site.Port]; pp != "" {
-			return nil, fmt.Errorf("Duplicate Port %d: %s vs. %s",
-				site.Port, pp, path)
-		}
-		portPaths[site.Port] = path
 		sites[i] = site
+		if site.ShutdownTimeout > timeout {
+			timeout = site.ShutdownTimeout
+		}
 	}
-	return &Kisipar{Sites: sites}, nil
+	for _, g := range groupSites(sites) {
+		if err := g.check(); err != nil {
+			return nil, err
+		}
+	}
+	return &Kisipar{Sites: sites, ShutdownTimeout: timeout}, nil
 }
 
-// Serve launches listen-and-serve routines for all Sites, with or without
-// TLS as per the configuration.  The last site in the list will block until
-// it is finished.
-func (k *Kisipar) Serve() {
+// Serve launches listen-and-serve routines for all Sites concurrently, with
+// or without TLS as per the configuration, and blocks until they are done.
+// Sites sharing a Port are served by the Server of the first of them, which
+// must be an http.Server.
+//
+// If any Server stops serving on its own, the others are shut down and its
+// error is returned.  On SIGINT or SIGTERM, or a call to Stop, all Sites are
+// shut down gracefully, waiting up to the ShutdownTimeout for open
+// connections to drain; any shutdown error is returned, otherwise nil.  If
+// Shutdown is called directly, Serve returns nil once the Servers are closed.
+//
+// On SIGHUP all Sites are reloaded in the background, as per Reload.
+func (k *Kisipar) Serve() error {
 
-	final := len(k.Sites) - 1
-	for i, s := range k.Sites {
+	for _, s := range k.Sites {
 		log.Printf("%s: listening on port %d.", s.Name, s.Port)
-		if LAUNCH_SERVERS {
-			if i == final {
-				log.Printf("%s (port %d): %s\n", s.Name, s.Port, s.Serve())
-			} else {
-				go log.Printf("%s (port %d): %s\n", s.Name, s.Port, s.Serve())
+	}
+	if !LAUNCH_SERVERS || len(k.Sites) == 0 {
+		return nil
+	}
+
+	// The Servers must be wired for reloading and routing before they start.
+	groups := k.portGroups()
+	for _, g := range groups {
+		if err := g.checkServer(); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		for _, s := range k.CurrentSites() {
+			s.StopWatching()
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+
+	errs := make(chan error, len(groups))
+	for _, g := range groups {
+		// Only the first Site in each group is served directly, so the
+		// others must start watching on their own.
+		for _, s := range g.sites[1:] {
+			if s.Watch {
+				s.StartWatching()
+			}
+		}
+		go func(s *site.Site) {
+			err := s.Serve()
+			if err == http.ErrServerClosed {
+				err = nil
+			} else if err != nil {
+				err = fmt.Errorf("%s (port %d): %s", s.Name, s.Port, err)
+			}
+			errs <- err
+		}(g.sites[0])
+	}
+	running := len(groups)
+
+	var err error
+	for done := false; !done; {
+		select {
+		case err = <-errs:
+			running--
+			if err == nil && atomic.LoadInt32(&k.shuttingDown) == 1 {
+				// Shutdown was called directly and stops the rest.
+				log.Println("Shut down.")
+				done = true
+				continue
+			}
+			if err == nil {
+				err = errors.New("Server stopped unexpectedly.")
+			}
+			log.Println(err)
+			k.shutdown()
+			done = true
+		case sig := <-sigs:
+			if sig == syscall.SIGHUP {
+				log.Printf("Received %s, reloading.", sig)
+				go k.Reload()
+				continue
+			}
+			log.Printf("Received %s, shutting down.", sig)
+			err = k.shutdown()
+			done = true
+		case <-k.stopChan():
+			log.Println("Stopped, shutting down.")
+			err = k.shutdown()
+			done = true
+		}
+	}
+
+	// Give any stragglers a moment to finish up after the shutdown, but do
+	// not wait on misbehaving servers forever.
+	timeout := time.After(k.shutdownTimeout() + time.Second)
+	for ; running > 0; running-- {
+		select {
+		case <-errs:
+		case <-timeout:
+			log.Printf("Gave up waiting for %d server(s) to stop.", running)
+			return err
+		}
+	}
+	return err
+
+}
+
+// Reload reloads all Sites from disk, as per site.LiveSite.Reload, and
+// returns the first error encountered.  Each Site is swapped in atomically
+// once it has loaded completely; a Site that fails to load keeps serving its
+// current version, and the error is logged.
+//
+// Reload is triggered by SIGHUP while serving, and may also be called
+// directly, or through the ReloadHandler.
+func (k *Kisipar) Reload() error {
+
+	// NOTE: Sites are loaded one at a time, in order, so the first error is
+	// that of the first Site to fail.
+	var first error
+	for _, l := range k.liveSites() {
+		if err := l.Reload(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// ReloadHandler returns an administrative handler triggering a Reload on
+// POST requests, answered with 204 (No Content), or 500 if any Site failed
+// to reload; the errors are logged, not sent.  Other methods are not
+// allowed.  The handler is not served by any Site: it should only be served
+// where it is protected, e.g. on a private port.
+func (k *Kisipar) ReloadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			code := http.StatusMethodNotAllowed
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		log.Printf("Reload requested by %s.", r.RemoteAddr)
+		if err := k.Reload(); err != nil {
+			code := http.StatusInternalServerError
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// CurrentSites returns the current versions of the Sites, i.e. the ones
+// handling requests, in the same order as the Sites property.
+func (k *Kisipar) CurrentSites() []*site.Site {
+
+	live := k.liveSites()
+	sites := make([]*site.Site, len(live))
+	for i, l := range live {
+		sites[i] = l.Site()
+	}
+	return sites
+}
+
+// The live sites and port groups are set up on demand, so that Servers may
+// be replaced after loading (e.g. for testing).
+func (k *Kisipar) setup() {
+
+	k.setupMutex.Lock()
+	defer k.setupMutex.Unlock()
+
+	if k.live != nil {
+		return
+	}
+	k.live = make([]*site.LiveSite, len(k.Sites))
+	liveMap := map[*site.Site]*site.LiveSite{}
+	for i, s := range k.Sites {
+		k.live[i] = site.NewLiveSite(s)
+		liveMap[s] = k.live[i]
+		if k.DevMode {
+			devSetup(s)
+		}
+	}
+	k.groups = groupSites(k.Sites)
+	for _, g := range k.groups {
+		for _, s := range g.sites {
+			g.live = append(g.live, liveMap[s])
+		}
+		if len(g.sites) > 1 {
+			if svr, ok := g.sites[0].Server.(*http.Server); ok {
+				svr.Handler = g
 			}
 		}
+		for _, l := range g.live {
+			l.Setup = k.reloadSetup(g, l)
+		}
 	}
+}
+
+// reloadSetup returns the Setup for reloads of the LiveSite in the group:
+// DevMode is applied if set, and a Site sharing its Port must not conflict
+// with the others, e.g. by a duplicate Host, lest it be served by mistake.
+func (k *Kisipar) reloadSetup(g *portGroup, l *site.LiveSite) func(*site.Site) error {
+	return func(fresh *site.Site) error {
+		if k.DevMode {
+			devSetup(fresh)
+		}
+		if len(g.live) > 1 {
+			return g.checkReload(l, fresh)
+		}
+		return nil
+	}
+}
 
+func devSetup(s *site.Site) error {
+	s.DevMode = true
+	s.Watch = true
+	return nil
+}
+
+func (k *Kisipar) liveSites() []*site.LiveSite {
+	k.setup()
+	return k.live
+}
+
+func (k *Kisipar) portGroups() []*portGroup {
+	k.setup()
+	return k.groups
+}
+
+// Stop initiates a graceful shutdown of a running Serve call, exactly as if
+// it had received SIGTERM.  Stop may be called more than once.
+func (k *Kisipar) Stop() {
+	stop := k.stopChan()
+	k.stopOnce.Do(func() { close(stop) })
+}
+
+// The stop channel needs lazy initialization so the zero Kisipar works.
+func (k *Kisipar) stopChan() chan bool {
+	k.initOnce.Do(func() { k.stop = make(chan bool) })
+	return k.stop
+}
+
+func (k *Kisipar) shutdownTimeout() time.Duration {
+	if k.ShutdownTimeout > 0 {
+		return k.ShutdownTimeout
+	}
+	return site.DEFAULT_SHUTDOWN_TIMEOUT
+}
+
+func (k *Kisipar) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), k.shutdownTimeout())
+	defer cancel()
+	return k.Shutdown(ctx)
+}
+
+// Shutdown gracefully shuts down all Servers concurrently, as per
+// http.Server.Shutdown, returning the first error encountered.  The context
+// controls how long to wait for open connections to drain.  A running Serve
+// call returns nil once the Servers are closed.
+func (k *Kisipar) Shutdown(ctx context.Context) error {
+
+	atomic.StoreInt32(&k.shuttingDown, 1)
+	groups := k.portGroups()
+	errs := make(chan error, len(groups))
+	for _, g := range groups {
+		go func(s *site.Site) {
+			err := s.Shutdown(ctx)
+			if err != nil {
+				err = fmt.Errorf("%s (port %d): %s", s.Name, s.Port, err)
+			}
+			errs <- err
+		}(g.sites[0])
+	}
+
+	var first error
+	for range groups {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
 }
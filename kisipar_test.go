@@ -2,12 +2,17 @@ package kisipar_test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/biztos/kisipar"
 	"github.com/stretchr/testify/assert"
@@ -58,6 +63,50 @@ func (s *FakeServer) ListenAndServe() error {
 func (s *FakeServer) ListenAndServeTLS(c, k string) error {
 	return fmt.Errorf("SECURE: %s & %s", c, k)
 }
+func (s *FakeServer) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// A DrainingServer serves until it is shut down, recording the context it
+// was given to drain its connections.
+type DrainingServer struct {
+	*BlockingServer
+	Err error
+}
+
+func (s *DrainingServer) Shutdown(ctx context.Context) error {
+	s.Err = ctx.Err()
+	return s.BlockingServer.Shutdown(ctx)
+}
+
+// A BlockingServer serves until it is shut down, like a real one.
+type BlockingServer struct {
+	Started  chan bool
+	closed   chan bool
+	ShutDown bool
+	Fail     error
+}
+
+func NewBlockingServer() *BlockingServer {
+	return &BlockingServer{
+		Started: make(chan bool, 1),
+		closed:  make(chan bool),
+	}
+}
+
+func (s *BlockingServer) ListenAndServe() error {
+	s.Started <- true
+	<-s.closed
+	return http.ErrServerClosed
+}
+func (s *BlockingServer) ListenAndServeTLS(c, k string) error {
+	return s.ListenAndServe()
+}
+func (s *BlockingServer) Shutdown(ctx context.Context) error {
+	s.ShutDown = true
+	close(s.closed)
+	return s.Fail
+}
 
 func Test_Load_RequiresPaths(t *testing.T) {
 	assert := assert.New(t)
@@ -114,7 +163,43 @@ func Test_Load_MultiSite(t *testing.T) {
 	}
 }
 
-func Test_Load_ErrorDuplicatePort(t *testing.T) {
+func Test_Load_MultiSite_PageExtensions(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path1 := tmpSite("Name: tmpSite1\nPort: 1000\nPageExtensions: [.md]")
+	defer os.RemoveAll(path1)
+	path2 := tmpSite("Name: tmpSite2\nPort: 2000\nPageExtensions: [.txt]")
+	defer os.RemoveAll(path2)
+	write := func(path, content string) {
+		if err := ioutil.WriteFile(path, []byte(content), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(path2, "pages", "two.txt"), "# Two")
+
+	k, err := kisipar.Load(path1, path2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, s2 := k.Sites[0], k.Sites[1]
+	if p := s2.Pageset.Page(filepath.Join(path2, "pages", "two")); assert.NotNil(p) {
+		assert.Equal("Two", p.Title(), "second site page parsed")
+	}
+
+	// The first site still finds its own pages after the second is loaded.
+	write(filepath.Join(path1, "pages", "one.md"), "# One")
+	key := filepath.Join(path1, "pages", "one")
+	if assert.Nil(s1.Pageset.RefreshPage(key), "new page found") {
+		assert.Equal("One", s1.Pageset.Page(key).Title(), "page parsed")
+	}
+	write(filepath.Join(path2, "pages", "more.md"), "# More")
+	assert.Error(s2.Pageset.RefreshPage(filepath.Join(path2, "pages", "more")),
+		"other site's extensions not loaded")
+
+}
+
+func Test_Load_ErrorDuplicateHost(t *testing.T) {
 
 	assert := assert.New(t)
 
@@ -127,14 +212,68 @@ func Test_Load_ErrorDuplicatePort(t *testing.T) {
 
 	_, err := kisipar.Load(path1, path2, path3)
 	if assert.Error(err, "error returned") {
-		assert.Equal("Duplicate Port 1000: "+path1+" vs. "+path3,
+		assert.Equal("Duplicate Host localhost on port 1000: "+
+			path1+" vs. "+path3,
 			err.Error(), "error as expected")
 	}
 }
 
-// Yeah, something is nondeterministic here, should see if maybe that
-// last buffer is not being flushed, or a goroutine is dropped maybe?
-func xxx_Test_Serve_MultiSite(t *testing.T) {
+func Test_Load_ShutdownTimeout(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path1 := tmpSite("Name: tmpSite1\nPort: 1000\nShutdownTimeout: 3")
+	defer os.RemoveAll(path1)
+	path2 := tmpSite("Name: tmpSite2\nPort: 2000\nShutdownTimeout: 7")
+	defer os.RemoveAll(path2)
+
+	k, err := kisipar.Load(path1, path2)
+	if assert.Nil(err, "no error returned") {
+		assert.Equal(7*time.Second, k.ShutdownTimeout,
+			"longest ShutdownTimeout used")
+	}
+}
+
+// serveMultiSite loads two sites with BlockingServers and serves them in the
+// background, returning once both are started.  The second server's
+// Shutdown fails with fail.
+func serveMultiSite(t *testing.T, fail error) (*kisipar.Kisipar, []*BlockingServer, chan error, func()) {
+
+	path1 := tmpSite("Name: tmpSite1\nPort: 8088")
+	path2 := tmpSite("Name: tmpSite2\nPort: 8099")
+	cleanup := func() {
+		os.RemoveAll(path1)
+		os.RemoveAll(path2)
+		log.SetOutput(os.Stderr)
+	}
+
+	k, err := kisipar.Load(path1, path2)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	servers := []*BlockingServer{NewBlockingServer(), NewBlockingServer()}
+	servers[1].Fail = fail
+	k.Sites[0].Server = servers[0]
+	k.Sites[1].Server = servers[1]
+	k.ShutdownTimeout = time.Second
+
+	log.SetOutput(ioutil.Discard)
+	done := make(chan error)
+	go func() { done <- k.Serve() }()
+	for _, s := range servers {
+		select {
+		case <-s.Started:
+		case <-time.After(5 * time.Second):
+			cleanup()
+			t.Fatal("server not started")
+		}
+	}
+
+	return k, servers, done, cleanup
+}
+
+func Test_Serve_NoLaunch(t *testing.T) {
 
 	assert := assert.New(t)
 
@@ -147,22 +286,305 @@ func xxx_Test_Serve_MultiSite(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	// Now fake out the Server so we don't actually launch one.
-	// (The things we do for unit testing...)
 	k.Sites[0].Server = &FakeServer{Name: "FIRST"}
 	k.Sites[1].Server = &FakeServer{Name: "LAST"}
 
-	// ...now serve, catching output.
+	kisipar.LAUNCH_SERVERS = false
+	defer func() { kisipar.LAUNCH_SERVERS = true }()
+
 	buf := new(bytes.Buffer)
 	log.SetOutput(buf)
 	log.SetFlags(0)
-	k.Serve()
+	defer log.SetOutput(os.Stderr)
+	assert.Nil(k.Serve(), "no error")
 	exp := `tmpSite1: listening on port 8088.
 tmpSite2: listening on port 8099.
-tmpSite2 (port 8099): INSECURE LAST
 `
 
 	assert.Equal(exp, buf.String(), "servers logged as expected")
 
 }
+
+func Test_Serve_MultiSiteFailure(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path1 := tmpSite("Name: tmpSite1\nPort: 8088")
+	defer os.RemoveAll(path1)
+	path2 := tmpSite("Name: tmpSite2\nPort: 8099")
+	defer os.RemoveAll(path2)
+
+	k, err := kisipar.Load(path1, path2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first one blocks, the last one fails at once.
+	blocker := NewBlockingServer()
+	k.Sites[0].Server = blocker
+	k.Sites[1].Server = &FakeServer{Name: "LAST"}
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	err = k.Serve()
+	if assert.Error(err, "error returned") {
+		assert.Equal("tmpSite2 (port 8099): INSECURE LAST", err.Error(),
+			"first error returned")
+	}
+	assert.True(blocker.ShutDown, "other server shut down")
+
+}
+
+func Test_Serve_Stop(t *testing.T) {
+
+	assert := assert.New(t)
+
+	k, servers, done, cleanup := serveMultiSite(t, nil)
+	defer cleanup()
+
+	k.Stop()
+	k.Stop() // harmless
+	select {
+	case err := <-done:
+		assert.Nil(err, "no error after graceful shutdown")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+	for i, s := range servers {
+		assert.True(s.ShutDown, "server %d shut down", i)
+	}
+
+}
+
+func Test_Serve_Shutdown(t *testing.T) {
+
+	assert := assert.New(t)
+
+	k, servers, done, cleanup := serveMultiSite(t, nil)
+	defer cleanup()
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	log.SetFlags(0)
+
+	assert.Nil(k.Shutdown(context.Background()), "no shutdown error")
+	select {
+	case err := <-done:
+		assert.Nil(err, "no error after outside shutdown")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+	for i, s := range servers {
+		assert.True(s.ShutDown, "server %d shut down", i)
+	}
+	assert.Equal("Shut down.\n", buf.String(), "shutdown logged")
+
+}
+
+func Test_Serve_Stop_ZeroShutdownTimeout(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path := tmpSite("")
+	defer os.RemoveAll(path)
+	loaded, err := kisipar.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &DrainingServer{BlockingServer: NewBlockingServer()}
+	loaded.Sites[0].Server = server
+
+	// A literal Kisipar has no ShutdownTimeout, but should drain all the
+	// same.
+	k := &kisipar.Kisipar{Sites: loaded.Sites}
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	done := make(chan error)
+	go func() { done <- k.Serve() }()
+	<-server.Started
+
+	k.Stop()
+	select {
+	case err := <-done:
+		assert.Nil(err, "no error after graceful shutdown")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+	assert.True(server.ShutDown, "server shut down")
+	assert.Nil(server.Err, "shutdown context not expired")
+
+}
+
+func Test_Serve_Signal(t *testing.T) {
+
+	assert := assert.New(t)
+
+	_, servers, done, cleanup := serveMultiSite(t, fmt.Errorf("DRAIN FAILED"))
+	defer cleanup()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if assert.Error(err, "shutdown error returned") {
+			assert.Equal("tmpSite2 (port 8099): DRAIN FAILED", err.Error(),
+				"error as expected")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+	for i, s := range servers {
+		assert.True(s.ShutDown, "server %d shut down", i)
+	}
+
+}
+
+func Test_Serve_Reload(t *testing.T) {
+
+	assert := assert.New(t)
+
+	k, servers, done, cleanup := serveMultiSite(t, nil)
+	defer cleanup()
+
+	cpath := filepath.Join(k.Sites[0].Path, "config.yaml")
+	cdata := []byte("Name: Reloaded\nPort: 8088")
+	if err := ioutil.WriteFile(cpath, cdata, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for k.CurrentSites()[0].Name != "Reloaded" {
+		if time.Now().After(deadline) {
+			t.Fatal("site not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal("tmpSite2", k.CurrentSites()[1].Name, "other site reloaded")
+	assert.True(k.CurrentSites()[0].Server == servers[0], "Server kept")
+
+	k.Stop()
+	select {
+	case err := <-done:
+		assert.Nil(err, "no error after graceful shutdown")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+
+}
+
+func Test_Reload(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path1 := tmpSite("Name: tmpSite1\nPort: 1000")
+	defer os.RemoveAll(path1)
+	path2 := tmpSite("Name: tmpSite2\nPort: 2000")
+	defer os.RemoveAll(path2)
+
+	k, err := kisipar.Load(path1, path2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(k.Sites, k.CurrentSites(), "current Sites before reload")
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	cdata := []byte("Name: [ Broken")
+	cpath := filepath.Join(path2, "config.yaml")
+	if err := ioutil.WriteFile(cpath, cdata, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	err = k.Reload()
+	if assert.Error(err, "error returned") {
+		assert.Regexp("^Reload error at "+path2, err.Error(),
+			"error as expected")
+	}
+	current := k.CurrentSites()
+	assert.False(k.Sites[0] == current[0], "good site reloaded")
+	assert.True(k.Sites[1] == current[1], "bad site kept")
+
+}
+
+func Test_ReloadHandler(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path := tmpSite("Name: tmpSite")
+	defer os.RemoveAll(path)
+	k, err := kisipar.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	h := k.ReloadHandler()
+	do := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://example.com/reload", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("GET")
+	assert.Equal(405, w.Code, "GET not allowed")
+	assert.Equal("POST", w.Header().Get("Allow"), "Allow header set")
+	assert.True(k.Sites[0] == k.CurrentSites()[0], "not reloaded")
+
+	assert.Equal(204, do("POST").Code, "POST reloads")
+	assert.False(k.Sites[0] == k.CurrentSites()[0], "reloaded")
+
+	cpath := filepath.Join(path, "config.yaml")
+	if err := ioutil.WriteFile(cpath, []byte("Name: [ Broken"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	w = do("POST")
+	assert.Equal(500, w.Code, "reload failure")
+	assert.NotContains(w.Body.String(), "Broken", "no details sent")
+
+}
+
+func Test_DevMode(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path := tmpSite("Name: tmpSite\nDevMode: false")
+	defer os.RemoveAll(path)
+
+	k, err := kisipar.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.DevMode = true
+	s := k.CurrentSites()[0]
+	assert.True(s.DevMode, "site in DevMode")
+	assert.True(s.Watch, "site watching")
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	assert.Nil(k.Reload(), "no error")
+	s = k.CurrentSites()[0]
+	assert.False(s == k.Sites[0], "site reloaded")
+	defer s.StopWatching()
+	assert.True(s.DevMode, "reloaded site in DevMode")
+	assert.True(s.Watch, "reloaded site watching")
+
+}
+
+func Test_Shutdown(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path := tmpSite("")
+	defer os.RemoveAll(path)
+
+	k, err := kisipar.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Sites[0].Server = &FakeServer{}
+	assert.Nil(k.Shutdown(context.Background()), "no error")
+
+}
@@ -37,6 +37,17 @@ type Page struct {
 	ModTime  time.Time // file mod time; instantiation time for Virtual.
 	Source   []byte    // raw, unparsed source data.
 
+	// The Parser to use instead of the one in ExtParsers, if set; it is
+	// kept when the Page is reloaded.  Pages loaded through a Registry have
+	// the Parser it chose.
+	Parser Parser
+
+	// The Cascade is the default meta for the Page, e.g. from its
+	// directories, merged beneath its own when it is parsed; it is kept when
+	// the Page is reloaded.  Pages loaded through a Registry have the
+	// Cascade it found for them.
+	Cascade map[string]interface{}
+
 	// The standard rendered HTML content:
 	Content template.HTML
 
@@ -50,70 +61,23 @@ type Page struct {
 }
 
 // Load loads a page and parses it using the Parser associated with its
-// extension in ExtParsers.
+// extension in ExtParsers, as per the DefaultRegistry.
 func Load(path string) (*Page, error) {
-
-	if path == "" {
-		return nil, errors.New("page.Load requires a source path.")
-	}
-
-	page, err := New(path)
-	if err != nil {
-		return nil, err
-	}
-	if err := page.Load(); err != nil {
-		return nil, err
-	}
-	if err := page.Parse(); err != nil {
-		return nil, err
-	}
-
-	return page, nil
-
+	return DefaultRegistry().Load(path)
 }
 
 // LoadAny loads the first page it finds for the source path with an extension
 // listed in ExtParsers.  Extensions are matched exactly, meaning that
 // ExtParsers must have entries of every supported extension case.
 func LoadAny(spath string) (*Page, error) {
-	if spath == "" {
-		return nil, errors.New("page.LoadAny requires a source path.")
-	}
-	for _, ep := range ExtParsers {
-		page, err := Load(spath + ep.Ext)
-		if err == nil {
-			return page, nil
-		}
-		if !os.IsNotExist(err) {
-			return nil, err
-		}
-	}
-	return nil, os.ErrNotExist
+	return DefaultRegistry().LoadAny(spath)
 }
 
 // LoadVirtual returns a page with a virtual path, i.e. not necessarily
 // corresponding to any file on disk.  The provided path should indicate
 // the source type, e.g. "virtual/document.md" for Markdown.
 func LoadVirtual(path string, input []byte) (*Page, error) {
-
-	if path == "" {
-		return nil, errors.New("page.LoadVirtual requires a source path.")
-	}
-
-	page, err := New(path)
-	if err != nil {
-		return nil, err
-	}
-
-	page.Virtual = true
-	page.Source = input
-	page.ModTime = time.Now().UTC()
-
-	if err := page.Parse(); err != nil {
-		return nil, err
-	}
-
-	return page, nil
+	return DefaultRegistry().LoadVirtual(path, input)
 }
 
 // LoadVirtualString is shorthand for LoadVirtual(path,[]byte(string).
@@ -167,9 +131,13 @@ func (p *Page) Load() error {
 	return nil
 }
 
-// Parse parses the Page's Source data into Meta and Content using the first
-// Parser in ExtParsers to match the Page's Path extension, or the
-// DefaultParser if none matches. Extension matching is case-insensitive.
+// Parse parses the Page's Source data into Meta and Content using the Page's
+// own Parser if it has one, otherwise the first Parser in ExtParsers to
+// match the Page's Path extension, or the DefaultParser if none matches.
+// Extension matching is case-insensitive.
+//
+// The Page's Cascade, if any, is merged beneath the parsed Meta as per
+// MergeMeta.
 //
 // If the Meta defines a boolean "Unlisted" (or "unlisted" or "UNLISTED")
 // with a value of true, the Page's Unlisted property is set to true.
@@ -181,6 +149,9 @@ func (p *Page) Parse() error {
 		return err
 	}
 	p.Meta = res.Meta()
+	if len(p.Cascade) > 0 {
+		p.Meta = MergeMeta(p.Cascade, p.Meta)
+	}
 	p.Content = template.HTML(res.Content())
 
 	if p.MetaBool("Unlisted") {
@@ -192,14 +163,43 @@ func (p *Page) Parse() error {
 }
 
 func (p *Page) getParser() Parser {
-	ext := strings.ToLower(filepath.Ext(p.Path))
-	for _, ep := range ExtParsers {
-		if ext == strings.ToLower(ep.Ext) {
-			return ep.Parser
-		}
+	if p.Parser != nil {
+		return p.Parser
 	}
-	return DefaultParser
+	return ParserFor(p.Path)
+}
 
+// ParserFor returns the first Parser in ExtParsers to match the extension of
+// the path, case-insensitively, or the DefaultParser if none matches.
+func ParserFor(path string) Parser {
+	return DefaultRegistry().ParserFor(path)
+}
+
+// reload returns a freshly loaded and parsed copy of the Page, with the
+// same Parser and Cascade.
+func (p *Page) reload() (*Page, error) {
+
+	fresh, err := New(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	fresh.Parser = p.Parser
+	fresh.Cascade = p.Cascade
+	if err := fresh.Load(); err != nil {
+		return nil, err
+	}
+	if err := fresh.Parse(); err != nil {
+		return nil, err
+	}
+	return fresh, nil
+
+}
+
+// copy returns a shallow copy of the Page, with its own mutex.
+func (p *Page) copy() *Page {
+	c := *p
+	c.mutex = &sync.Mutex{}
+	return &c
 }
 
 // String returns a hopefully-useful stringification of the page, for logging
@@ -242,7 +242,7 @@ func (p *Page) Refresh() error {
 		return nil
 	}
 
-	fresh, err := Load(p.Path)
+	fresh, err := p.reload()
 	if err != nil {
 		p.mutex.Unlock()
 		return err
@@ -259,6 +259,49 @@ func (p *Page) Refresh() error {
 
 }
 
+// Changed returns true if the modtime of the source file is different than
+// the current ModTime, as it is when the Page needs reloading.  Virtual
+// Pages never change.  File errors, including not-found, are returned.
+func (p *Page) Changed() (bool, error) {
+	if p.Virtual {
+		return false, nil
+	}
+	info, err := os.Stat(p.Path)
+	if err != nil {
+		return false, err
+	}
+	return info.ModTime().UTC() != p.ModTime, nil
+}
+
+// Reloaded returns a freshly loaded copy of the Page if the modtime of the
+// source file is different than the current ModTime, or the Page itself if
+// it is unchanged or Virtual.  Unlike Refresh, Reloaded never modifies the
+// Page, so it is safe to call while other goroutines are reading it; the
+// caller is expected to swap in the copy.  The Unlisted property is carried
+// over to the copy, as it may have been set by the caller.  Errors are
+// returned as per Refresh.
+func (p *Page) Reloaded() (*Page, error) {
+
+	changed, err := p.Changed()
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return p, nil
+	}
+
+	fresh, err := p.reload()
+	if err != nil {
+		return nil, err
+	}
+	if p.Unlisted {
+		fresh.Unlisted = true
+	}
+
+	return fresh, nil
+
+}
+
 // Time returns the newer of the page's Created and Updated meta times;
 // if neither is set or neither is parseable, returns the ModTime.
 func (p *Page) Time() *time.Time {
@@ -334,6 +377,49 @@ func (p *Page) Tags() []string {
 	return p.MetaStringArray("Tags")
 }
 
+// Start returns the start time of the Page as an event, from the Start meta
+// key, or nil if it is not an event.  Times without zone information are
+// in the Page's TimeZone.
+func (p *Page) Start() *time.Time {
+	return p.MetaTimeIn("Start", p.TimeZone())
+}
+
+// End returns the end time of the Page as an event, from the End meta key,
+// or nil if there is none.  Times without zone information are in the
+// Page's TimeZone.
+func (p *Page) End() *time.Time {
+	return p.MetaTimeIn("End", p.TimeZone())
+}
+
+// Location returns the Location string from the Page's Meta block, i.e.
+// where the Page's event takes place.
+// Location is simply shorthand for MetaString("Location").
+func (p *Page) Location() string {
+	return p.MetaString("Location")
+}
+
+// IsEvent returns true if the Page has a valid Start time.
+func (p *Page) IsEvent() bool {
+	return p.Start() != nil
+}
+
+// AllDay returns true if the Page is an event whose Start is a date only,
+// with no time of day.
+func (p *Page) AllDay() bool {
+	return p.IsEvent() && utli.IsDateString(p.MetaString("Start"))
+}
+
+// TimeZone returns the Location named by the TimeZone meta key, such as
+// "Europe/Budapest", or UTC if it is not set or not known.
+func (p *Page) TimeZone() *time.Location {
+	if name := p.MetaString("TimeZone"); name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
 // MetaBool returns a boolean value from the Page's Meta block, with
 // undefined and non-boolean values treated as false. If there is no match
 // for the exact key, lookup is attempted on the lowercase and uppercase
@@ -372,11 +458,198 @@ func (p *Page) MetaString(key string) string {
 }
 
 // MetaTime returns a time value from the Meta, if the requested key holds
-// a string value that can be parsed into a time.  Nil is returned in all
-// other cases.
+// a native time, as decoded from TOML, or a string value that can be parsed
+// into a time.  The YAML decoder gives timestamps as strings, so these are
+// parsed with the YAML timestamp formats first, then the formats of
+// utli.ParseTimeString.  Nil is returned in all other cases.
 func (p *Page) MetaTime(key string) *time.Time {
+	return p.MetaTimeIn(key, time.UTC)
+}
+
+// MetaTimeIn is like MetaTime, but a time without zone information is taken
+// to be in the given Location.
+func (p *Page) MetaTimeIn(key string, loc *time.Location) *time.Time {
 
-	return utli.ParseTimeString(p.MetaString(key))
+	val := p.metaValForKey(key)
+	if t, ok := val.(time.Time); ok {
+		t = inLocation(t, loc)
+		return &t
+	}
+	if s, ok := val.(string); ok {
+		if t := parseYamlTimestamp(s, loc); t != nil {
+			return t
+		}
+	}
+	return utli.ParseTimeStringInLocation(p.MetaString(key), loc)
+
+}
+
+// The TOML decoder gives local dates and times, which have no zone
+// information, these fixed zones.
+var localZones = map[string]string{
+	"datetime-local": "2006-01-02 15:04:05",
+	"date-local":     "2006-01-02",
+	"time-local":     "15:04:05",
+}
+
+// inLocation returns the time in the Location if it has no zone
+// information, otherwise as it is.
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	if _, local := localZones[t.Location().String()]; !local {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(),
+		t.Second(), t.Nanosecond(), loc)
+}
+
+// The YAML timestamp formats, as accepted by the YAML decoder for time
+// values; those without a zone are in the given Location.
+var yamlTimestampFormats = []string{
+	"2006-1-2T15:4:5.999999999Z07:00",
+	"2006-1-2t15:4:5.999999999Z07:00",
+	"2006-1-2 15:4:5.999999999",
+	"2006-1-2",
+}
+
+// parseYamlTimestamp returns the time of the YAML timestamp string, or nil
+// if it is not one.
+func parseYamlTimestamp(s string, loc *time.Location) *time.Time {
+	for _, f := range yamlTimestampFormats {
+		if t, err := time.ParseInLocation(f, s, loc); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+// MetaInt returns an integer value from the Meta, with undefined and
+// non-numeric values treated as zero, and floats truncated.  Key lookup
+// follows the logic of MetaString.
+func (p *Page) MetaInt(key string) int {
+
+	switch v := p.metaValForKey(key).(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case uint:
+		return int(v)
+	case uint32:
+		return int(v)
+	case uint64:
+		return int(v)
+	case float32:
+		return int(v)
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
+
+}
+
+// MetaFloat returns a floating-point value from the Meta, with undefined
+// and non-numeric values treated as zero.  Key lookup follows the logic of
+// MetaString.
+func (p *Page) MetaFloat(key string) float64 {
+
+	switch v := p.metaValForKey(key).(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	default:
+		return float64(p.MetaInt(key))
+	}
+
+}
+
+// MetaMap returns a map value from the Meta, or nil if there is no map for
+// the key.  Maps decoded from YAML, which may have keys of any type, are
+// converted to maps of strings, also when nested, so that their values can
+// be accessed by field in templates.  Key lookup follows the logic of
+// MetaString.
+func (p *Page) MetaMap(key string) map[string]interface{} {
+
+	m, _ := normalizeMeta(p.metaValForKey(key)).(map[string]interface{})
+	return m
+
+}
+
+// MetaList returns a list value from the Meta, or nil if there is no list
+// for the key.  Any maps in the list are converted as for MetaMap.  Key
+// lookup follows the logic of MetaString.
+func (p *Page) MetaList(key string) []interface{} {
+
+	switch v := normalizeMeta(p.metaValForKey(key)).(type) {
+	case []interface{}:
+		return v
+	case []string:
+		res := make([]interface{}, len(v))
+		for i, e := range v {
+			res[i] = e
+		}
+		return res
+	default:
+		return nil
+	}
+
+}
+
+// MetaPath returns the value at the dotted path in the Meta, such as
+// "Author.Email" for the Email in the Author map, or "Authors.0" for the
+// first item of the Authors list; or nil if there is none.  Each key is
+// looked up as for MetaString, and maps are converted as for MetaMap.
+func (p *Page) MetaPath(path string) interface{} {
+
+	keys := strings.Split(path, ".")
+	val := p.metaValForKey(keys[0])
+	for _, key := range keys[1:] {
+		switch v := normalizeMeta(val).(type) {
+		case map[string]interface{}:
+			val = valForKey(v, key)
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			val = v[i]
+		default:
+			return nil
+		}
+	}
+	return normalizeMeta(val)
+
+}
+
+// normalizeMeta returns the meta value with any maps, also nested in maps
+// and lists, converted to maps of strings.
+func normalizeMeta(val interface{}) interface{} {
+
+	switch v := val.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			res[k] = normalizeMeta(e)
+		}
+		return res
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			res[stringify(k)] = normalizeMeta(e)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, e := range v {
+			res[i] = normalizeMeta(e)
+		}
+		return res
+	default:
+		return val
+	}
 
 }
 
@@ -493,6 +766,12 @@ func stringify(val interface{}) string {
 		return strconv.FormatFloat(v, 'f', -1, 64)
 	case bool:
 		return strconv.FormatBool(v)
+	case time.Time:
+		// Times without zones keep their form, so they still parse as such.
+		if layout, local := localZones[v.Location().String()]; local {
+			return v.Format(layout)
+		}
+		return v.String()
 	default:
 		// TODO: useful formatting of times
 		if i, ok := v.(fmt.Stringer); ok {
@@ -507,13 +786,40 @@ func stringify(val interface{}) string {
 	}
 }
 
+// MergeMeta returns a new meta map with the values of meta over those of
+// defaults.  As meta keys are looked up in several cases, a key in defaults
+// is dropped if meta has the same key in any case, e.g. "title" overrides
+// "Title".  The maps are merged at the top level only.
+func MergeMeta(defaults, meta map[string]interface{}) map[string]interface{} {
+
+	merged := make(map[string]interface{}, len(defaults)+len(meta))
+	have := make(map[string]bool, len(meta))
+	for k, v := range meta {
+		merged[k] = v
+		have[strings.ToLower(k)] = true
+	}
+	for k, v := range defaults {
+		if !have[strings.ToLower(k)] {
+			merged[k] = v
+		}
+	}
+	return merged
+
+}
+
 func (p *Page) metaValForKey(key string) interface{} {
+	return valForKey(p.Meta, key)
+}
+
+// valForKey returns the value for the key in the map, falling back on the
+// lowercase and uppercase versions of the key, in that order.
+func valForKey(m map[string]interface{}, key string) interface{} {
 
-	v := p.Meta[key]
+	v := m[key]
 	if v == nil {
-		v = p.Meta[strings.ToLower(key)]
+		v = m[strings.ToLower(key)]
 		if v == nil {
-			v = p.Meta[strings.ToUpper(key)]
+			v = m[strings.ToUpper(key)]
 		}
 	}
 	return v
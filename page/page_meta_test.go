@@ -274,3 +274,306 @@ func Test_MetaBool(t *testing.T) {
 	assert.True(p.MetaBool("this"), "true for uppercase fallback")
 
 }
+
+func Test_MetaTimeIn(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p := &page.Page{Meta: map[string]interface{}{
+		"ts_local": "2016-05-08 12:00:00",
+		"ts_zoned": "2016-05-08T12:00:00+02:00",
+	}}
+	loc := time.FixedZone("Test", -3600)
+
+	assert.Nil(p.MetaTimeIn("nonesuch", loc), "nil for not-found")
+	if ts := p.MetaTimeIn("ts_local", loc); assert.NotNil(ts, "parsed") {
+		assert.Equal(13, ts.UTC().Hour(), "time without zone in location")
+	}
+	if ts := p.MetaTimeIn("ts_zoned", loc); assert.NotNil(ts, "parsed") {
+		assert.Equal(10, ts.UTC().Hour(), "zoned time not moved")
+	}
+
+}
+
+func Test_Event(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p := &page.Page{Meta: map[string]interface{}{}}
+	assert.False(p.IsEvent(), "not an event without Start")
+	assert.False(p.AllDay(), "not all-day without Start")
+	assert.Nil(p.Start(), "no Start")
+	assert.Equal(time.UTC, p.TimeZone(), "UTC by default")
+
+	p.Meta["Start"] = "2016-05-08"
+	p.Meta["Location"] = "Budapest"
+	assert.True(p.IsEvent(), "event with Start")
+	assert.True(p.AllDay(), "all-day with date Start")
+	assert.Equal("Budapest", p.Location(), "Location")
+	assert.Nil(p.End(), "no End")
+
+	p.Meta["Start"] = "2016-05-08 10:00:00"
+	p.Meta["End"] = "2016-05-08 12:00:00"
+	p.Meta["TimeZone"] = "Etc/GMT-2"
+	assert.False(p.AllDay(), "not all-day with time Start")
+	if assert.NotNil(p.Start(), "Start parsed") {
+		assert.Equal(8, p.Start().UTC().Hour(), "Start in TimeZone")
+	}
+	if assert.NotNil(p.End(), "End parsed") {
+		assert.Equal(10, p.End().UTC().Hour(), "End in TimeZone")
+	}
+
+	p.Meta["TimeZone"] = "Nowhere/Special"
+	assert.Equal(time.UTC, p.TimeZone(), "UTC for unknown zone")
+
+}
+
+func Test_MergeMeta(t *testing.T) {
+
+	assert := assert.New(t)
+
+	defaults := map[string]interface{}{
+		"Title":    "Default",
+		"Author":   "Someone",
+		"Template": "blog",
+	}
+	meta := map[string]interface{}{
+		"title":  "Mine",
+		"Author": "Me",
+		"Tags":   "a, b",
+	}
+	assert.Equal(map[string]interface{}{
+		"title":    "Mine",
+		"Author":   "Me",
+		"Tags":     "a, b",
+		"Template": "blog",
+	}, page.MergeMeta(defaults, meta), "merged with meta on top")
+	assert.Equal(3, len(defaults), "defaults unchanged")
+	assert.Equal(3, len(meta), "meta unchanged")
+
+	assert.Equal(map[string]interface{}{"Title": "Default", "Author": "Someone",
+		"Template": "blog"}, page.MergeMeta(defaults, nil), "nil meta")
+	assert.Equal(map[string]interface{}{}, page.MergeMeta(nil, nil),
+		"empty map for nils")
+
+}
+
+func Test_MetaTime_Native(t *testing.T) {
+
+	assert := assert.New(t)
+
+	zoned := time.Date(2016, 5, 8, 12, 0, 0, 0, time.FixedZone("", 7200))
+	local := time.Date(2016, 5, 8, 12, 0, 0, 0,
+		time.FixedZone("datetime-local", 0))
+	date := time.Date(2016, 5, 8, 0, 0, 0, 0, time.FixedZone("date-local", 0))
+	p := &page.Page{Meta: map[string]interface{}{
+		"zoned":  zoned,
+		"local":  local,
+		"DATE":   date,
+		"string": "2016-05-08",
+	}}
+	loc := time.FixedZone("Test", -3600)
+
+	if ts := p.MetaTime("zoned"); assert.NotNil(ts, "time returned") {
+		assert.True(zoned.Equal(*ts), "zoned time as is")
+	}
+	if ts := p.MetaTime("Local"); assert.NotNil(ts, "lowercase fallback") {
+		assert.Equal(12, ts.UTC().Hour(), "local time in UTC")
+	}
+	if ts := p.MetaTimeIn("Local", loc); assert.NotNil(ts, "time returned") {
+		assert.Equal(13, ts.UTC().Hour(), "local time in location")
+	}
+	if ts := p.MetaTimeIn("zoned", loc); assert.NotNil(ts, "time returned") {
+		assert.Equal(10, ts.UTC().Hour(), "zoned time not moved")
+	}
+	if ts := p.MetaTime("date"); assert.NotNil(ts, "uppercase fallback") {
+		assert.Equal(date.Day(), ts.Day(), "date returned")
+	}
+
+	assert.Equal("2016-05-08 12:00:00", p.MetaString("Local"),
+		"local time stringified without zone")
+	assert.Equal("2016-05-08", p.MetaString("DATE"),
+		"local date stringified as date")
+
+	p.Meta["Start"] = date
+	assert.True(p.AllDay(), "all-day with local date Start")
+	p.Meta["Start"] = local
+	assert.False(p.AllDay(), "not all-day with local time Start")
+
+}
+
+func Test_MetaInt(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p := &page.Page{Meta: map[string]interface{}{
+		"int":    3,
+		"int64":  int64(4),
+		"uint64": uint64(5),
+		"float":  6.7,
+		"string": "8",
+		"upper":  9,
+	}}
+
+	assert.Equal(0, p.MetaInt("nonesuch"), "zero for not-found")
+	assert.Equal(3, p.MetaInt("int"), "int")
+	assert.Equal(4, p.MetaInt("int64"), "int64")
+	assert.Equal(5, p.MetaInt("uint64"), "uint64")
+	assert.Equal(6, p.MetaInt("float"), "float truncated")
+	assert.Equal(0, p.MetaInt("string"), "zero for string")
+	assert.Equal(9, p.MetaInt("UPPER"), "case fallback")
+
+}
+
+func Test_MetaFloat(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p := &page.Page{Meta: map[string]interface{}{
+		"int":     3,
+		"int64":   int64(4),
+		"float":   6.5,
+		"float32": float32(1.5),
+		"string":  "8",
+	}}
+
+	assert.Equal(0.0, p.MetaFloat("nonesuch"), "zero for not-found")
+	assert.Equal(3.0, p.MetaFloat("int"), "int")
+	assert.Equal(4.0, p.MetaFloat("int64"), "int64")
+	assert.Equal(6.5, p.MetaFloat("float"), "float")
+	assert.Equal(1.5, p.MetaFloat("float32"), "float32")
+	assert.Equal(0.0, p.MetaFloat("string"), "zero for string")
+	assert.Equal(6.5, p.MetaFloat("FLOAT"), "case fallback")
+
+}
+
+func Test_MetaMap_MetaList(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p := &page.Page{Meta: map[string]interface{}{
+		"yaml": map[interface{}]interface{}{
+			"a": 1,
+			2:   []interface{}{map[interface{}]interface{}{"b": "c"}},
+		},
+		"plain":   map[string]interface{}{"x": "y"},
+		"list":    []interface{}{1, map[interface{}]interface{}{"b": "c"}},
+		"strings": []string{"a", "b"},
+		"string":  "a, b",
+	}}
+
+	assert.Nil(p.MetaMap("nonesuch"), "nil map for not-found")
+	assert.Nil(p.MetaMap("list"), "nil map for list")
+	assert.Equal(map[string]interface{}{"x": "y"}, p.MetaMap("plain"),
+		"plain map")
+	assert.Equal(map[string]interface{}{
+		"a": 1,
+		"2": []interface{}{map[string]interface{}{"b": "c"}},
+	}, p.MetaMap("YAML"), "YAML map converted, also nested")
+
+	assert.Nil(p.MetaList("nonesuch"), "nil list for not-found")
+	assert.Nil(p.MetaList("string"), "nil list for string")
+	assert.Nil(p.MetaList("plain"), "nil list for map")
+	assert.Equal([]interface{}{1, map[string]interface{}{"b": "c"}},
+		p.MetaList("list"), "list with maps converted")
+	assert.Equal([]interface{}{"a", "b"}, p.MetaList("strings"),
+		"string list")
+
+}
+
+func Test_MetaPath(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p := &page.Page{Meta: map[string]interface{}{
+		"Author": map[interface{}]interface{}{
+			"name":  "Jo",
+			"Email": "jo@example.com",
+			"Links": []interface{}{
+				map[interface{}]interface{}{"Url": "http://example.com"},
+			},
+		},
+		"plain": map[string]interface{}{"KEY": "val"},
+		"title": "Hi",
+	}}
+
+	assert.Equal("jo@example.com", p.MetaPath("Author.Email"), "nested key")
+	assert.Equal("Jo", p.MetaPath("Author.Name"), "case fallback")
+	assert.Equal("val", p.MetaPath("Plain.key"), "plain map")
+	assert.Equal("http://example.com", p.MetaPath("Author.Links.0.Url"),
+		"list index")
+	assert.Equal("Hi", p.MetaPath("Title"), "top-level key")
+	assert.Equal(map[string]interface{}{"Url": "http://example.com"},
+		p.MetaPath("Author.Links.0"), "map converted")
+
+	for _, path := range []string{"nonesuch", "Author.Nonesuch",
+		"Author.Links.1", "Author.Links.x", "Author.Links.-1",
+		"Title.x", "Author.Email.x", ""} {
+		assert.Nil(p.MetaPath(path), "nil for %q", path)
+	}
+
+}
+
+func Test_TypedMeta_Parsed(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p, err := page.LoadVirtualString("/toml.md", `# TOML
+
+`+"```toml"+`
+Rating = 4
+Score = 2.5
+Start = 2016-05-08
+Updated = 2016-05-08T10:00:00
+Tags = ["a", "b"]
+
+[Author]
+Name = "Jo"
+Email = "jo@example.com"
+`+"```"+`
+`)
+	if !assert.Nil(err, "no error parsing TOML") {
+		return
+	}
+	assert.Equal(4, p.MetaInt("Rating"), "int")
+	assert.Equal(2.5, p.MetaFloat("Score"), "float")
+	assert.Equal("jo@example.com", p.MetaPath("Author.Email"), "path")
+	assert.Equal([]interface{}{"a", "b"}, p.MetaList("Tags"), "list")
+	assert.True(p.AllDay(), "all-day from local date")
+	if ts := p.MetaTime("Updated"); assert.NotNil(ts, "time") {
+		assert.Equal(10, ts.UTC().Hour(), "local time in UTC")
+	}
+
+	p, err = page.LoadVirtualString("/yaml.md", "# YAML\n\n"+
+		"    Rating: 4\n    Score: 2.5\n    Author: {Name: Jo, Email: jo@x}\n")
+	if !assert.Nil(err, "no error parsing YAML") {
+		return
+	}
+	assert.Equal(4, p.MetaInt("Rating"), "int")
+	assert.Equal(2.5, p.MetaFloat("Score"), "float")
+	assert.Equal(map[string]interface{}{"Name": "Jo", "Email": "jo@x"},
+		p.MetaMap("Author"), "map")
+	assert.Equal("jo@x", p.MetaPath("Author.Email"), "path")
+
+	// YAML timestamps come as strings, in formats of their own:
+	p, err = page.LoadVirtualString("/yaml-times.md", "# YAML Times\n\n"+
+		"    Start: 2016-5-8\n    Updated: 2016-05-08t10:00:00.5-02:00\n"+
+		"    Created: 2016-05-08 10:00:00\n")
+	if !assert.Nil(err, "no error parsing YAML") {
+		return
+	}
+	assert.IsType("", p.Meta["Updated"], "YAML time is a string")
+	assert.True(p.AllDay(), "all-day from YAML date")
+	if ts := p.MetaTime("Start"); assert.NotNil(ts, "date") {
+		assert.Equal(8, ts.Day(), "date parsed")
+	}
+	if ts := p.MetaTime("Updated"); assert.NotNil(ts, "time") {
+		assert.Equal(12, ts.UTC().Hour(), "zoned time in UTC")
+		assert.Equal(500000000, ts.Nanosecond(), "fraction kept")
+	}
+	loc := time.FixedZone("Test", -3600)
+	if ts := p.MetaTimeIn("Created", loc); assert.NotNil(ts, "time") {
+		assert.Equal(11, ts.UTC().Hour(), "time without zone in location")
+	}
+
+}
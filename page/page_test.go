@@ -980,6 +980,91 @@ Here!
 
 }
 
+func Test_Reloaded_Virtual(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p := &page.Page{Virtual: true}
+	res, err := p.Reloaded()
+	assert.Nil(err, "no error on virtual reload that would otherwise fail")
+	assert.True(p == res, "same page returned")
+
+}
+
+func Test_Reloaded_SameTimes(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, derr := ioutil.TempDir("", "kisipar-page-test-")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a-page.md")
+	if err := ioutil.WriteFile(path, []byte("# Here"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	p, err := page.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := p.Reloaded()
+	assert.Nil(err, "no error on Reloaded")
+	assert.True(p == res, "same page returned")
+
+}
+
+func Test_Reloaded_NotFound(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p := &page.Page{Path: "/nonesuch/a-page.md"}
+	res, err := p.Reloaded()
+	if assert.Error(err, "have error on Reloaded") {
+		assert.True(os.IsNotExist(err), "error passes os.IsNotExist")
+	}
+	assert.Nil(res, "no page returned")
+
+}
+
+func Test_Reloaded_Success(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, derr := ioutil.TempDir("", "kisipar-page-test-")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a-page.md")
+	if err := ioutil.WriteFile(path, []byte("# Here"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	p, err := page.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Unlisted = true
+
+	// Rewrite the file, and tweak the mod time in case we're very fast.
+	if err := ioutil.WriteFile(path, []byte("# There"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	p.ModTime = time.Unix(0, 0)
+
+	res, err := p.Reloaded()
+	assert.Nil(err, "no error on Reloaded")
+	if assert.NotNil(res, "page returned") {
+		assert.False(p == res, "new page returned")
+		assert.Equal("There", res.Title(), "new page has new content")
+		assert.True(res.Unlisted, "Unlisted carried over")
+	}
+	assert.Equal("Here", p.Title(), "original page untouched")
+	assert.Equal(time.Unix(0, 0), p.ModTime, "original mod time untouched")
+
+}
+
 func Test_LoadVirtual_SetUnlisted(t *testing.T) {
 
 	assert := assert.New(t)
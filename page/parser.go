@@ -32,7 +32,10 @@ type ExtParser struct {
 // a particular cased extension (".Txt" for instance) then you need to set
 // that up here in ExtParsers.
 //
-// The standard values should be sufficient for any normal Kisipar site.
+// The standard values should be sufficient for any normal Kisipar site, and
+// ExtParsers should not be changed while Pages are being loaded; they are
+// only the defaults, and a site wanting other parsers should rather have its
+// own Registry.
 var ExtParsers = []*ExtParser{
 	{".md", &MdParser{}},       // .md -> Markdown
 	{".MD", &MdParser{}},       // .MD -> Markdown (hello MSDOS!)
@@ -42,14 +45,11 @@ var ExtParsers = []*ExtParser{
 	{".TXT", &MdParser{}},      // versa.
 }
 
-// LimitExtParsers removes any ExtParser entries from ExtParsers not matching
-// the provided set of extensions, putting the resulting ExtParsers in the
-// order of the extlist received.  This is useful for keeping the behavior
-// of LoadAny in sync with any site-wide preload operations.
-//
-// Note that this is destructive: once limited, the original set of ExtParsers
-// is gone.
-func LimitExtParsers(extlist []string) {
+// LimitExtParsers returns the ExtParser entries from ExtParsers matching the
+// provided set of extensions, in the order of the extlist received.  This is
+// useful for keeping a site's parsers in sync with its page extensions.
+// ExtParsers itself is not changed.
+func LimitExtParsers(extlist []string) []*ExtParser {
 	have := map[string]*ExtParser{}
 	for _, ep := range ExtParsers {
 		have[ep.Ext] = ep
@@ -62,18 +62,25 @@ func LimitExtParsers(extlist []string) {
 		}
 	}
 
-	ExtParsers = keepers
+	return keepers
 
 }
 
 // MdParser is the standard Markdown parser, using the frostedmd parsing
-// logic based on blackfriday.
-type MdParser struct{}
+// logic.  The Frosted parser holds the Markdown extensions, HTML flags, meta
+// position and engine; if it is nil, the common settings are used, as in
+// frostedmd.MarkdownCommon.
+type MdParser struct {
+	Frosted *frostedmd.Parser
+}
 
 // Parse implements the Parser interface for the MdParser type.
 func (p *MdParser) Parse(b []byte) (ParseResult, error) {
 
-	return frostedmd.MarkdownCommon(b)
+	if p.Frosted == nil {
+		return frostedmd.MarkdownCommon(b)
+	}
+	return p.Frosted.Parse(b)
 
 }
 
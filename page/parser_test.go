@@ -4,10 +4,15 @@
 package page_test
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/biztos/kisipar/frostedmd"
 	"github.com/biztos/kisipar/page"
 )
 
@@ -114,19 +119,104 @@ func Test_Parse_LimitExtParsers(t *testing.T) {
 
 	// Empty! (Would you ever do this?)
 	exp := []*page.ExtParser{}
-	page.LimitExtParsers([]string{})
-	assert.Equal(exp, page.ExtParsers, "limit to empty -> empty")
+	assert.Equal(exp, page.LimitExtParsers([]string{}),
+		"limit to empty -> empty")
 
 	// Just .md
-	page.ExtParsers = origExtParsers
 	exp = []*page.ExtParser{origExtParsers[0]}
-	page.LimitExtParsers([]string{".md"})
-	assert.Equal(exp, page.ExtParsers, "limit to .md -> one")
+	assert.Equal(exp, page.LimitExtParsers([]string{".md"}),
+		"limit to .md -> one")
 
 	// A couple.
-	page.ExtParsers = origExtParsers
 	exp = []*page.ExtParser{origExtParsers[0], origExtParsers[4]}
-	page.LimitExtParsers([]string{".md", ".txt"})
-	assert.Equal(exp, page.ExtParsers, "limit to .md+.txt -> two")
+	assert.Equal(exp, page.LimitExtParsers([]string{".md", ".txt"}),
+		"limit to .md+.txt -> two")
+
+	// ...and nothing was lost.
+	assert.Equal(origExtParsers, page.ExtParsers, "ExtParsers unchanged")
+
+}
+
+func Test_ParserFor(t *testing.T) {
+
+	assert := assert.New(t)
+
+	origExtParsers := page.ExtParsers
+	defer func() { page.ExtParsers = origExtParsers }()
+	tp := &TestParser{}
+	page.ExtParsers = []*page.ExtParser{{".HERE", tp}}
+
+	assert.Equal(tp, page.ParserFor("/some/thing.here"), "ext matched")
+	assert.Equal(page.DefaultParser, page.ParserFor("/some/thing.there"),
+		"default if no match")
+
+}
+
+func Test_Parse_PageParser(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p := &page.Page{
+		Path:   "/some/thing.md",
+		Source: []byte("RAW"),
+		Parser: &TestParser{},
+	}
+
+	err := p.Parse()
+	assert.Nil(err, "no error parsing with the page's parser")
+	assert.Equal(p.Title(), "tested", "meta set by parser")
+	assert.Equal("test parsed", string(p.Content), "content set by parser")
+
+}
+
+func Test_MdParser_Frosted(t *testing.T) {
+
+	assert := assert.New(t)
+
+	input := []byte("# Hi\n\n\"There.\"")
+
+	res, err := (&page.MdParser{}).Parse(input)
+	assert.Nil(err, "no error with common settings")
+	assert.Equal("<h1>Hi</h1>\n\n<p>&ldquo;There.&rdquo;</p>\n",
+		string(res.Content()), "common settings used")
+
+	fp := frostedmd.NewBasic()
+	fp.Engine = frostedmd.CommonMark
+	res, err = (&page.MdParser{Frosted: fp}).Parse(input)
+	assert.Nil(err, "no error with Frosted parser")
+	assert.Equal("<h1>Hi</h1>\n\n<p>&quot;There.&quot;</p>\n",
+		string(res.Content()), "Frosted parser used")
+	assert.Equal("Hi", res.Meta()["Title"], "title from header")
+
+}
+
+func Test_Refresh_KeepsParser(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, derr := ioutil.TempDir("", "kisipar-page-test-")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a-page.md")
+	if err := ioutil.WriteFile(path, []byte("# Hi"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	p, err := page.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Parser = &TestParser{}
+	p.ModTime = time.Unix(0, 0)
+
+	fresh, err := p.Reloaded()
+	assert.Nil(err, "no error on Reloaded")
+	assert.Equal("test parsed", string(fresh.Content), "reloaded with parser")
+	assert.Equal(p.Parser, fresh.Parser, "parser kept")
+
+	err = p.Refresh()
+	assert.Nil(err, "no error on Refresh")
+	assert.Equal("test parsed", string(p.Content), "refreshed with parser")
 
 }
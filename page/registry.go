@@ -0,0 +1,194 @@
+// page/registry.go - Kisipar parser registries.
+// ----------------
+
+package page
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A Registry chooses the Parser for each Page by its path, so that every
+// site can have its own Parsers.  Pages loaded through a Registry keep the
+// Parser it chose for them, also when they are reloaded.
+//
+// The ExtParsers and DefaultParser work as the globals of the same names,
+// which are only the defaults; cf. NewRegistry and DefaultRegistry.  A nil
+// Registry is the DefaultRegistry.
+//
+// A Registry should not be changed while Pages are being loaded with it.
+type Registry struct {
+	ExtParsers    []*ExtParser
+	DefaultParser Parser
+
+	// Choose, if set, may replace the Parser chosen for a path by its
+	// extension, e.g. to use special settings for some paths.
+	Choose func(path string, parser Parser) Parser
+
+	// Cascade, if set, returns the default meta for the Page at path, which
+	// is set as its Cascade before it is parsed.
+	Cascade func(path string) map[string]interface{}
+}
+
+// NewRegistry returns a Registry with the ExtParsers for the extensions in
+// extlist, as per LimitExtParsers, and the global DefaultParser.
+func NewRegistry(extlist []string) *Registry {
+	return &Registry{
+		ExtParsers:    LimitExtParsers(extlist),
+		DefaultParser: DefaultParser,
+	}
+}
+
+// DefaultRegistry returns a Registry with the current global ExtParsers and
+// DefaultParser.
+func DefaultRegistry() *Registry {
+	return &Registry{
+		ExtParsers:    ExtParsers,
+		DefaultParser: DefaultParser,
+	}
+}
+
+func (r *Registry) orDefault() *Registry {
+	if r == nil {
+		return DefaultRegistry()
+	}
+	return r
+}
+
+// ParserFor returns the Parser for the path: the first in ExtParsers to
+// match its extension, case-insensitively, or else the DefaultParser, as
+// changed by Choose if set.
+func (r *Registry) ParserFor(path string) Parser {
+
+	r = r.orDefault()
+	parser := r.DefaultParser
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, ep := range r.ExtParsers {
+		if ext == strings.ToLower(ep.Ext) {
+			parser = ep.Parser
+			break
+		}
+	}
+	if r.Choose != nil {
+		parser = r.Choose(path, parser)
+	}
+	return parser
+
+}
+
+// Load loads a page and parses it using the Parser for its path, with the
+// Cascade for its path if the Registry has one.
+func (r *Registry) Load(path string) (*Page, error) {
+
+	if path == "" {
+		return nil, errors.New("page.Load requires a source path.")
+	}
+
+	page, err := New(path)
+	if err != nil {
+		return nil, err
+	}
+	page.Parser = r.ParserFor(path)
+	page.Cascade = r.cascadeFor(path)
+	if err := page.Load(); err != nil {
+		return nil, err
+	}
+	if err := page.Parse(); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+
+}
+
+// LoadAny loads the first page it finds for the source path with an
+// extension listed in the Registry's ExtParsers.  Extensions are matched
+// exactly, meaning that ExtParsers must have entries of every supported
+// extension case.
+func (r *Registry) LoadAny(spath string) (*Page, error) {
+	r = r.orDefault()
+	return r.LoadAnyWith(spath, r.Load)
+}
+
+// LoadAnyWith works as LoadAny, but loads the page with load instead of the
+// Registry's Load, e.g. to check it as well.  Errors of load for which
+// os.IsNotExist is true are taken to mean the page is not there.
+func (r *Registry) LoadAnyWith(spath string, load func(path string) (*Page, error)) (*Page, error) {
+	if spath == "" {
+		return nil, errors.New("page.LoadAny requires a source path.")
+	}
+	r = r.orDefault()
+	for _, ep := range r.ExtParsers {
+		page, err := load(spath + ep.Ext)
+		if err == nil {
+			return page, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// LoadVirtual returns a page with a virtual path, parsed using the Parser
+// and Cascade for the path; cf. the LoadVirtual function.
+func (r *Registry) LoadVirtual(path string, input []byte) (*Page, error) {
+
+	if path == "" {
+		return nil, errors.New("page.LoadVirtual requires a source path.")
+	}
+
+	page, err := New(path)
+	if err != nil {
+		return nil, err
+	}
+
+	page.Virtual = true
+	page.Source = input
+	page.ModTime = time.Now().UTC()
+	page.Parser = r.ParserFor(path)
+	page.Cascade = r.cascadeFor(path)
+
+	if err := page.Parse(); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// Reparsed returns a copy of the Page for use with the Registry: if the
+// Parser chosen for it, given its own or else the one for its path, or the
+// Cascade for its path differ from what it was parsed with, the copy is
+// parsed again with them.  The Page itself is not modified, so it may be
+// shared, e.g. among virtual sites.
+func (r *Registry) Reparsed(p *Page) (*Page, error) {
+
+	r = r.orDefault()
+	cur := p.getParser()
+	parser := cur
+	if r.Choose != nil {
+		parser = r.Choose(p.Path, cur)
+	}
+	cascade := r.cascadeFor(p.Path)
+
+	c := p.copy()
+	if parser != cur || len(cascade) > 0 || len(p.Cascade) > 0 {
+		c.Parser = parser
+		c.Cascade = cascade
+		if err := c.Parse(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+
+}
+
+func (r *Registry) cascadeFor(path string) map[string]interface{} {
+	if r == nil || r.Cascade == nil {
+		return nil
+	}
+	return r.Cascade(path)
+}
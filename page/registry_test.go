@@ -0,0 +1,235 @@
+// page/registry_test.go - tests for parser registries.
+// ---------------------
+
+package page_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/biztos/kisipar/page"
+)
+
+func Test_NewRegistry(t *testing.T) {
+
+	assert := assert.New(t)
+
+	r := page.NewRegistry([]string{".txt", ".nonesuch"})
+	assert.Equal([]*page.ExtParser{page.ExtParsers[4]}, r.ExtParsers,
+		"ExtParsers limited")
+	assert.Equal(page.DefaultParser, r.DefaultParser, "DefaultParser set")
+	assert.Equal(6, len(page.ExtParsers), "global ExtParsers unchanged")
+
+}
+
+func Test_DefaultRegistry(t *testing.T) {
+
+	assert := assert.New(t)
+
+	origExtParsers := page.ExtParsers
+	defer func() { page.ExtParsers = origExtParsers }()
+	page.ExtParsers = []*page.ExtParser{{".here", &TestParser{}}}
+
+	r := page.DefaultRegistry()
+	assert.Equal(page.ExtParsers, r.ExtParsers, "current ExtParsers")
+	assert.Equal(page.DefaultParser, r.DefaultParser, "DefaultParser set")
+
+	var nilr *page.Registry
+	assert.Equal(page.ExtParsers[0].Parser, nilr.ParserFor("x.here"),
+		"nil Registry is the default")
+
+}
+
+func Test_Registry_ParserFor(t *testing.T) {
+
+	assert := assert.New(t)
+
+	tp := &TestParser{}
+	vp := &page.VerbatimParser{}
+	r := &page.Registry{
+		ExtParsers:    []*page.ExtParser{{".HERE", tp}},
+		DefaultParser: vp,
+	}
+	assert.Equal(tp, r.ParserFor("/some/thing.here"), "ext matched")
+	assert.Equal(vp, r.ParserFor("/some/thing.md"), "default if no match")
+
+	other := &TestParser{}
+	r.Choose = func(path string, parser page.Parser) page.Parser {
+		if filepath.Dir(path) == "/other" {
+			return other
+		}
+		return parser
+	}
+	assert.True(other == r.ParserFor("/other/thing.here"), "chosen")
+	assert.True(tp == r.ParserFor("/some/thing.here"), "not chosen")
+
+}
+
+func Test_Registry_Load(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, derr := ioutil.TempDir("", "kisipar-page-test-")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	defer os.RemoveAll(dir)
+	key := filepath.Join(dir, "a-page")
+	if err := ioutil.WriteFile(key+".md", []byte("# Hi"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	tp := &TestParser{}
+	r := &page.Registry{ExtParsers: []*page.ExtParser{{".md", tp}}}
+
+	p, err := r.Load(key + ".md")
+	if assert.Nil(err, "no error on Load") {
+		assert.Equal("test parsed", string(p.Content), "registry parser used")
+		assert.True(tp == p.Parser, "page keeps parser")
+	}
+
+	p, err = r.LoadAny(key)
+	if assert.Nil(err, "no error on LoadAny") {
+		assert.Equal("test parsed", string(p.Content), "registry parser used")
+	}
+
+	_, err = page.NewRegistry([]string{".txt"}).LoadAny(key)
+	assert.True(os.IsNotExist(err), "only registry extensions tried")
+
+	tried := []string{}
+	_, err = r.LoadAnyWith(key, func(path string) (*page.Page, error) {
+		tried = append(tried, path)
+		if path == key+".md" {
+			return nil, errors.New("checked")
+		}
+		return nil, os.ErrNotExist
+	})
+	assert.EqualError(err, "checked", "error from load returned")
+	assert.Equal(key+".md", tried[len(tried)-1], "load used until found")
+
+	p, err = r.LoadVirtual("virtual.md", []byte("# Hi"))
+	if assert.Nil(err, "no error on LoadVirtual") {
+		assert.Equal("test parsed", string(p.Content), "registry parser used")
+		assert.True(p.Virtual, "page is virtual")
+	}
+
+	_, err = r.Load("")
+	assert.Error(err, "error for empty path")
+	_, err = r.LoadAny("")
+	assert.Error(err, "error for empty path")
+	_, err = r.LoadVirtual("", nil)
+	assert.Error(err, "error for empty path")
+
+}
+
+func Test_Registry_Cascade(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, derr := ioutil.TempDir("", "kisipar-page-test-")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a-page.md")
+	src := []byte("# Here\n\n    Author: Me\n    tags: [x]\n")
+	if err := ioutil.WriteFile(path, src, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	r := page.NewRegistry([]string{".md"})
+	r.Cascade = func(path string) map[string]interface{} {
+		return map[string]interface{}{
+			"Author":   "Someone",
+			"Tags":     []string{"y"},
+			"Template": "special",
+			"Unlisted": true,
+		}
+	}
+
+	p, err := r.Load(path)
+	if !assert.Nil(err, "no error on Load") {
+		return
+	}
+	assert.Equal("Me", p.Author(), "own meta wins")
+	assert.Equal([]string{"x"}, p.Tags(), "own meta wins in any case")
+	assert.Equal("special", p.MetaString("Template"), "cascaded meta")
+	assert.True(p.Unlisted, "Unlisted cascaded")
+	assert.Equal(r.Cascade(path), p.Cascade, "page keeps Cascade")
+
+	// Rewrite the file, and tweak the mod time in case we're very fast.
+	if err := ioutil.WriteFile(path, []byte("# There"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	p.ModTime = time.Unix(0, 0)
+	fresh, err := p.Reloaded()
+	if assert.Nil(err, "no error on Reloaded") {
+		assert.Equal("Someone", fresh.Author(), "Cascade kept on reload")
+	}
+
+	p, err = r.LoadVirtual("virtual.md", []byte("# Hi"))
+	if assert.Nil(err, "no error on LoadVirtual") {
+		assert.Equal("special", p.MetaString("Template"),
+			"cascaded meta for virtual page")
+	}
+
+}
+
+func Test_Registry_Reparsed(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p, err := page.LoadVirtualString("/a/page.md", "# Here\n\n    Author: Me\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := p.Parser
+	meta := p.Meta
+	content := p.Content
+
+	// Nothing to change, so nothing parsed:
+	r := page.NewRegistry([]string{".md"})
+	c, err := r.Reparsed(p)
+	if assert.Nil(err, "no error") {
+		assert.False(c == p, "copy returned")
+		assert.Equal(p.Meta, c.Meta, "meta as is")
+	}
+
+	// A chosen parser and a cascade are applied to the copy only:
+	tp := &TestParser{}
+	r.Choose = func(path string, parser page.Parser) page.Parser {
+		return tp
+	}
+	r.Cascade = func(path string) map[string]interface{} {
+		return map[string]interface{}{"Template": "special"}
+	}
+	c, err = r.Reparsed(p)
+	if assert.Nil(err, "no error") {
+		assert.True(tp == c.Parser, "copy has chosen parser")
+		assert.Equal("tested", c.Title(), "copy parsed with it")
+		assert.Equal("special", c.MetaString("Template"), "copy cascaded")
+	}
+	assert.True(parser == p.Parser, "page parser unchanged")
+	assert.Nil(p.Cascade, "page cascade unchanged")
+	assert.Equal(meta, p.Meta, "page meta unchanged")
+	assert.Equal(content, p.Content, "page content unchanged")
+
+	// Parse errors are returned:
+	bad, err := page.New("/bad.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad.Source = []byte("# Bad\n\n```json\n{ id: [bad,\n```\n")
+	_, err = page.NewRegistry([]string{".md"}).Reparsed(bad)
+	assert.Nil(err, "no error without parsing")
+	r.Choose = nil
+	_, err = r.Reparsed(bad)
+	assert.Error(err, "error returned")
+
+}
@@ -0,0 +1,88 @@
+// pageset/events.go - event Pages of the Pageset.
+// -----------------
+
+package pageset
+
+import (
+	"sort"
+	"time"
+
+	"github.com/biztos/kisipar/page"
+	"github.com/biztos/kisipar/utli"
+)
+
+// Events returns the Pageset's event Pages, i.e. those with a Start time,
+// in order of their Start times; ties are broken by Path.  Unlisted Pages
+// are excluded.  The result is cached for future use.
+func (ps *Pageset) Events() []*page.Page {
+
+	ps.mutex.RLock()
+	cached := ps.cache.events
+	ps.mutex.RUnlock()
+	if cached != nil {
+		return cached
+	}
+
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if ps.cache.events == nil {
+		events := []*page.Page{}
+		starts := map[*page.Page]time.Time{}
+		for _, p := range ps.listedPages() {
+			if start := p.Start(); start != nil {
+				events = append(events, p)
+				starts[p] = *start
+			}
+		}
+		sort.Slice(events, func(i, j int) bool {
+			si, sj := starts[events[i]], starts[events[j]]
+			if !si.Equal(sj) {
+				return si.Before(sj)
+			}
+			return events[i].Path < events[j].Path
+		})
+		ps.cache.events = events
+	}
+
+	return ps.cache.events
+
+}
+
+// UpcomingEvents returns the Events that have not yet ended, in order of
+// their Start times.  An event without an End ends at its Start, or at the
+// end of its day if it is an all-day event.
+func (ps *Pageset) UpcomingEvents() []*page.Page {
+
+	now := time.Now()
+	upcoming := []*page.Page{}
+	for _, p := range ps.Events() {
+		if EventEnd(p).After(now) {
+			upcoming = append(upcoming, p)
+		}
+	}
+	return upcoming
+
+}
+
+// EventEnd returns the time at which the event Page ends: its End, if it
+// has one, else the end of its Start day for all-day events, else its Start.
+// A date-only End includes the whole day.  The zero time is returned if the
+// Page is not an event.
+func EventEnd(p *page.Page) time.Time {
+
+	start := p.Start()
+	if start == nil {
+		return time.Time{}
+	}
+	if end := p.End(); end != nil {
+		if utli.IsDateString(p.MetaString("End")) {
+			return end.AddDate(0, 0, 1)
+		}
+		return *end
+	}
+	if p.AllDay() {
+		return start.AddDate(0, 0, 1)
+	}
+	return *start
+
+}
@@ -0,0 +1,114 @@
+// pageset/events_test.go - tests for Pageset events
+// ----------------------
+
+package pageset_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/biztos/kisipar/page"
+	"github.com/biztos/kisipar/pageset"
+)
+
+func eventPageset(t *testing.T) *pageset.Pageset {
+
+	past := time.Now().Add(-48 * time.Hour)
+	future := time.Now().Add(48 * time.Hour)
+	sources := map[string]string{
+		"/past.md": "# Past\n\n    Start: " + past.UTC().Format("2006-01-02 15:04:05"),
+		"/today.md": "# Today\n\n    Start: " +
+			time.Now().UTC().Format("2006-01-02"),
+		"/future-b.md": "# Future B\n\n    Start: " +
+			future.Format(time.RFC3339),
+		"/future-a.md": "# Future A\n\n    Start: " +
+			future.Format(time.RFC3339),
+		"/ongoing.md": "# Ongoing\n\n    Start: " +
+			past.Format(time.RFC3339) + "\n    End: " +
+			future.Format(time.RFC3339),
+		"/hidden.md": "# Hidden\n\n    Unlisted: true\n    Start: " +
+			future.Format(time.RFC3339),
+		"/plain.md": "# Plain",
+	}
+	pages := []*page.Page{}
+	for path, src := range sources {
+		p, err := page.LoadVirtualString(path, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, p)
+	}
+	ps, err := pageset.New(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ps
+
+}
+
+// pagePaths returns the Paths of the Pages.
+func pagePaths(pages []*page.Page) []string {
+	paths := make([]string, len(pages))
+	for i, p := range pages {
+		paths[i] = p.Path
+	}
+	return paths
+}
+
+func Test_Events(t *testing.T) {
+
+	assert := assert.New(t)
+
+	ps := eventPageset(t)
+	exp := []string{"/ongoing.md", "/past.md", "/today.md",
+		"/future-a.md", "/future-b.md"}
+	assert.Equal(exp, pagePaths(ps.Events()), "events sorted by Start")
+	assert.Equal(exp, pagePaths(ps.Events()), "cached events same")
+
+	p, err := page.LoadVirtualString("/new.md", "# New\n\n    Start: 2000-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.AddPage(p)
+	assert.Equal("/new.md", ps.Events()[0].Path, "added event included")
+
+}
+
+func Test_UpcomingEvents(t *testing.T) {
+
+	assert := assert.New(t)
+
+	ps := eventPageset(t)
+	assert.Equal([]string{"/ongoing.md", "/today.md", "/future-a.md",
+		"/future-b.md"}, pagePaths(ps.UpcomingEvents()),
+		"ended events excluded")
+
+}
+
+func Test_EventEnd(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p := &page.Page{Meta: map[string]interface{}{}}
+	assert.True(pageset.EventEnd(p).IsZero(), "zero for non-event")
+
+	p.Meta["Start"] = "2016-05-08 10:00:00"
+	assert.Equal("2016-05-08T10:00:00Z",
+		pageset.EventEnd(p).Format(time.RFC3339), "Start without End")
+
+	p.Meta["End"] = "2016-05-08 12:00:00"
+	assert.Equal("2016-05-08T12:00:00Z",
+		pageset.EventEnd(p).Format(time.RFC3339), "End")
+
+	p.Meta["Start"] = "2016-05-08"
+	delete(p.Meta, "End")
+	assert.Equal("2016-05-09T00:00:00Z",
+		pageset.EventEnd(p).Format(time.RFC3339), "all-day without End")
+
+	p.Meta["End"] = "2016-05-10"
+	assert.Equal("2016-05-11T00:00:00Z",
+		pageset.EventEnd(p).Format(time.RFC3339), "all-day with date End")
+
+}
@@ -20,6 +20,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/biztos/kisipar/page"
 )
@@ -41,6 +42,18 @@ type cache struct {
 
 	// Tags are a bit expensive to extract:
 	tags []string
+
+	// Events, in order of their Start times:
+	events []*page.Page
+
+	// The search index is very expensive, so its documents are kept by
+	// Page and survive clearAll: changed Pages are new Pages.
+	search     *searchIndex
+	searchDocs map[*page.Page]*searchDoc
+
+	// The generation counts the changes, so that work done without the
+	// lock can tell whether it is still current.
+	generation int
 }
 
 func (c *cache) clearAll() {
@@ -48,11 +61,16 @@ func (c *cache) clearAll() {
 	c.byPath = nil
 	c.byCreated = nil
 	c.byModTime = nil
+	c.byTime = nil
 
 	c.pathSubsets = map[string]*Pageset{}
 	c.tagSubsets = map[string]*Pageset{}
 
 	c.tags = nil
+	c.events = nil
+	c.search = nil
+
+	c.generation++
 
 }
 
@@ -66,6 +84,9 @@ func (c *cache) clearAll() {
 //
 // Pages are normally accessed, e.g. in a template, using one of the sorting
 // "By*" methods, which remove unlisted pages.
+//
+// A Pageset is safe for concurrent use.  Slices returned by the sorting
+// methods are shared with other callers and must not be modified.
 type Pageset struct {
 
 	// We keep a map of extension-stripped Paths to Pages, but don't allow it
@@ -74,6 +95,24 @@ type Pageset struct {
 
 	// We cache aggressively, as it's only lists of pointers:
 	cache *cache
+
+	// The mutex guards the pageMap and the cache.  Pages are never loaded
+	// or parsed while it is held, so readers are not blocked by a slow
+	// reparse; instead, fresh Pages are swapped in whole.
+	mutex sync.RWMutex
+
+	// The searchMutex lets only one goroutine at a time build the search
+	// index, which it does without holding the mutex.
+	searchMutex sync.Mutex
+
+	// The Registry loads new Pages in RefreshPage; if nil, the page
+	// package's defaults are used.
+	Registry *page.Registry
+
+	// Loader, if set, loads all Pages in RefreshPage, new and changed, in
+	// place of the Registry and the Pages' own Parsers, e.g. to check them
+	// as well.  The Registry still finds the new Pages' extensions.
+	Loader func(path string) (*page.Page, error)
 }
 
 // New creates a Pageset with the provided slice of Pages.  Each Page must
@@ -102,14 +141,35 @@ func New(pages []*page.Page) (*Pageset, error) {
 // Len returns the number of Pages in the Pageset.  Note that this includes
 // Unlisted Pages.
 func (ps *Pageset) Len() int {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
 	return len(ps.pageMap)
 }
 
 // Page returns the Page at the given path key, or nil if none is defined.
 func (ps *Pageset) Page(key string) *page.Page {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
 	return ps.pageMap[key]
 }
 
+// Pages returns all the Pages in the Pageset, including Unlisted Pages, in
+// Path order.  Unlike the sorting methods' results, the slice is not cached.
+func (ps *Pageset) Pages() []*page.Page {
+
+	ps.mutex.RLock()
+	pages := make([]*page.Page, 0, len(ps.pageMap))
+	for _, p := range ps.pageMap {
+		pages = append(pages, p)
+	}
+	ps.mutex.RUnlock()
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].Path < pages[j].Path
+	})
+	return pages
+
+}
+
 // AddPage adds a Page to the Pageset, and clears the sorting and subset
 // caches.  If a Page for the Page's Path exists in the Pageset it is
 // replaced.
@@ -118,8 +178,10 @@ func (ps *Pageset) AddPage(p *page.Page) {
 	// TODO: selective unCache if we are replacing by path.
 	// unCacheNonPath?  Or what? uncache(all bool)
 	key := strings.TrimSuffix(p.Path, filepath.Ext(p.Path))
+	ps.mutex.Lock()
 	ps.pageMap[key] = p
 	ps.cache.clearAll()
+	ps.mutex.Unlock()
 
 }
 
@@ -127,33 +189,41 @@ func (ps *Pageset) AddPage(p *page.Page) {
 // Pageset, and clears the sorting and subset caches.
 func (ps *Pageset) RemovePage(key string) {
 
+	ps.mutex.Lock()
 	delete(ps.pageMap, key)
 	ps.cache.clearAll()
+	ps.mutex.Unlock()
 
 }
 
 // RefreshPage refreshes a Page at the given path key, by reloading it,
 // loading it into the Pageset, or removing it if it is no longer on disk.
 // If the page is not found or any filesystem or parse error occurs, the
-// error is returned; nil is returned on success.
+// error is returned; nil is returned on success.  Existing Pages are reloaded
+// with their own Parsers, and new ones are loaded with the Pageset's
+// Registry, unless the Pageset has a Loader.
+//
+// Pages are never modified in place: a changed Page is replaced by a fresh
+// copy, so any Page already handed out to a reader remains consistent.
+// Loading happens without holding the Pageset's lock, and if another
+// goroutine changes the Page at the key in the meantime, its result wins.
 func (ps *Pageset) RefreshPage(key string) error {
 
 	// Refresh the page if it exists, removing it from the Pageset on error.
 	if p := ps.Page(key); p != nil {
-		oldModTime := p.ModTime
-		if err := p.Refresh(); err != nil {
-			delete(ps.pageMap, key)
-			ps.cache.clearAll()
+		fresh, err := ps.reloaded(p)
+		if err != nil {
+			ps.swapPage(key, p, nil)
 
 			if !isReallyNotExist(err) {
 				// A parse error, or similar, occurred.
 				return err
 			}
 		} else {
-			if p.ModTime != oldModTime {
-				ps.cache.clearAll()
+			if fresh != p {
+				ps.swapPage(key, p, fresh)
 			}
-			return err
+			return nil
 		}
 
 	}
@@ -161,10 +231,15 @@ func (ps *Pageset) RefreshPage(key string) error {
 	// If we don't (any longer) have it, let's try to get it.
 	// (It's a supported, if obscure, use-case to delete foo.md and have
 	// foo.txt loaded in its place.)
-	p, err := page.LoadAny(key)
+	var p *page.Page
+	var err error
+	if ps.Loader != nil {
+		p, err = ps.Registry.LoadAnyWith(key, ps.Loader)
+	} else {
+		p, err = ps.Registry.LoadAny(key)
+	}
 	if err == nil {
-		ps.pageMap[key] = p
-		ps.cache.clearAll()
+		ps.swapPage(key, nil, p)
 		return nil
 	} else if isReallyNotExist(err) {
 		return os.ErrNotExist
@@ -174,6 +249,44 @@ func (ps *Pageset) RefreshPage(key string) error {
 
 }
 
+// reloaded returns the Page as per its Reloaded method, but loaded with the
+// Loader if the Pageset has one.
+func (ps *Pageset) reloaded(p *page.Page) (*page.Page, error) {
+
+	if ps.Loader == nil {
+		return p.Reloaded()
+	}
+	changed, err := p.Changed()
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return p, nil
+	}
+	return ps.Loader(p.Path)
+
+}
+
+// swapPage replaces the Page at key with the fresh one, or removes it if
+// fresh is nil, but only if the current Page is still the old one; thus
+// concurrent refreshes of the same key can not undo each other's work.
+func (ps *Pageset) swapPage(key string, old, fresh *page.Page) {
+
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if ps.pageMap[key] != old {
+		return
+	}
+	if fresh == nil {
+		delete(ps.pageMap, key)
+	} else {
+		ps.pageMap[key] = fresh
+	}
+	ps.cache.clearAll()
+
+}
+
 // ...for when IsNotExist isn't enough:
 func isReallyNotExist(err error) bool {
 
@@ -186,6 +299,8 @@ func isReallyNotExist(err error) bool {
 	return false
 }
 
+// listedPages returns the cached listed Pages, building the cache if
+// necessary; the caller must hold the write lock.
 func (ps *Pageset) listedPages() []*page.Page {
 
 	if len(ps.cache.listed) == 0 {
@@ -209,7 +324,16 @@ func (ps *Pageset) listedPages() []*page.Page {
 // Unlisted pages are ignored. The result is cached for future use.
 func (ps *Pageset) Tags() []string {
 
-	if len(ps.cache.tags) == 0 {
+	ps.mutex.RLock()
+	tags := ps.cache.tags
+	ps.mutex.RUnlock()
+	if tags != nil {
+		return tags
+	}
+
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if ps.cache.tags == nil {
 		have := map[string]bool{}
 		tags := []string{}
 		pages := ps.listedPages()
@@ -234,7 +358,11 @@ func (ps *Pageset) Tags() []string {
 // not marked Unlisted.
 func (ps *Pageset) ListedSubset() *Pageset {
 
-	subset, err := New(ps.listedPages())
+	ps.mutex.Lock()
+	listed := ps.listedPages()
+	ps.mutex.Unlock()
+
+	subset, err := New(listed)
 	if err != nil {
 		// This can only be programmer error, since you should not be able
 		// to get contradictory pages into the same pageset using the
@@ -251,6 +379,15 @@ func (ps *Pageset) ListedSubset() *Pageset {
 func (ps *Pageset) TagSubset(tag string) *Pageset {
 
 	tag = strings.ToLower(tag)
+	ps.mutex.RLock()
+	subset := ps.cache.tagSubsets[tag]
+	ps.mutex.RUnlock()
+	if subset != nil {
+		return subset
+	}
+
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
 	if subset := ps.cache.tagSubsets[tag]; subset != nil {
 		return subset
 	}
@@ -290,6 +427,15 @@ func (ps *Pageset) PathSubset(prefix, trim string) *Pageset {
 	// We need an equatable thing for our key, apparently; not []string.
 	// So maybe just this...
 	key := trim + "\n" + prefix
+	ps.mutex.RLock()
+	subset := ps.cache.pathSubsets[key]
+	ps.mutex.RUnlock()
+	if subset != nil {
+		return subset
+	}
+
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
 	if subset := ps.cache.pathSubsets[key]; subset != nil {
 		return subset
 	}
@@ -383,17 +529,24 @@ func (s byPath) Less(i, j int) bool {
 // Unlisted Pages are excluded.  The result is cached for future use.
 func (ps *Pageset) ByPath() []*page.Page {
 
-	if ps.cache.byPath != nil {
-		return ps.cache.byPath
+	ps.mutex.RLock()
+	cached := ps.cache.byPath
+	ps.mutex.RUnlock()
+	if cached != nil {
+		return cached
 	}
 
-	listed := ps.listedPages()
-	pages := make([]*page.Page, len(listed))
-	copy(pages, listed)
-	sort.Sort(byPath(pages))
-	ps.cache.byPath = pages
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if ps.cache.byPath == nil {
+		listed := ps.listedPages()
+		pages := make([]*page.Page, len(listed))
+		copy(pages, listed)
+		sort.Sort(byPath(pages))
+		ps.cache.byPath = pages
+	}
 
-	return pages
+	return ps.cache.byPath
 }
 
 // SORT BY TIME: CREATED (FALLBACK: FILE MOD TIME; TIEBREAKER: PATH)
@@ -433,17 +586,24 @@ func (s byCreated) Less(i, j int) bool {
 // future use.
 func (ps *Pageset) ByCreated() []*page.Page {
 
-	if ps.cache.byCreated != nil {
-		return ps.cache.byCreated
+	ps.mutex.RLock()
+	cached := ps.cache.byCreated
+	ps.mutex.RUnlock()
+	if cached != nil {
+		return cached
 	}
 
-	listed := ps.listedPages()
-	pages := make([]*page.Page, len(listed))
-	copy(pages, listed)
-	sort.Sort(byCreated(pages))
-	ps.cache.byCreated = pages
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if ps.cache.byCreated == nil {
+		listed := ps.listedPages()
+		pages := make([]*page.Page, len(listed))
+		copy(pages, listed)
+		sort.Sort(byCreated(pages))
+		ps.cache.byCreated = pages
+	}
 
-	return pages
+	return ps.cache.byCreated
 }
 
 // SORT BY TIME: MOD TIME (TIEBREAKER: PATH)
@@ -476,17 +636,24 @@ func (s byModTime) Less(i, j int) bool {
 // secondary sort key is the Path.
 func (ps *Pageset) ByModTime() []*page.Page {
 
-	if ps.cache.byModTime != nil {
-		return ps.cache.byModTime
+	ps.mutex.RLock()
+	cached := ps.cache.byModTime
+	ps.mutex.RUnlock()
+	if cached != nil {
+		return cached
 	}
 
-	listed := ps.listedPages()
-	pages := make([]*page.Page, len(listed))
-	copy(pages, listed)
-	sort.Sort(byModTime(pages))
-	ps.cache.byModTime = pages
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if ps.cache.byModTime == nil {
+		listed := ps.listedPages()
+		pages := make([]*page.Page, len(listed))
+		copy(pages, listed)
+		sort.Sort(byModTime(pages))
+		ps.cache.byModTime = pages
+	}
 
-	return pages
+	return ps.cache.byModTime
 
 }
 
@@ -521,17 +688,24 @@ func (s byTime) Less(i, j int) bool {
 // sort key is the Path.
 func (ps *Pageset) ByTime() []*page.Page {
 
-	if ps.cache.byTime != nil {
-		return ps.cache.byTime
+	ps.mutex.RLock()
+	cached := ps.cache.byTime
+	ps.mutex.RUnlock()
+	if cached != nil {
+		return cached
 	}
 
-	listed := ps.listedPages()
-	pages := make([]*page.Page, len(listed))
-	copy(pages, listed)
-	sort.Sort(byTime(pages))
-	ps.cache.byTime = pages
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if ps.cache.byTime == nil {
+		listed := ps.listedPages()
+		pages := make([]*page.Page, len(listed))
+		copy(pages, listed)
+		sort.Sort(byTime(pages))
+		ps.cache.byTime = pages
+	}
 
-	return pages
+	return ps.cache.byTime
 
 }
 
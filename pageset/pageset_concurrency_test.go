@@ -0,0 +1,223 @@
+// pageset/pageset_concurrency_test.go - concurrency tests for Pagesets
+// -----------------------------------
+// These are most useful with the race detector: go test -race
+
+package pageset_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/biztos/kisipar/page"
+	"github.com/biztos/kisipar/pageset"
+)
+
+const stressLoops = 200
+
+// readAll exercises every read and cached method of the Pageset, including
+// the contents of the returned Pages.
+func readAll(ps *pageset.Pageset) {
+
+	ps.Len()
+	ps.Page("/a/p0")
+	for _, p := range ps.ByPath() {
+		_ = p.Title()
+		_ = p.Content
+	}
+	for _, p := range ps.ByTime() {
+		_ = p.Tags()
+	}
+	ps.ByCreated()
+	ps.ByModTime()
+	ps.Tags()
+	ps.TagSubset("even").ByPath()
+	ps.PathSubset("/a/", "").ByTime()
+	ps.ListedSubset().Len()
+	for _, r := range ps.Search("p*") {
+		_ = r.Page.Title()
+	}
+}
+
+func Test_Concurrency_AddRemove(t *testing.T) {
+
+	assert := assert.New(t)
+
+	ps, err := pageset.New([]*page.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < stressLoops; i++ {
+				path := fmt.Sprintf("/a/p%d.md", i%10)
+				src := fmt.Sprintf("# Page %d\n\n    Tags: [even]\n", i)
+				p, err := page.LoadVirtualString(path, src)
+				if err != nil {
+					panic(err)
+				}
+				if w%2 == 0 {
+					ps.AddPage(p)
+				} else {
+					ps.RemovePage(fmt.Sprintf("/a/p%d", i%10))
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < stressLoops; i++ {
+				readAll(ps)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.True(ps.Len() <= 10, "no more than ten pages in the set")
+	assert.Equal(len(ps.ByPath()), ps.Len(), "sorted set is consistent")
+
+}
+
+func Test_Concurrency_RefreshPage(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "kisipar-pageset-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keys := make([]string, 5)
+	pages := make([]*page.Page, 5)
+	for i := range keys {
+		keys[i] = filepath.Join(dir, fmt.Sprintf("p%d", i))
+		path := keys[i] + ".md"
+		src := []byte(fmt.Sprintf("# Page %d\n", i))
+		if err := ioutil.WriteFile(path, src, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if pages[i], err = page.Load(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ps, err := pageset.New(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < stressLoops; i++ {
+			path := keys[i%len(keys)] + ".md"
+			src := []byte(fmt.Sprintf("# Page %d\n\n    Tags: [even]\n", i))
+			if err := ioutil.WriteFile(path, src, os.ModePerm); err != nil {
+				panic(err)
+			}
+			// Mod times are not always granular enough to notice:
+			mtime := time.Now().Add(time.Duration(i) * time.Second)
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				panic(err)
+			}
+		}
+	}()
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := 0; i < stressLoops; i++ {
+				// Parse errors are possible on partially-written files.
+				ps.RefreshPage(keys[(i+r)%len(keys)])
+				readAll(ps)
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	// Now that things are quiet, everything should refresh cleanly.
+	for _, key := range keys {
+		assert.Nil(ps.RefreshPage(key), "no error on final refresh")
+	}
+	assert.Equal(len(keys), ps.Len(), "all pages in the set")
+
+}
+
+// A blockingParser waits for its release channel to be closed before
+// parsing, simulating a very slow parse.
+type blockingParser struct {
+	started chan bool
+	release chan bool
+}
+
+func (bp *blockingParser) Parse(b []byte) (page.ParseResult, error) {
+	bp.started <- true
+	<-bp.release
+	return (&page.VerbatimParser{}).Parse(b)
+}
+
+func Test_Concurrency_RefreshDoesNotBlockReaders(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "kisipar-pageset-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := filepath.Join(dir, "slow")
+	if err := ioutil.WriteFile(key+".slow", []byte("slow"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	bp := &blockingParser{
+		started: make(chan bool, 1),
+		release: make(chan bool),
+	}
+	orig := page.ExtParsers
+	defer func() { page.ExtParsers = orig }()
+	page.ExtParsers = append([]*page.ExtParser{{Ext: ".slow", Parser: bp}}, orig...)
+
+	p1, _ := page.LoadVirtualString("/a/p0.md", "# First!")
+	ps, err := pageset.New([]*page.Page{p1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- ps.RefreshPage(key) }()
+	<-bp.started
+
+	// The parse is stuck, but reads must not be:
+	read := make(chan bool)
+	go func() {
+		readAll(ps)
+		read <- true
+	}()
+	select {
+	case <-read:
+	case <-time.After(5 * time.Second):
+		t.Fatal("readers blocked by slow parse")
+	}
+	assert.Nil(ps.Page(key), "slow page not yet in the set")
+
+	close(bp.release)
+	assert.Nil(<-done, "no error from slow refresh")
+	if assert.NotNil(ps.Page(key), "slow page now in the set") {
+		assert.Equal("slow", string(ps.Page(key).Content), "content parsed")
+	}
+
+}
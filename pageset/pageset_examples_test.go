@@ -34,7 +34,7 @@ func Example() {
 	// 2 First!
 }
 
-func ExamplePageset_Subset() {
+func ExamplePageset_PathSubset() {
 
 	// Given a Pageset:
 	p1, _ := page.LoadVirtualString("my/pages/here/a.md", "# First!")
@@ -128,6 +128,23 @@ func Test_Page_Found(t *testing.T) {
 
 }
 
+func Test_Pages(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p1, _ := page.LoadVirtualString("/b.md", "# Second!")
+	p2, _ := page.LoadVirtualString("/a.md", "# First!")
+	p2.Unlisted = true
+
+	ps, err := pageset.New([]*page.Page{p1, p2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal([]*page.Page{p2, p1}, ps.Pages(),
+		"all pages in Path order")
+
+}
+
 func Test_AddPage(t *testing.T) {
 
 	assert := assert.New(t)
@@ -344,9 +361,14 @@ Here!
 		t.Fatal(err)
 	}
 
-	// Refresh should work.
+	// Refresh should work, replacing the page.
 	err = ps.RefreshPage(key)
 	assert.Nil(err, "no error refreshing a stale")
+	assert.Equal([]byte(input), p.Source, "original page not modified")
+	p = ps.Page(key)
+	if !assert.NotNil(p, "page for key after refresh") {
+		t.FailNow()
+	}
 
 	expMeta := map[string]interface{}{
 		"Title":  "Fresher",
@@ -440,6 +462,90 @@ func Test_RefreshPage_LoadNew(t *testing.T) {
 
 }
 
+func Test_RefreshPage_LoadNewWithRegistry(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, derr := ioutil.TempDir("", "kisipar-page-test-")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	defer os.RemoveAll(dir)
+
+	key := filepath.Join(dir, "a-page")
+	for _, ext := range []string{".md", ".txt"} {
+		input := []byte("# Test page " + ext)
+		if err := ioutil.WriteFile(key+ext, input, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only .txt is in the registry.
+	ps, err := pageset.New([]*page.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.Registry = page.NewRegistry([]string{".txt"})
+
+	err = ps.RefreshPage(key)
+	assert.Nil(err, "no error returned")
+	p := ps.Page(key)
+	if assert.NotNil(p, "page returned for key after refresh") {
+		assert.Equal("Test page .txt", p.Title(), "page from registry")
+		assert.Equal(page.ExtParsers[4].Parser, p.Parser, "parser set")
+	}
+
+}
+
+func Test_RefreshPage_Loader(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, derr := ioutil.TempDir("", "kisipar-page-test-")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	defer os.RemoveAll(dir)
+
+	key := filepath.Join(dir, "a-page")
+	path := key + ".md"
+	if err := ioutil.WriteFile(path, []byte("# Test page"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// The Loader loads new and changed pages, and may reject them.
+	ps, err := pageset.New([]*page.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := []string{}
+	ps.Loader = func(path string) (*page.Page, error) {
+		loaded = append(loaded, path)
+		p, err := page.Load(path)
+		if err == nil && p.Title() == "Bad page" {
+			return nil, fmt.Errorf("bad page")
+		}
+		return p, err
+	}
+
+	assert.Nil(ps.RefreshPage(key), "no error loading new page")
+	assert.NotNil(ps.Page(key), "new page loaded")
+	assert.Nil(ps.RefreshPage(key), "no error for unchanged page")
+	assert.Equal([]string{path}, loaded, "unchanged page not loaded")
+
+	if err := ioutil.WriteFile(path, []byte("# Bad page"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	assert.EqualError(ps.RefreshPage(key), "bad page", "error from Loader")
+	assert.Equal([]string{path, path}, loaded, "changed page loaded")
+	assert.Nil(ps.Page(key), "rejected page removed")
+
+}
+
 func Test_RefreshPage_LoadReplacement(t *testing.T) {
 
 	assert := assert.New(t)
@@ -1201,3 +1307,22 @@ func Test_Tags(t *testing.T) {
 	assert.Equal(exp, ps.Tags(), "cached tags as expected")
 
 }
+
+func Test_Tags_None(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p, _ := page.LoadVirtualString("/a.md", "# 1")
+	ps, err := pageset.New([]*page.Page{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal([]string{}, ps.Tags(), "empty tags")
+
+	// The empty list is cached too, so a change behind the Pageset's back
+	// goes unnoticed.
+	p.Meta["Tags"] = []interface{}{"foo"}
+	assert.Equal([]string{}, ps.Tags(), "cached empty tags")
+
+}
@@ -0,0 +1,327 @@
+// pageset/search.go - full-text search of the Pageset.
+// -----------------
+
+package pageset
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/biztos/kisipar/page"
+)
+
+// The searchable fields of a Page, and the relative weights of their matches:
+const (
+	fieldTitle = iota
+	fieldTags
+	fieldDescription
+	fieldContent
+	numFields
+)
+
+var fieldWeights = [numFields]float64{8, 4, 2, 1}
+
+// A SearchResult is a Page matching a search query, with its Score: the
+// higher, the more relevant.
+type SearchResult struct {
+	Page  *page.Page
+	Score float64
+}
+
+// A searchDoc holds the tokens of each field of a Page.
+type searchDoc struct {
+	page   *page.Page
+	fields [numFields][]string
+}
+
+// A posting lists the positions of a term in one field of one document.
+type posting struct {
+	doc       int
+	field     int
+	positions []int
+}
+
+// A searchIndex is an inverted index of terms to postings.  The vocabulary
+// is sorted, for prefix matching.
+type searchIndex struct {
+	docs  []*searchDoc
+	terms map[string][]*posting
+	vocab []string
+}
+
+// Search returns the Pages matching the query, best match first; ties are
+// broken by Path.  Unlisted Pages are excluded.
+//
+// The Page titles, tags, descriptions and content (without HTML markup) are
+// searched, in that order of relevance.  Every word in the query must
+// match, ignoring case and punctuation.  A word ending in "*" matches as a
+// prefix, and words in double quotes match only as a phrase:
+//
+//	kisipar templates
+//	"static export"
+//	temp*
+//
+// The index is built on first use, and rebuilt after the Pageset changes;
+// only Pages that have changed are reprocessed.
+func (ps *Pageset) Search(query string) []*SearchResult {
+
+	terms := parseQuery(query)
+	if len(terms) == 0 {
+		return []*SearchResult{}
+	}
+	idx := ps.searchIndex()
+
+	scores := map[int]float64{}
+	for i, t := range terms {
+		matched := idx.match(t)
+		if i == 0 {
+			scores = matched
+			continue
+		}
+		for doc := range scores {
+			if score, ok := matched[doc]; ok {
+				scores[doc] += score
+			} else {
+				delete(scores, doc)
+			}
+		}
+	}
+
+	results := make([]*SearchResult, 0, len(scores))
+	for doc, score := range scores {
+		results = append(results, &SearchResult{
+			Page:  idx.docs[doc].page,
+			Score: score,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Page.Path < results[j].Page.Path
+	})
+	return results
+
+}
+
+// searchIndex returns the cached index, building it if necessary.  The
+// index is built without holding the lock, so that readers are not blocked,
+// and only cached if the Pageset has not changed in the meantime.
+func (ps *Pageset) searchIndex() *searchIndex {
+
+	ps.mutex.RLock()
+	idx := ps.cache.search
+	ps.mutex.RUnlock()
+	if idx != nil {
+		return idx
+	}
+
+	ps.searchMutex.Lock()
+	defer ps.searchMutex.Unlock()
+	ps.mutex.Lock()
+	if ps.cache.search != nil {
+		idx = ps.cache.search
+		ps.mutex.Unlock()
+		return idx
+	}
+	pages := append([]*page.Page{}, ps.listedPages()...)
+	oldDocs := ps.cache.searchDocs
+	generation := ps.cache.generation
+	ps.mutex.Unlock()
+
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].Path < pages[j].Path
+	})
+
+	// Pages are replaced, not changed, so their documents can be reused.
+	// The maps are never changed once cached, so they are safe to read.
+	docs := map[*page.Page]*searchDoc{}
+	idx = &searchIndex{terms: map[string][]*posting{}}
+	for i, p := range pages {
+		doc := oldDocs[p]
+		if doc == nil {
+			doc = newSearchDoc(p)
+		}
+		docs[p] = doc
+		idx.docs = append(idx.docs, doc)
+		for f, tokens := range doc.fields {
+			positions := map[string][]int{}
+			for pos, tok := range tokens {
+				positions[tok] = append(positions[tok], pos)
+			}
+			for term, pp := range positions {
+				idx.terms[term] = append(idx.terms[term],
+					&posting{doc: i, field: f, positions: pp})
+			}
+		}
+	}
+	for term := range idx.terms {
+		idx.vocab = append(idx.vocab, term)
+	}
+	sort.Strings(idx.vocab)
+
+	ps.mutex.Lock()
+	if ps.cache.generation == generation {
+		ps.cache.searchDocs = docs
+		ps.cache.search = idx
+	}
+	ps.mutex.Unlock()
+	return idx
+
+}
+
+func newSearchDoc(p *page.Page) *searchDoc {
+
+	doc := &searchDoc{page: p}
+	doc.fields[fieldTitle] = tokenize(p.Title())
+	doc.fields[fieldTags] = tokenize(strings.Join(p.Tags(), " "))
+	doc.fields[fieldDescription] = tokenize(p.Description())
+	doc.fields[fieldContent] = tokenize(stripHTML(string(p.Content)))
+	return doc
+
+}
+
+// A queryTerm is a single word or a phrase, the last word of which may be
+// a prefix.
+type queryTerm struct {
+	words  []string
+	prefix bool
+}
+
+// parseQuery splits the query into terms: quoted phrases, and words.  Words
+// that tokenize to more than one token, e.g. "foo-bar", are phrases too.
+func parseQuery(query string) []*queryTerm {
+
+	terms := []*queryTerm{}
+	add := func(s string) {
+		prefix := strings.HasSuffix(s, "*")
+		if words := tokenize(s); len(words) > 0 {
+			terms = append(terms, &queryTerm{words: words, prefix: prefix})
+		}
+	}
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			add(part)
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			add(word)
+		}
+	}
+	return terms
+
+}
+
+// expand returns the indexed terms matching the word.
+func (idx *searchIndex) expand(word string, prefix bool) []string {
+
+	if !prefix {
+		return []string{word}
+	}
+	terms := []string{}
+	i := sort.SearchStrings(idx.vocab, word)
+	for ; i < len(idx.vocab) && strings.HasPrefix(idx.vocab[i], word); i++ {
+		terms = append(terms, idx.vocab[i])
+	}
+	return terms
+
+}
+
+// match returns the scores of the documents matching the term.  Each field
+// scores its weight times a dampened count of the matches, and the total
+// is weighted by the rarity of the term across documents.
+func (idx *searchIndex) match(t *queryTerm) map[int]float64 {
+
+	// Positions of each word, by document and field.
+	type key struct{ doc, field int }
+	last := len(t.words) - 1
+	wordPositions := make([]map[key]map[int]bool, len(t.words))
+	for i, word := range t.words {
+		wordPositions[i] = map[key]map[int]bool{}
+		for _, term := range idx.expand(word, t.prefix && i == last) {
+			for _, p := range idx.terms[term] {
+				k := key{p.doc, p.field}
+				if wordPositions[i][k] == nil {
+					wordPositions[i][k] = map[int]bool{}
+				}
+				for _, pos := range p.positions {
+					wordPositions[i][k][pos] = true
+				}
+			}
+		}
+	}
+
+	// Phrases must have each word follow the one before.
+	scores := map[int]float64{}
+	for k, starts := range wordPositions[0] {
+		count := 0
+		for pos := range starts {
+			found := true
+			for i := 1; i <= last && found; i++ {
+				found = wordPositions[i][k][pos+i]
+			}
+			if found {
+				count++
+			}
+		}
+		if count > 0 {
+			scores[k.doc] += fieldWeights[k.field] * (1 + math.Log(float64(count)))
+		}
+	}
+
+	idf := math.Log(1 + float64(len(idx.docs))/float64(len(scores)))
+	for doc := range scores {
+		scores[doc] *= idf
+	}
+	return scores
+
+}
+
+// tokenize splits the string into lowercase words of letters and digits.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// stripHTML returns the text of the HTML fragment, without tags, scripts or
+// styles, and with entities unescaped.
+func stripHTML(s string) string {
+
+	var b strings.Builder
+	skip := ""
+	for {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			if skip == "" {
+				b.WriteString(s)
+			}
+			break
+		}
+		if skip == "" {
+			b.WriteString(s[:i])
+		}
+		j := strings.IndexByte(s[i:], '>')
+		if j < 0 {
+			break
+		}
+		tag := strings.ToLower(s[i+1 : i+j])
+		name := strings.FieldsFunc(tag, func(r rune) bool {
+			return unicode.IsSpace(r) || r == '/'
+		})
+		if skip == "" && len(name) > 0 && !strings.HasPrefix(tag, "/") &&
+			(name[0] == "script" || name[0] == "style") {
+			skip = name[0]
+		} else if skip != "" && strings.HasPrefix(tag, "/") &&
+			len(name) > 0 && name[0] == skip {
+			skip = ""
+		}
+		b.WriteByte(' ')
+		s = s[i+j+1:]
+	}
+	return html.UnescapeString(b.String())
+
+}
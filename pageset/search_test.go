@@ -0,0 +1,174 @@
+// pageset/search_test.go - tests for Pageset full-text search
+// ----------------------
+
+package pageset_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/biztos/kisipar/page"
+	"github.com/biztos/kisipar/pageset"
+)
+
+// searchPaths returns the Paths of the Pages in the results.
+func searchPaths(results []*pageset.SearchResult) []string {
+	paths := make([]string, len(results))
+	for i, r := range results {
+		paths[i] = r.Page.Path
+	}
+	return paths
+}
+
+func searchPageset(t *testing.T) *pageset.Pageset {
+
+	sources := map[string]string{
+		"/gardening.md": `# Gardening Tips
+
+    Tags: [outdoors, plants]
+    Description: Growing tomatoes at home.
+
+Water your <em>tomato</em> plants early in the morning.`,
+		"/cooking.md": `# Cooking
+
+    Tags: [kitchen]
+
+A simple tomato sauce needs garlic, olive oil and tomatoes.
+
+<script>var secret = "gardening";</script>`,
+		"/hidden.md": `# Secret Tomato Garden
+
+    Unlisted: true
+
+Tomatoes everywhere.`,
+		"/weather.md": `# Weather
+
+Early morning fog, then sun &amp; rain: good for cooking indoors.`,
+	}
+	pages := []*page.Page{}
+	for path, src := range sources {
+		p, err := page.LoadVirtualString(path, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, p)
+	}
+	ps, err := pageset.New(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ps
+
+}
+
+func Test_Search(t *testing.T) {
+
+	assert := assert.New(t)
+
+	ps := searchPageset(t)
+
+	assert.Empty(ps.Search(""), "empty query finds nothing")
+	assert.Empty(ps.Search("  ?! "), "punctuation finds nothing")
+	assert.Empty(ps.Search("nonesuch"), "no match finds nothing")
+
+	assert.Equal([]string{"/cooking.md", "/gardening.md"},
+		searchPaths(ps.Search("tomato")),
+		"content matches, best first, unlisted excluded")
+	assert.Equal([]string{"/gardening.md"},
+		searchPaths(ps.Search("TOMATO Plants")),
+		"all words must match, case ignored")
+	assert.Equal([]string{"/gardening.md", "/cooking.md"},
+		searchPaths(ps.Search("tomatoes")),
+		"description beats content")
+	assert.Equal([]string{"/cooking.md"}, searchPaths(ps.Search("kitchen")),
+		"tags searched")
+	assert.Equal([]string{"/weather.md"}, searchPaths(ps.Search("sun & rain")),
+		"entities unescaped")
+	assert.Empty(ps.Search("em"), "markup not searched")
+	assert.Empty(ps.Search("secret"), "scripts not searched")
+
+}
+
+func Test_Search_Ranking(t *testing.T) {
+
+	assert := assert.New(t)
+
+	ps := searchPageset(t)
+
+	results := ps.Search("gardening")
+	if assert.Equal(1, len(results), "one result") {
+		assert.True(results[0].Score > 0, "score is positive")
+	}
+
+	assert.Equal([]string{"/cooking.md", "/weather.md"},
+		searchPaths(ps.Search("cooking")), "title beats content")
+	assert.Equal([]string{"/gardening.md", "/weather.md"},
+		searchPaths(ps.Search("early")), "ties broken by path")
+
+}
+
+func Test_Search_Phrase(t *testing.T) {
+
+	assert := assert.New(t)
+
+	ps := searchPageset(t)
+
+	assert.Equal([]string{"/weather.md"},
+		searchPaths(ps.Search(`"early morning"`)), "phrase matched")
+	assert.Equal([]string{"/gardening.md"},
+		searchPaths(ps.Search(`"in the morning"`)), "longer phrase matched")
+	assert.Empty(ps.Search(`"morning early"`), "phrase order matters")
+	assert.Equal([]string{"/cooking.md"},
+		searchPaths(ps.Search("olive-oil")), "hyphenated words are a phrase")
+	assert.Equal([]string{"/cooking.md"},
+		searchPaths(ps.Search(`"olive o*" garlic`)),
+		"phrase prefix with another word")
+
+}
+
+func Test_Search_Prefix(t *testing.T) {
+
+	assert := assert.New(t)
+
+	ps := searchPageset(t)
+
+	assert.Equal([]string{"/gardening.md", "/cooking.md"},
+		searchPaths(ps.Search("tom*")), "prefix matched, all forms count")
+	assert.Equal([]string{"/gardening.md"},
+		searchPaths(ps.Search("garden*")), "prefix matched in title")
+	assert.Empty(ps.Search("zz*"), "prefix beyond vocabulary")
+	assert.Empty(ps.Search("tom"), "no prefix without star")
+
+}
+
+func Test_Search_Updates(t *testing.T) {
+
+	assert := assert.New(t)
+
+	ps := searchPageset(t)
+	assert.Empty(ps.Search("pancakes"), "no pancakes yet")
+
+	p, err := page.LoadVirtualString("/breakfast.md", "# Pancakes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.AddPage(p)
+	assert.Equal([]string{"/breakfast.md"},
+		searchPaths(ps.Search("pancakes")), "added page found")
+
+	fresh, err := page.LoadVirtualString("/breakfast.md", "# Waffles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.AddPage(fresh)
+	assert.Empty(ps.Search("pancakes"), "replaced page content gone")
+	assert.Equal([]string{"/breakfast.md"},
+		searchPaths(ps.Search("waffles")), "replaced page found")
+
+	ps.RemovePage("/breakfast")
+	assert.Empty(ps.Search("waffles"), "removed page gone")
+	assert.Equal([]string{"/cooking.md", "/gardening.md"},
+		searchPaths(ps.Search("tomato")), "others still found")
+
+}
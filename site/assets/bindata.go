@@ -1,6 +1,7 @@
 // Code generated by go-bindata.
 // sources:
 // data/demosite/templates/default.html
+// data/demosite/templates/error.html
 // DO NOT EDIT!
 
 package assets
@@ -88,6 +89,26 @@ func demositeTemplatesDefaultHtml() (*asset, error) {
 	return a, nil
 }
 
+var _demositeTemplatesErrorHtml = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x84\x52\x41\x6e\x83\x30\x10\xbc\xe7\x15\x5b\x7a\x85\x90\x5c\x7a\x20\x4e\x6e\x55\x7b\x69\x2e\xed\x07\x5c\x58\x62\x4b\xc6\xb6\xec\x4d\x01\x21\xfe\x5e\x19\xda\x12\x44\x9a\xc8\x48\xe0\xd9\x99\x1d\x2f\x1e\xf6\x50\x98\x9c\x5a\x8b\x20\xa8\x52\x87\x15\x1b\x5f\x00\x00\x4c\x20\x2f\xc6\xcf\xb0\x18\x49\x52\x78\xe8\x3a\x58\xbf\x13\xa7\xb3\x87\xbe\x87\x69\xf7\x81\x0d\x05\x24\x19\x31\x49\xb8\x3e\xf2\x0a\xa1\xef\x59\x3a\x2a\xa7\x4e\x9e\x5a\x85\x10\x5c\xf7\x11\x61\x43\x69\xee\x7d\x34\xd5\xc3\xfa\x34\x45\x0b\xdd\x0c\x0a\x4f\x69\x34\x25\x25\xaf\xa4\x6a\x33\x78\x41\xe3\x4e\x92\xc7\xe0\xd1\xc9\x72\xb7\x20\x87\xd6\x09\x57\xf2\xa4\x33\xc8\x51\x13\xba\x39\xa7\x9f\xed\xc4\xf6\x9e\x5f\xf4\x8a\xea\x0b\x49\xe6\x1c\x8e\x78\xc6\x28\x86\x3f\x20\x06\xcf\xb5\x4f\xae\x1c\x64\x6e\xf2\xf8\xec\x9c\x71\x57\x8c\x6a\x59\x90\xc8\xe0\x69\xb3\xb1\xcd\xed\x49\x14\x96\xb4\x64\x54\xdc\x9d\xa4\xce\x60\x63\x1b\xe0\x67\x32\xbb\xdb\xa3\xbc\xa1\x56\x26\x86\xca\x68\xe3\x2d\xcf\x71\x49\xcf\x8d\x32\x2e\x03\x87\xc5\xb2\x56\x0b\x49\x98\x0c\xc2\x0c\xac\xc3\xa4\x76\xdc\xfe\x37\x36\x4b\x87\xeb\xfe\xc9\x54\x3a\x85\x8a\x85\x3b\xbe\x48\x85\xd8\xde\x0b\x17\x4b\xc5\x76\x12\x74\x1d\xd4\x92\x04\xac\xc7\x7f\xda\x5f\x58\x5a\x87\x20\x8b\x7d\x34\x54\xa2\xa1\xed\x10\x44\xeb\x2e\x62\xd8\x75\x80\xba\xf8\xd5\xb1\x74\x3c\x0e\x4b\x05\x55\xea\xb0\xfa\x1e\x00\xb3\x30\x4d\x33\x19\x03\x00\x00")
+
+func demositeTemplatesErrorHtmlBytes() ([]byte, error) {
+	return bindataRead(
+		_demositeTemplatesErrorHtml,
+		"demosite/templates/error.html",
+	)
+}
+
+func demositeTemplatesErrorHtml() (*asset, error) {
+	bytes, err := demositeTemplatesErrorHtmlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "demosite/templates/error.html", size: 793, mode: os.FileMode(420), modTime: time.Unix(1792179992, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 // Asset loads and returns the asset for the given name.
 // It returns an error if the asset could not be found or
 // could not be loaded.
@@ -141,6 +162,7 @@ func AssetNames() []string {
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
 	"demosite/templates/default.html": demositeTemplatesDefaultHtml,
+	"demosite/templates/error.html": demositeTemplatesErrorHtml,
 }
 
 // AssetDir returns the file names below a certain
@@ -186,6 +208,7 @@ var _bintree = &bintree{nil, map[string]*bintree{
 	"demosite": &bintree{nil, map[string]*bintree{
 		"templates": &bintree{nil, map[string]*bintree{
 			"default.html": &bintree{demositeTemplatesDefaultHtml, map[string]*bintree{}},
+			"error.html": &bintree{demositeTemplatesErrorHtml, map[string]*bintree{}},
 		}},
 	}},
 }}
@@ -0,0 +1,213 @@
+// atom.go - Atom feed generation for the Kisipar site.
+// -------
+//
+// USEFUL: https://validator.w3.org/feed/docs/atom.html
+
+package site
+
+import (
+	// Standard:
+	"encoding/xml"
+	"time"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/pageset"
+)
+
+// ATOM_TIME_FORMAT is the format of the Atom date constructs.
+const ATOM_TIME_FORMAT = "2006-01-02T15:04:05-07:00"
+
+// An AtomFeed is an Atom 1.0 feed document.
+type AtomFeed struct {
+	XMLName     xml.Name        `xml:"http://www.w3.org/2005/Atom feed"`
+	XMLBase     string          `xml:"xml:base,attr,omitempty"`
+	FHNS        string          `xml:"xmlns:fh,attr,omitempty"`
+	Archive     *FeedArchive    `xml:"fh:archive"`
+	Title       string          `xml:"title"`
+	ID          string          `xml:"id"`
+	Link        []*AtomLink     `xml:"link"`
+	Updated     string          `xml:"updated"`
+	Author      []*AtomPerson   `xml:"author"`
+	Contributor []*AtomPerson   `xml:"contributor"`
+	Category    []*AtomCategory `xml:"category"`
+	Rights      *AtomText       `xml:"rights"`
+	Entry       []*AtomEntry    `xml:"entry"`
+}
+
+// An AtomEntry is a single Page in an AtomFeed.  Its XMLBase is the Page's
+// URL, against which any relative links in its content are resolved.
+type AtomEntry struct {
+	XMLBase     string          `xml:"xml:base,attr,omitempty"`
+	Title       string          `xml:"title"`
+	ID          string          `xml:"id"`
+	Link        []*AtomLink     `xml:"link"`
+	Published   string          `xml:"published,omitempty"`
+	Updated     string          `xml:"updated"`
+	Author      []*AtomPerson   `xml:"author"`
+	Contributor []*AtomPerson   `xml:"contributor"`
+	Category    []*AtomCategory `xml:"category"`
+	Rights      *AtomText       `xml:"rights"`
+	Summary     *AtomText       `xml:"summary"`
+	Content     *AtomText       `xml:"content"`
+}
+
+// An AtomLink is a link from an AtomFeed or AtomEntry.
+type AtomLink struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+// An AtomPerson is an author or contributor.
+type AtomPerson struct {
+	Name  string `xml:"name"`
+	URI   string `xml:"uri,omitempty"`
+	Email string `xml:"email,omitempty"`
+}
+
+// An AtomCategory is a category of an AtomFeed or AtomEntry, here a tag.
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+// An AtomText is a text construct: "text", "html" or "xhtml".
+type AtomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+// atomPeople returns the named persons, or nil if there are none.
+func atomPeople(names []string) []*AtomPerson {
+	if len(names) == 0 {
+		return nil
+	}
+	people := make([]*AtomPerson, len(names))
+	for i, name := range names {
+		people[i] = &AtomPerson{Name: name}
+	}
+	return people
+}
+
+// atomRights returns the rights as text, or nil if there are none.
+func atomRights(rights string) *AtomText {
+	if rights == "" {
+		return nil
+	}
+	return &AtomText{Type: "text", Body: rights}
+}
+
+// Feed returns an Atom Feed for the Site based on its configuration.
+// If a Pageset is provided, that is used for the Entries; otherwise
+// the main Site Pageset is used.
+// Pages are used in descending Time order, i.e. Updated > Created; ModTime
+// is the fallback. The Feed's Updated field is the time of the newest
+// entry.
+//
+// Entry authors are the Page's Authors or Author, or else the Site Owner;
+// contributors are its Contributors, categories its Tags, and rights its
+// Rights, or the FeedRights of the Site.  Relative links in the content are
+// made absolute.  Podcast episodes have their media linked as enclosures.
+//
+// Once there are more Pages than FeedItems, the Feed links to its archives
+// per RFC 5005; cf. FeedArchiveItems.
+// TODO: An optional Template for the Feed.
+func (s *Site) Feed(ps *pageset.Pageset) *AtomFeed {
+	return s.atomFeed(s.mainFeed(ps))
+}
+
+// atomFeed returns the feed as an AtomFeed.
+func (s *Site) atomFeed(feed *feed) *AtomFeed {
+
+	self := s.BaseURL + feed.path(s.FeedPath)
+	f := &AtomFeed{
+		XMLBase: s.BaseURL + "/",
+		Title:   feed.title,
+		ID:      self,
+		Author:  atomPeople([]string{s.Owner}),
+		Rights:  atomRights(s.FeedRights),
+		Updated: time.Now().Format(ATOM_TIME_FORMAT), // default if no entries
+		Link: []*AtomLink{
+			{Rel: "self", Href: self, Type: ATOM_CONTENT_TYPE},
+			{Rel: "alternate", Href: feed.home, Type: "text/html"},
+		},
+	}
+
+	if feed.archive > 0 {
+		f.FHNS = FEED_HISTORY_NS
+		f.Archive = &FeedArchive{}
+	}
+	for _, link := range s.feedArchiveLinks(feed, s.FeedPath) {
+		f.Link = append(f.Link, &AtomLink{
+			Rel:  link.rel,
+			Href: link.href,
+			Type: ATOM_CONTENT_TYPE,
+		})
+	}
+
+	items, newest := s.feedItems(feed)
+	if newest != nil {
+		f.Updated = newest.Format(ATOM_TIME_FORMAT)
+	}
+	f.Entry = make([]*AtomEntry, len(items))
+	for i, item := range items {
+
+		e := &AtomEntry{
+			XMLBase:     item.url,
+			Title:       item.title,
+			ID:          item.url,
+			Updated:     item.updated.Format(ATOM_TIME_FORMAT),
+			Author:      atomPeople(item.authors),
+			Contributor: atomPeople(item.contributors),
+			Content: &AtomText{
+				Type: "html",
+				Body: item.content,
+			},
+			Link: []*AtomLink{
+				{Rel: "alternate", Href: item.url, Type: "text/html"},
+			},
+		}
+		if ep := item.episode; ep != nil {
+			e.Link = append(e.Link, &AtomLink{
+				Rel:    "enclosure",
+				Href:   ep.media.url,
+				Type:   ep.media.ctype,
+				Length: ep.media.length,
+			})
+		}
+		for _, tag := range item.page.Tags() {
+			e.Category = append(e.Category, &AtomCategory{Term: tag})
+		}
+		if item.rights != "" {
+			e.Rights = atomRights(item.rights)
+		}
+
+		// Published?  (This is pretty useful but not required.)
+		if item.published != nil {
+			e.Published = item.published.Format(ATOM_TIME_FORMAT)
+		}
+
+		// Summarized?
+		if item.summary != "" {
+			e.Summary = &AtomText{
+				Type: "text",
+				Body: item.summary,
+			}
+		}
+
+		f.Entry[i] = e
+
+	}
+	return f
+
+}
+
+// feedXML returns the feed as Atom XML.
+func (s *Site) feedXML(f *feed) ([]byte, error) {
+	data, err := xml.MarshalIndent(s.atomFeed(f), "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
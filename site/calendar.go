@@ -0,0 +1,213 @@
+// calendar.go - iCalendar files of the Kisipar site's events.
+// -----------
+//
+// USEFUL: https://www.rfc-editor.org/rfc/rfc5545
+
+package site
+
+import (
+	// Standard:
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/page"
+	"github.com/biztos/kisipar/pageset"
+)
+
+// CALENDAR_CONTENT_TYPE is the Content-Type of the iCalendar files.
+const CALENDAR_CONTENT_TYPE = "text/calendar; charset=utf-8"
+
+// CALENDAR_EXT is the extension of the iCalendar files, also appended to
+// the paths of event Pages for their own calendars.
+const CALENDAR_EXT = ".ics"
+
+// CALENDAR_PRODID identifies Kisipar as the producer of its calendars.
+const CALENDAR_PRODID = "-//biztos//Kisipar//EN"
+
+// The longest line allowed, in octets, before folding:
+const calendarLineMax = 75
+
+const (
+	calendarTimeFormat = "20060102T150405Z"
+	calendarDateFormat = "20060102"
+)
+
+// Calendar returns an iCalendar file with the given name, containing the
+// events among the pages, e.g. those of Pageset.Events.  Pages which are
+// not events are skipped.
+//
+// Events with a time are given in UTC; all-day events, those with a Start
+// date and no time of day, are given as dates in the Page's TimeZone.
+// Each event's UID is derived from its URL, so it stays the same as long
+// as the Page does not move.  The DTSTAMP is the Page's Time, or its Start
+// if it has none, so the same Pages always give the same calendar.
+func (s *Site) Calendar(name string, pages []*page.Page) []byte {
+
+	buf := new(bytes.Buffer)
+	line := func(prop, value string) {
+		writeCalendarLine(buf, prop+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", CALENDAR_PRODID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", calendarText(name))
+	for _, p := range pages {
+		start := p.Start()
+		if start == nil {
+			continue
+		}
+		purl := s.PageURL(p)
+		line("BEGIN", "VEVENT")
+		line("UID", s.calendarUID(purl))
+		stamp := *start
+		if t := p.Time(); t != nil && !t.IsZero() {
+			stamp = *t
+		}
+		line("DTSTAMP", stamp.UTC().Format(calendarTimeFormat))
+		if p.AllDay() {
+			loc := p.TimeZone()
+			line("DTSTART;VALUE=DATE", start.In(loc).Format(calendarDateFormat))
+			end := pageset.EventEnd(p).In(loc)
+			line("DTEND;VALUE=DATE", end.Format(calendarDateFormat))
+		} else {
+			line("DTSTART", start.UTC().Format(calendarTimeFormat))
+			if end := p.End(); end != nil {
+				line("DTEND", pageset.EventEnd(p).UTC().Format(calendarTimeFormat))
+			}
+		}
+		line("SUMMARY", calendarText(p.Title()))
+		if loc := p.Location(); loc != "" {
+			line("LOCATION", calendarText(loc))
+		}
+		desc := p.Description()
+		if desc == "" {
+			desc = p.Summary()
+		}
+		if desc != "" {
+			line("DESCRIPTION", calendarText(desc))
+		}
+		line("URL", purl)
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+
+	return buf.Bytes()
+
+}
+
+// EventCalendarURL returns the full URL of the iCalendar file of the event
+// Page, or an empty string if the Page is not an event or calendars are
+// turned off.
+func (s *Site) EventCalendarURL(p *page.Page) string {
+	if s.NoCalendar || p == nil || !p.IsEvent() {
+		return ""
+	}
+	return s.URL(eventCalendarPath(s.Href(p)))
+}
+
+// eventCalendarPath returns the request path of the iCalendar file of the
+// Page at href: "/foo/bar" has "/foo/bar.ics", and the home page has
+// "/index.ics".
+func eventCalendarPath(href string) string {
+	rpath := path.Clean(filepath.ToSlash(href))
+	if rpath == "/" {
+		rpath = "/index"
+	}
+	return rpath + CALENDAR_EXT
+}
+
+// calendarUID returns a stable, globally unique UID for the event at purl.
+func (s *Site) calendarUID(purl string) string {
+	sum := sha1.Sum([]byte(purl))
+	return hex.EncodeToString(sum[:]) + "@" + s.Host
+}
+
+// calendarPage returns the event Page whose own calendar is at rpath, or nil
+// if there is none.
+func (s *Site) calendarPage(rpath string) *page.Page {
+	if !strings.HasSuffix(rpath, CALENDAR_EXT) {
+		return nil
+	}
+	ppath := strings.TrimSuffix(rpath, CALENDAR_EXT)
+	if ppath == "/index" {
+		ppath = "/"
+	}
+	p, err := s.PageForPath(ppath)
+	if err != nil || p == nil || !p.IsEvent() {
+		return nil
+	}
+	return p
+}
+
+// Send the site calendar if the path matches the CalendarPath and there are
+// any events, or the calendar of an event Page if the path is the Page's
+// path plus CALENDAR_EXT.
+func (s *Site) handleCalendar(w http.ResponseWriter, req *http.Request, rpath string) bool {
+
+	if s.NoCalendar || s.Pageset == nil {
+		return false
+	}
+
+	var data []byte
+	if rpath == s.CalendarPath {
+		events := s.Pageset.Events()
+		if len(events) == 0 {
+			return false
+		}
+		data = s.Calendar(s.Name, events)
+	} else if p := s.calendarPage(rpath); p != nil {
+		data = s.Calendar(p.Title(), []*page.Page{p})
+	} else {
+		return false
+	}
+
+	w.Header().Set("Content-Type", CALENDAR_CONTENT_TYPE)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+	return true
+
+}
+
+// calendarText escapes the value for an iCalendar TEXT property.
+func calendarText(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(value)
+}
+
+// writeCalendarLine writes the content line, folded as necessary, with a
+// CRLF line ending.  Lines are folded before calendarLineMax octets, never
+// inside a UTF-8 character.
+func writeCalendarLine(buf *bytes.Buffer, line string) {
+
+	max := calendarLineMax
+	for len(line) > max {
+		i := max
+		for i > 0 && !utf8.RuneStart(line[i]) {
+			i--
+		}
+		buf.WriteString(line[:i])
+		buf.WriteString("\r\n ")
+		line = line[i:]
+		// Continuation lines start with the space.
+		max = calendarLineMax - 1
+	}
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+
+}
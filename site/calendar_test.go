@@ -0,0 +1,267 @@
+// calendar_test.go - tests for the Kisipar event calendars.
+// ----------------
+
+package site_test
+
+import (
+	// Standard:
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	// Third-party:
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/page"
+	"github.com/biztos/kisipar/site"
+)
+
+var calendarYaml = `# CALENDAR TEST
+Name: Calendar Test
+Pages:
+    party.md: |
+        # Party, Big; Loud
+
+            Start: 2016-05-08 18:00:00
+            End: 2016-05-08 23:30:00
+            TimeZone: Etc/GMT-2
+            Location: The Garden
+            Description: "Bring food.\nBring drink."
+
+        Fun.
+    fair.md: |
+        # Fair
+
+            Start: 2016-05-01
+            End: 2016-05-03
+    plain.md: "# Plain"
+`
+
+func Test_Calendar(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(calendarYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(s.Calendar(s.Name, s.Pageset.Events()))
+
+	assert.True(strings.HasPrefix(body, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"),
+		"calendar begins")
+	assert.True(strings.HasSuffix(body, "END:VEVENT\r\nEND:VCALENDAR\r\n"),
+		"calendar ends")
+	assert.Contains(body, "PRODID:-//biztos//Kisipar//EN\r\n", "PRODID")
+	assert.Contains(body, "X-WR-CALNAME:Calendar Test\r\n", "name")
+	assert.Equal(2, strings.Count(body, "BEGIN:VEVENT"), "two events")
+	assert.True(strings.Index(body, "SUMMARY:Fair") <
+		strings.Index(body, "SUMMARY:Party"), "events in order")
+
+	assert.Contains(body, "DTSTART;VALUE=DATE:20160501\r\n"+
+		"DTEND;VALUE=DATE:20160504\r\n", "all-day dates, end exclusive")
+	assert.Contains(body, "DTSTART:20160508T160000Z\r\n"+
+		"DTEND:20160508T213000Z\r\n", "times in UTC from TimeZone")
+	assert.Contains(body, `SUMMARY:Party\, Big\; Loud`, "text escaped")
+	assert.Contains(body, `DESCRIPTION:Bring food.\nBring drink.`,
+		"newlines escaped")
+	assert.Contains(body, "LOCATION:The Garden\r\n", "location")
+	assert.Contains(body, "URL:http://localhost:8020/party\r\n", "URL")
+	assert.Regexp(`UID:[0-9a-f]{40}@localhost\r\n`, body, "UID")
+	assert.NotContains(body, "Plain", "non-events skipped")
+
+	again := string(s.Calendar(s.Name, s.Pageset.Events()))
+	assert.Equal(uidLines(body), uidLines(again), "UIDs stable")
+
+	for _, line := range strings.Split(body, "\r\n") {
+		assert.True(len(line) <= 75, "line not too long: %q", line)
+	}
+
+}
+
+func Test_Calendar_Stamp(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(calendarYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := &page.Page{Path: "/created.md", Meta: map[string]interface{}{
+		"Start":   "2016-05-08 18:00:00",
+		"Created": "2016-04-01 12:00:00",
+	}}
+	unknown := &page.Page{Path: "/unknown.md", Meta: map[string]interface{}{
+		"Start": "2016-05-08 18:00:00",
+	}}
+	pages := []*page.Page{created, unknown}
+
+	body := string(s.Calendar(s.Name, pages))
+	assert.Contains(body, "DTSTAMP:20160401T120000Z\r\n", "Created stamp")
+	assert.Contains(body, "DTSTAMP:20160508T180000Z\r\n",
+		"Start stamp without time")
+	assert.Equal(body, string(s.Calendar(s.Name, pages)), "output stable")
+
+}
+
+// uidLines returns the UID lines of the calendar.
+func uidLines(body string) []string {
+	uids := []string{}
+	for _, line := range strings.Split(body, "\r\n") {
+		if strings.HasPrefix(line, "UID:") {
+			uids = append(uids, line)
+		}
+	}
+	return uids
+}
+
+func Test_Calendar_Folding(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(`# FOLDING TEST
+Pages:
+    long.md: |
+        # Long
+
+            Start: 2016-05-08
+            Location: "` + strings.Repeat("ő", 100) + `"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(s.Calendar("Long", s.Pageset.Events()))
+	lines := strings.Split(body, "\r\n")
+	folded := ""
+	for _, line := range lines {
+		assert.True(len(line) <= 75, "line not too long: %q", line)
+		if strings.HasPrefix(line, " ") {
+			folded += line[1:]
+		} else if strings.HasPrefix(line, "LOCATION:") {
+			folded = line
+		}
+	}
+	assert.Equal("LOCATION:"+strings.Repeat("ő", 100), folded,
+		"folded line unfolds, characters intact")
+
+}
+
+func Test_MainHandler_Calendar(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(calendarYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, rec := ReqAndRec(t, "http://example.com/calendar.ics")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "calendar served")
+	assert.Equal("text/calendar; charset=utf-8",
+		rec.Header().Get("Content-Type"), "content type set")
+	assert.Equal(2, strings.Count(rec.Body.String(), "BEGIN:VEVENT"),
+		"all events in calendar")
+
+	assert.Equal("http://localhost:8020/party.ics",
+		s.EventCalendarURL(s.Pageset.Page("party")), "event calendar URL")
+	assert.Equal("", s.EventCalendarURL(s.Pageset.Page("plain")),
+		"no calendar URL for non-event")
+
+	s.NoCalendar = true
+	req, rec = ReqAndRec(t, "http://example.com/calendar.ics")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "calendar not served with NoCalendar")
+	assert.Equal("", s.EventCalendarURL(s.Pageset.Page("party")),
+		"no calendar URL with NoCalendar")
+
+}
+
+func Test_MainHandler_CalendarNoEvents(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(`# NO EVENTS
+Pages:
+    a.md: "# A"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, rec := ReqAndRec(t, "http://example.com/calendar.ics")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "no calendar without events")
+
+}
+
+func Test_MainHandler_CalendarTemplate(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "pages", "gig.md"),
+		"# Gig\n\n    Start: 2999-01-01 20:00:00\n    Location: Pub")
+	writeFile(t, filepath.Join(dir, "templates", "single.html"),
+		`{{ range .Site.Pageset.UpcomingEvents }}{{ .Title }} at {{ .Location }} {{ $.Site.EventCalendarURL . }}{{ end }}`)
+	s, err := site.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, rec := ReqAndRec(t, "http://example.com/foo")
+	s.ServeHTTP(rec, req)
+	assert.Equal("Gig at Pub http://localhost:8020/gig.ics", rec.Body.String(),
+		"events in templates")
+
+	req, rec = ReqAndRec(t, "http://example.com/gig.ics")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "event calendar served from disk")
+	body := rec.Body.String()
+	assert.Equal(1, strings.Count(body, "BEGIN:VEVENT"), "one event")
+	assert.Contains(body, "X-WR-CALNAME:Gig\r\n", "named for event")
+	assert.Contains(body, "DTSTART:29990101T200000Z", "event in calendar")
+
+	req, rec = ReqAndRec(t, "http://example.com/foo.ics")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "no calendar for non-events")
+
+	s.NoCalendar = true
+	req, rec = ReqAndRec(t, "http://example.com/gig.ics")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "event calendar not served with NoCalendar")
+
+}
+
+func Test_Export_Calendars(t *testing.T) {
+
+	assert := assert.New(t)
+
+	sdir, s := watchSite(t)
+	defer os.RemoveAll(sdir)
+	dir := exportDir(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(sdir, "pages", "gig.md"),
+		"# Gig\n\n    Start: 2999-01-01 20:00:00")
+	s, err := site.Load(sdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.Export(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(report.Written, "calendar.ics", "site calendar written")
+	assert.Contains(report.Written, "gig.ics", "event calendar written")
+	assert.NotContains(report.Written, "foo.ics", "no calendar for non-event")
+
+	for _, rpath := range []string{"/calendar.ics", "/gig.ics"} {
+		req, rec := ReqAndRec(t, "http://example.com"+rpath)
+		s.ServeHTTP(rec, req)
+		assert.Equal(rec.Body.String(), readExport(t, dir, rpath[1:]),
+			"%s as served", rpath)
+	}
+
+}
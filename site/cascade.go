@@ -0,0 +1,171 @@
+// cascade.go - default meta cascading down to the Pages of the Kisipar site.
+// ----------
+
+package site
+
+import (
+	// Standard:
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	// Third-party:
+	"gopkg.in/yaml.v2"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/page"
+)
+
+// CASCADE_FILE is the name of the YAML files under the PagePath holding
+// default meta for the Pages in their directory and below, e.g.:
+//
+//   Template: blog
+//   Author: Jane Doe
+//   Tags: [blog]
+//
+// Such files are not served or exported unless ServePageSources is set.
+var CASCADE_FILE = "_meta.yaml"
+
+// CASCADE_KEY is the meta key under which an index Page may define default
+// meta for the other Pages in its directory and below, as for CASCADE_FILE.
+var CASCADE_KEY = "Cascade"
+
+// cascadeFor returns the default meta for the Page at path, merged from the
+// CASCADE_FILEs and index Page cascades of its directories, the nearest
+// taking precedence.  Within a directory, the index Page's cascade takes
+// precedence over the file; it does not apply to the index Page itself.
+// The CASCADE_KEY itself never cascades.
+func (s *Site) cascadeFor(path string) map[string]interface{} {
+
+	dirs := []string{}
+	top := filepath.Clean(s.PagePath)
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == top || filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	s.cascadeMutex.RLock()
+	defer s.cascadeMutex.RUnlock()
+
+	var meta map[string]interface{}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		meta = mergeCascade(meta, s.metaFiles[dirs[i]])
+		if i > 0 || !isIndexPath(path) {
+			meta = mergeCascade(meta, s.indexCascades[dirs[i]])
+		}
+	}
+	return meta
+
+}
+
+// mergeCascade merges the cascaded meta over the meta, dropping the
+// CASCADE_KEY.
+func mergeCascade(meta, cascade map[string]interface{}) map[string]interface{} {
+
+	if len(cascade) == 0 {
+		return meta
+	}
+	merged := page.MergeMeta(meta, cascade)
+	for k := range merged {
+		if strings.EqualFold(k, CASCADE_KEY) {
+			delete(merged, k)
+		}
+	}
+	return merged
+
+}
+
+// resetCascades sets the meta from the CASCADE_FILEs at paths, and clears
+// the index Page cascades.  In case of error, nothing is changed.
+func (s *Site) resetCascades(paths []string) error {
+
+	metaFiles := map[string]map[string]interface{}{}
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		meta := map[string]interface{}{}
+		if err := yaml.Unmarshal(b, &meta); err != nil {
+			return fmt.Errorf("Meta file %s: %s", path, err.Error())
+		}
+		metaFiles[filepath.Dir(path)] = meta
+	}
+
+	s.cascadeMutex.Lock()
+	s.metaFiles = metaFiles
+	s.indexCascades = map[string]map[string]interface{}{}
+	s.cascadeMutex.Unlock()
+	return nil
+
+}
+
+// setIndexCascade sets the cascade of the Page's directory from its meta
+// under the CASCADE_KEY, if it is an index Page.  An error is returned if
+// the cascade is not a map.
+func (s *Site) setIndexCascade(p *page.Page) error {
+
+	if !p.IsIndex {
+		return nil
+	}
+	var cascade map[string]interface{}
+	for k, v := range p.Meta {
+		if !strings.EqualFold(k, CASCADE_KEY) {
+			continue
+		}
+		switch m := v.(type) {
+		case map[string]interface{}:
+			cascade = m
+		case map[interface{}]interface{}:
+			// As from YAML.
+			cascade = make(map[string]interface{}, len(m))
+			for mk, mv := range m {
+				cascade[fmt.Sprint(mk)] = mv
+			}
+		default:
+			return fmt.Errorf("Page %s: %s is not a map.", p.Path, k)
+		}
+		break
+	}
+
+	dir := filepath.Dir(p.Path)
+	s.cascadeMutex.Lock()
+	if cascade == nil {
+		delete(s.indexCascades, dir)
+	} else {
+		s.indexCascades[dir] = cascade
+	}
+	s.cascadeMutex.Unlock()
+	return nil
+
+}
+
+// sortIndexFirst sorts the Page paths with the index Pages first, top-down,
+// so that their cascades are known before the Pages below them are loaded.
+// The order is otherwise unchanged.
+func sortIndexFirst(paths []string) {
+
+	depth := func(path string) int {
+		if !isIndexPath(path) {
+			return -1
+		}
+		return strings.Count(filepath.ToSlash(path), "/")
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		di, dj := depth(paths[i]), depth(paths[j])
+		return di >= 0 && (dj < 0 || di < dj)
+	})
+
+}
+
+// isIndexPath returns true if the path is that of an index Page, as per
+// page.New.
+func isIndexPath(path string) bool {
+	ext := filepath.Ext(path)
+	return strings.ToLower(strings.TrimSuffix(filepath.Base(path), ext)) ==
+		"index"
+}
@@ -0,0 +1,233 @@
+// cascade_test.go - tests for the Kisipar site's cascading meta.
+// ---------------
+
+package site_test
+
+import (
+	// Standard:
+	"os"
+	"path/filepath"
+	"testing"
+
+	// Third-party:
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/site"
+)
+
+// cascadeSite creates and loads a temp site with cascading meta under the
+// blog directory.
+func cascadeSite(t *testing.T) (string, *site.Site) {
+
+	dir := tempSite(t)
+	pdir := filepath.Join(dir, "pages")
+	for _, sub := range []string{"blog", filepath.Join("blog", "old")} {
+		if err := os.Mkdir(filepath.Join(pdir, sub), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(dir, "templates", "post.html"),
+		"P:{{ .Page.Title }} by {{ .Page.Author }}")
+	writeFile(t, filepath.Join(pdir, "blog", site.CASCADE_FILE),
+		"Template: post\nAuthor: Jane\nTags: [blog]\n")
+	writeFile(t, filepath.Join(pdir, "blog", "index.md"),
+		"# Blog\n\n    Cascade:\n        Author: Joe\n        Series: Blog\n")
+	writeFile(t, filepath.Join(pdir, "blog", "a-post.md"),
+		"# A Post\n\n    Tags: [mine]\n")
+	writeFile(t, filepath.Join(pdir, "blog", "old", site.CASCADE_FILE),
+		"Unlisted: true\nSeries: Old\n")
+	writeFile(t, filepath.Join(pdir, "blog", "old", "b-post.md"),
+		"# B Post")
+	writeFile(t, filepath.Join(pdir, "blog", "old", "c-post.md"),
+		"# C Post\n\n    Unlisted: false\n")
+
+	s, err := site.Load(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return dir, s
+}
+
+func Test_Cascade(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := cascadeSite(t)
+	defer os.RemoveAll(dir)
+	pdir := filepath.Join(dir, "pages")
+
+	idx := s.Pageset.Page(filepath.Join(pdir, "blog", "index"))
+	if assert.NotNil(idx, "index page loaded") {
+		assert.Equal("Jane", idx.Author(), "own cascade not applied to index")
+		assert.Equal("post", idx.MetaString("Template"), "file applies")
+	}
+	a := s.Pageset.Page(filepath.Join(pdir, "blog", "a-post"))
+	if assert.NotNil(a, "post loaded") {
+		assert.Equal("Joe", a.Author(), "index cascade over file")
+		assert.Equal("Blog", a.MetaString("Series"), "index cascade applies")
+		assert.Equal([]string{"mine"}, a.Tags(), "own meta wins")
+		assert.Nil(a.Meta[site.CASCADE_KEY], "cascade key not cascaded")
+		assert.False(a.Unlisted, "not unlisted")
+	}
+	b := s.Pageset.Page(filepath.Join(pdir, "blog", "old", "b-post"))
+	if assert.NotNil(b, "old post loaded") {
+		assert.Equal("Old", b.MetaString("Series"), "nearest cascade wins")
+		assert.Equal("Joe", b.Author(), "cascades from above")
+		assert.Equal([]string{"blog"}, b.Tags(), "cascades from above")
+		assert.True(b.Unlisted, "unlisted by cascade")
+	}
+	c := s.Pageset.Page(filepath.Join(pdir, "blog", "old", "c-post"))
+	if assert.NotNil(c, "other old post loaded") {
+		assert.False(c.Unlisted, "page overrides cascaded Unlisted")
+	}
+	foo := s.Pageset.Page(filepath.Join(pdir, "foo"))
+	if assert.NotNil(foo, "top page loaded") {
+		assert.Nil(foo.Cascade, "no cascade above")
+		assert.Equal("", foo.Author(), "no cascaded meta")
+	}
+
+	// Templates are chosen by the cascaded meta, and the meta files are
+	// not served.
+	handler := s.MainHandler()
+	req, w := ReqAndRec(t, "http://example.com/blog/a-post")
+	handler(w, req)
+	assert.Equal("P:A Post by Joe", w.Body.String(), "template cascaded")
+	req, w = ReqAndRec(t, "http://example.com/blog/"+site.CASCADE_FILE)
+	handler(w, req)
+	assert.Equal(404, w.Code, "meta file not served")
+
+	s.ServePageSources = true
+	req, w = ReqAndRec(t, "http://example.com/blog/"+site.CASCADE_FILE)
+	handler(w, req)
+	assert.Equal(200, w.Code, "meta file served with sources")
+
+}
+
+func Test_Cascade_Errors(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir := tempSite(t)
+	defer os.RemoveAll(dir)
+	pdir := filepath.Join(dir, "pages")
+
+	mpath := filepath.Join(pdir, site.CASCADE_FILE)
+	writeFile(t, mpath, "Author: [Jane\n")
+	_, err := site.Load(dir)
+	if assert.Error(err, "error for bad meta file") {
+		assert.Equal("Meta file "+mpath+": yaml: line 1: "+
+			"did not find expected ',' or ']'", err.Error(), "error useful")
+	}
+
+	os.Remove(mpath)
+	writeFile(t, filepath.Join(pdir, "index.md"), "# Top\n\n    Cascade: nope\n")
+	_, err = site.Load(dir)
+	if assert.Error(err, "error for bad cascade") {
+		assert.Equal("Page "+filepath.Join(pdir, "index.md")+
+			": Cascade is not a map.", err.Error(), "error useful")
+	}
+
+}
+
+func Test_Cascade_Virtual(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(`# VIRTUAL CASCADE
+Pages:
+    blog/index.md: |
+        # Blog
+
+            Cascade: {Template: post, Unlisted: true}
+    blog/a-post.md: "# A Post"
+    blog/more/b-post.md: "# B Post\n\n    Template: other\n"
+    other.md: "# Other"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := s.Pageset.Page("blog/a-post"); assert.NotNil(p, "post loaded") {
+		assert.Equal("post", p.MetaString("Template"), "cascaded")
+		assert.True(p.Unlisted, "unlisted by cascade")
+	}
+	if p := s.Pageset.Page("blog/more/b-post"); assert.NotNil(p) {
+		assert.Equal("other", p.MetaString("Template"), "own meta wins")
+		assert.True(p.Unlisted, "unlisted by cascade from above")
+	}
+	if p := s.Pageset.Page("blog/index"); assert.NotNil(p) {
+		assert.False(p.Unlisted, "index not unlisted by own cascade")
+	}
+	if p := s.Pageset.Page("other"); assert.NotNil(p) {
+		assert.Equal("", p.MetaString("Template"), "not cascaded")
+	}
+
+	_, err = site.LoadVirtualYaml(`# BAD VIRTUAL CASCADE
+Pages:
+    index.md: "# Hi\n\n    Cascade: [x]\n"
+`)
+	if assert.Error(err, "error for bad cascade") {
+		assert.Equal("Page index.md: Cascade is not a map.", err.Error(),
+			"error useful")
+	}
+
+}
+
+func Test_Watcher_Cascade(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := cascadeSite(t)
+	defer os.RemoveAll(dir)
+	pdir := filepath.Join(dir, "pages")
+	w := site.NewWatcher(s, 0)
+
+	author := func(rpath string) string {
+		p := s.Pageset.Page(filepath.Join(pdir, rpath))
+		if p == nil {
+			t.Fatalf("no page for %s", rpath)
+		}
+		return p.Author()
+	}
+
+	// Meta files:
+	writeFile(t, filepath.Join(pdir, "blog", site.CASCADE_FILE),
+		"Author: Jill\n")
+	ev := w.Scan()
+	assert.Nil(ev.Errors, "no errors")
+	assert.Equal([]string{filepath.Join(pdir, "blog", site.CASCADE_FILE)},
+		ev.Assets, "meta file is an asset")
+	assert.Equal("Jill", author(filepath.Join("blog", "index")),
+		"index recascaded")
+	assert.Equal("Joe", author(filepath.Join("blog", "a-post")),
+		"index cascade still wins")
+
+	// Index pages:
+	writeFile(t, filepath.Join(pdir, "blog", "index.md"), "# Blog")
+	ev = w.Scan()
+	assert.Nil(ev.Errors, "no errors")
+	assert.Equal("Jill", author(filepath.Join("blog", "a-post")),
+		"page recascaded after index change")
+	assert.Equal("Jill", author(filepath.Join("blog", "old", "b-post")),
+		"page recascaded after index change")
+
+	// Removals:
+	os.Remove(filepath.Join(pdir, "blog", site.CASCADE_FILE))
+	ev = w.Scan()
+	assert.Nil(ev.Errors, "no errors")
+	assert.Equal("", author(filepath.Join("blog", "a-post")),
+		"page recascaded after meta file removal")
+
+	// Errors keep the old cascades:
+	writeFile(t, filepath.Join(pdir, "blog", "old", site.CASCADE_FILE),
+		"Author: [Jane\n")
+	ev = w.Scan()
+	if assert.Equal(1, len(ev.Errors), "one error") {
+		assert.Contains(ev.Errors[0].Error(), "Meta file", "error useful")
+	}
+	if p := s.Pageset.Page(filepath.Join(pdir, "blog", "old", "b-post")); assert.NotNil(p) {
+		assert.True(p.Unlisted, "old cascade kept")
+	}
+
+}
@@ -0,0 +1,83 @@
+// check.go - checking a Kisipar site for problems.
+// --------
+
+package site
+
+import (
+	// Standard:
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+)
+
+// A CheckReport describes the result of a Check.
+type CheckReport struct {
+
+	// The Site as loaded, without any Pages found to have problems.
+	Site *Site
+
+	// The number of Pages checked, including those with problems.
+	Pages int
+
+	// The Problems found, in the order found.
+	Problems []error
+}
+
+// OK returns true if the Check found no problems.
+func (r *CheckReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Check loads the Site at spath as Load does, but instead of stopping at the
+// first problem, it checks everything: it parses all the templates, loads
+// all the Pages, validates their meta against the MetaSchemas, and renders
+// every Page.  Templates named in the meta must exist, and the Redirects
+// may not loop; cf. CheckRedirects.  An error is returned only if the Site
+// can not be checked at all, e.g. for a bad config.
+func Check(spath string) (*CheckReport, error) {
+
+	s, err := New(spath)
+	if err != nil {
+		return nil, err
+	}
+	report := &CheckReport{Site: s}
+	add := func(err error) {
+		report.Problems = append(report.Problems, err)
+	}
+
+	for _, err := range s.CheckRedirects() {
+		add(err)
+	}
+	tmplErr := s.LoadTemplates()
+	if tmplErr != nil {
+		add(fmt.Errorf("Template error: %s", tmplErr.Error()))
+	}
+	bad := map[string]bool{}
+	err = s.loadPages(func(path string, err error) {
+		bad[path] = true
+		add(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Pages = s.Pageset.Len() + len(bad)
+
+	// Without templates there is no rendering.
+	if tmplErr != nil {
+		return report, nil
+	}
+	for _, p := range s.Pageset.Pages() {
+		if name := p.MetaString("Template"); name != "" &&
+			s.Template.Lookup(name) == nil {
+			add(fmt.Errorf("Page %s: template not found: %s", p.Path, name))
+		}
+		rpath := path.Clean(filepath.ToSlash(s.Href(p)))
+		req, _ := http.NewRequest("GET", rpath, nil)
+		if _, err := s.renderPage(req, rpath); err != nil {
+			add(fmt.Errorf("Render error for %s: %s", p.Path, err.Error()))
+		}
+	}
+	return report, nil
+
+}
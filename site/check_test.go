@@ -0,0 +1,83 @@
+// check_test.go - tests for checking the Kisipar site.
+// -------------
+
+package site_test
+
+import (
+	// Standard:
+	"os"
+	"path/filepath"
+	"testing"
+
+	// Third-party:
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/site"
+)
+
+func Test_Check(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir := tempSite(t)
+	defer os.RemoveAll(dir)
+	pdir := filepath.Join(dir, "pages")
+
+	report, err := site.Check(dir)
+	if !assert.Nil(err, "no error") {
+		return
+	}
+	assert.True(report.OK(), "no problems")
+	assert.Equal(1, report.Pages, "one page checked")
+	assert.Equal("Watched", report.Site.Name, "site loaded")
+
+	writeFile(t, filepath.Join(dir, "config.yaml"),
+		"MetaSchema: {/: {Strict: true}}")
+	writeFile(t, filepath.Join(dir, "templates", "broken.html"),
+		"{{ .Nonesuch }}")
+	writeFile(t, filepath.Join(pdir, "bad.md"),
+		"# Bad\n\n    Craeted: 2020-01-02\n    Updated: then\n")
+	writeFile(t, filepath.Join(pdir, "bad-yaml.md"), "# Bad\n\n    Bad: [\n")
+	writeFile(t, filepath.Join(pdir, "missing.md"),
+		"# Missing\n\n    Template: nonesuch\n")
+	writeFile(t, filepath.Join(pdir, "broken.md"),
+		"# Broken\n\n    Template: broken\n")
+
+	report, err = site.Check(dir)
+	if !assert.Nil(err, "no error") {
+		return
+	}
+	assert.False(report.OK(), "problems found")
+	assert.Equal(5, report.Pages, "all pages checked")
+	problems := []string{}
+	for _, p := range report.Problems {
+		problems = append(problems, p.Error())
+	}
+	if assert.Equal(5, len(problems), "all problems reported") {
+		assert.Regexp("^Page error for "+filepath.Join(pdir, "bad-yaml.md")+
+			": yaml: line 3: ", problems[0], "parse error")
+		assert.Equal("Page "+filepath.Join(pdir, "bad.md")+
+			": meta Craeted: unknown key; did you mean Created?",
+			problems[1], "schema problem")
+		assert.Equal("Page "+filepath.Join(pdir, "bad.md")+
+			": meta Updated: not a valid time: then.",
+			problems[2], "all schema problems for the page")
+		assert.Regexp("^Render error for "+filepath.Join(pdir, "broken.md")+
+			": .*can't evaluate field Nonesuch", problems[3], "render error")
+		assert.Equal("Page "+filepath.Join(pdir, "missing.md")+
+			": template not found: nonesuch", problems[4], "missing template")
+	}
+
+	writeFile(t, filepath.Join(dir, "templates", "broken.html"), "{{ x }}")
+	report, err = site.Check(dir)
+	if assert.Nil(err, "no error") && assert.False(report.OK()) {
+		assert.Regexp("^Template error: ", report.Problems[0].Error(),
+			"template error reported")
+		assert.Equal(5, report.Pages, "pages still checked")
+	}
+
+	_, err = site.Check("no-such-path-here-we-hope")
+	assert.Error(err, "error for bad site path")
+
+}
@@ -0,0 +1,315 @@
+// devmode.go - development mode for the Kisipar site.
+// ----------
+// In DevMode a small script is injected into every HTML page, which listens
+// for server-sent events from the Site's Watcher: browsers reload when files
+// change, and errors are shown in an overlay naming the file and line.
+
+package site
+
+import (
+	// Standard library:
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DEV_EVENTS_PATH is the URL path of the server-sent event stream in DevMode.
+var DEV_EVENTS_PATH = "/_kisipar/events"
+
+// DEV_SCRIPT is injected into HTML pages in DevMode.  The first verb is the
+// JSON of any DevError to show at once, the second the JSON of the events
+// path.
+var DEV_SCRIPT = `<script id="kisipar-dev">
+(function() {
+    function overlay(p) {
+        var div = document.getElementById("kisipar-overlay");
+        if (!div) {
+            div = document.createElement("div");
+            div.id = "kisipar-overlay";
+            div.style.cssText = "position:fixed;top:0;left:0;right:0;" +
+                "bottom:0;z-index:99999;overflow:auto;padding:2em;" +
+                "background:rgba(0,0,0,0.85);color:#f66;" +
+                "font-family:Menlo,monospace;white-space:pre-wrap;";
+            document.body.appendChild(div);
+        }
+        div.textContent = (p.File || "") + (p.Line ? ":" + p.Line : "") +
+            "\n\n" + p.Message;
+    }
+    var problem = %s;
+    if (problem) {
+        overlay(problem);
+    }
+    var events = new EventSource(%s);
+    events.addEventListener("reload", function() {
+        location.reload();
+    });
+    events.addEventListener("problem", function(e) {
+        overlay(JSON.parse(e.data));
+    });
+})();
+</script>
+`
+
+// A DevError is an error located, as far as possible, in a file of the Site,
+// for display in DevMode.  The Line is zero if unknown.
+type DevError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+// Error returns the error as a string of the form "File:Line: Message".
+func (e *DevError) Error() string {
+	if e.File == "" {
+		return e.Message
+	}
+	if e.Line == 0 {
+		return e.File + ": " + e.Message
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+var templateErrorRx = regexp.MustCompile(`(?s)template: ([^:\s]+):(\d+):(?:\d+:)? ?(.*)$`)
+var pageErrorRx = regexp.MustCompile(`(?s)^Page error for (\S+): (.*)$`)
+var lineRx = regexp.MustCompile(`\bline (\d+)\b`)
+
+// DevError locates the err in the Site's files if it is a Template or Page
+// error, as reported by the handlers or the Watcher.  Other errors are
+// returned with their message only.  Page lines are relative to the meta
+// block where the parser reports them so.
+func (s *Site) DevError(err error) *DevError {
+
+	if de, ok := err.(*DevError); ok {
+		return de
+	}
+	msg := err.Error()
+	if m := templateErrorRx.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[2])
+		return &DevError{
+			File:    s.templateFile(m[1]),
+			Line:    line,
+			Message: m[3],
+		}
+	}
+	if m := pageErrorRx.FindStringSubmatch(msg); m != nil {
+		de := &DevError{File: s.pageFile(m[1]), Message: m[2]}
+		if lm := lineRx.FindStringSubmatch(m[2]); lm != nil {
+			de.Line, _ = strconv.Atoi(lm[1])
+		}
+		return de
+	}
+	return &DevError{Message: msg}
+
+}
+
+// templateFile returns the file for the named template, or else the name.
+func (s *Site) templateFile(name string) string {
+
+	if s.TemplatePath != "" {
+		base := filepath.Join(s.TemplatePath, filepath.FromSlash(name))
+		if files, _ := filepath.Glob(base + ".*"); len(files) > 0 {
+			return files[0]
+		}
+		if info, err := os.Stat(base); err == nil && !info.IsDir() {
+			return base
+		}
+	}
+	return name
+
+}
+
+// pageFile returns the source file of a Page, given either its file path
+// or a request path, or else the path given.
+func (s *Site) pageFile(path string) string {
+
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		return path
+	}
+	if s.PagePath != "" {
+		key := filepath.Join(s.PagePath, filepath.FromSlash(path))
+		for _, k := range []string{key, filepath.Join(key, "index")} {
+			for _, ext := range s.PageExtensions {
+				if _, err := os.Stat(k + ext); err == nil {
+					return k + ext
+				}
+			}
+		}
+	}
+	return path
+
+}
+
+// injectDevScript inserts the DEV_SCRIPT before the closing body tag of the
+// page, or at its end if there is none.  If problem is not nil, the page
+// shows it in the overlay at once.
+func injectDevScript(page []byte, problem *DevError) []byte {
+
+	pjson := []byte("null")
+	if problem != nil {
+		pjson, _ = json.Marshal(problem)
+	}
+	epath, _ := json.Marshal(DEV_EVENTS_PATH)
+	script := fmt.Sprintf(DEV_SCRIPT, pjson, epath)
+
+	idx := bytes.LastIndex(bytes.ToLower(page), []byte("</body>"))
+	if idx == -1 {
+		return append(page, script...)
+	}
+	res := make([]byte, 0, len(page)+len(script))
+	res = append(res, page[:idx]...)
+	res = append(res, script...)
+	return append(res, page[idx:]...)
+
+}
+
+// A devEvent is a server-sent event.
+type devEvent struct {
+	name string
+	data string
+}
+
+// A devHub distributes events to the browsers connected to a Site.
+type devHub struct {
+	clients map[chan devEvent]bool
+	closed  bool
+	mutex   sync.Mutex
+}
+
+func (h *devHub) subscribe() chan devEvent {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	ch := make(chan devEvent, 8)
+	if h.closed {
+		close(ch)
+		return ch
+	}
+	if h.clients == nil {
+		h.clients = map[chan devEvent]bool{}
+	}
+	h.clients[ch] = true
+	return ch
+}
+
+func (h *devHub) unsubscribe(ch chan devEvent) {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.clients[ch] {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+// send sends the event to every client without blocking; slow clients miss
+// out, but will catch the next reload.
+func (h *devHub) send(ev devEvent) {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for ch := range h.clients {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// close disconnects all clients, which then reload.
+func (h *devHub) close() {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for ch := range h.clients {
+		close(ch)
+	}
+	h.clients = nil
+	h.closed = true
+}
+
+func (s *Site) devEvents() *devHub {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.devHub == nil {
+		s.devHub = &devHub{}
+	}
+	return s.devHub
+}
+
+// devNotify tells the browsers about changes found by the Watcher: the first
+// error, if any, is shown in the overlay; otherwise they reload, unless
+// the Site itself is being reloaded for a config change.
+func (s *Site) devNotify(ev *WatchEvent) {
+
+	if !s.DevMode {
+		return
+	}
+	s.mutex.RLock()
+	reloading := ev.Config && s.reload != nil
+	s.mutex.RUnlock()
+
+	// A reloading Site closes the event stream when it is replaced, and the
+	// browsers reload then.
+	if reloading {
+		return
+	}
+	if len(ev.Errors) > 0 {
+		data, _ := json.Marshal(s.DevError(ev.Errors[0]))
+		s.devEvents().send(devEvent{"problem", string(data)})
+	} else if !ev.Empty() {
+		s.devEvents().send(devEvent{"reload", "{}"})
+	}
+
+}
+
+// serveDevEvents serves the server-sent event stream at DEV_EVENTS_PATH until
+// the client goes away or the Site is replaced.  Note that the Server's
+// WriteTimeout also ends the stream, whereupon the browser reconnects.
+func (s *Site) serveDevEvents(w http.ResponseWriter, req *http.Request) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.sendInternalServerError(w, req,
+			fmt.Errorf("Streaming not supported by %T.", w))
+		return
+	}
+
+	hub := s.devEvents()
+	ch := hub.subscribe()
+	defer hub.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 1000\n\n")
+	flusher.Flush()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				ev = devEvent{"reload", "{}"}
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.name,
+				strings.Replace(ev.data, "\n", "\ndata: ", -1))
+			flusher.Flush()
+			if !ok {
+				return
+			}
+		}
+	}
+
+}
@@ -0,0 +1,244 @@
+// devmode_test.go - tests for the Kisipar site development mode.
+// ---------------
+
+package site_test
+
+import (
+	// Standard:
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	// Third-party:
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/site"
+)
+
+func Test_DevError_Error(t *testing.T) {
+
+	assert := assert.New(t)
+
+	assert.Equal("oops", (&site.DevError{Message: "oops"}).Error(),
+		"message only")
+	assert.Equal("foo.md: oops",
+		(&site.DevError{File: "foo.md", Message: "oops"}).Error(),
+		"file and message")
+	assert.Equal("foo.md:3: oops",
+		(&site.DevError{File: "foo.md", Line: 3, Message: "oops"}).Error(),
+		"file, line and message")
+
+}
+
+func Test_DevError(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	tpath := filepath.Join(dir, "templates", "single.html")
+	ppath := filepath.Join(dir, "pages", "foo.md")
+
+	de := &site.DevError{File: "x", Message: "y"}
+	assert.True(de == s.DevError(de), "DevError passed through")
+
+	assert.Equal(&site.DevError{Message: "other"},
+		s.DevError(errors.New("other")), "other errors as-is")
+
+	assert.Equal(&site.DevError{
+		File:    tpath,
+		Line:    12,
+		Message: `executing "single" at <.Nope>: oops`,
+	}, s.DevError(errors.New(
+		`template: single:12:5: executing "single" at <.Nope>: oops`)),
+		"template execution error located")
+
+	assert.Equal(&site.DevError{
+		File:    tpath,
+		Line:    2,
+		Message: `unexpected "}" in operand`,
+	}, s.DevError(errors.New(
+		`Template error: template: single:2: unexpected "}" in operand`)),
+		"template parse error located")
+
+	assert.Equal(&site.DevError{
+		File:    "nonesuch/template",
+		Line:    1,
+		Message: "oops",
+	}, s.DevError(errors.New("template: nonesuch/template:1: oops")),
+		"unknown template named")
+
+	assert.Equal(&site.DevError{
+		File:    ppath,
+		Line:    2,
+		Message: "yaml: line 2: oops",
+	}, s.DevError(errors.New("Page error for /foo: yaml: line 2: oops")),
+		"page error located by request path")
+
+	assert.Equal(&site.DevError{
+		File:    ppath,
+		Message: "oops",
+	}, s.DevError(errors.New("Page error for "+ppath+": oops")),
+		"page error located by file path")
+
+	assert.Equal(&site.DevError{
+		File:    "/nonesuch",
+		Message: "oops",
+	}, s.DevError(errors.New("Page error for /nonesuch: oops")),
+		"unknown page named")
+
+}
+
+func Test_DevMode_ScriptInjected(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "templates", "single.html"),
+		"<html><body>{{ .Page.Title }}</BODY></html>")
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	req, rec := ReqAndRec(t, "http://example.com/foo")
+	s.ServeHTTP(rec, req)
+	assert.Equal("<html><body>Foo</BODY></html>", rec.Body.String(),
+		"no script outside DevMode")
+
+	s.DevMode = true
+	req, rec = ReqAndRec(t, "http://example.com/foo")
+	s.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	assert.Regexp(`^<html><body>Foo<script id="kisipar-dev">`, body,
+		"script injected before body end")
+	assert.Regexp(`</script>\n</BODY></html>$`, body,
+		"body end kept")
+	assert.Contains(body, `var problem = null;`, "no problem")
+	assert.Contains(body, `new EventSource("/_kisipar/events")`,
+		"events path set")
+
+	// Pages without a body get it at the end.
+	writeFile(t, filepath.Join(dir, "templates", "single.html"), "NOBODY")
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	req, rec = ReqAndRec(t, "http://example.com/foo")
+	s.ServeHTTP(rec, req)
+	assert.Regexp(`^NOBODY<script id="kisipar-dev">(?s).*</script>\n$`,
+		rec.Body.String(), "script appended")
+
+}
+
+func Test_DevMode_ErrorOverlay(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	tpath := filepath.Join(dir, "templates", "single.html")
+	writeFile(t, tpath, "\n{{ .Page.Nonesuch }}")
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	s.DevMode = true
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	req, rec := ReqAndRec(t, "http://example.com/foo")
+	s.ServeHTTP(rec, req)
+	assert.Equal(500, rec.Code, "code 500 sent")
+	body := rec.Body.String()
+	assert.Contains(body, `var problem = {"File":"`+tpath+`","Line":2,`,
+		"overlay shows template file and line")
+	assert.Contains(body, tpath+":2: ", "error page shows file and line")
+
+}
+
+// readEvent reads the next server-sent event from the stream.
+func readEvent(t *testing.T, r *bufio.Reader) string {
+
+	lines := []string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == "\n" {
+			if len(lines) > 0 {
+				return strings.Join(lines, "")
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, "retry:") {
+			lines = append(lines, line)
+		}
+	}
+}
+
+func Test_DevMode_Events(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	// Nothing to see outside DevMode.
+	res, err := http.Get(srv.URL + site.DEV_EVENTS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	assert.Equal(404, res.StatusCode, "events not found outside DevMode")
+
+	s.DevMode = true
+	s.WatchInterval = 10 * time.Millisecond
+	s.StartWatching()
+	defer s.StopWatching()
+
+	res, err = http.Get(srv.URL + site.DEV_EVENTS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	assert.Equal("text/event-stream", res.Header.Get("Content-Type"),
+		"event stream served")
+	r := bufio.NewReader(res.Body)
+
+	writeFile(t, filepath.Join(dir, "pages", "foo.md"), "# Changed")
+	assert.Equal("event: reload\ndata: {}\n", readEvent(t, r),
+		"reload sent on change")
+
+	ppath := filepath.Join(dir, "pages", "foo.md")
+	writeFile(t, ppath, "# Bad!\n\n    foo: { x [ y,\n")
+	ev := readEvent(t, r)
+	assert.Regexp(`^event: problem\ndata: \{"File":"`+ppath+`","Line":`, ev,
+		"problem sent on error")
+
+	// Replacing the Site reloads the browser once more.
+	writeFile(t, ppath, "# Good")
+	assert.Equal("event: reload\ndata: {}\n", readEvent(t, r),
+		"reload sent on fix")
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	// A config change replaces it, and the browser reloads only then.
+	l := site.NewLiveSite(s)
+	writeFile(t, filepath.Join(dir, "config.yaml"), "Name: Changed")
+	assert.Equal("event: reload\ndata: {}\n", readEvent(t, r),
+		"reload sent on replacement")
+	assert.Equal("Changed", l.Site().Name, "config change reloaded the Site")
+	_, err = r.ReadString('\n')
+	assert.Error(err, "stream ended")
+
+}
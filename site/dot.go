@@ -7,10 +7,12 @@ import (
 	// Standard library:
 	"html/template"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	// Kisipar packages:
+	"github.com/biztos/kisipar/funcmap"
 	"github.com/biztos/kisipar/page"
 	"github.com/biztos/kisipar/pageset"
 )
@@ -35,6 +37,20 @@ type Dot struct {
 	// Now hold the timestamp of the Dot's creation.
 	Now time.Time
 
+	// Status is the HTTP status code of the response, e.g. 200 for a Page
+	// or 404 for an error page.
+	Status int
+
+	// Error holds the details of the error on an error page, but only if
+	// the Site is in DevMode; otherwise it is always nil, lest internal
+	// information leak to the public.
+	Error error
+
+	// Query and Results are set when rendering the "search" template: the
+	// query as given, and the matching Pages, best first.
+	Query   string
+	Results []*pageset.SearchResult
+
 	// Register is useful in templates when one needs, say, to keep track
 	// of indent levels.  It is set via - ta-da! - SetRegister.
 	Register int
@@ -48,6 +64,11 @@ func (d *Dot) SetRegister(v int) int {
 	return old
 }
 
+// StatusText returns the standard text for the Status, e.g. "Not Found".
+func (d *Dot) StatusText() string {
+	return http.StatusText(d.Status)
+}
+
 // URL returns the full URL string of the request.
 func (d *Dot) URL() string {
 	if d.Request == nil {
@@ -86,14 +107,15 @@ func (d *Dot) Template() *template.Template {
 	if d.Site == nil {
 		panic("Site is nil")
 	}
-	if d.Site.Template == nil {
+	top := d.Site.CurrentTemplate()
+	if top == nil {
 		panic("Site.Template is nil")
 	}
 
 	// Page override:
 	if d.Page != nil {
 		if name := d.Page.MetaString("Template"); name != "" {
-			if tmpl := d.Site.Template.Lookup(name); tmpl != nil {
+			if tmpl := top.Lookup(name); tmpl != nil {
 				return tmpl
 			}
 		}
@@ -106,17 +128,17 @@ func (d *Dot) Template() *template.Template {
 	}
 	if d.Request != nil {
 		path := strings.TrimPrefix(strings.ToLower(d.Request.URL.Path), "/")
-		if tmpl := d.Site.Template.Lookup(path + "/" + alt); tmpl != nil {
+		if tmpl := top.Lookup(path + "/" + alt); tmpl != nil {
 			return tmpl
 		}
 		parts := strings.Split(path, "/")
 		for len(parts) > 0 {
 			name := strings.Join(parts, "/")
 			if name != "" {
-				if tmpl := d.Site.Template.Lookup(name); tmpl != nil {
+				if tmpl := top.Lookup(name); tmpl != nil {
 					return tmpl
 				}
-				if tmpl := d.Site.Template.Lookup(name + "/" + alt); tmpl != nil {
+				if tmpl := top.Lookup(name + "/" + alt); tmpl != nil {
 					return tmpl
 				}
 			}
@@ -126,11 +148,39 @@ func (d *Dot) Template() *template.Template {
 	}
 
 	// Top-level special templates:
-	if tmpl := d.Site.Template.Lookup(alt); tmpl != nil {
+	if tmpl := top.Lookup(alt); tmpl != nil {
 		return tmpl
 	}
 
 	// Final fallback: the top-level (default) template.
-	return d.Site.Template
+	return top
+
+}
+
+// ErrorTemplate returns the template in which to render an error page for
+// the Dot's Status.  A template named for the Status, e.g. "404", is
+// preferred, then one named "error", and finally the default error template,
+// which is named "kisipar/error".  Sites without templates, i.e. those not
+// loaded, also get the default error template.
+func (d *Dot) ErrorTemplate() *template.Template {
+
+	if d.Site == nil {
+		panic("Site is nil")
+	}
+	if top := d.Site.CurrentTemplate(); top != nil {
+		for _, name := range []string{
+			strconv.Itoa(d.Status),
+			"error",
+			DEFAULT_ERROR_NAME,
+		} {
+			if tmpl := top.Lookup(name); tmpl != nil {
+				return tmpl
+			}
+		}
+	}
+
+	// Unloaded (or hand-built) template sets get a fresh copy.
+	return template.Must(template.New(DEFAULT_ERROR_NAME).
+		Funcs(funcmap.New()).Parse(DEFAULT_ERROR_TEMPLATE))
 
 }
@@ -12,7 +12,7 @@ import (
 	"text/template"
 )
 
-func ExampleSite_NewDot() {
+func ExampleDot() {
 
 	// Let's imagine a Dot for a single non-index page, say "/foo/bar.md"
 	p, err := page.LoadVirtualString("foo/bar.md", "# Bar!")
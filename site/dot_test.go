@@ -242,3 +242,48 @@ Templates:
 	}
 
 }
+
+func Test_Dot_StatusText(t *testing.T) {
+
+	assert := assert.New(t)
+
+	assert.Equal("Not Found", (&site.Dot{Status: 404}).StatusText(),
+		"text for 404")
+	assert.Equal("", (&site.Dot{}).StatusText(), "no text for zero")
+
+}
+
+func Test_Dot_ErrorTemplate(t *testing.T) {
+
+	assert := assert.New(t)
+
+	AssertPanicsWith(t, func() { (&site.Dot{}).ErrorTemplate() },
+		"Site is nil", "ErrorTemplate call panics for empty Dot")
+
+	// No templates loaded:
+	d := &site.Dot{Site: &site.Site{}, Status: 404}
+	assert.Equal(site.DEFAULT_ERROR_NAME, d.ErrorTemplate().Name(),
+		"default for unloaded Site")
+
+	// Standard templates:
+	s, err := site.LoadVirtual(nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Site = s
+	assert.Equal(site.DEFAULT_ERROR_NAME, d.ErrorTemplate().Name(),
+		"default for Site without error templates")
+
+	// Site error template, then status template:
+	if _, err := s.Template.New("error").Parse("E"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal("error", d.ErrorTemplate().Name(), "error template")
+	if _, err := s.Template.New("404").Parse("NF"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal("404", d.ErrorTemplate().Name(), "status template")
+	d.Status = 500
+	assert.Equal("error", d.ErrorTemplate().Name(), "error template")
+
+}
@@ -0,0 +1,459 @@
+// export.go - static export of the Kisipar site.
+// ---------
+// An exported site is a tree of plain files, with every Page and index at
+// its own "index.html", which any static file server can serve in place of
+// Kisipar itself.
+
+package site
+
+import (
+	// Standard library:
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/page"
+)
+
+// EXPORT_MANIFEST is the file, at the top of the export directory, listing
+// the files written by the last Export.  Files in the directory not listed
+// there are never touched.
+var EXPORT_MANIFEST = ".kisipar-export"
+
+// EXPORT_NOT_FOUND is the file to which Export writes the Site's 404 page,
+// as expected by most static hosts.
+var EXPORT_NOT_FOUND = "404.html"
+
+// An ExportReport describes the result of an Export.  File paths are
+// slash-separated and relative to the export directory.
+type ExportReport struct {
+
+	// Written lists the files that were new or changed.
+	Written []string
+
+	// Unchanged lists the files that were already up to date.
+	Unchanged []string
+
+	// Removed lists the files from the last Export no longer produced.
+	Removed []string
+
+	// BrokenLinks lists the internal links in exported Pages to paths
+	// which the Site does not serve.
+	BrokenLinks []*BrokenLink
+}
+
+// A BrokenLink is a link in an exported Page to a path of the Site that
+// does not exist.
+type BrokenLink struct {
+
+	// Page is the request path of the Page containing the link.
+	Page string
+
+	// Link is the link as it appears in the Page.
+	Link string
+}
+
+// String returns the link as "Page: Link".
+func (b *BrokenLink) String() string {
+	return b.Page + ": " + b.Link
+}
+
+// An exportFile is either rendered data or a source file to copy.
+type exportFile struct {
+	rpath string
+	src   string
+	data  []byte
+	page  bool
+}
+
+// Export writes the Site as static files to the directory dir, creating it
+// if necessary, such that a static file server would serve the same content
+// at the same paths as the Site itself.
+//
+// Every Page and index is rendered exactly as the MainHandler would render
+// it, and written to "index.html" under its request path: "/foo/bar" goes
+// to "foo/bar/index.html".  Aliases get pages there which redirect to their
+// Pages, as static hosts can not be expected to send redirects, and so do
+// the paths of exact Redirects, even over static files.  The Feed, sitemap,
+// robots.txt and calendars, if any, are written to their paths, and the 404
+// page to EXPORT_NOT_FOUND.
+// Page assets are copied, following ServePageSources, as are the static
+// files.  Where paths collide, the same precedence applies as in the
+// MainHandler: static files win.
+//
+// The export is incremental: all Pages are rendered, as any of them may
+// depend on any other, but files are only written if their content has
+// changed, so that their modification times remain useful for syncing.
+// Copied files keep the modification times of their sources.  Files written
+// by a previous Export but no longer produced are removed.
+//
+// Internal links in the rendered Pages are checked against the exported
+// files, and any broken ones are reported.  They are not errors.
+func (s *Site) Export(dir string) (*ExportReport, error) {
+
+	files, err := s.exportFiles()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dir = filepath.Clean(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Export error: %s", err)
+	}
+
+	report := &ExportReport{}
+	if err := s.removeStale(dir, files, report); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		dest := filepath.Join(dir, filepath.FromSlash(name))
+		changed, err := writeExportFile(dest, files[name])
+		if err != nil {
+			return nil, fmt.Errorf("Export error for %s: %s", name, err)
+		}
+		if changed {
+			report.Written = append(report.Written, name)
+		} else {
+			report.Unchanged = append(report.Unchanged, name)
+		}
+	}
+	manifest := strings.Join(names, "\n") + "\n"
+	mpath := filepath.Join(dir, EXPORT_MANIFEST)
+	if err := ioutil.WriteFile(mpath, []byte(manifest), 0644); err != nil {
+		return nil, fmt.Errorf("Export error: %s", err)
+	}
+
+	report.BrokenLinks = s.brokenLinks(files, names)
+	return report, nil
+
+}
+
+// exportFiles collects the files to export, keyed by their output paths.
+// They are collected in reverse order of precedence, so that files found
+// later replace those found earlier.
+func (s *Site) exportFiles() (map[string]*exportFile, error) {
+
+	files := map[string]*exportFile{}
+
+	// The 404 page:
+	nfpath := "/" + EXPORT_NOT_FOUND
+	req, _ := http.NewRequest("GET", nfpath, nil)
+	body, _ := s.renderError(req, http.StatusNotFound, nil)
+	files[EXPORT_NOT_FOUND] = &exportFile{rpath: nfpath, data: body}
+
+	// Page assets:
+	if s.PagePath != "" {
+		err := walkFiles(s.PagePath, func(name, src string) {
+			ext := path.Ext(name)
+			if ext == "" {
+				return
+			}
+			if !s.ServePageSources {
+				for _, pext := range s.PageExtensions {
+					if ext == pext {
+						return
+					}
+				}
+				if path.Base(name) == CASCADE_FILE {
+					return
+				}
+			}
+			files[name] = &exportFile{rpath: "/" + name, src: src}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Export error for assets: %s", err)
+		}
+	}
+
+	// Pages and indexes, including those implied by the Page paths; Unlisted
+	// Pages too, as they are served all the same:
+	rpaths := map[string]bool{"/": true}
+	if s.Pageset != nil {
+		for _, p := range s.Pageset.Pages() {
+			rpath := path.Clean(filepath.ToSlash(s.Href(p)))
+			for strings.HasPrefix(rpath, "/") && rpath != "/" {
+				rpaths[rpath] = true
+				rpath = path.Dir(rpath)
+			}
+		}
+	}
+	for rpath := range rpaths {
+		req, _ := http.NewRequest("GET", rpath, nil)
+		body, err := s.renderPage(req, rpath)
+		if err != nil {
+			return nil, fmt.Errorf("Export error for %s: %s", rpath, err)
+		}
+		if body == nil {
+			continue
+		}
+		name := strings.TrimPrefix(path.Join(rpath, "index.html"), "/")
+		files[name] = &exportFile{rpath: rpath, data: body, page: true}
+	}
+
+	// Aliases, as pages redirecting to their Pages:
+	for alias, p := range s.aliasPages() {
+		name := strings.TrimPrefix(path.Join(alias, "index.html"), "/")
+		files[name] = &exportFile{rpath: alias, data: aliasHTML(s.PageURL(p))}
+	}
+
+	// The feeds, main feed last so it wins:
+	if formats := s.feedFormats(); len(formats) > 0 {
+		main := s.mainFeed(nil)
+		feeds := append(s.subFeeds(), main)
+		for n := 1; n <= s.feedArchives(main); n++ {
+			archive := s.mainFeed(nil)
+			archive.archive = n
+			feeds = append(feeds, archive)
+		}
+		for _, f := range feeds {
+			for _, ff := range formats {
+				rpath := f.path(ff.rpath)
+				if strings.Trim(rpath, "/") == "" {
+					continue
+				}
+				data, err := ff.data(f)
+				if err != nil {
+					return nil, fmt.Errorf("Export error for %s: %s", rpath, err)
+				}
+				name := strings.TrimPrefix(path.Clean(rpath), "/")
+				files[name] = &exportFile{rpath: rpath, data: data}
+			}
+		}
+	}
+
+	// The sitemap and robots.txt:
+	if !s.NoSitemap {
+		docs, err := s.sitemapDocs()
+		if err != nil {
+			return nil, fmt.Errorf("Export error for %s: %s", s.SitemapPath, err)
+		}
+		for rpath, data := range docs {
+			name := strings.TrimPrefix(path.Clean(rpath), "/")
+			files[name] = &exportFile{rpath: rpath, data: data}
+		}
+	}
+	if !s.NoRobots {
+		name := strings.TrimPrefix(ROBOTS_PATH, "/")
+		files[name] = &exportFile{rpath: ROBOTS_PATH, data: s.robotsTXT()}
+	}
+
+	// The event calendars:
+	if !s.NoCalendar && s.Pageset != nil {
+		events := s.Pageset.Events()
+		for _, p := range events {
+			rpath := eventCalendarPath(s.Href(p))
+			name := strings.TrimPrefix(rpath, "/")
+			files[name] = &exportFile{
+				rpath: rpath,
+				data:  s.Calendar(p.Title(), []*page.Page{p}),
+			}
+		}
+		if len(events) > 0 && strings.Trim(s.CalendarPath, "/") != "" {
+			name := strings.TrimPrefix(path.Clean(s.CalendarPath), "/")
+			files[name] = &exportFile{
+				rpath: s.CalendarPath,
+				data:  s.Calendar(s.Name, events),
+			}
+		}
+	}
+
+	// Static files, except those the MainHandler would never serve:
+	if s.StaticPath != "" {
+		err := walkFiles(s.StaticPath, func(name, src string) {
+			if path.Ext(name) != "" {
+				files[name] = &exportFile{rpath: "/" + name, src: src}
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Export error for static files: %s", err)
+		}
+	}
+
+	// Exact redirects, last as they win even over static files:
+	for from, data := range s.redirectStubs() {
+		name := strings.TrimPrefix(from, "/")
+		if path.Ext(from) == "" {
+			name = strings.TrimPrefix(path.Join(from, "index.html"), "/")
+		}
+		files[name] = &exportFile{rpath: from, data: data}
+	}
+
+	return files, nil
+
+}
+
+// walkFiles calls f with the slash-separated relative name and the file path
+// of each regular file under root.  A missing root has no files.
+func walkFiles(root string, f func(name, src string)) error {
+
+	err := filepath.Walk(root, func(src string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, src)
+		if err != nil {
+			return err
+		}
+		f(filepath.ToSlash(rel), src)
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+
+}
+
+// writeExportFile writes or copies the file to dest unless it is already up
+// to date, returning true if it was written.  Copies are considered up to
+// date if they have the size and modification time of their source.
+func writeExportFile(dest string, f *exportFile) (bool, error) {
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return false, err
+	}
+
+	if f.src == "" {
+		if have, err := ioutil.ReadFile(dest); err == nil && bytes.Equal(have, f.data) {
+			return false, nil
+		}
+		return true, ioutil.WriteFile(dest, f.data, 0644)
+	}
+
+	info, err := os.Stat(f.src)
+	if err != nil {
+		return false, err
+	}
+	if have, err := os.Stat(dest); err == nil && have.Mode().IsRegular() &&
+		have.Size() == info.Size() && have.ModTime().Equal(info.ModTime()) {
+		return false, nil
+	}
+	if err := copyFile(dest, f.src); err != nil {
+		return false, err
+	}
+	return true, os.Chtimes(dest, info.ModTime(), info.ModTime())
+
+}
+
+func copyFile(dest, src string) error {
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+
+}
+
+// removeStale removes the files listed in the manifest of the last Export
+// which are no longer produced, along with any directories left empty.
+func (s *Site) removeStale(dir string, files map[string]*exportFile, report *ExportReport) error {
+
+	manifest, err := ioutil.ReadFile(filepath.Join(dir, EXPORT_MANIFEST))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("Export error: %s", err)
+	}
+	for _, name := range strings.Split(string(manifest), "\n") {
+		// Never stray outside the directory, whatever the manifest says.
+		if name == "" || files[name] != nil || path.IsAbs(name) ||
+			path.Clean(name) != name || strings.HasPrefix(name, "../") {
+			continue
+		}
+		dest := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.Remove(dest); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("Export error for %s: %s", name, err)
+		}
+		report.Removed = append(report.Removed, name)
+		for d := filepath.Dir(dest); d != dir; d = filepath.Dir(d) {
+			if os.Remove(d) != nil {
+				break
+			}
+		}
+	}
+	return nil
+
+}
+
+var linkRx = regexp.MustCompile(`(?i)\s(?:href|src)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// brokenLinks finds the internal links in the exported Pages whose targets
+// are not among the exported files.
+func (s *Site) brokenLinks(files map[string]*exportFile, names []string) []*BrokenLink {
+
+	served := map[string]bool{}
+	for _, name := range names {
+		served["/"+name] = true
+		if name == "index.html" {
+			served["/"] = true
+		} else if strings.HasSuffix(name, "/index.html") {
+			served["/"+strings.TrimSuffix(name, "/index.html")] = true
+		}
+	}
+
+	broken := []*BrokenLink{}
+	for _, name := range names {
+		f := files[name]
+		if !f.page {
+			continue
+		}
+		for _, m := range linkRx.FindAllSubmatch(f.data, -1) {
+			link := string(m[1]) + string(m[2])
+			if target, ok := s.internalPath(f.rpath, link); ok && !served[target] {
+				broken = append(broken, &BrokenLink{Page: f.rpath, Link: link})
+			}
+		}
+	}
+	return broken
+
+}
+
+// internalPath returns the cleaned request path of the link, as resolved
+// from the request path base, if it is a link within the Site.
+func (s *Site) internalPath(base, link string) (string, bool) {
+
+	link = strings.TrimSpace(html.UnescapeString(link))
+	if strings.Contains(s.BaseURL, "://") && strings.HasPrefix(link, s.BaseURL) {
+		link = "/" + strings.TrimPrefix(strings.TrimPrefix(link, s.BaseURL), "/")
+	}
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Opaque != "" ||
+		u.Path == "" {
+		return "", false
+	}
+	return path.Clean((&url.URL{Path: base}).ResolveReference(u).Path), true
+
+}
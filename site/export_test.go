@@ -0,0 +1,288 @@
+// export_test.go - tests for the Kisipar site static export.
+// --------------
+
+package site_test
+
+import (
+	// Standard:
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	// Third-party:
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/site"
+)
+
+// exportDir returns a fresh directory to export into.
+func exportDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "kisipar-site-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func readExport(t *testing.T, dir, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func Test_Export_FullSite(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.Load(filepath.Join("test_data", "full_site"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := exportDir(t)
+	defer os.RemoveAll(dir)
+
+	report, err := s.Export(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(report.Unchanged, "nothing unchanged on first export")
+	assert.Empty(report.Removed, "nothing removed on first export")
+	assert.Equal([]string{
+		"404.html",
+		"bar/abacus/index.html",
+		"bar/boomerang/index.html",
+		"bar/feed.json",
+		"bar/feed.xml",
+		"bar/index.html",
+		"bar/rss.xml",
+		"feed.json",
+		"feed.xml",
+		"foo/assets/that.js",
+		"foo/assets/this.js",
+		"foo/bar/index.html",
+		"foo/bat/index.html",
+		"foo/baz/index.html",
+		"foo/boogie.js",
+		"foo/feed.json",
+		"foo/feed.xml",
+		"foo/not_a_page.pl",
+		"foo/rss.xml",
+		"foo/stuff.dir/feed.json",
+		"foo/stuff.dir/feed.xml",
+		"foo/stuff.dir/rss.xml",
+		"index.html",
+		"js/kisipar.js",
+		"js/special.dir/special.js",
+		"other/index.html",
+		"robots.txt",
+		"rss.xml",
+		"sitemap.xml",
+	}, report.Written, "all files written")
+
+	// Everything is as served, bar the 404 page which is not the same
+	// request.
+	for _, name := range report.Written {
+		if name == site.EXPORT_NOT_FOUND {
+			continue
+		}
+		rpath := "/" + strings.TrimSuffix(name, "index.html")
+		req, rec := ReqAndRec(t, "http://example.com"+rpath)
+		s.ServeHTTP(rec, req)
+		assert.Equal(200, rec.Code, "200 served for %s", rpath)
+		assert.Equal(rec.Body.String(), readExport(t, dir, name),
+			"export matches server for %s", name)
+	}
+	assert.Contains(readExport(t, dir, "404.html"), "Oh no!",
+		"404 page uses the site template")
+
+	manifest := readExport(t, dir, site.EXPORT_MANIFEST)
+	assert.Equal(strings.Join(report.Written, "\n")+"\n", manifest,
+		"manifest lists the files written")
+
+}
+
+func Test_Export_Incremental(t *testing.T) {
+
+	assert := assert.New(t)
+
+	sdir, s := watchSite(t)
+	defer os.RemoveAll(sdir)
+	dir := exportDir(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "keep.txt"), "not ours")
+
+	if _, err := s.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	report, err := s.Export(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(report.Written, "nothing written when nothing changed")
+	assert.Contains(report.Unchanged, "foo/index.html", "page unchanged")
+	assert.Contains(report.Unchanged, "x.js", "static file unchanged")
+
+	writeFile(t, filepath.Join(sdir, "pages", "foo.md"), "# Changed")
+	writeFile(t, filepath.Join(sdir, "static", "x.js"), "y")
+	report, err = s.Export(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(report.Written, "foo/index.html", "changed page written")
+	assert.Contains(report.Written, "x.js", "changed static file written")
+	assert.Equal("S:Changed", readExport(t, dir, "foo/index.html"),
+		"page content updated")
+	assert.Equal("y", readExport(t, dir, "x.js"), "static content updated")
+	assert.Contains(report.Unchanged, "404.html", "404 page unchanged")
+
+	// Pages no longer in the Site are removed, along with their directories,
+	// but other files are left alone.
+	if err := os.Remove(filepath.Join(sdir, "pages", "foo.md")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(sdir, "pages", "bar.md"), "# Bar")
+	s, err = site.Load(sdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = s.Export(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal([]string{"foo/index.html"}, report.Removed, "page removed")
+	assert.Contains(report.Written, "bar/index.html", "new page written")
+	_, err = os.Stat(filepath.Join(dir, "foo"))
+	assert.True(os.IsNotExist(err), "empty directory removed")
+	assert.Equal("not ours", readExport(t, dir, "keep.txt"),
+		"unknown file kept")
+
+}
+
+func Test_Export_Precedence(t *testing.T) {
+
+	assert := assert.New(t)
+
+	sdir, s := watchSite(t)
+	defer os.RemoveAll(sdir)
+	dir := exportDir(t)
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(sdir, "static", "foo"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(sdir, "static", "foo", "index.html"), "STATIC")
+	writeFile(t, filepath.Join(sdir, "static", "README"), "never served")
+
+	report, err := s.Export(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal("STATIC", readExport(t, dir, "foo/index.html"),
+		"static file beats page")
+	assert.NotContains(report.Written, "README",
+		"static file without extension not exported")
+	assert.NotContains(report.Written, "foo.md", "page source not exported")
+
+	s.ServePageSources = true
+	report, err = s.Export(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal([]string{"foo.md"}, report.Written,
+		"page source exported with ServePageSources")
+
+}
+
+func Test_Export_BrokenLinks(t *testing.T) {
+
+	assert := assert.New(t)
+
+	sdir, s := watchSite(t)
+	defer os.RemoveAll(sdir)
+	dir := exportDir(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(sdir, "templates", "single.html"), `
+<a href="/nope">broken</a>
+<a href="x.js">relative</a>
+<a href='/foo/'>self</a>
+<img src="{{ .Site.URL "gone.png" }}">
+<a href="https://example.com/nope">external</a>
+<a href="mailto:me@example.com">mail</a>
+<a href="#top">fragment</a>
+<a href="/feed.xml?x=1">feed</a>`)
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.Export(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal([]*site.BrokenLink{
+		{Page: "/foo", Link: "/nope"},
+		{Page: "/foo", Link: s.URL("gone.png")},
+	}, report.BrokenLinks, "broken internal links found")
+	assert.Equal("/foo: /nope", report.BrokenLinks[0].String(),
+		"link stringifies")
+
+}
+
+func Test_Export_Unlisted(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(`# UNLISTED EXPORT
+Pages:
+    /foo.md: "# Foo"
+    /secret/x.md: "# Secret\n\n    Unlisted: true\n"
+Templates:
+    single: '{{ .Page.Title }} <a href="/secret/x">secret</a>'
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := exportDir(t)
+	defer os.RemoveAll(dir)
+
+	report, err := s.Export(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(report.Written, "secret/x/index.html",
+		"unlisted page exported")
+	assert.Contains(readExport(t, dir, "secret/x/index.html"), "Secret",
+		"unlisted page rendered")
+	assert.Empty(report.BrokenLinks, "links to unlisted page not broken")
+
+}
+
+func Test_Export_Errors(t *testing.T) {
+
+	assert := assert.New(t)
+
+	sdir, s := watchSite(t)
+	defer os.RemoveAll(sdir)
+	dir := exportDir(t)
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(sdir, "templates", "single.html"),
+		"{{ .Page.Nonesuch }}")
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.Export(dir)
+	if assert.Error(err, "error returned for template failure") {
+		assert.Regexp("^Export error for /foo: template: single", err.Error(),
+			"error is useful")
+	}
+
+	file := filepath.Join(dir, "file")
+	writeFile(t, file, "x")
+	_, err = s.Export(file)
+	assert.Error(err, "error returned for bad directory")
+
+}
@@ -2,147 +2,334 @@
 // -------
 // TODO: deal with remote content etc, obviously this is going to require
 // some kind of re-parse no?
-//
-// USEFUL: https://validator.w3.org/feed/docs/atom.html
 
 package site
 
 import (
 
 	// Standard:
-	"encoding/xml"
+	"fmt"
+	"html"
+	"html/template"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
-	// Third-Party:
-	"golang.org/x/tools/blog/atom"
-
 	// Kisipar:
+	"github.com/biztos/kisipar/page"
 	"github.com/biztos/kisipar/pageset"
 )
 
-// SaneEntry extends a Google Atom Entry to support an xml:base attribute,
-// thus making it minimally sane.  WTF, GOOG?
-type SaneEntry struct {
-	atom.Entry
-	XMLBase string `xml:"xml:base,attr"`
+// The content types of the feed formats:
+const (
+	ATOM_CONTENT_TYPE      = "application/atom+xml"
+	JSON_FEED_CONTENT_TYPE = "application/feed+json"
+	RSS_CONTENT_TYPE       = "application/rss+xml"
+)
+
+// A feedFormat is one of the formats in which the Site's feeds are served.
+// Its rpath is the path of the main feed in that format.
+type feedFormat struct {
+	rpath string
+	ctype string
+	data  func(f *feed) ([]byte, error)
 }
 
-// SaneFeed allows a Google-style Feed to have an xml:base attribute per
-// entry, and thus not be COMPLETELY EFFING INSANE.
-// (TODO: write own, this shit is not so fancy.)
-type SaneFeed struct {
-	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
-	Title   string       `xml:"title"`
-	ID      string       `xml:"id"`
-	Link    []atom.Link  `xml:"link"`
-	Updated atom.TimeStr `xml:"updated"`
-	Author  *atom.Person `xml:"author"`
-	Entry   []*SaneEntry `xml:"entry"`
+// feedFormats returns the enabled formats of the Site's feeds, Atom first.
+// A format with an empty path is disabled.
+func (s *Site) feedFormats() []*feedFormat {
+
+	if s.NoFeed {
+		return nil
+	}
+	formats := []*feedFormat{}
+	for _, f := range []*feedFormat{
+		{s.FeedPath, ATOM_CONTENT_TYPE, s.feedXML},
+		{s.JSONFeedPath, JSON_FEED_CONTENT_TYPE, s.jsonFeedData},
+		{s.RSSFeedPath, RSS_CONTENT_TYPE, s.rssFeedXML},
+	} {
+		if f.rpath != "" {
+			formats = append(formats, f)
+		}
+	}
+	return formats
+
 }
 
-// Feed returns an Atom Feed (as a SaneFeed) for the Site based on its
-// configuration.
-// If a Pageset is provided, that is used for the Entries; otherwise
-// the main Site Pageset is used.
-// Pages are used in descending Time order, i.e. Updated > Created; ModTime
-// is the fallback. The Feed's Updated field is the time of the newest
-// entry.
-// TODO: An optional Template for the Feed.
-// TODO: Support more parts of the Person for author.
-func (s *Site) Feed(ps *pageset.Pageset) *SaneFeed {
+// A feed is one of the Site's feeds: the main feed, or the feed of a
+// section or a tag.  The main feed is served at the paths of the formats;
+// the others in their dir, under the same file names, e.g. for "/blog":
+// "/blog/feed.xml", "/blog/feed.json" and "/blog/rss.xml".  A main feed
+// with an archive number is one of its archives.
+type feed struct {
+	dir     string
+	title   string
+	home    string
+	archive int
+	pageset *pageset.Pageset
+}
+
+// path returns the URL path of the feed in the format served at fpath.
+func (f *feed) path(fpath string) string {
+	if f.archive > 0 {
+		return feedArchivePath(fpath, f.archive)
+	}
+	if f.dir == "" {
+		return fpath
+	}
+	return path.Join(f.dir, path.Base(fpath))
+}
 
+// mainFeed returns the main feed of the Site, for the Pageset if provided,
+// otherwise for the main Site Pageset.
+func (s *Site) mainFeed(ps *pageset.Pageset) *feed {
 	if ps == nil {
 		ps = s.Pageset
 	}
+	return &feed{
+		title:   s.FeedTitle,
+		home:    s.BaseURL + "/",
+		pageset: ps,
+	}
+}
 
-	f := &SaneFeed{
-		Title: s.FeedTitle,
-		ID:    s.BaseURL + s.FeedPath,
-		Author: &atom.Person{
-			Name: s.Owner,
-		},
-		Updated: atom.Time(time.Now()), // default if no entries
-		Link: []atom.Link{
-			atom.Link{
-				Rel:  "self",
-				Href: s.BaseURL + s.FeedPath,
-			},
-			atom.Link{
-				Rel:  "alternate",
-				Href: s.BaseURL,
-			},
-		},
-	}
-	entries := make([]*SaneEntry, s.FeedItems)
-
-	pages := ps.ByTime()
-	total := len(pages)
-	if total > s.FeedItems {
-		total = s.FeedItems
-	}
-	for i, p := range pages {
-		ts := p.Time()
-		if i == 0 {
-			f.Updated = atom.Time(*ts)
-		}
-		if i == total {
-			break
-		}
+// subFeed returns the feed of the tag or section at the URL path dir, or
+// nil if there is no such feed or it has no Pages.
+func (s *Site) subFeed(dir string) *feed {
 
-		// If we have no page Author, try the site Owner.
-		// TODO: collect all authors for the feed-level Author tags.
-		// (For which probably have to rewrite the atom library right?)
-		author := p.Author()
-		if author == "" {
-			author = s.Owner
+	if s.Pageset == nil || dir == "/" || dir == "." {
+		return nil
+	}
+
+	f := &feed{dir: dir}
+	var name string
+	if !s.NoTagFeeds && path.Dir(dir) == path.Clean(s.TagFeedPath) {
+		name = path.Base(dir)
+		f.home = s.BaseURL + "/"
+		f.pageset = s.Pageset.TagSubset(name)
+	} else if !s.NoSectionFeeds {
+		name = path.Base(dir)
+		f.home = s.BaseURL + dir
+		prefix := filepath.FromSlash(strings.TrimPrefix(dir, "/") + "/")
+		trim := s.PagePath + string(os.PathSeparator)
+		f.pageset = s.Pageset.PathSubset(prefix, trim)
+		for _, p := range f.pageset.ByTime() {
+			if p.IsIndex && s.fileURL(p) == f.home && p.Title() != "" {
+				name = p.Title()
+				break
+			}
 		}
+	} else {
+		return nil
+	}
+	if len(f.pageset.ByTime()) == 0 {
+		return nil
+	}
+
+	if title, ok := s.FeedTitles[dir]; ok {
+		f.title = title
+	} else {
+		f.title = s.FeedTitle + ": " + name
+	}
+	return f
+
+}
 
-		// We always have content.
-		// TODO: fix it up, or if not needed then put it down there.
-		// (links are fine but need to be absolute)
-		content := p.Content
-
-		// Use the self-URL as the xml:base until proven wrong.
-		selfurl := s.PageURL(p)
-		e := atom.Entry{
-			Title:   p.Title(),
-			ID:      s.PageURL(p),
-			Updated: atom.Time(*ts),
-			Author: &atom.Person{
-				Name: author,
-			},
-			Content: &atom.Text{
-				Type: "html",
-				Body: string(content),
-			},
-			Link: []atom.Link{
-				atom.Link{
-					Rel:  "self",
-					Href: selfurl,
-				},
-			},
+// subFeeds returns the feeds of all the Site's sections and tags that have
+// listed Pages, sections first, each in path order.
+func (s *Site) subFeeds() []*feed {
+
+	if s.Pageset == nil {
+		return nil
+	}
+
+	dirs := []string{}
+	if !s.NoSectionFeeds {
+		seen := map[string]bool{}
+		// Sections are directories, whatever the Pages' routes.
+		for _, p := range s.Pageset.ByTime() {
+			dir := strings.TrimPrefix(s.fileURL(p), s.BaseURL)
+			if !p.IsIndex {
+				dir = path.Dir(dir)
+			}
+			for ; dir != "/" && dir != "." && !seen[dir]; dir = path.Dir(dir) {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
 		}
+		sort.Strings(dirs)
+	}
+	if !s.NoTagFeeds {
+		for _, tag := range s.Pageset.Tags() {
+			if tag != "" && !strings.Contains(tag, "/") {
+				dirs = append(dirs, path.Join(s.TagFeedPath, tag))
+			}
+		}
+	}
 
-		// Published?  (This is pretty useful but not required.)
-		if pub := p.Created(); pub != nil {
-			e.Published = atom.Time(*pub)
+	feeds := []*feed{}
+	for _, dir := range dirs {
+		if f := s.subFeed(dir); f != nil {
+			feeds = append(feeds, f)
 		}
+	}
+	return feeds
 
-		// Summarized?
-		if summary := p.Summary(); summary != "" {
-			e.Summary = &atom.Text{
-				Type: "text",
-				Body: string(summary),
+}
+
+// feedForPath returns the feed and its format served at the URL path, or
+// nils if there is none.  The main feed and its archives win over any
+// section or tag.
+func (s *Site) feedForPath(rpath string) (*feed, *feedFormat) {
+
+	formats := s.feedFormats()
+	for _, ff := range formats {
+		if rpath == ff.rpath {
+			return s.mainFeed(nil), ff
+		}
+	}
+	for _, ff := range formats {
+		if n := feedArchiveNumber(rpath, ff.rpath); n > 0 {
+			if f := s.mainFeed(nil); n <= s.feedArchives(f) {
+				f.archive = n
+				return f, ff
 			}
 		}
+	}
+	for _, ff := range formats {
+		if path.Base(rpath) != path.Base(ff.rpath) {
+			continue
+		}
+		if f := s.subFeed(path.Dir(rpath)); f != nil {
+			return f, ff
+		}
+	}
+	return nil, nil
+
+}
+
+// FeedLinks returns the autodiscovery links to the Site's main feed, one
+// for each format, for use in the head of an HTML template:
+//
+//	<head>
+//	    {{ .Site.FeedLinks }}
+//	</head>
+//
+// If there are no feeds it returns an empty string.
+func (s *Site) FeedLinks() template.HTML {
+
+	links := []string{}
+	for _, f := range s.feedFormats() {
+		links = append(links, fmt.Sprintf(
+			`<link rel="alternate" type="%s" title="%s" href="%s">`,
+			f.ctype,
+			html.EscapeString(s.FeedTitle),
+			html.EscapeString(s.BaseURL+f.rpath),
+		))
+	}
+	return template.HTML(strings.Join(links, "\n"))
+
+}
+
+// A feedItem is a Page as it appears in each of the Site's feeds, with the
+// fallbacks already applied and the links in its content made absolute.
+type feedItem struct {
+	page         *page.Page
+	title        string
+	url          string
+	authors      []string
+	contributors []string
+	rights       string
+	content      string
+	summary      string
+	published    *time.Time
+	updated      time.Time
+	episode      *episode
+}
 
-		entries[i] = &SaneEntry{
-			e,
-			selfurl,
+// feedItems returns the items for the feed from its Pageset, along with the
+// time of the newest Page, which is nil if there are no Pages.
+// Pages are used in descending Time order, i.e. Updated > Created; ModTime
+// is the fallback.  At most FeedItems are returned, or for an archive, the
+// Pages of its chunk.
+func (s *Site) feedItems(f *feed) ([]*feedItem, *time.Time) {
+
+	var newest *time.Time
+	pages := f.pageset.ByTime()
+	if f.archive > 0 {
+		pages = s.feedArchivePages(f)
+	}
+	if len(pages) > 0 {
+		newest = pages[0].Time()
+	}
+	if len(pages) > s.FeedItems && f.archive == 0 {
+		pages = pages[:s.FeedItems]
+	}
+
+	items := []*feedItem{}
+	for _, p := range pages {
+		ts := p.Time()
+
+		// If we have no page Authors or Author, try the site Owner.
+		authors := p.MetaStringArray("Authors")
+		if len(authors) == 0 {
+			if author := p.Author(); author != "" {
+				authors = []string{author}
+			} else {
+				authors = []string{s.Owner}
+			}
 		}
 
+		purl := s.PageURL(p)
+		items = append(items, &feedItem{
+			page:         p,
+			title:        p.Title(),
+			url:          purl,
+			authors:      authors,
+			contributors: p.MetaStringArray("Contributors"),
+			rights:       p.MetaString("Rights"),
+			content:      absoluteLinks(string(p.Content), purl),
+			summary:      p.Summary(),
+			published:    p.Created(),
+			updated:      *ts,
+			episode:      s.pageEpisode(p, purl),
+		})
 	}
-	f.Entry = entries[:total]
-	return f
+	return items, newest
+
+}
+
+// absoluteLinks returns the HTML content with the relative href and src
+// attributes resolved against the base URL, so that they work wherever the
+// content is read.
+func absoluteLinks(content, base string) string {
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return content
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range linkRx.FindAllStringSubmatchIndex(content, -1) {
+		start, end := m[2], m[3]
+		if start < 0 {
+			start, end = m[4], m[5]
+		}
+		link := html.UnescapeString(content[start:end])
+		u, err := url.Parse(strings.TrimSpace(link))
+		if err != nil || u.Scheme != "" {
+			continue
+		}
+		b.WriteString(content[last:start])
+		b.WriteString(html.EscapeString(baseURL.ResolveReference(u).String()))
+		last = end
+	}
+	b.WriteString(content[last:])
+	return b.String()
 
 }
@@ -1,10 +1,15 @@
-// feed_test.go -- tests for the kisipar Atom feed generator.
+// feed_test.go -- tests for the kisipar feed generators.
 // ------------
 
 package site_test
 
 import (
 	// Standard:
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path"
+	"path/filepath"
 	"testing"
 
 	// Third-party:
@@ -30,8 +35,8 @@ func Test_Feed_SiteDefaults(t *testing.T) {
 	f := s.Feed(nil)
 	assert.Equal("Anonymous Kisipar Site", f.Title)
 	assert.Equal("http://localhost:8020/feed.xml", f.ID)
-	if assert.NotNil(f.Author, "author set") {
-		assert.Equal("Anonymous Kisipar Fan", f.Author.Name)
+	if assert.Equal(1, len(f.Author), "author set") {
+		assert.Equal("Anonymous Kisipar Fan", f.Author[0].Name)
 	}
 
 }
@@ -57,8 +62,8 @@ func Test_Feed_EntryDefaults(t *testing.T) {
 		e := f.Entry[0]
 		assert.Equal("foo", e.Title)
 		assert.Equal("http://localhost:8020/foo", e.ID)
-		if assert.NotNil(e.Author, "author set") {
-			assert.Equal("Anonymous Kisipar Fan", e.Author.Name)
+		if assert.Equal(1, len(e.Author), "author set") {
+			assert.Equal("Anonymous Kisipar Fan", e.Author[0].Name)
 		}
 	}
 
@@ -185,3 +190,504 @@ Pages:
 	}
 
 }
+
+var feedFormatsYaml = `# FEED FORMATS TEST
+Name: Feed Formats & Co.
+Owner: Site Owner
+FeedItems: 2
+Pages:
+    a.md: |
+        # One
+
+            Author: Page Author
+            Created: 2017-01-02
+            Summary: This <summary> is text.
+
+        Content here.
+    b.md: "# Two"
+    c.md: "# Three"
+`
+
+func Test_JSONFeed(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(feedFormatsYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := s.JSONFeed(nil)
+	assert.Equal("https://jsonfeed.org/version/1.1", f.Version, "version set")
+	assert.Equal("Feed Formats & Co.", f.Title, "title set")
+	assert.Equal("http://localhost:8020/", f.HomePageURL, "home page set")
+	assert.Equal("http://localhost:8020/feed.json", f.FeedURL, "feed URL set")
+	if assert.Equal(1, len(f.Authors), "one feed author") {
+		assert.Equal("Site Owner", f.Authors[0].Name, "owner is author")
+	}
+
+	atom := s.Feed(nil)
+	if assert.Equal(2, len(f.Items), "FeedItems sets limit") {
+		for i, item := range f.Items {
+			assert.Equal(atom.Entry[i].ID, item.ID, "same items as Atom")
+		}
+	}
+	for _, item := range f.Items {
+		if item.Title != "One" {
+			assert.Empty(item.DatePublished, "no Created, no date_published")
+			assert.Equal("Site Owner", item.Authors[0].Name, "owner fallback")
+			continue
+		}
+		assert.Equal("http://localhost:8020/a", item.URL, "url set")
+		assert.Equal("<p>Content here.</p>\n", item.ContentHTML,
+			"content set")
+		assert.Equal("This <summary> is text.", item.Summary, "summary set")
+		assert.Equal("2017-01-02T00:00:00Z", item.DatePublished,
+			"date_published from Created")
+		assert.NotEmpty(item.DateModified, "date_modified set")
+		assert.Equal("Page Author", item.Authors[0].Name, "page author")
+	}
+
+}
+
+func Test_RSSFeed(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(feedFormatsYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := s.RSSFeed(nil)
+	assert.Equal("2.0", f.Version, "version set")
+	c := f.Channel
+	assert.Equal("Feed Formats & Co.", c.Title, "title set")
+	assert.Equal("http://localhost:8020/", c.Link, "link set")
+	assert.Equal("http://localhost:8020/rss.xml", c.AtomLink[0].Href,
+		"self link set")
+
+	atom := s.Feed(nil)
+	if assert.Equal(2, len(c.Item), "FeedItems sets limit") {
+		for i, item := range c.Item {
+			assert.Equal(atom.Entry[i].ID, item.GUID.Value, "same items as Atom")
+		}
+	}
+	for _, item := range c.Item {
+		if item.Title != "One" {
+			assert.Equal(item.Content, item.Description,
+				"no summary, content for description")
+			assert.Equal([]string{"Site Owner"}, item.Creator, "owner fallback")
+			continue
+		}
+		assert.Equal("http://localhost:8020/a", item.Link, "link set")
+		assert.True(item.GUID.IsPermaLink, "guid is permalink")
+		assert.Equal("This &lt;summary&gt; is text.", item.Description,
+			"summary as HTML for description")
+		assert.Equal("<p>Content here.</p>\n", item.Content, "content set")
+		assert.Equal("Mon, 02 Jan 2017 00:00:00 +0000", item.PubDate,
+			"pubDate from Created")
+		assert.Equal([]string{"Page Author"}, item.Creator, "page author")
+	}
+
+}
+
+func Test_MainHandler_FeedFormats(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(feedFormatsYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, rec := ReqAndRec(t, "http://example.com/feed.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "Atom served")
+	assert.Equal("application/atom+xml", rec.Header().Get("Content-Type"),
+		"Atom content type")
+
+	req, rec = ReqAndRec(t, "http://example.com/feed.json")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "JSON Feed served")
+	assert.Equal("application/feed+json", rec.Header().Get("Content-Type"),
+		"JSON Feed content type")
+	jf := &site.JSONFeed{}
+	if assert.NoError(json.Unmarshal(rec.Body.Bytes(), jf), "valid JSON") {
+		assert.Equal(2, len(jf.Items), "items included")
+	}
+
+	req, rec = ReqAndRec(t, "http://example.com/rss.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "RSS served")
+	assert.Equal("application/rss+xml", rec.Header().Get("Content-Type"),
+		"RSS content type")
+	assert.Regexp(`^<\?xml version="1.0" encoding="UTF-8"\?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"`,
+		rec.Body.String(), "RSS document")
+	rf := &site.RSSFeed{}
+	if assert.NoError(xml.Unmarshal(rec.Body.Bytes(), rf), "valid XML") {
+		assert.Equal(2, len(rf.Channel.Item), "items included")
+	}
+
+	s.JSONFeedPath = ""
+	req, rec = ReqAndRec(t, "http://example.com/feed.json")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "JSON Feed not served with empty path")
+
+	s.NoFeed = true
+	req, rec = ReqAndRec(t, "http://example.com/rss.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "RSS not served with NoFeed")
+
+}
+
+func Test_MainHandler_FeedPaths(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(`# FEED PATHS TEST
+JSONFeedPath: /feeds/main.json
+RSSFeedPath: ""
+Pages:
+    a.md: "# One"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, rec := ReqAndRec(t, "http://example.com/feeds/main.json")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "JSON Feed served at JSONFeedPath")
+
+	req, rec = ReqAndRec(t, "http://example.com/rss.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "RSS disabled by empty RSSFeedPath")
+
+}
+
+func Test_FeedLinks(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(feedFormatsYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `<link rel="alternate" type="application/atom+xml" title="Feed Formats &amp; Co." href="http://localhost:8020/feed.xml">
+<link rel="alternate" type="application/feed+json" title="Feed Formats &amp; Co." href="http://localhost:8020/feed.json">
+<link rel="alternate" type="application/rss+xml" title="Feed Formats &amp; Co." href="http://localhost:8020/rss.xml">`
+	assert.Equal(exp, string(s.FeedLinks()), "links for all formats")
+
+	s.RSSFeedPath = ""
+	assert.NotContains(string(s.FeedLinks()), "rss", "disabled format skipped")
+
+	s.NoFeed = true
+	assert.Equal("", string(s.FeedLinks()), "no links with NoFeed")
+
+}
+
+func Test_FeedLinks_Template(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "templates", "single.html"),
+		`<head>{{ .Site.FeedLinks }}</head>`)
+	writeFile(t, filepath.Join(dir, "config.yaml"), "NoFeed: true")
+	s, err := site.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, rec := ReqAndRec(t, "http://example.com/foo")
+	s.ServeHTTP(rec, req)
+	assert.Equal("<head></head>", rec.Body.String(), "no feeds, no links")
+
+	writeFile(t, filepath.Join(dir, "config.yaml"),
+		"FeedTitle: Watched\nJSONFeedPath: \"\"\nRSSFeedPath: \"\"")
+	s, err = site.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, rec = ReqAndRec(t, "http://example.com/foo")
+	s.ServeHTTP(rec, req)
+	assert.Equal(`<head><link rel="alternate" type="application/atom+xml" title="Watched" href="http://localhost:8020/feed.xml"></head>`,
+		rec.Body.String(), "links not escaped in template")
+
+}
+
+var subFeedsYaml = `# SUB FEEDS TEST
+Name: Sub Feeds
+FeedTitles:
+    /tags/go: All About Go
+Pages:
+    blog/index.md: "# The Blog"
+    blog/a.md: |
+        # Blog A
+
+            Tags: [Go, misc]
+    blog/deep/b.md: "# Blog B"
+    other.md: |
+        # Other
+
+            Tags: [go]
+    hidden.md: |
+        # Hidden
+
+            Tags: [go, secret]
+            Unlisted: true
+`
+
+func Test_MainHandler_SectionFeeds(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(subFeedsYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, rec := ReqAndRec(t, "http://example.com/blog/feed.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "section Atom feed served")
+	f := &site.AtomFeed{}
+	if assert.NoError(xml.Unmarshal(rec.Body.Bytes(), f), "valid XML") {
+		assert.Equal("Sub Feeds: The Blog", f.Title, "title from index")
+		assert.Equal("http://localhost:8020/blog/feed.xml", f.ID, "ID set")
+		if assert.Equal(2, len(f.Link), "two links") {
+			assert.Equal("http://localhost:8020/blog/feed.xml", f.Link[0].Href,
+				"self link set")
+			assert.Equal("http://localhost:8020/blog", f.Link[1].Href,
+				"alternate link to section")
+		}
+		assert.Equal(3, len(f.Entry), "section pages included")
+	}
+
+	req, rec = ReqAndRec(t, "http://example.com/blog/deep/feed.json")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "nested section JSON Feed served")
+	jf := &site.JSONFeed{}
+	if assert.NoError(json.Unmarshal(rec.Body.Bytes(), jf), "valid JSON") {
+		assert.Equal("Sub Feeds: deep", jf.Title, "title from directory")
+		assert.Equal("http://localhost:8020/blog/deep/feed.json", jf.FeedURL,
+			"feed URL set")
+		if assert.Equal(1, len(jf.Items), "one item") {
+			assert.Equal("Blog B", jf.Items[0].Title, "nested page")
+		}
+	}
+
+	for _, rpath := range []string{"/other/feed.xml", "/nope/rss.xml",
+		"/blog/nope.xml"} {
+		req, rec = ReqAndRec(t, "http://example.com"+rpath)
+		s.ServeHTTP(rec, req)
+		assert.Equal(404, rec.Code, "no feed at %s", rpath)
+	}
+
+	s.NoSectionFeeds = true
+	req, rec = ReqAndRec(t, "http://example.com/blog/feed.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "no section feeds with NoSectionFeeds")
+
+}
+
+func Test_MainHandler_TagFeeds(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(subFeedsYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, rec := ReqAndRec(t, "http://example.com/tags/go/rss.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "tag RSS feed served")
+	rf := &site.RSSFeed{}
+	if assert.NoError(xml.Unmarshal(rec.Body.Bytes(), rf), "valid XML") {
+		c := rf.Channel
+		assert.Equal("All About Go", c.Title, "title from FeedTitles")
+		titles := []string{}
+		for _, item := range c.Item {
+			titles = append(titles, item.Title)
+		}
+		assert.ElementsMatch([]string{"Blog A", "Other"}, titles,
+			"tagged pages included, any case, unlisted excluded")
+	}
+
+	req, rec = ReqAndRec(t, "http://example.com/tags/misc/feed.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "tag Atom feed served")
+	f := &site.AtomFeed{}
+	if assert.NoError(xml.Unmarshal(rec.Body.Bytes(), f), "valid XML") {
+		assert.Equal("Sub Feeds: misc", f.Title, "default title from tag")
+		assert.Equal("http://localhost:8020/tags/misc/feed.xml", f.ID,
+			"ID set")
+	}
+
+	for _, rpath := range []string{"/tags/secret/feed.xml",
+		"/tags/nope/feed.xml", "/tags/feed.xml"} {
+		req, rec = ReqAndRec(t, "http://example.com"+rpath)
+		s.ServeHTTP(rec, req)
+		assert.Equal(404, rec.Code, "no feed at %s", rpath)
+	}
+
+	s.TagFeedPath = "/topics"
+	req, rec = ReqAndRec(t, "http://example.com/topics/go/feed.json")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "tag feed served under TagFeedPath")
+
+	s.NoTagFeeds = true
+	req, rec = ReqAndRec(t, "http://example.com/topics/go/feed.json")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "no tag feeds with NoTagFeeds")
+
+}
+
+func Test_Export_SubFeeds(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(subFeedsYaml + `
+RSSFeedPath: ""
+JSONFeedPath: ""
+NoSitemap: true
+NoRobots: true
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := exportDir(t)
+	defer os.RemoveAll(dir)
+
+	report, err := s.Export(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feeds := []string{}
+	for _, name := range report.Written {
+		if path.Base(name) == "feed.xml" {
+			feeds = append(feeds, name)
+		}
+	}
+	assert.Equal([]string{
+		"blog/deep/feed.xml",
+		"blog/feed.xml",
+		"feed.xml",
+		"tags/go/feed.xml",
+		"tags/misc/feed.xml",
+	}, feeds, "section and tag feeds exported")
+
+}
+
+func Test_FeedTitles_Error(t *testing.T) {
+
+	_, err := site.LoadVirtualYaml(`# BAD FEED TITLES
+FeedTitles: [nope]
+`)
+	assert.EqualError(t, err, "Config FeedTitles is not a map.",
+		"error for non-map FeedTitles")
+
+}
+
+func Test_Feed_AtomEntryDetails(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(`# ATOM TEST
+Name: Atom Test
+FeedRights: Copyright the Site.
+Pages:
+    blog/post.md: |
+        # Post
+
+            Authors: [Ann, Bob]
+            Contributors: Cy, Di
+            Tags: [go, feeds]
+            Rights: Copyright Ann.
+
+        <a href="other">other</a> <img src='/img/x.png'>
+        <a href="https://example.com/y?a=1&amp;b=2">abs</a>
+        <a href="#top">top</a> <a href="../up?a=1&amp;b=2">up</a>
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := s.Feed(nil)
+	assert.Equal("http://localhost:8020/", f.XMLBase, "feed xml:base set")
+	if assert.NotNil(f.Rights, "feed rights set") {
+		assert.Equal("Copyright the Site.", f.Rights.Body, "FeedRights used")
+	}
+	if !assert.Equal(1, len(f.Entry), "one entry") {
+		return
+	}
+	e := f.Entry[0]
+	assert.Equal("http://localhost:8020/blog/post", e.XMLBase,
+		"entry xml:base set")
+	assert.Equal([]*site.AtomPerson{{Name: "Ann"}, {Name: "Bob"}}, e.Author,
+		"authors from Authors")
+	assert.Equal([]*site.AtomPerson{{Name: "Cy"}, {Name: "Di"}},
+		e.Contributor, "contributors from Contributors")
+	assert.Equal([]*site.AtomCategory{{Term: "go"}, {Term: "feeds"}},
+		e.Category, "categories from Tags")
+	if assert.NotNil(e.Rights, "entry rights set") {
+		assert.Equal("Copyright Ann.", e.Rights.Body, "Rights used")
+	}
+	body := e.Content.Body
+	assert.Contains(body, `href="http://localhost:8020/blog/other"`,
+		"relative link made absolute")
+	assert.Contains(body, `src='http://localhost:8020/img/x.png'`,
+		"root-relative image made absolute")
+	assert.Contains(body, `href="https://example.com/y?a=1&amp;b=2"`,
+		"absolute link untouched")
+	assert.Contains(body, `href="http://localhost:8020/blog/post#top"`,
+		"fragment made absolute")
+	assert.Contains(body, `href="http://localhost:8020/up?a=1&amp;b=2"`,
+		"entities preserved")
+
+	jf := s.JSONFeed(nil)
+	assert.Equal(body, jf.Items[0].ContentHTML, "JSON Feed content the same")
+	assert.Equal([]*site.JSONFeedAuthor{{Name: "Ann"}, {Name: "Bob"}},
+		jf.Items[0].Authors, "JSON Feed authors the same")
+
+}
+
+func Test_MainHandler_AtomXML(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(`# ATOM XML TEST
+Name: Atom XML
+Pages:
+    a.md: |
+        # Alpha
+
+            Tags: [x]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, rec := ReqAndRec(t, "http://example.com/feed.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "Atom served")
+	body := rec.Body.String()
+	assert.Regexp(`^<\?xml version="1.0" encoding="UTF-8"\?>
+<feed xmlns="http://www.w3.org/2005/Atom" xml:base="http://localhost:8020/">
+    <title>Atom XML</title>
+    <id>http://localhost:8020/feed.xml</id>
+    <link rel="self" href="http://localhost:8020/feed.xml" type="application/atom\+xml"></link>
+    <link rel="alternate" href="http://localhost:8020/" type="text/html"></link>
+    <updated>[^<]+</updated>
+    <author>
+        <name>Anonymous Kisipar Fan</name>
+    </author>
+    <entry xml:base="http://localhost:8020/a">
+        <title>Alpha</title>`, body, "feed XML as expected")
+	assert.Contains(body, `<category term="x"></category>`, "category")
+	assert.NotContains(body, "<rights>", "no empty rights")
+	assert.NotContains(body, "<contributor>", "no empty contributors")
+
+	f := &site.AtomFeed{}
+	if assert.NoError(xml.Unmarshal(rec.Body.Bytes(), f), "valid XML") {
+		assert.Equal(1, len(f.Entry), "entry read back")
+	}
+
+}
@@ -0,0 +1,123 @@
+// feedarchive.go - RFC 5005 archived feeds for the Kisipar site.
+// --------------
+//
+// USEFUL: https://www.rfc-editor.org/rfc/rfc5005#section-4
+
+package site
+
+import (
+	// Standard:
+	"path"
+	"strconv"
+	"strings"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/page"
+)
+
+// FEED_HISTORY_NS is the namespace of the Feed History elements.
+const FEED_HISTORY_NS = "http://purl.org/syndication/history/1.0"
+
+// A FeedArchive marks an archive document: <fh:archive/>.
+type FeedArchive struct{}
+
+// feedArchivePath returns the path of the archive numbered n of the feed
+// served at fpath: "/feed.xml" has "/feed-1.xml", "/feed-2.xml" etc.
+func feedArchivePath(fpath string, n int) string {
+	ext := path.Ext(fpath)
+	return strings.TrimSuffix(fpath, ext) + "-" + strconv.Itoa(n) + ext
+}
+
+// feedArchiveNumber returns the number of the archive of the feed served at
+// fpath if rpath is the path of one, otherwise zero.
+func feedArchiveNumber(rpath, fpath string) int {
+	ext := path.Ext(fpath)
+	prefix := strings.TrimSuffix(fpath, ext) + "-"
+	if !strings.HasPrefix(rpath, prefix) || !strings.HasSuffix(rpath, ext) ||
+		len(rpath) <= len(prefix)+len(ext) {
+		return 0
+	}
+	num := rpath[len(prefix) : len(rpath)-len(ext)]
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 1 || strconv.Itoa(n) != num {
+		return 0
+	}
+	return n
+}
+
+// feedArchiveItems returns the number of items in each archive: the
+// FeedArchiveItems, if set and not more than the FeedItems, otherwise the
+// FeedItems.
+func (s *Site) feedArchiveItems() int {
+	if s.FeedArchiveItems > 0 && s.FeedArchiveItems < s.FeedItems {
+		return s.FeedArchiveItems
+	}
+	return s.FeedItems
+}
+
+// feedArchives returns the number of archives of the feed.  Only the main
+// feed is archived, and only once it has more Pages than FeedItems.
+//
+// The archives hold the Pages in chunks from the oldest, so the first
+// archive has the oldest Pages, and only complete chunks are archived: an
+// archive does not change when Pages are added.  Pages not yet archived are
+// all in the feed itself, which may also have Pages already archived.
+func (s *Site) feedArchives(f *feed) int {
+
+	if s.NoFeedArchives || f.dir != "" || f.pageset == nil {
+		return 0
+	}
+	size := s.feedArchiveItems()
+	total := len(f.pageset.ByTime())
+	if size < 1 || total <= s.FeedItems {
+		return 0
+	}
+	return total / size
+
+}
+
+// feedArchivePages returns the Pages of the archive feed, newest first.
+func (s *Site) feedArchivePages(f *feed) []*page.Page {
+
+	pages := f.pageset.ByTime()
+	if f.archive > s.feedArchives(f) {
+		return nil
+	}
+	size := s.feedArchiveItems()
+	end := len(pages) - (f.archive-1)*size
+	return pages[end-size : end]
+
+}
+
+// A feedArchiveLink is a link between a feed and its archives.
+type feedArchiveLink struct {
+	rel  string
+	href string
+}
+
+// feedArchiveLinks returns the links of the feed in the format served at
+// fpath to its archives: from the feed itself to its newest archive, and
+// from each archive to the feed and the archives before and after it.
+func (s *Site) feedArchiveLinks(f *feed, fpath string) []*feedArchiveLink {
+
+	count := s.feedArchives(f)
+	if count == 0 {
+		return nil
+	}
+	if f.archive == 0 {
+		return []*feedArchiveLink{
+			{"prev-archive", s.BaseURL + feedArchivePath(fpath, count)},
+		}
+	}
+	links := []*feedArchiveLink{{"current", s.BaseURL + fpath}}
+	if f.archive > 1 {
+		links = append(links, &feedArchiveLink{"prev-archive",
+			s.BaseURL + feedArchivePath(fpath, f.archive-1)})
+	}
+	if f.archive < count {
+		links = append(links, &feedArchiveLink{"next-archive",
+			s.BaseURL + feedArchivePath(fpath, f.archive+1)})
+	}
+	return links
+
+}
@@ -0,0 +1,268 @@
+// feedarchive_test.go - tests for the Kisipar archived feeds.
+// -------------------
+
+package site_test
+
+import (
+	// Standard:
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	// Third-party:
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/page"
+	"github.com/biztos/kisipar/site"
+)
+
+// archiveSite returns a site with n pages, "P1" being the oldest, with
+// three items in its feeds and two in each archive.
+func archiveSite(t *testing.T, n int, extra string) *site.Site {
+
+	yaml := "# ARCHIVE TEST\nFeedItems: 3\nFeedArchiveItems: 2\n" + extra +
+		"\nPages:\n"
+	for i := 1; i <= n; i++ {
+		yaml += fmt.Sprintf(`    p%d.md: |
+        # P%d
+
+            Created: 2017-01-%02d
+`, i, i, i)
+	}
+	s, err := site.LoadVirtualYaml(yaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+
+}
+
+// atomLinks returns the hrefs of the feed links by rel.
+func atomLinks(f *site.AtomFeed) map[string]string {
+	links := map[string]string{}
+	for _, link := range f.Link {
+		links[link.Rel] = link.Href
+	}
+	return links
+}
+
+// fetchAtom returns the Atom feed served at the path.
+func fetchAtom(t *testing.T, s *site.Site, rpath string) *site.AtomFeed {
+	req, rec := ReqAndRec(t, "http://example.com"+rpath)
+	s.ServeHTTP(rec, req)
+	f := &site.AtomFeed{}
+	if err := xml.Unmarshal(rec.Body.Bytes(), f); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// atomTitles returns the titles of the feed entries.
+func atomTitles(f *site.AtomFeed) []string {
+	titles := []string{}
+	for _, e := range f.Entry {
+		titles = append(titles, e.Title)
+	}
+	return titles
+}
+
+func Test_Feed_Archives(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s := archiveSite(t, 7, "")
+	f := s.Feed(nil)
+	assert.Equal([]string{"P7", "P6", "P5"}, atomTitles(f), "newest in feed")
+	assert.Nil(f.Archive, "feed is not an archive")
+	assert.Equal(map[string]string{
+		"self":         "http://localhost:8020/feed.xml",
+		"alternate":    "http://localhost:8020/",
+		"prev-archive": "http://localhost:8020/feed-3.xml",
+	}, atomLinks(f), "feed links to newest archive")
+
+	exp := map[string]struct {
+		titles []string
+		links  map[string]string
+	}{
+		"/feed-1.xml": {
+			[]string{"P2", "P1"},
+			map[string]string{
+				"self":         "http://localhost:8020/feed-1.xml",
+				"alternate":    "http://localhost:8020/",
+				"current":      "http://localhost:8020/feed.xml",
+				"next-archive": "http://localhost:8020/feed-2.xml",
+			},
+		},
+		"/feed-2.xml": {
+			[]string{"P4", "P3"},
+			map[string]string{
+				"self":         "http://localhost:8020/feed-2.xml",
+				"alternate":    "http://localhost:8020/",
+				"current":      "http://localhost:8020/feed.xml",
+				"prev-archive": "http://localhost:8020/feed-1.xml",
+				"next-archive": "http://localhost:8020/feed-3.xml",
+			},
+		},
+		"/feed-3.xml": {
+			[]string{"P6", "P5"},
+			map[string]string{
+				"self":         "http://localhost:8020/feed-3.xml",
+				"alternate":    "http://localhost:8020/",
+				"current":      "http://localhost:8020/feed.xml",
+				"prev-archive": "http://localhost:8020/feed-2.xml",
+			},
+		},
+	}
+	for rpath, e := range exp {
+		req, rec := ReqAndRec(t, "http://example.com"+rpath)
+		s.ServeHTTP(rec, req)
+		if !assert.Equal(200, rec.Code, "archive %s served", rpath) {
+			continue
+		}
+		assert.Contains(rec.Body.String(),
+			`<feed xmlns="http://www.w3.org/2005/Atom" xml:base="http://localhost:8020/" xmlns:fh="http://purl.org/syndication/history/1.0">`,
+			"history namespace in %s", rpath)
+		assert.Contains(rec.Body.String(), "<fh:archive></fh:archive>",
+			"%s marked as archive", rpath)
+		af := &site.AtomFeed{}
+		if assert.NoError(xml.Unmarshal(rec.Body.Bytes(), af), "valid XML") {
+			assert.Equal(e.titles, atomTitles(af), "entries in %s", rpath)
+			assert.Equal(e.links, atomLinks(af), "links in %s", rpath)
+		}
+	}
+
+	for _, rpath := range []string{"/feed-0.xml", "/feed-4.xml",
+		"/feed-01.xml", "/feed-x.xml", "/feed-.xml"} {
+		req, rec := ReqAndRec(t, "http://example.com"+rpath)
+		s.ServeHTTP(rec, req)
+		assert.Equal(404, rec.Code, "no archive at %s", rpath)
+	}
+
+}
+
+func Test_Feed_ArchivesStable(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s := archiveSite(t, 7, "")
+	before := atomTitles(fetchAtom(t, s, "/feed-1.xml"))
+
+	p, err := page.LoadVirtualString("/p8.md", "# P8\n\n    Created: 2017-01-08\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Pageset.AddPage(p)
+	assert.Equal(before, atomTitles(fetchAtom(t, s, "/feed-1.xml")),
+		"archive unchanged by new page")
+	assert.Equal("http://localhost:8020/feed-4.xml",
+		atomLinks(s.Feed(nil))["prev-archive"], "new archive linked")
+
+}
+
+func Test_Feed_ArchivesOtherFormats(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s := archiveSite(t, 7, "")
+
+	req, rec := ReqAndRec(t, "http://example.com/rss-2.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "RSS archive served")
+	body := rec.Body.String()
+	assert.Contains(body, `xmlns:fh="http://purl.org/syndication/history/1.0"`,
+		"history namespace")
+	assert.Contains(body, `
+        <atom:link href="http://localhost:8020/rss-2.xml" rel="self" type="application/rss+xml"></atom:link>
+        <atom:link href="http://localhost:8020/rss.xml" rel="current" type="application/rss+xml"></atom:link>
+        <atom:link href="http://localhost:8020/rss-1.xml" rel="prev-archive" type="application/rss+xml"></atom:link>
+        <atom:link href="http://localhost:8020/rss-3.xml" rel="next-archive" type="application/rss+xml"></atom:link>
+        <fh:archive></fh:archive>`, body, "RSS archive links")
+	assert.Equal(2, strings.Count(body, "<item>"), "RSS archive items")
+
+	req, rec = ReqAndRec(t, "http://example.com/rss.xml")
+	s.ServeHTTP(rec, req)
+	assert.Contains(rec.Body.String(), `<atom:link href="http://localhost:8020/rss-3.xml" rel="prev-archive"`,
+		"RSS feed links to newest archive")
+	assert.NotContains(rec.Body.String(), "fh:", "RSS feed not an archive")
+
+	req, rec = ReqAndRec(t, "http://example.com/feed.json")
+	s.ServeHTTP(rec, req)
+	jf := &site.JSONFeed{}
+	if assert.NoError(json.Unmarshal(rec.Body.Bytes(), jf), "valid JSON") {
+		assert.Equal("http://localhost:8020/feed-3.json", jf.NextURL,
+			"JSON Feed next is newest archive")
+	}
+	req, rec = ReqAndRec(t, "http://example.com/feed-1.json")
+	s.ServeHTTP(rec, req)
+	jf = &site.JSONFeed{}
+	if assert.NoError(json.Unmarshal(rec.Body.Bytes(), jf), "valid JSON") {
+		assert.Equal("http://localhost:8020/feed-1.json", jf.FeedURL,
+			"JSON Feed archive URL")
+		assert.Empty(jf.NextURL, "oldest archive has no next")
+		assert.Equal(2, len(jf.Items), "JSON Feed archive items")
+	}
+
+}
+
+func Test_Feed_NoArchives(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s := archiveSite(t, 3, "")
+	assert.NotContains(atomLinks(s.Feed(nil)), "prev-archive",
+		"no archives until more pages than FeedItems")
+	req, rec := ReqAndRec(t, "http://example.com/feed-1.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "no archive served")
+
+	s = archiveSite(t, 7, "NoFeedArchives: true")
+	assert.NotContains(atomLinks(s.Feed(nil)), "prev-archive",
+		"no archives with NoFeedArchives")
+	req, rec = ReqAndRec(t, "http://example.com/feed-1.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "no archive served with NoFeedArchives")
+
+	s = archiveSite(t, 7, "FeedArchiveItems: 5")
+	assert.Equal("http://localhost:8020/feed-2.xml",
+		atomLinks(s.Feed(nil))["prev-archive"],
+		"archives no bigger than FeedItems")
+
+}
+
+func Test_Export_FeedArchives(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s := archiveSite(t, 5, "NoSitemap: true\nNoRobots: true")
+	dir := exportDir(t)
+	defer os.RemoveAll(dir)
+
+	report, err := s.Export(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feeds := []string{}
+	for _, name := range report.Written {
+		if strings.HasPrefix(name, "feed") || strings.HasPrefix(name, "rss") {
+			feeds = append(feeds, name)
+		}
+	}
+	assert.Equal([]string{
+		"feed-1.json",
+		"feed-1.xml",
+		"feed-2.json",
+		"feed-2.xml",
+		"feed.json",
+		"feed.xml",
+		"rss-1.xml",
+		"rss-2.xml",
+		"rss.xml",
+	}, feeds, "archives exported")
+	assert.Contains(readExport(t, dir, "feed-1.xml"), "<title>P1</title>",
+		"archive content exported")
+
+}
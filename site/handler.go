@@ -6,8 +6,8 @@ package site
 import (
 	// Standard:
 	"bytes"
-	"encoding/xml"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"path"
@@ -89,26 +89,33 @@ func (s *Site) NewServeMux(handlers ...*PatternHandler) *http.ServeMux {
 // MainHandler returns an HTTP handler function applying the Kisipar logic
 // to the current Site.  That logic, in a nutshell, is:
 //
-// 1. Static files take priority, followed by Pages, then page assets.
+// 1. Redirects and rewrites come first, even before static files; cf.
+//    Redirect.
 //
-// 2. Static paths containing no extension look for an "index.html" file under
+// 2. Static files take priority, followed by Pages, then page assets.
+//
+// 3. Static paths containing no extension look for an "index.html" file under
 //    the implied directory, e.g.: "/foo" will match "/foo/index.html".
 //
-// 3. Requests containing a dot (".") anywhere in the cleaned path are not
+// 4. Requests containing a dot (".") anywhere in the cleaned path are not
 //    considered potential Pages; those not containing any extension are not
 //    considered potential page-asset files.
 //
-// 4. Pages are sought at the path key first, then at its index, e.g.:
+// 5. Pages are sought at the path key first, then at its index, e.g.:
 //    "foo/bar" -> "foo/bar.md" OR "foo/bar/index.md" (where the ".md"
 //    extension is the first match from the Site's PageExtensions).
 //
-// 5. Directories are treated as not-found.
+// 6. Directories are treated as not-found.
 //
-// 6. Page source files are available as page assets *only* if the Site's
+// 7. Page source files are available as page assets *only* if the Site's
 //    ServePageSources property is set to true; otherwise no page asset
-//    with an extension matching the Site's PageExtensions will be found.
+//    with an extension matching the Site's PageExtensions, nor any
+//    CASCADE_FILE, will be found.
+//
+// 8. Pages with custom routes are found only at those, and their Aliases
+//    redirect to them permanently; cf. Permalinks.
 //
-// 7. If the top of the site is not otherwise handled, a simple default page
+// 9. If the top of the site is not otherwise handled, a simple default page
 //    is served.
 func (s *Site) MainHandler() func(w http.ResponseWriter, req *http.Request) {
 
@@ -123,6 +130,22 @@ func (s *Site) MainHandler() func(w http.ResponseWriter, req *http.Request) {
 
 		// TODO: special cases as needed
 
+		// Browsers listen here for changes in DevMode.
+		if s.DevMode && rpath == DEV_EVENTS_PATH {
+			s.serveDevEvents(w, req)
+			return
+		}
+
+		// Redirects beat even static files, as they are how a site moves;
+		// rewrites carry on with the rewritten request.
+		if r, target := s.RedirectFor(rpath); r != nil {
+			if !r.Rewrite {
+				s.sendRedirect(w, req, r, target)
+				return
+			}
+			req, rpath = rewriteRequest(req, target)
+		}
+
 		// Static beats everything else, because you may need to drop in
 		// a static file in an emergency.  This includes special cases such
 		// as the feed.
@@ -136,11 +159,39 @@ func (s *Site) MainHandler() func(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 
+		// Likewise the sitemap and robots.txt.
+		if s.handleSitemap(w, req, rpath) {
+			return
+		}
+		if s.handleRobots(w, req, rpath) {
+			return
+		}
+
+		// Search, if enabled, unless there is a Page at its path.
+		if s.handleSearch(w, req, rpath) {
+			return
+		}
+
+		// Calendars of events, before the Pages they belong to.
+		if s.handleCalendar(w, req, rpath) {
+			return
+		}
+
+		// Old paths of Pages send their visitors on.
+		if s.handleAlias(w, req, rpath) {
+			return
+		}
+
 		// Check for a proper Page, or index.
 		if s.handlePage(w, req, rpath) {
 			return
 		}
 
+		// Refreshing the Page may have given it new aliases.
+		if s.handleAlias(w, req, rpath) {
+			return
+		}
+
 		// Check for page-level assets, which are a special kind of static
 		// file.
 		if s.handleAsset(w, req, rpath) {
@@ -168,6 +219,10 @@ func (s *Site) MainHandler() func(w http.ResponseWriter, req *http.Request) {
 // PageForPath returns a Page from the Site's Pageset for the given cleaned
 // request Path.
 //
+// Pages with custom routes are found at those, and not at their file paths;
+// cf. Permalinks.  They are refreshed like any other Page, and if a Page's
+// custom route or Aliases change, the routes are set again.
+//
 // Exact matches on virtual pages take precedence, but they *must* be on
 // virtual pages: a non-virtual page with a key matching a request path
 // would be a dangerous coincidence, as the Site's PagePath is part of the
@@ -175,7 +230,8 @@ func (s *Site) MainHandler() func(w http.ResponseWriter, req *http.Request) {
 //
 // Otherwise a match is sought in the Pageset after first refreshing the path
 // key.  First the path itself is sought, then the path's index: "foo/bar"
-// then "foo/bar/index".
+// then "foo/bar/index".  If the Site has a running Watcher then the refresh
+// is skipped, as the Watcher keeps the Pageset up to date.
 //
 // Pages not found will result in os.IsNotExist style errors; parse or
 // filesystem errors are returned as-is.
@@ -199,6 +255,33 @@ func (s *Site) PageForPath(rpath string) (*page.Page, error) {
 	if s.Pageset == nil {
 		return nil, os.ErrNotExist
 	}
+	if key := s.routeKey(rpath); key != "" {
+		if !s.watching() {
+			err := s.refreshPage(key)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		if p := s.Pageset.Page(key); p != nil {
+			if route, _ := s.customRoute(p); route == rpath {
+				return p, nil
+			}
+		}
+	}
+
+	p, err := s.pageForFilePath(rpath)
+	if p != nil {
+		if route, _ := s.customRoute(p); route != "" && route != rpath {
+			return nil, os.ErrNotExist
+		}
+	}
+	return p, err
+
+}
+
+// pageForFilePath returns the Page for the request path as per PageForPath,
+// by its file path only.
+func (s *Site) pageForFilePath(rpath string) (*page.Page, error) {
 
 	idxpath := path.Join(rpath, "index")
 
@@ -218,8 +301,19 @@ func (s *Site) PageForPath(rpath string) (*page.Page, error) {
 	key := filepath.Join(s.PagePath, filepath.FromSlash(rpath))
 	idxkey := filepath.Join(s.PagePath, filepath.FromSlash(idxpath))
 
+	// If we are watching, the Pageset is already up to date.
+	if s.watching() {
+		if p := s.Pageset.Page(key); p != nil {
+			return p, nil
+		}
+		if p := s.Pageset.Page(idxkey); p != nil {
+			return p, nil
+		}
+		return nil, os.ErrNotExist
+	}
+
 	// Exact match takes precedence.
-	if err := s.Pageset.RefreshPage(key); err != nil && !os.IsNotExist(err) {
+	if err := s.refreshPage(key); err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
 	if p := s.Pageset.Page(key); p != nil {
@@ -227,7 +321,7 @@ func (s *Site) PageForPath(rpath string) (*page.Page, error) {
 	}
 
 	// Index is our fallback.  Not-found errors are caught here too.
-	if err := s.Pageset.RefreshPage(idxkey); err != nil {
+	if err := s.refreshPage(idxkey); err != nil {
 		return nil, err
 	}
 
@@ -239,18 +333,68 @@ func (s *Site) PageForPath(rpath string) (*page.Page, error) {
 	return s.Pageset.Page(idxkey), nil
 }
 
-// TODO: gussy these up! Use templates and Dots if available, etc.
-func (s *Site) sendInternalServerError(w http.ResponseWriter, req *http.Request, err error) {
-	// TODO: log the error, don't put it here.
-	w.WriteHeader(http.StatusInternalServerError)
-	fmt.Fprintf(w, "ERROR: %s\n", err.Error())
+// sendError sends an error page for the HTTP status, rendered with the
+// template chosen by Dot.ErrorTemplate.  Any error is logged for server
+// errors (5xx), but is only passed to the template in DevMode.  Should the
+// error template itself fail, a plain-text page is sent instead.
+func (s *Site) sendError(w http.ResponseWriter, req *http.Request, status int, err error) {
+
+	if err != nil && status >= 500 {
+		log.Printf("%s: %d error for %s: %s", s.Name, status, req.URL.Path, err)
+	}
+
+	body, ctype := s.renderError(req, status, err)
+	w.Header().Set("Content-Type", ctype)
+	w.WriteHeader(status)
+	w.Write(body)
+
+}
+
+// renderError renders the error page for sendError, returning the body and
+// its content type.
+func (s *Site) renderError(req *http.Request, status int, err error) ([]byte, string) {
+
+	dot := &Dot{
+		Request: req,
+		Site:    s,
+		Now:     time.Now(),
+		Status:  status,
+	}
+	var problem *DevError
+	if s.DevMode && err != nil {
+		problem = s.DevError(err)
+		dot.Error = problem
+	}
+
+	ctype := "text/html; charset=utf-8"
+	buf := new(bytes.Buffer)
+	tmpl := dot.ErrorTemplate()
+	if terr := tmpl.Execute(buf, dot); terr != nil {
+		log.Printf("%s: error template %s failed: %s", s.Name, tmpl.Name(), terr)
+		ctype = "text/plain; charset=utf-8"
+		buf.Reset()
+		fmt.Fprintf(buf, "%d %s\n", status, http.StatusText(status))
+		if s.DevMode {
+			if err != nil {
+				fmt.Fprintf(buf, "\n%s\n", err)
+			}
+			fmt.Fprintf(buf, "\nTemplate error: %s\n", terr)
+		}
+	} else if s.DevMode {
+		buf = bytes.NewBuffer(injectDevScript(buf.Bytes(), problem))
+	}
+	return buf.Bytes(), ctype
+
+}
 
+func (s *Site) sendInternalServerError(w http.ResponseWriter, req *http.Request, err error) {
+	s.sendError(w, req, http.StatusInternalServerError, err)
 }
+
 func (s *Site) sendNotFound(w http.ResponseWriter, req *http.Request) {
 	// TODO: log the error IF that is set.  So, something like:
 	// if s.LogNotFoundErrors { ... }
-	w.WriteHeader(http.StatusNotFound)
-	fmt.Fprintln(w, "NOT FOUND")
+	s.sendError(w, req, http.StatusNotFound, nil)
 }
 
 // Send a static page, or error out, and let the caller know whether the
@@ -296,23 +440,23 @@ func (s *Site) handleStatic(w http.ResponseWriter, req *http.Request, rpath stri
 
 }
 
-// Send a News Feed if the path matches the one set in the site config.
-// TODO: sub-feeds, tag-feeds, etc.  Handle them here; config TBD.
+// Send a News Feed if the path matches one of the formats set in the site
+// config, for the whole site or for one of its sections or tags.
 func (s *Site) handleFeed(w http.ResponseWriter, req *http.Request, rpath string) bool {
 
-	if s.NoFeed || rpath != s.FeedPath {
+	f, ff := s.feedForPath(rpath)
+	if f == nil {
 		return false
 	}
 
-	f := s.Feed(nil)
-	data, err := xml.MarshalIndent(&f, "", "    ")
+	data, err := ff.data(f)
 	if err != nil {
 		s.sendInternalServerError(w, req, err)
 		return true
 	}
 
 	// Good enough for now! Send it.
-	w.Header().Set("Content-Type", "application/atom+xml")
+	w.Header().Set("Content-Type", ff.ctype)
 	w.WriteHeader(http.StatusOK)
 	if _, err := w.Write(data); err != nil {
 		s.sendInternalServerError(w, req, err)
@@ -323,22 +467,94 @@ func (s *Site) handleFeed(w http.ResponseWriter, req *http.Request, rpath string
 
 }
 
+// Send the sitemap, or one of its parts, if the path matches.
+func (s *Site) handleSitemap(w http.ResponseWriter, req *http.Request, rpath string) bool {
+
+	if s.Pageset == nil || !s.isSitemapPath(rpath) {
+		return false
+	}
+	docs, err := s.sitemapDocs()
+	if err != nil {
+		s.sendInternalServerError(w, req, err)
+		return true
+	}
+	data, ok := docs[rpath]
+	if !ok {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+	return true
+
+}
+
+// Send robots.txt unless it is turned off.
+func (s *Site) handleRobots(w http.ResponseWriter, req *http.Request, rpath string) bool {
+
+	if s.NoRobots || rpath != ROBOTS_PATH {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(s.robotsTXT())
+	return true
+
+}
+
 // Send a Page, or error out, returning true if the response has been served.
 func (s *Site) handlePage(w http.ResponseWriter, req *http.Request, rpath string) bool {
 
+	body, err := s.renderPage(req, rpath)
+	if err != nil {
+		s.sendInternalServerError(w, req, err)
+		return true
+	}
+	if body == nil {
+		return false
+	}
+	if s.DevMode {
+		body = injectDevScript(body, nil)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	// TODO: figure out whether we need to (want to) set the content-length,
+	// especially in a reverse-proxy context a la Nginx.
+	if _, err := w.Write(body); err != nil {
+
+		// It's not clear how this might be triggered in real life, but
+		// we should catch it just the same.  However sending an internal
+		// server error is not really an option anymore.
+		msg := fmt.Sprintf("Write failed for %s: %s", rpath, err.Error())
+		panic(msg)
+	}
+
+	// TODO: log something obvious here, similar to Apache common but in
+	// nice JSON format.
+	return true
+
+}
+
+// renderPage renders the Page or index for the cleaned request path, as
+// served by handlePage and written by Export.  If there is nothing to render
+// then the result is nil, without error.
+func (s *Site) renderPage(req *http.Request, rpath string) ([]byte, error) {
+
 	// We don't bother with anything that has a dot in its path.
 	// Want dot dirs? Sorry!
 	if strings.Contains(rpath, ".") {
-		return false
+		return nil, nil
 	}
 
 	// We take the given page if we have it, but if we don't we might still
 	// have an index.
 	p, err := s.PageForPath(rpath)
 	if err != nil && !os.IsNotExist(err) {
-		err = fmt.Errorf("Page error for %s: %s", rpath, err.Error())
-		s.sendInternalServerError(w, req, err)
-		return true
+		return nil, fmt.Errorf("Page error for %s: %s", rpath, err.Error())
 	}
 
 	// Shall we have a Pageset?  And if so, which one?
@@ -356,18 +572,19 @@ func (s *Site) handlePage(w http.ResponseWriter, req *http.Request, rpath string
 		ps = s.Pageset.PathSubset(prefix, s.PagePath)
 		if ps.Len() == 0 {
 			// No such subset, ergo no index page to handle.
-			return false
+			return nil, nil
 		}
 
 	}
 
-	// Prep & Serve, we should be good here.
+	// Prep & Render, we should be good here.
 	dot := &Dot{
 		Request: req,
 		Page:    p,
 		Pageset: ps,
 		Site:    s,
 		Now:     time.Now(),
+		Status:  http.StatusOK,
 	}
 
 	// PROBLEM: we want control of the header, which we lose if write to the
@@ -377,27 +594,9 @@ func (s *Site) handlePage(w http.ResponseWriter, req *http.Request, rpath string
 	tmpl := dot.Template()
 	buf := new(bytes.Buffer)
 	if err := tmpl.Execute(buf, dot); err != nil {
-		s.sendInternalServerError(w, req, err)
-		return true
-	}
-
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-
-	// TODO: figure out whether we need to (want to) set the content-length,
-	// especially in a reverse-proxy context a la Nginx.
-	if _, err := w.Write(buf.Bytes()); err != nil {
-
-		// It's not clear how this might be triggered in real life, but
-		// we should catch it just the same.  However sending an internal
-		// server error is not really an option anymore.
-		msg := fmt.Sprintf("Write failed for %s: %s", rpath, err.Error())
-		panic(msg)
+		return nil, err
 	}
-
-	// TODO: log something obvious here, similar to Apache common but in
-	// nice JSON format.
-	return true
+	return buf.Bytes(), nil
 
 }
 
@@ -423,6 +622,9 @@ func (s *Site) handleAsset(w http.ResponseWriter, req *http.Request, rpath strin
 				return false
 			}
 		}
+		if path.Base(rpath) == CASCADE_FILE {
+			return false
+		}
 	}
 
 	fpath := filepath.Join(s.PagePath, filepath.FromSlash(rpath))
@@ -5,9 +5,11 @@ package site_test
 
 import (
 	// Standard:
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -690,14 +692,28 @@ func Test_MainHandler_StandardPageParseFailure(t *testing.T) {
 	}
 	s.Pageset.ByPath()[0].ModTime = time.Unix(1, 1)
 
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
 	req, w := ReqAndRec(t, "http://example.com/page")
 	handler(w, req)
 
-	// TODO: real(-ish) error pages!
-	exp := "ERROR: Page error for /page: yaml: did not find expected ',' or '}'\n"
+	exp := "Page error for /page: yaml: line 3: did not find expected ',' or '}'"
 
 	assert.Equal(500, w.Code, "code 500 sent")
-	assert.Equal(exp, w.Body.String(), "body as expected")
+	assert.Regexp("<h1>500 Internal Server Error</h1>", w.Body.String(),
+		"default error page sent")
+	assert.NotContains(w.Body.String(), "yaml", "error not leaked")
+	assert.Contains(buf.String(), exp, "error logged")
+
+	// In DevMode we want to see the error.
+	s.DevMode = true
+	req, w = ReqAndRec(t, "http://example.com/page")
+	handler(w, req)
+	assert.Equal(500, w.Code, "code 500 sent")
+	assert.Contains(w.Body.String(), "did not find expected &#39;,&#39;",
+		"error shown in DevMode")
 
 }
 
@@ -740,12 +756,15 @@ func Test_MainHandler_TemplateExecuteFailure(t *testing.T) {
 	}
 	handler := s.MainHandler()
 
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
 	req, w := ReqAndRec(t, "http://example.com/page")
 	handler(w, req)
 
-	// TODO: real(-ish) error pages! And logging!
 	assert.Equal(500, w.Code, "code 500 sent")
-	assert.Regexp("^ERROR: template: page", w.Body.String(), "body as expected")
+	assert.Regexp("<h1>500 Internal Server Error</h1>", w.Body.String(),
+		"default error page sent")
+	assert.NotContains(w.Body.String(), "template: page", "error not leaked")
 
 }
 
@@ -1087,3 +1106,77 @@ func Test_PageForPath_NoMatch_Virtual(t *testing.T) {
 	assert.Nil(pfp, "no page returned")
 
 }
+
+func Test_MainHandler_NotFoundErrorTemplate(t *testing.T) {
+
+	assert := assert.New(t)
+
+	path := filepath.Join("test_data", "full_site")
+	s, err := site.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.MainHandler()
+
+	req, w := ReqAndRec(t, "http://example.com/nonesuch")
+	handler(w, req)
+	assert.Equal(404, w.Code, "code 404 sent")
+	assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"),
+		"content type is HTML")
+	assert.Regexp(`<div id="Error">\s+Oh no!`, w.Body.String(),
+		"site error template used")
+
+}
+
+func Test_MainHandler_StatusErrorTemplate(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	tpath := filepath.Join(dir, "templates", "404.html")
+	writeFile(t, tpath, "NF:{{ .Status }} {{ .StatusText }} {{ .Error }}")
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	req, w := ReqAndRec(t, "http://example.com/nonesuch")
+	s.ServeHTTP(w, req)
+	assert.Equal(404, w.Code, "code 404 sent")
+	assert.Equal("NF:404 Not Found ", w.Body.String(),
+		"status template used")
+
+}
+
+func Test_MainHandler_ErrorTemplateFailure(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	tpath := filepath.Join(dir, "templates", "error.html")
+	writeFile(t, tpath, "{{ .Nonesuch }}")
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	req, w := ReqAndRec(t, "http://example.com/nonesuch")
+	s.ServeHTTP(w, req)
+	assert.Equal(404, w.Code, "code 404 sent")
+	assert.Equal("text/plain; charset=utf-8", w.Header().Get("Content-Type"),
+		"content type is plain text")
+	assert.Equal("404 Not Found\n", w.Body.String(), "plain text sent")
+	assert.Regexp("error template error failed", buf.String(),
+		"template failure logged")
+
+	s.DevMode = true
+	req, w = ReqAndRec(t, "http://example.com/nonesuch")
+	s.ServeHTTP(w, req)
+	assert.Regexp("^404 Not Found\n\nTemplate error: .*Nonesuch",
+		w.Body.String(), "template error shown in DevMode")
+
+}
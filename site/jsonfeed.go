@@ -0,0 +1,117 @@
+// jsonfeed.go - JSON Feed generation for the Kisipar site.
+// -----------
+//
+// USEFUL: https://www.jsonfeed.org/version/1.1/
+
+package site
+
+import (
+	// Standard:
+	"encoding/json"
+	"time"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/pageset"
+)
+
+// JSON_FEED_VERSION is the version URL of the JSON Feed specification.
+const JSON_FEED_VERSION = "https://jsonfeed.org/version/1.1"
+
+// A JSONFeed is a JSON Feed 1.1 document.  Its NextURL is that of the
+// archive with the next older items, if any.
+type JSONFeed struct {
+	Version     string            `json:"version"`
+	Title       string            `json:"title"`
+	HomePageURL string            `json:"home_page_url,omitempty"`
+	FeedURL     string            `json:"feed_url,omitempty"`
+	NextURL     string            `json:"next_url,omitempty"`
+	Authors     []*JSONFeedAuthor `json:"authors,omitempty"`
+	Items       []*JSONFeedItem   `json:"items"`
+}
+
+// A JSONFeedAuthor is the author of a JSONFeed or one of its items.
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// A JSONFeedItem is a single Page in a JSONFeed.  The ContentHTML is always
+// included, as the specification requires some content.
+type JSONFeedItem struct {
+	ID            string                `json:"id"`
+	URL           string                `json:"url,omitempty"`
+	Title         string                `json:"title,omitempty"`
+	ContentHTML   string                `json:"content_html"`
+	Summary       string                `json:"summary,omitempty"`
+	DatePublished string                `json:"date_published,omitempty"`
+	DateModified  string                `json:"date_modified,omitempty"`
+	Authors       []*JSONFeedAuthor     `json:"authors,omitempty"`
+	Attachments   []*JSONFeedAttachment `json:"attachments,omitempty"`
+}
+
+// A JSONFeedAttachment is the media file of a podcast episode.
+type JSONFeedAttachment struct {
+	URL               string `json:"url"`
+	MIMEType          string `json:"mime_type"`
+	SizeInBytes       int64  `json:"size_in_bytes,omitempty"`
+	DurationInSeconds int    `json:"duration_in_seconds,omitempty"`
+}
+
+// JSONFeed returns a JSON Feed for the Site, with the same items as its
+// Atom Feed.  If a Pageset is provided, that is used for the items;
+// otherwise the main Site Pageset is used.
+func (s *Site) JSONFeed(ps *pageset.Pageset) *JSONFeed {
+	return s.jsonFeed(s.mainFeed(ps))
+}
+
+// jsonFeed returns the feed as a JSONFeed.
+func (s *Site) jsonFeed(feed *feed) *JSONFeed {
+
+	f := &JSONFeed{
+		Version:     JSON_FEED_VERSION,
+		Title:       feed.title,
+		HomePageURL: feed.home,
+		FeedURL:     s.BaseURL + feed.path(s.JSONFeedPath),
+		Authors:     []*JSONFeedAuthor{{Name: s.Owner}},
+	}
+
+	for _, link := range s.feedArchiveLinks(feed, s.JSONFeedPath) {
+		if link.rel == "prev-archive" {
+			f.NextURL = link.href
+		}
+	}
+
+	items, _ := s.feedItems(feed)
+	f.Items = make([]*JSONFeedItem, len(items))
+	for i, item := range items {
+		ji := &JSONFeedItem{
+			ID:           item.url,
+			URL:          item.url,
+			Title:        item.title,
+			ContentHTML:  item.content,
+			Summary:      item.summary,
+			DateModified: item.updated.Format(time.RFC3339),
+		}
+		for _, author := range item.authors {
+			ji.Authors = append(ji.Authors, &JSONFeedAuthor{Name: author})
+		}
+		if item.published != nil {
+			ji.DatePublished = item.published.Format(time.RFC3339)
+		}
+		if ep := item.episode; ep != nil {
+			ji.Attachments = []*JSONFeedAttachment{{
+				URL:               ep.media.url,
+				MIMEType:          ep.media.ctype,
+				SizeInBytes:       ep.media.length,
+				DurationInSeconds: ep.media.duration,
+			}}
+		}
+		f.Items[i] = ji
+	}
+	return f
+
+}
+
+// jsonFeedData returns the feed as JSON.
+func (s *Site) jsonFeedData(f *feed) ([]byte, error) {
+	return json.MarshalIndent(s.jsonFeed(f), "", "    ")
+}
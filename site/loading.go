@@ -65,26 +65,40 @@ func Load(path string) (*Site, error) {
 // LoadPages loads the pages at the Site's PagePath into the Pageset.  If the
 // Site already has a Pageset, it will be replaced.  Any file under the
 // PagePath whose extension matches one of the PageExtensions will be
-// loaded.
+// loaded, with the meta cascading down from the CASCADE_FILEs and index
+// Pages above it, and validated against its MetaSchema, if any.  Pages may
+// not share URL paths; cf. Permalinks.
 func (s *Site) LoadPages() error {
+	return s.loadPages(nil)
+}
+
+// loadPages loads the pages as per LoadPages.  If report is not nil, any
+// errors with a single Page are passed to it with the Page's path, and the
+// Page left out, instead of stopping the load.
+func (s *Site) loadPages(report func(path string, err error)) error {
 
 	wantExt := map[string]bool{}
 	for _, e := range s.PageExtensions {
 		wantExt[e] = true
 	}
 	s.Pageset, _ = pageset.New([]*page.Page{})
+	s.Pageset.Registry = s.Parsers
+	s.Pageset.Loader = s.loadPage
+	s.resetCascades(nil)
 	if s.PagePath != "" {
+		paths := []string{}
+		metaFiles := []string{}
 		visit := func(path string, f os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
-			if !f.IsDir() && wantExt[filepath.Ext(path)] {
-				p, err := page.Load(path)
-				if err != nil {
-					return err
-				}
-				s.unlistByPath(p)
-				s.Pageset.AddPage(p)
+			if f.IsDir() {
+				return nil
+			}
+			if f.Name() == CASCADE_FILE {
+				metaFiles = append(metaFiles, path)
+			} else if wantExt[filepath.Ext(path)] {
+				paths = append(paths, path)
 			}
 			return nil
 		}
@@ -92,9 +106,63 @@ func (s *Site) LoadPages() error {
 		if err != nil {
 			return err
 		}
+		if err := s.resetCascades(metaFiles); err != nil {
+			return err
+		}
+
+		// Index Pages come first, as their cascades apply to the others.
+		sortIndexFirst(paths)
+		for _, path := range paths {
+			p, err := s.loadPage(path)
+			if err != nil {
+				if report == nil {
+					return err
+				}
+				if errs, ok := err.(pageErrors); ok {
+					for _, err := range errs {
+						report(path, err)
+					}
+				} else {
+					report(path, fmt.Errorf("Page error for %s: %s",
+						path, err.Error()))
+				}
+				continue
+			}
+			s.Pageset.AddPage(p)
+		}
 	}
 
-	return nil
+	// Routes are only known once all the Pages are.
+	var routeErr error
+	s.setRoutes(func(path string, err error) {
+		if report != nil {
+			report(path, err)
+		} else if routeErr == nil {
+			routeErr = err
+		}
+	})
+	return routeErr
+
+}
+
+// loadPage loads the Page at path, sets the cascade of an index Page and
+// validates it against its MetaSchema.  Pages under UnlistedPaths are
+// Unlisted.  All Pages are loaded this way, including those reloaded by
+// the Pageset and the Watcher.
+func (s *Site) loadPage(path string) (*page.Page, error) {
+
+	p, err := s.Parsers.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.setIndexCascade(p); err != nil {
+		return nil, err
+	}
+	if errs := s.CheckPage(p); len(errs) > 0 {
+		return nil, pageErrors(errs)
+	}
+	s.unlistByPath(p)
+	return p, nil
 
 }
 
@@ -112,6 +180,13 @@ func (s *Site) LoadTemplates() error {
 		return errors.New("DEFAULT_TEMPLATE: " + err.Error())
 	}
 
+	// Default error pages live in the kisipar namespace, and may be
+	// overridden in the same way as any other template.
+	_, err = tmpl.New(DEFAULT_ERROR_NAME).Parse(DEFAULT_ERROR_TEMPLATE)
+	if err != nil {
+		return errors.New("DEFAULT_ERROR_TEMPLATE: " + err.Error())
+	}
+
 	// Every file in the directory is a template, regardless of extension.
 	if s.TemplatePath != "" {
 
@@ -163,13 +238,15 @@ func (s *Site) LoadTemplates() error {
 
 	}
 
-	s.Template = tmpl
+	s.setTemplate(tmpl)
 	return nil
 }
 
 // Load initializes a virtual site containing the provided pages, with cfg
 // as its Config.  A nil Config is acceptable, as is an empty array of pages
-// and a nil template.
+// and a nil template.  The index pages' cascades, the MetaSchemas and the
+// routes apply as for LoadPages, but there are no CASCADE_FILEs.  The Site
+// serves copies of the pages, which are not modified.
 func LoadVirtual(cfg *config.Config, pages []*page.Page,
 	tmpl *template.Template) (*Site, error) {
 
@@ -194,13 +271,41 @@ func LoadVirtual(cfg *config.Config, pages []*page.Page,
 	}
 	site.Template = tmpl
 
-	// Ingest the pages, if any:
-	site.unlistByPath(pages...)
-	ps, err := pageset.New(pages)
+	// Ingest copies of the pages, if any, parsed with the Site's parser and
+	// the cascades of the index pages; the pages themselves may be shared.
+	for _, p := range pages {
+		if err := site.setIndexCascade(p); err != nil {
+			return nil, err
+		}
+	}
+	copies := make([]*page.Page, len(pages))
+	for i, p := range pages {
+		c, err := site.Parsers.Reparsed(p)
+		if err != nil {
+			return nil, err
+		}
+		if errs := site.CheckPage(c); len(errs) > 0 {
+			return nil, errs[0]
+		}
+		copies[i] = c
+	}
+	site.unlistByPath(copies...)
+	ps, err := pageset.New(copies)
 	if err != nil {
 		return nil, err
 	}
+	ps.Registry = site.Parsers
+	ps.Loader = site.loadPage
 	site.Pageset = ps
+	var routeErr error
+	site.setRoutes(func(path string, err error) {
+		if routeErr == nil {
+			routeErr = err
+		}
+	})
+	if routeErr != nil {
+		return nil, routeErr
+	}
 
 	return site, nil
 
@@ -138,6 +138,7 @@ func Test_LoadTemplates(t *testing.T) {
 		"error",
 		"foo/bar",
 		"index",
+		"kisipar/error", // the default error page
 		"shared/foot",
 		"shared/head",
 		"single",
@@ -431,6 +432,42 @@ func Test_LoadVirtual_Success(t *testing.T) {
 
 }
 
+func Test_LoadVirtual_SharedPages(t *testing.T) {
+
+	assert := assert.New(t)
+
+	p, _ := page.LoadVirtualString("/blog/post.md", "# Post")
+	idx1, _ := page.LoadVirtualString("/blog/index.md",
+		"# Blog\n\n    Cascade: {Author: One}\n")
+	idx2, _ := page.LoadVirtualString("/blog/index.md",
+		"# Blog\n\n    Cascade: {Author: Two}\n")
+	meta := p.Meta
+
+	s1, err := site.LoadVirtual(nil, []*page.Page{p, idx1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _ := config.ParseYaml("UnlistedPaths: [/blog]")
+	s2, err := site.LoadVirtual(cfg, []*page.Page{p, idx2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p1 := s1.Pageset.Page("/blog/post")
+	p2 := s2.Pageset.Page("/blog/post")
+	if assert.NotNil(p1, "first site has page") &&
+		assert.NotNil(p2, "second site has page") {
+		assert.Equal("One", p1.Author(), "first cascade")
+		assert.False(p1.Unlisted, "listed in first site")
+		assert.Equal("Two", p2.Author(), "second cascade")
+		assert.True(p2.Unlisted, "unlisted in second site")
+	}
+	assert.Equal(meta, p.Meta, "shared page meta unchanged")
+	assert.Nil(p.Cascade, "shared page cascade unchanged")
+	assert.False(p.Unlisted, "shared page listed")
+
+}
+
 func Test_LoadVirtual_SuccessWithNils(t *testing.T) {
 
 	assert := assert.New(t)
@@ -628,7 +665,7 @@ Pages:
     foo.md: ` + pageData
 	_, err := site.LoadVirtualYaml(yaml)
 	if assert.Error(err, "error on load") {
-		assert.Regexp("^Page foo.md: invalid character",
+		assert.Regexp("^Page foo.md: json: line 4: invalid character",
 			err.Error(), "error is useful")
 	}
 
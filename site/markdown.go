@@ -0,0 +1,249 @@
+// markdown.go - Markdown settings of the Kisipar site.
+// -----------
+
+package site
+
+import (
+	// Standard:
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	// Third-party:
+	"github.com/russross/blackfriday"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/frostedmd"
+	"github.com/biztos/kisipar/page"
+)
+
+// DEFAULT_MARKDOWN_PROFILE is the name of the MarkdownProfile which, if
+// configured, applies to all Markdown Pages not matched by another one.
+var DEFAULT_MARKDOWN_PROFILE = "default"
+
+// A MarkdownProfile is a named set of Markdown settings, applied to the
+// Markdown Pages with any of its PageExtensions or under any of its Paths.
+// It is configured under MarkdownProfiles in the config file, e.g.:
+//
+//   MarkdownProfiles:
+//       notes:
+//           Engine: commonmark
+//           Extensions: [tables, fenced_code, strikethrough]
+//           Smartypants: false
+//           HardLineBreaks: true
+//           MetaAtEnd: true
+//           FrontMatter: true
+//           HeadingIDs: true
+//           PageExtensions: [.txt]
+//           Paths: [/notes, /journal]
+//
+// The Engine defaults to the Site's MarkdownEngine, and the Extensions to
+// the common set (cf. frostedmd.COMMON_EXTENSIONS), named as in
+// frostedmd.EXTENSION_NAMES.  Smartypants, HardLineBreaks and HeadingIDs,
+// if set, switch the corresponding features on or off whatever the
+// Extensions, and MetaAtEnd puts the meta block at the end of the Markdown
+// source.  FrontMatter defaults to the Site's FrontMatter.
+//
+// Paths are prefixes matched as for UnlistedPaths.  If a Page matches more
+// than one profile's Paths, the longest prefix wins; Paths take precedence
+// over PageExtensions.  The profile named by DEFAULT_MARKDOWN_PROFILE, if
+// configured, applies to any other Markdown Pages.
+//
+// Once loaded, the switches reflect the resulting settings: HeadingIDs is
+// true if automatic heading IDs are on.
+type MarkdownProfile struct {
+	Name           string
+	Engine         string
+	Extensions     []string
+	Smartypants    bool
+	HardLineBreaks bool
+	MetaAtEnd      bool
+	FrontMatter    bool
+	HeadingIDs     bool
+	PageExtensions []string
+	Paths          []string
+
+	parser *page.MdParser
+}
+
+// setupMarkdown sets the Site's Parsers from its PageExtensions, and its
+// MarkdownEngine, FrontMatter and MarkdownProfiles from the config.
+func (s *Site) setupMarkdown() error {
+
+	s.Parsers = page.NewRegistry(s.PageExtensions)
+	s.Parsers.Choose = s.chooseParser
+
+	// Which engine renders the Markdown by default?
+	s.MarkdownEngine = s.Config.UString("MarkdownEngine",
+		frostedmd.DEFAULT_ENGINE)
+	engine, err := frostedmd.EngineNamed(s.MarkdownEngine)
+	if err != nil {
+		return err
+	}
+	s.FrontMatter = s.Config.UBool("FrontMatter", frostedmd.FRONT_MATTER)
+	s.mdParser = nil
+	if engine != frostedmd.Blackfriday ||
+		s.FrontMatter != frostedmd.FRONT_MATTER {
+		fp := frostedmd.New()
+		fp.Engine = engine
+		fp.FrontMatter = s.FrontMatter
+		s.mdParser = &page.MdParser{Frosted: fp}
+	}
+
+	// Any special profiles?
+	s.MarkdownProfiles = []*MarkdownProfile{}
+	if s.Config.Root == nil {
+		return nil
+	}
+	profiles, err := s.Config.Map("MarkdownProfiles")
+	if err != nil {
+		if isConfigTypeError(err) {
+			return fmt.Errorf("Config MarkdownProfiles is not a map.")
+		}
+		return nil
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		mp, err := s.markdownProfile(name)
+		if err != nil {
+			return err
+		}
+		s.MarkdownProfiles = append(s.MarkdownProfiles, mp)
+		if name == DEFAULT_MARKDOWN_PROFILE {
+			s.mdParser = mp.parser
+		}
+	}
+
+	return nil
+
+}
+
+// markdownProfile returns the MarkdownProfile configured with the name, or
+// an error if its configuration is invalid.
+func (s *Site) markdownProfile(name string) (*MarkdownProfile, error) {
+
+	key := "MarkdownProfiles." + name
+	if _, err := s.Config.Map(key); err != nil {
+		return nil, fmt.Errorf("Config %s is not a map.", key)
+	}
+
+	var err error
+	mp := &MarkdownProfile{
+		Name:   name,
+		Engine: s.Config.UString(key+".Engine", s.MarkdownEngine),
+	}
+	fp := frostedmd.New()
+	fp.FrontMatter = s.FrontMatter
+	fp.Engine, err = frostedmd.EngineNamed(mp.Engine)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", key, err.Error())
+	}
+	mp.Extensions, err = s.configStringList(key + ".Extensions")
+	if err != nil {
+		return nil, err
+	}
+	if len(mp.Extensions) > 0 {
+		fp.MarkdownExtensions, err = frostedmd.ExtensionsNamed(mp.Extensions)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", key, err.Error())
+		}
+	}
+	mp.PageExtensions, err = s.configStringList(key + ".PageExtensions")
+	if err != nil {
+		return nil, err
+	}
+	mp.Paths, err = s.configStringList(key + ".Paths")
+	if err != nil {
+		return nil, err
+	}
+
+	// The switches only change what they are set for.
+	if on, err := s.Config.Bool(key + ".Smartypants"); err == nil {
+		fp.HtmlFlags = setBits(fp.HtmlFlags, frostedmd.SMARTYPANTS_FLAGS, on)
+	}
+	if on, err := s.Config.Bool(key + ".HardLineBreaks"); err == nil {
+		fp.MarkdownExtensions = setBits(fp.MarkdownExtensions,
+			blackfriday.EXTENSION_HARD_LINE_BREAK, on)
+	}
+	if on, err := s.Config.Bool(key + ".HeadingIDs"); err == nil {
+		fp.MarkdownExtensions = setBits(fp.MarkdownExtensions,
+			frostedmd.HEADING_ID_EXTENSIONS, on)
+	}
+	fp.MetaAtEnd = s.Config.UBool(key+".MetaAtEnd", fp.MetaAtEnd)
+	fp.FrontMatter = s.Config.UBool(key+".FrontMatter", fp.FrontMatter)
+
+	mp.Smartypants = fp.HtmlFlags&blackfriday.HTML_USE_SMARTYPANTS != 0
+	mp.HardLineBreaks =
+		fp.MarkdownExtensions&blackfriday.EXTENSION_HARD_LINE_BREAK != 0
+	mp.HeadingIDs =
+		fp.MarkdownExtensions&blackfriday.EXTENSION_AUTO_HEADER_IDS != 0
+	mp.MetaAtEnd = fp.MetaAtEnd
+	mp.FrontMatter = fp.FrontMatter
+	mp.parser = &page.MdParser{Frosted: fp}
+
+	return mp, nil
+
+}
+
+// setBits returns the flags with the bits set if on, or cleared if not.
+func setBits(flags, bits int, on bool) int {
+	if on {
+		return flags | bits
+	}
+	return flags &^ bits
+}
+
+// chooseParser returns the Parser the Site uses for the Page at path, given
+// the parser for its extension: for Markdown, that of the matching
+// MarkdownProfile or the MarkdownEngine, otherwise the same parser.
+func (s *Site) chooseParser(path string, parser page.Parser) page.Parser {
+
+	if _, ok := parser.(*page.MdParser); !ok {
+		return parser
+	}
+	if mp := s.profileFor(path); mp != nil {
+		return mp.parser
+	}
+	if s.mdParser != nil {
+		return s.mdParser
+	}
+	return parser
+
+}
+
+// profileFor returns the MarkdownProfile for the Page at path, if any other
+// than the default.  Paths take precedence over PageExtensions, and the
+// longest matching path prefix wins.
+func (s *Site) profileFor(path string) *MarkdownProfile {
+
+	rpath := strings.TrimPrefix(path, s.PagePath)
+	var found *MarkdownProfile
+	longest := -1
+	for _, mp := range s.MarkdownProfiles {
+		for _, prefix := range mp.Paths {
+			if len(prefix) > longest && strings.HasPrefix(rpath, prefix) {
+				found = mp
+				longest = len(prefix)
+			}
+		}
+	}
+	if found != nil {
+		return found
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, mp := range s.MarkdownProfiles {
+		for _, pext := range mp.PageExtensions {
+			if ext == strings.ToLower(pext) {
+				return mp
+			}
+		}
+	}
+	return nil
+
+}
@@ -0,0 +1,199 @@
+// markdown_test.go - tests for the Kisipar site's Markdown settings.
+// ----------------
+
+package site_test
+
+import (
+	// Standard:
+	"os"
+	"path/filepath"
+	"testing"
+
+	// Third-party:
+	"github.com/olebedev/config"
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/page"
+	"github.com/biztos/kisipar/site"
+)
+
+var markdownProfilesYaml = `# MARKDOWN PROFILES TEST
+MarkdownProfiles:
+    notes:
+        Engine: commonmark
+        Smartypants: false
+        HardLineBreaks: true
+        Paths: [/notes]
+    deep:
+        Extensions: [fenced_code]
+        HeadingIDs: true
+        Paths: [/notes/deep]
+    text:
+        MetaAtEnd: true
+        PageExtensions: [.TXT]
+`
+
+func Test_MarkdownProfiles(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	pdir := filepath.Join(dir, "pages")
+	for _, sub := range []string{"notes", filepath.Join("notes", "deep")} {
+		if err := os.Mkdir(filepath.Join(pdir, sub), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src := "# Hi\n\n\"One\"\nTwo\n\n    Tags: [x]\n"
+	writeFile(t, filepath.Join(dir, "config.yaml"), markdownProfilesYaml)
+	writeFile(t, filepath.Join(pdir, "plain.md"), src)
+	writeFile(t, filepath.Join(pdir, "notes", "note.md"), src)
+	writeFile(t, filepath.Join(pdir, "notes", "deep", "deep.md"), src)
+	writeFile(t, filepath.Join(pdir, "text.txt"), src)
+	s, err := site.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Equal(3, len(s.MarkdownProfiles), "three profiles") {
+		mp := s.MarkdownProfiles[1]
+		assert.Equal("notes", mp.Name, "profiles sorted by name")
+		assert.Equal("commonmark", mp.Engine, "engine set")
+		assert.False(mp.Smartypants, "smartypants off")
+		assert.True(mp.HardLineBreaks, "hard line breaks on")
+		assert.False(mp.HeadingIDs, "heading IDs not on by default")
+		assert.False(mp.MetaAtEnd, "meta not at end by default")
+		assert.True(s.MarkdownProfiles[0].HeadingIDs, "heading IDs on")
+		assert.True(s.MarkdownProfiles[2].MetaAtEnd, "meta at end")
+	}
+
+	content := func(rpath string) string {
+		p := s.Pageset.Page(filepath.Join(pdir, rpath))
+		if p == nil {
+			t.Fatalf("no page for %s", rpath)
+		}
+		return string(p.Content)
+	}
+	code := "<pre><code>Tags: [x]\n</code></pre>\n"
+	assert.Equal("<h1>Hi</h1>\n\n<p>&ldquo;One&rdquo;\nTwo</p>\n\n"+code,
+		content("plain"), "common settings without a profile")
+	assert.Equal("<h1>Hi</h1>\n\n<p>&quot;One&quot;<br />\nTwo</p>\n\n"+code,
+		content(filepath.Join("notes", "note")), "profile by path")
+	assert.Equal("<h1 id=\"hi\">Hi</h1>\n\n<p>&ldquo;One&rdquo;\nTwo</p>\n\n"+
+		code, content(filepath.Join("notes", "deep", "deep")),
+		"longest path prefix wins")
+	assert.Equal("<h1>Hi</h1>\n\n<p>&ldquo;One&rdquo;\nTwo</p>\n",
+		content("text"), "profile by extension, case-insensitive")
+	if p := s.Pageset.Page(filepath.Join(pdir, "text")); assert.NotNil(p) {
+		assert.Equal([]string{"x"}, p.Tags(), "meta at end found")
+	}
+
+}
+
+func Test_MarkdownProfiles_Default(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(`# DEFAULT PROFILE
+MarkdownProfiles:
+    default:
+        Smartypants: false
+Pages:
+    foo.md: "# Foo\n\n\"Bar\""
+    foo/bar.txt: "# Bar\n\n\"Baz\""
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"foo", "foo/bar"} {
+		if p := s.Pageset.Page(key); assert.NotNil(p, key) {
+			assert.Contains(string(p.Content), "&quot;", "default for %s", key)
+		}
+	}
+
+}
+
+func Test_FrontMatter(t *testing.T) {
+
+	assert := assert.New(t)
+
+	pages := `
+Pages:
+    foo.md: "---\nfoo: bar\n---\n# Foo"
+    bar.txt: "---\nfoo: bar\n---\n# Bar"
+`
+	s, err := site.LoadVirtualYaml("# NO FRONT MATTER" + pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(s.FrontMatter, "front matter off by default")
+	if p := s.Pageset.Page("foo"); assert.NotNil(p) {
+		assert.Equal("", p.MetaString("foo"), "no front matter by default")
+		assert.Contains(string(p.Content), "<hr", "rule kept by default")
+	}
+
+	s, err = site.LoadVirtualYaml(`# FRONT MATTER
+FrontMatter: true
+MarkdownProfiles:
+    text:
+        FrontMatter: false
+        PageExtensions: [.txt]
+` + pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(s.FrontMatter, "front matter on")
+	if p := s.Pageset.Page("foo"); assert.NotNil(p) {
+		assert.Equal("bar", p.MetaString("foo"), "front matter from config")
+		assert.NotContains(string(p.Content), "<hr", "front matter removed")
+	}
+	if p := s.Pageset.Page("bar"); assert.NotNil(p) {
+		assert.Equal("", p.MetaString("foo"), "front matter off in profile")
+	}
+
+}
+
+func Test_MarkdownProfiles_Errors(t *testing.T) {
+
+	assert := assert.New(t)
+
+	for _, tc := range []struct{ yaml, exp string }{
+		{"MarkdownProfiles: [x]", "Config MarkdownProfiles is not a map."},
+		{"MarkdownProfiles: {x: 1}", "Config MarkdownProfiles.x is not a map."},
+		{"MarkdownProfiles: {x: {Engine: nonesuch}}",
+			`MarkdownProfiles.x: Unknown Markdown engine "nonesuch"; ` +
+				"known engines: blackfriday, commonmark."},
+		{"MarkdownProfiles: {x: {Extensions: [tables, nonesuch]}}",
+			`MarkdownProfiles.x: Unknown Markdown extension "nonesuch".`},
+		{"MarkdownProfiles: {x: {Paths: /foo}}",
+			"Config MarkdownProfiles.x.Paths is not a list."},
+	} {
+		cfg, err := config.ParseYaml(tc.yaml)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = site.LoadVirtual(cfg, nil, nil)
+		if assert.Error(err, tc.yaml) {
+			assert.Equal(tc.exp, err.Error(), "error useful")
+		}
+	}
+
+}
+
+func Test_PageExtensions_ExtParsersKept(t *testing.T) {
+
+	assert := assert.New(t)
+
+	orig := append([]*page.ExtParser{}, page.ExtParsers...)
+	cfg, _ := config.ParseYaml(`PageExtensions: [.foo, .txt]`)
+	s, err := site.LoadVirtual(cfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(orig, page.ExtParsers, "global ExtParsers unchanged")
+	assert.Equal([]*page.ExtParser{orig[4]}, s.Parsers.ExtParsers,
+		"site has its own ExtParsers")
+
+}
@@ -0,0 +1,282 @@
+// podcast.go - podcast support for the Kisipar site feeds.
+// ----------
+//
+// USEFUL: https://help.apple.com/itc/podcasts_connect/#/itcb54353390
+// USEFUL: https://podcasting2.org/podcast-namespace
+
+package site
+
+import (
+	// Standard:
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/page"
+)
+
+// The namespaces of the podcast elements in the RSS feed:
+const (
+	ITUNES_NS  = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+	PODCAST_NS = "https://podcastindex.org/namespace/1.0"
+)
+
+// MEDIA_TYPES maps the file extensions of common podcast media to their
+// MIME types, which are not all known to the mime package.  Other types
+// are looked up with mime.TypeByExtension, defaulting to
+// application/octet-stream.
+var MEDIA_TYPES = map[string]string{
+	".aac":  "audio/aac",
+	".flac": "audio/flac",
+	".m4a":  "audio/x-m4a",
+	".m4v":  "video/x-m4v",
+	".mov":  "video/quicktime",
+	".mp3":  "audio/mpeg",
+	".mp4":  "video/mp4",
+	".oga":  "audio/ogg",
+	".ogg":  "audio/ogg",
+	".opus": "audio/opus",
+	".srt":  "application/x-subrip",
+	".vtt":  "text/vtt",
+	".wav":  "audio/wav",
+	".webm": "video/webm",
+}
+
+// mediaType returns the MIME type for the file name or URL path.
+func mediaType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if ctype, ok := MEDIA_TYPES[ext]; ok {
+		return ctype
+	}
+	if ctype := mime.TypeByExtension(ext); ctype != "" {
+		return ctype
+	}
+	return "application/octet-stream"
+}
+
+// A feedMedia is the media file of a podcast episode, enclosed in its feed
+// item.  The length is zero if the file is not local to the Site.
+type feedMedia struct {
+	url      string
+	ctype    string
+	length   int64
+	duration int
+}
+
+// An episode holds the podcast meta of a Page that has media.
+type episode struct {
+	media       *feedMedia
+	episode     int
+	season      int
+	episodeType string
+	explicit    bool
+	transcript  string
+}
+
+// pageEpisode returns the podcast episode of the Page, or nil if it has no
+// Audio or Video in its meta.
+//
+// The media may be a URL, or a path resolved against the Page URL like a
+// link; a local file is looked for under the StaticPath and then the
+// PagePath, the same as when it is served, for its length.  The Duration
+// may be in seconds or as "[hours:]minutes:seconds".  Episode and Season
+// are numbers, EpisodeType is "full", "trailer" or "bonus", Explicit is a
+// boolean, and Transcript a URL or path like the media.
+func (s *Site) pageEpisode(p *page.Page, purl string) *episode {
+
+	src := p.MetaString("Audio")
+	if src == "" {
+		src = p.MetaString("Video")
+	}
+	if src == "" {
+		return nil
+	}
+	mediaURL, rpath := s.resolveMedia(src, purl)
+
+	m := &feedMedia{
+		url:      mediaURL,
+		ctype:    mediaType(mediaURL),
+		duration: parseDuration(p.MetaString("Duration")),
+	}
+	if rpath != "" {
+		for _, dir := range []string{s.StaticPath, s.PagePath} {
+			if dir == "" {
+				continue
+			}
+			info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(rpath)))
+			if err == nil && !info.IsDir() {
+				m.length = info.Size()
+				break
+			}
+		}
+	}
+
+	e := &episode{
+		media:       m,
+		episodeType: strings.ToLower(p.MetaString("EpisodeType")),
+		explicit:    p.MetaBool("Explicit"),
+	}
+	e.episode, _ = strconv.Atoi(p.MetaString("Episode"))
+	e.season, _ = strconv.Atoi(p.MetaString("Season"))
+	if t := p.MetaString("Transcript"); t != "" {
+		e.transcript, _ = s.resolveMedia(t, purl)
+	}
+	return e
+
+}
+
+// resolveMedia returns the absolute URL of the media source as linked from
+// the Page URL, and its request path if it is within the Site.
+func (s *Site) resolveMedia(src, purl string) (string, string) {
+
+	base, err := url.Parse(purl)
+	if err != nil {
+		return src, ""
+	}
+	ref, err := url.Parse(strings.TrimSpace(src))
+	if err != nil {
+		return src, ""
+	}
+	u := base.ResolveReference(ref)
+	site, err := url.Parse(s.BaseURL)
+	if err != nil || u.Scheme != site.Scheme || u.Host != site.Host ||
+		!strings.HasPrefix(u.Path, site.Path) {
+		return u.String(), ""
+	}
+	return u.String(), path.Clean("/" + strings.TrimPrefix(u.Path, site.Path))
+
+}
+
+// parseDuration returns the number of seconds in the duration, given in
+// seconds or as "[hours:]minutes:seconds", or zero if it is not valid.
+func parseDuration(d string) int {
+
+	parts := strings.Split(strings.TrimSpace(d), ":")
+	if len(parts) > 3 {
+		return 0
+	}
+	total := 0.0
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0
+		}
+		total = total*60 + n
+	}
+	return int(total)
+
+}
+
+// An ItunesChannel holds the podcast elements of an RSSChannel.
+type ItunesChannel struct {
+	Author   string            `xml:"itunes:author,omitempty"`
+	Image    *ItunesImage      `xml:"itunes:image"`
+	Category []*ItunesCategory `xml:"itunes:category"`
+	Explicit string            `xml:"itunes:explicit"`
+	Type     string            `xml:"itunes:type,omitempty"`
+	Owner    *ItunesOwner      `xml:"itunes:owner"`
+	GUID     string            `xml:"podcast:guid,omitempty"`
+	Locked   *PodcastLocked    `xml:"podcast:locked"`
+}
+
+// An ItunesItem holds the podcast elements of an RSSItem.
+type ItunesItem struct {
+	Duration       int                `xml:"itunes:duration,omitempty"`
+	Episode        int                `xml:"itunes:episode,omitempty"`
+	Season         int                `xml:"itunes:season,omitempty"`
+	EpisodeType    string             `xml:"itunes:episodeType,omitempty"`
+	Explicit       string             `xml:"itunes:explicit,omitempty"`
+	PodcastEpisode int                `xml:"podcast:episode,omitempty"`
+	PodcastSeason  int                `xml:"podcast:season,omitempty"`
+	Transcript     *PodcastTranscript `xml:"podcast:transcript"`
+}
+
+// An ItunesImage is the artwork of a podcast.
+type ItunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// An ItunesCategory is a podcast category, possibly with a subcategory.
+type ItunesCategory struct {
+	Text        string          `xml:"text,attr"`
+	Subcategory *ItunesCategory `xml:"itunes:category"`
+}
+
+// An ItunesOwner is the contact for a podcast.
+type ItunesOwner struct {
+	Name  string `xml:"itunes:name"`
+	Email string `xml:"itunes:email"`
+}
+
+// A PodcastLocked tells other platforms whether they may import the podcast.
+type PodcastLocked struct {
+	Owner string `xml:"owner,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// A PodcastTranscript links to the transcript of an episode.
+type PodcastTranscript struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// itunesChannel returns the podcast elements of the Site's RSS channels.
+// Categories are given as "Category" or "Category/Subcategory".
+func (s *Site) itunesChannel() *ItunesChannel {
+
+	c := &ItunesChannel{
+		Author:   s.Owner,
+		Explicit: strconv.FormatBool(s.PodcastExplicit),
+		Type:     s.PodcastType,
+		GUID:     s.PodcastGUID,
+	}
+	if s.PodcastImage != "" {
+		href, _ := s.resolveMedia(s.PodcastImage, s.BaseURL+"/")
+		c.Image = &ItunesImage{Href: href}
+	}
+	for _, cat := range s.PodcastCategories {
+		parts := strings.SplitN(cat, "/", 2)
+		ic := &ItunesCategory{Text: strings.TrimSpace(parts[0])}
+		if len(parts) > 1 {
+			ic.Subcategory = &ItunesCategory{Text: strings.TrimSpace(parts[1])}
+		}
+		c.Category = append(c.Category, ic)
+	}
+	if s.PodcastEmail != "" {
+		c.Owner = &ItunesOwner{Name: s.Owner, Email: s.PodcastEmail}
+	}
+	if s.PodcastLocked {
+		c.Locked = &PodcastLocked{Owner: s.PodcastEmail, Value: "yes"}
+	}
+	return c
+
+}
+
+// itunesItem returns the podcast elements of the episode's RSS item.
+func (s *Site) itunesItem(e *episode) *ItunesItem {
+
+	i := &ItunesItem{
+		Duration:       e.media.duration,
+		Episode:        e.episode,
+		Season:         e.season,
+		EpisodeType:    e.episodeType,
+		PodcastEpisode: e.episode,
+		PodcastSeason:  e.season,
+	}
+	if e.explicit {
+		i.Explicit = "true"
+	}
+	if e.transcript != "" {
+		i.Transcript = &PodcastTranscript{
+			URL:  e.transcript,
+			Type: mediaType(e.transcript),
+		}
+	}
+	return i
+
+}
@@ -0,0 +1,206 @@
+// podcast_test.go - tests for the Kisipar podcast feeds.
+// ---------------
+
+package site_test
+
+import (
+	// Standard:
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	// Third-party:
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/site"
+)
+
+// podcastSite returns a site with three episodes: one with its audio among
+// the pages, one with static video, and one with remote audio; and a page
+// that is not an episode.
+func podcastSite(t *testing.T) (string, *site.Site) {
+
+	dir := tempSite(t)
+	writeFile(t, filepath.Join(dir, "config.yaml"), `Name: Podcast
+Owner: Pod Caster
+PodcastImage: /art.jpg
+PodcastCategories: ["Technology", "Society & Culture/Documentary"]
+PodcastType: serial
+PodcastEmail: pod@example.com
+PodcastGUID: abc-123
+PodcastLocked: true
+`)
+	writeFile(t, filepath.Join(dir, "pages", "ep1.md"), `# Episode One
+
+    Audio: ep1.mp3
+    Duration: "1:02:03"
+    Episode: 1
+    Season: 2
+    EpisodeType: Full
+    Explicit: true
+    Transcript: ep1.vtt
+
+Show notes.`)
+	writeFile(t, filepath.Join(dir, "pages", "ep1.mp3"), strings.Repeat("x", 1234))
+	if err := os.Mkdir(filepath.Join(dir, "static", "media"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "static", "media", "ep2.mp4"), "video")
+	writeFile(t, filepath.Join(dir, "pages", "ep2.md"), `# Episode Two
+
+    Video: /media/ep2.mp4
+    Duration: 90
+`)
+	writeFile(t, filepath.Join(dir, "pages", "ep3.md"), `# Episode Three
+
+    Audio: https://cdn.example.com/ep3.ogg
+    Duration: bogus
+`)
+	s, err := site.Load(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return dir, s
+
+}
+
+func Test_RSSFeed_Podcast(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := podcastSite(t)
+	defer os.RemoveAll(dir)
+
+	req, rec := ReqAndRec(t, "http://example.com/rss.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "RSS served")
+	body := rec.Body.String()
+
+	assert.Contains(body, `xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:podcast="https://podcastindex.org/namespace/1.0">`,
+		"podcast namespaces declared")
+	assert.Contains(body, `
+        <itunes:author>Pod Caster</itunes:author>
+        <itunes:image href="http://localhost:8020/art.jpg"></itunes:image>
+        <itunes:category text="Technology"></itunes:category>
+        <itunes:category text="Society &amp; Culture">
+            <itunes:category text="Documentary"></itunes:category>
+        </itunes:category>
+        <itunes:explicit>false</itunes:explicit>
+        <itunes:type>serial</itunes:type>
+        <itunes:owner>
+            <itunes:name>Pod Caster</itunes:name>
+            <itunes:email>pod@example.com</itunes:email>
+        </itunes:owner>
+        <podcast:guid>abc-123</podcast:guid>
+        <podcast:locked owner="pod@example.com">yes</podcast:locked>
+        <item>`, body, "channel podcast elements")
+
+	assert.Contains(body, `
+            <enclosure url="http://localhost:8020/ep1.mp3" length="1234" type="audio/mpeg"></enclosure>
+            <itunes:duration>3723</itunes:duration>
+            <itunes:episode>1</itunes:episode>
+            <itunes:season>2</itunes:season>
+            <itunes:episodeType>full</itunes:episodeType>
+            <itunes:explicit>true</itunes:explicit>
+            <podcast:episode>1</podcast:episode>
+            <podcast:season>2</podcast:season>
+            <podcast:transcript url="http://localhost:8020/ep1.vtt" type="text/vtt"></podcast:transcript>
+        </item>`, body, "episode from pages")
+	assert.Contains(body, `
+            <enclosure url="http://localhost:8020/media/ep2.mp4" length="5" type="video/mp4"></enclosure>
+            <itunes:duration>90</itunes:duration>
+        </item>`, body, "video episode from static")
+	assert.Contains(body, `
+            <enclosure url="https://cdn.example.com/ep3.ogg" length="0" type="audio/ogg"></enclosure>
+        </item>`, body, "remote episode, no length or duration")
+	assert.Equal(3, strings.Count(body, "<enclosure"), "only episodes enclosed")
+
+}
+
+func Test_RSSFeed_NotPodcast(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+
+	req, rec := ReqAndRec(t, "http://example.com/rss.xml")
+	s.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	assert.NotContains(body, "itunes", "no iTunes elements without episodes")
+	assert.NotContains(body, "podcast", "no podcast elements without episodes")
+	assert.NotContains(body, "enclosure", "no enclosures without episodes")
+
+}
+
+func Test_Feed_PodcastEnclosures(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := podcastSite(t)
+	defer os.RemoveAll(dir)
+
+	enclosures := map[string]*site.AtomLink{}
+	for _, e := range s.Feed(nil).Entry {
+		for _, link := range e.Link {
+			if link.Rel == "enclosure" {
+				enclosures[e.Title] = link
+			}
+		}
+	}
+	assert.Equal(map[string]*site.AtomLink{
+		"Episode One": {
+			Rel:    "enclosure",
+			Href:   "http://localhost:8020/ep1.mp3",
+			Type:   "audio/mpeg",
+			Length: 1234,
+		},
+		"Episode Two": {
+			Rel:    "enclosure",
+			Href:   "http://localhost:8020/media/ep2.mp4",
+			Type:   "video/mp4",
+			Length: 5,
+		},
+		"Episode Three": {
+			Rel:  "enclosure",
+			Href: "https://cdn.example.com/ep3.ogg",
+			Type: "audio/ogg",
+		},
+	}, enclosures, "Atom enclosures for episodes")
+
+	req, rec := ReqAndRec(t, "http://example.com/feed.json")
+	s.ServeHTTP(rec, req)
+	f := &site.JSONFeed{}
+	if err := json.Unmarshal(rec.Body.Bytes(), f); err != nil {
+		t.Fatal(err)
+	}
+	attachments := map[string]*site.JSONFeedAttachment{}
+	for _, item := range f.Items {
+		if len(item.Attachments) > 0 {
+			attachments[item.Title] = item.Attachments[0]
+		}
+	}
+	assert.Equal(map[string]*site.JSONFeedAttachment{
+		"Episode One": {
+			URL:               "http://localhost:8020/ep1.mp3",
+			MIMEType:          "audio/mpeg",
+			SizeInBytes:       1234,
+			DurationInSeconds: 3723,
+		},
+		"Episode Two": {
+			URL:               "http://localhost:8020/media/ep2.mp4",
+			MIMEType:          "video/mp4",
+			SizeInBytes:       5,
+			DurationInSeconds: 90,
+		},
+		"Episode Three": {
+			URL:      "https://cdn.example.com/ep3.ogg",
+			MIMEType: "audio/ogg",
+		},
+	}, attachments, "JSON Feed attachments for episodes")
+
+}
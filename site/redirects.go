@@ -0,0 +1,413 @@
+// redirects.go - redirect and rewrite rules for the Kisipar site.
+// ------------
+
+package site
+
+import (
+	// Standard:
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	// Third-party:
+	"gopkg.in/yaml.v2"
+)
+
+// REDIRECTS_FILE is the file, at the top of the Site's Path, which may hold
+// more Redirects as a YAML list, for long migration tables.  Unlike the
+// config file, it is applied again by the Watcher when it changes.
+var REDIRECTS_FILE = "redirects.yaml"
+
+// REDIRECT_STATUSES are the HTTP statuses a Redirect may send.
+var REDIRECT_STATUSES = []int{301, 302, 307, 308, 410}
+
+// DEFAULT_REDIRECT_STATUS is the Status of Redirects not setting one.
+var DEFAULT_REDIRECT_STATUS = http.StatusMovedPermanently
+
+// MAX_REDIRECT_CHAIN is the longest chain of Redirects Check accepts.
+var MAX_REDIRECT_CHAIN = 10
+
+// A Redirect is a rule sending the requests for certain paths elsewhere.
+// Redirects are configured as a list under Redirects in the config file,
+// followed by any in the REDIRECTS_FILE, e.g.:
+//
+//   Redirects:
+//       - {From: /old.html, To: /new}
+//       - {Prefix: /docs, To: /manual, Status: 302}
+//       - {Match: "^/(\\d{4})/(.+)$", To: "/blog/$2?year=$1"}
+//       - {From: /gone, Status: 410}
+//       - {Prefix: /api, To: /v2/api, Rewrite: true}
+//
+// A Redirect matches the cleaned request path exactly (From), as a prefix
+// (Prefix), meaning the path itself or anything below it, the rest of the
+// path being appended to To; or by regular expression (Match), To being
+// expanded with its capture groups, as $1 or ${name}.  To may be a path or
+// a full URL.  Any query in the request is kept, after any query in To.
+//
+// The Status is one of REDIRECT_STATUSES, or DEFAULT_REDIRECT_STATUS if not
+// set; a 410 (Gone) has no To.  A Rewrite is no redirect at all: the request
+// is served as if for To, which must be a path of the Site.
+//
+// Exact Redirects are matched first, then the others in order, the first
+// match winning.  Redirects come before everything else, even static files,
+// and are applied only once, so a rewritten request is not redirected
+// again.  Check finds redirect loops, and sitetest.AssertRedirect tests
+// Redirects from Go tests.
+type Redirect struct {
+	From    string
+	Prefix  string
+	Match   *regexp.Regexp
+	To      string
+	Status  int
+	Rewrite bool
+}
+
+// setupRedirects sets the Site's Redirects from the config and the
+// REDIRECTS_FILE.  On error, the Redirects are left as they were.
+func (s *Site) setupRedirects() error {
+
+	redirects := []*Redirect{}
+	exact := map[string]*Redirect{}
+	add := func(source string, list []interface{}) error {
+		for i, v := range list {
+			r, err := newRedirect(v)
+			if err == nil && r.From != "" && exact[r.From] != nil {
+				err = fmt.Errorf("From %s is already redirected.", r.From)
+			}
+			if err != nil {
+				return fmt.Errorf("%s item %d: %s", source, i, err.Error())
+			}
+			if r.From != "" {
+				exact[r.From] = r
+			}
+			redirects = append(redirects, r)
+		}
+		return nil
+	}
+
+	if s.Config.Root != nil {
+		list, err := s.Config.List("Redirects")
+		if err != nil && isConfigTypeError(err) {
+			return fmt.Errorf("Config Redirects is not a list.")
+		}
+		if err := add("Config Redirects", list); err != nil {
+			return err
+		}
+	}
+
+	if s.Path != "" {
+		fpath := filepath.Join(s.Path, REDIRECTS_FILE)
+		b, err := ioutil.ReadFile(fpath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		var list []map[string]interface{}
+		if err := yaml.Unmarshal(b, &list); err != nil {
+			return fmt.Errorf("Redirects file %s: %s", fpath, err.Error())
+		}
+		items := make([]interface{}, len(list))
+		for i, item := range list {
+			items[i] = item
+		}
+		if err := add("Redirects file "+fpath, items); err != nil {
+			return err
+		}
+	}
+
+	s.redirectMutex.Lock()
+	s.Redirects = redirects
+	s.exactRedirects = exact
+	s.redirectMutex.Unlock()
+	return nil
+
+}
+
+// newRedirect returns the Redirect from its config.
+func newRedirect(v interface{}) (*Redirect, error) {
+
+	cfg, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not a map.")
+	}
+	r := &Redirect{}
+	matches := 0
+	for k, v := range cfg {
+		switch k {
+		case "From", "Prefix", "Match", "To":
+			str, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s is not a string.", k)
+			}
+			switch k {
+			case "From":
+				r.From = str
+			case "Prefix":
+				r.Prefix = str
+			case "Match":
+				rx, err := regexp.Compile(str)
+				if err != nil {
+					return nil, fmt.Errorf("Match: %s", err.Error())
+				}
+				r.Match = rx
+			case "To":
+				r.To = str
+			}
+			if k != "To" {
+				matches++
+			}
+		case "Status":
+			if r.Status, ok = v.(int); !ok {
+				return nil, fmt.Errorf("Status is not a number.")
+			}
+		case "Rewrite":
+			if r.Rewrite, ok = v.(bool); !ok {
+				return nil, fmt.Errorf("Rewrite is not a boolean.")
+			}
+		default:
+			return nil, fmt.Errorf("Unknown setting %s.", k)
+		}
+	}
+	if err := r.check(matches); err != nil {
+		return nil, err
+	}
+	return r, nil
+
+}
+
+// check returns an error if the Redirect, with the given number of match
+// settings, makes no sense.  From and Prefix are cleaned, and the Status
+// defaulted.
+func (r *Redirect) check(matches int) error {
+
+	if matches != 1 {
+		return fmt.Errorf("Needs one of From, Prefix or Match.")
+	}
+	for _, p := range []*string{&r.From, &r.Prefix} {
+		if *p == "" {
+			continue
+		}
+		if !strings.HasPrefix(*p, "/") {
+			return fmt.Errorf("%s does not start with a slash.", *p)
+		}
+		*p = path.Clean(*p)
+	}
+
+	if r.Rewrite {
+		if r.Status != 0 {
+			return fmt.Errorf("Status is not allowed for a rewrite.")
+		}
+		if !isLocalPath(r.To) {
+			return fmt.Errorf("To %q is not a path of the Site.", r.To)
+		}
+		return nil
+	}
+	if r.Status == 0 {
+		r.Status = DEFAULT_REDIRECT_STATUS
+	}
+	known := false
+	names := make([]string, len(REDIRECT_STATUSES))
+	for i, status := range REDIRECT_STATUSES {
+		known = known || r.Status == status
+		names[i] = fmt.Sprint(status)
+	}
+	if !known {
+		return fmt.Errorf("Status %d is not one of %s.", r.Status,
+			strings.Join(names, ", "))
+	}
+	if r.Status == http.StatusGone {
+		if r.To != "" {
+			return fmt.Errorf("To is not allowed for status %d.", r.Status)
+		}
+	} else if r.To == "" {
+		return fmt.Errorf("To is missing.")
+	}
+	return nil
+
+}
+
+// isLocalPath returns true if the target is a path of the Site rather than
+// a URL elsewhere.
+func isLocalPath(target string) bool {
+	return strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//")
+}
+
+// Target returns the target of the Redirect for the cleaned request path,
+// before any query of the request is added, and true; or the empty string
+// and false if the Redirect does not match.
+func (r *Redirect) Target(rpath string) (string, bool) {
+
+	switch {
+	case r.From != "":
+		return r.To, rpath == r.From
+	case r.Prefix != "":
+		prefix := strings.TrimSuffix(r.Prefix, "/")
+		if rpath != r.Prefix && !strings.HasPrefix(rpath, prefix+"/") {
+			return "", false
+		}
+		rest := strings.TrimPrefix(rpath, prefix)
+		to, query := r.To, ""
+		if i := strings.Index(to, "?"); i >= 0 {
+			to, query = to[:i], to[i:]
+		}
+		if rest != "" {
+			to = strings.TrimSuffix(to, "/") + rest
+		}
+		return to + query, true
+	default:
+		m := r.Match.FindStringSubmatchIndex(rpath)
+		if m == nil {
+			return "", false
+		}
+		return string(r.Match.ExpandString(nil, r.To, rpath, m)), true
+	}
+
+}
+
+// RedirectFor returns the Redirect for the cleaned request path, and its
+// Target, if any applies.
+func (s *Site) RedirectFor(rpath string) (*Redirect, string) {
+
+	s.redirectMutex.RLock()
+	defer s.redirectMutex.RUnlock()
+	if r := s.exactRedirects[rpath]; r != nil {
+		return r, r.To
+	}
+	for _, r := range s.Redirects {
+		if r.From != "" {
+			continue
+		}
+		if target, ok := r.Target(rpath); ok {
+			return r, target
+		}
+	}
+	return nil, ""
+
+}
+
+// withQuery returns the target with the query added after its own, if any.
+func withQuery(target, query string) string {
+	if query == "" {
+		return target
+	}
+	if strings.Contains(target, "?") {
+		return target + "&" + query
+	}
+	return target + "?" + query
+}
+
+// Send the redirect, or the Gone page.
+func (s *Site) sendRedirect(w http.ResponseWriter, req *http.Request, r *Redirect, target string) {
+
+	if r.Status == http.StatusGone {
+		s.sendError(w, req, r.Status, nil)
+		return
+	}
+	http.Redirect(w, req, withQuery(target, req.URL.RawQuery), r.Status)
+
+}
+
+// rewriteRequest returns a copy of the request for the rewrite target, and
+// its cleaned path.
+func rewriteRequest(req *http.Request, target string) (*http.Request, string) {
+
+	u, err := url.Parse(target)
+	if err != nil {
+		// Only a bad capture could do this, so we serve what we can.
+		u = &url.URL{Path: target}
+	}
+	rr := req.Clone(req.Context())
+	rr.URL.Path = u.Path
+	rr.URL.RawPath = ""
+	if u.RawQuery != "" && req.URL.RawQuery != "" {
+		rr.URL.RawQuery = u.RawQuery + "&" + req.URL.RawQuery
+	} else if u.RawQuery != "" {
+		rr.URL.RawQuery = u.RawQuery
+	}
+	return rr, path.Clean("/" + u.Path)
+
+}
+
+// CheckRedirects returns the problems with the Site's Redirects: loops, and
+// chains longer than MAX_REDIRECT_CHAIN, as followed from each From and
+// Prefix.  Chains end at rewrites, and at targets outside the Site.
+func (s *Site) CheckRedirects() []error {
+
+	s.redirectMutex.RLock()
+	redirects := s.Redirects
+	s.redirectMutex.RUnlock()
+
+	errs := []error{}
+	found := map[string]bool{}
+	for _, r := range redirects {
+		start := r.From
+		if start == "" {
+			start = r.Prefix
+		}
+		if start == "" || r.Rewrite {
+			continue
+		}
+		chain := []string{start}
+		for cur := start; ; {
+			rr, target := s.RedirectFor(cur)
+			if rr == nil || rr.Rewrite || !isLocalPath(target) {
+				break
+			}
+			next := path.Clean(strings.SplitN(target, "?", 2)[0])
+			loop := -1
+			for i, p := range chain {
+				if p == next {
+					loop = i
+				}
+			}
+			chain = append(chain, next)
+			if loop >= 0 {
+				members := append([]string{}, chain[loop:len(chain)-1]...)
+				sort.Strings(members)
+				key := strings.Join(members, " ")
+				if !found[key] {
+					found[key] = true
+					errs = append(errs, fmt.Errorf("Redirect loop: %s",
+						strings.Join(chain[loop:], " -> ")))
+				}
+				break
+			}
+			if len(chain) > MAX_REDIRECT_CHAIN+1 {
+				errs = append(errs, fmt.Errorf("Redirect chain from %s is "+
+					"longer than %d: %s ...", start, MAX_REDIRECT_CHAIN,
+					strings.Join(chain, " -> ")))
+				break
+			}
+			cur = next
+		}
+	}
+	return errs
+
+}
+
+// redirectStubs returns pages redirecting as the exact Redirects do, by
+// path, for static hosts which can not be expected to send redirects.
+func (s *Site) redirectStubs() map[string][]byte {
+
+	s.redirectMutex.RLock()
+	defer s.redirectMutex.RUnlock()
+	stubs := map[string][]byte{}
+	for from, r := range s.exactRedirects {
+		if r.Rewrite || r.Status == http.StatusGone {
+			continue
+		}
+		target := r.To
+		if isLocalPath(target) {
+			target = strings.TrimSuffix(s.BaseURL, "/") + target
+		}
+		stubs[from] = aliasHTML(target)
+	}
+	return stubs
+
+}
@@ -0,0 +1,209 @@
+// redirects_test.go - tests for the Kisipar site's redirects and rewrites.
+// -----------------
+
+package site_test
+
+import (
+	// Standard:
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	// Third-party:
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/site"
+	"github.com/biztos/kisipar/site/sitetest"
+)
+
+var redirectsYaml = `# REDIRECTS TEST
+Redirects:
+    - {From: /old.html, To: /new}
+    - {From: /away, To: "https://example.org/there?from=us", Status: 302}
+    - {Prefix: /docs, To: /manual/, Status: 307}
+    - {Match: "^/(\\d{4})/(?P<slug>[a-z-]+)$", To: "/blog/${slug}?year=$1"}
+    - {From: /gone, Status: 410}
+    - {Prefix: /fake, To: "/real?via=rewrite", Rewrite: true}
+    - {Prefix: /, To: /nowhere, Status: 308}
+Pages:
+    /real/page.md: "# Real Page"
+Templates:
+    single: "{{ .Page.Title }}:{{ .Request.URL.Path }}?{{ .Request.URL.RawQuery }}"
+`
+
+func Test_Redirects(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(redirectsYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Equal(7, len(s.Redirects), "all redirects set") {
+		return
+	}
+	assert.Equal(301, s.Redirects[0].Status, "default status")
+
+	base := "http://example.com"
+	sitetest.AssertRedirect(t, s, base+"/old.html", 301, "/new")
+	sitetest.AssertRedirect(t, s, base+"/old.html?a=b", 301, "/new?a=b")
+	sitetest.AssertRedirect(t, s, base+"/away?a=b", 302,
+		"https://example.org/there?from=us&a=b")
+	sitetest.AssertRedirect(t, s, base+"/docs", 307, "/manual/")
+	sitetest.AssertRedirect(t, s, base+"/docs/a/b", 307, "/manual/a/b")
+	sitetest.AssertRedirect(t, s, base+"/docsx", 308, "/nowhere/docsx")
+	sitetest.AssertRedirect(t, s, base+"/2020/a-post?x=1", 301,
+		"/blog/a-post?year=2020&x=1")
+	sitetest.AssertRedirect(t, s, base+"/gone", 410, "")
+
+	// Rewrites serve the target, with the query:
+	handler := s.MainHandler()
+	req, w := ReqAndRec(t, base+"/fake/page?x=1")
+	handler(w, req)
+	assert.Equal(200, w.Code, "rewrite served")
+	assert.Equal("Real Page:/real/page?via=rewrite&amp;x=1", w.Body.String(),
+		"rewritten request served")
+
+	r, target := s.RedirectFor("/docs/x")
+	if assert.NotNil(r, "redirect found") {
+		assert.Equal("/docs", r.Prefix, "prefix redirect found")
+		assert.Equal("/manual/x", target, "target returned")
+	}
+	r, _ = s.RedirectFor("/fake/x")
+	assert.True(r.Rewrite, "rewrite found")
+
+	s, _ = site.LoadVirtualYaml("# NO REDIRECTS")
+	r, target = s.RedirectFor("/anything")
+	assert.Nil(r, "no redirect")
+	assert.Equal("", target, "no target")
+
+}
+
+func Test_Redirects_Errors(t *testing.T) {
+
+	assert := assert.New(t)
+
+	for yaml, exp := range map[string]string{
+		"Redirects: {a: b}":                           "Config Redirects is not a list.",
+		"Redirects: [x]":                              "Config Redirects item 0: not a map.",
+		"Redirects: [{To: /x}]":                       "Config Redirects item 0: Needs one of From, Prefix or Match.",
+		"Redirects: [{From: /a, Prefix: /b, To: /x}]": "Config Redirects item 0: Needs one of From, Prefix or Match.",
+		"Redirects: [{From: a, To: /x}]":              "Config Redirects item 0: a does not start with a slash.",
+		"Redirects: [{From: /a, To: 1}]":              "Config Redirects item 0: To is not a string.",
+		"Redirects: [{From: /a, To: /b, Status: x}]":  "Config Redirects item 0: Status is not a number.",
+		"Redirects: [{From: /a, To: /b, Status: 200}]": "Config Redirects item 0: " +
+			"Status 200 is not one of 301, 302, 307, 308, 410.",
+		"Redirects: [{From: /a}]":                      "Config Redirects item 0: To is missing.",
+		"Redirects: [{From: /a, To: /b, Status: 410}]": "Config Redirects item 0: To is not allowed for status 410.",
+		"Redirects: [{From: /a, To: /b, Rewrite: x}]":  "Config Redirects item 0: Rewrite is not a boolean.",
+		"Redirects: [{From: /a, To: /b, Other: x}]":    "Config Redirects item 0: Unknown setting Other.",
+		"Redirects: [{Match: \"(\", To: /b}]":          "Config Redirects item 0: Match: error parsing regexp: missing closing ): `(`",
+		"Redirects: [{From: /a, To: /b}, {From: /a/, To: /c}]": "Config Redirects item 1: " +
+			"From /a is already redirected.",
+		"Redirects: [{From: /a, To: /b, Rewrite: true, Status: 301}]": "" +
+			"Config Redirects item 0: Status is not allowed for a rewrite.",
+		"Redirects: [{From: /a, To: \"//x.com/b\", Rewrite: true}]": "" +
+			"Config Redirects item 0: To \"//x.com/b\" is not a path of the Site.",
+	} {
+		_, err := site.LoadVirtualYaml(yaml)
+		if assert.Error(err, "error for %s", yaml) {
+			assert.Equal(exp, err.Error(), "error useful for %s", yaml)
+		}
+	}
+
+}
+
+func Test_CheckRedirects(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(`# REDIRECT LOOPS
+Redirects:
+    - {From: /a, To: /b}
+    - {From: /b, To: "/c?x=1"}
+    - {Prefix: /c, To: /a}
+    - {From: /d, To: /d/}
+    - {Prefix: /e, To: /e/e}
+    - {From: /f, To: /g}
+    - {From: /g, To: "https://example.org/f"}
+    - {From: /h, To: /a, Rewrite: true}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := []string{}
+	for _, err := range s.CheckRedirects() {
+		errs = append(errs, err.Error())
+	}
+	assert.Equal([]string{
+		"Redirect loop: /a -> /b -> /c -> /a",
+		"Redirect loop: /d -> /d",
+		"Redirect chain from /e is longer than 10: /e -> /e/e -> /e/e/e -> " +
+			"/e/e/e/e -> /e/e/e/e/e -> /e/e/e/e/e/e -> /e/e/e/e/e/e/e -> " +
+			"/e/e/e/e/e/e/e/e -> /e/e/e/e/e/e/e/e/e -> /e/e/e/e/e/e/e/e/e/e -> " +
+			"/e/e/e/e/e/e/e/e/e/e/e -> /e/e/e/e/e/e/e/e/e/e/e/e ...",
+	}, errs, "loops and long chains found once each")
+
+}
+
+func Test_Redirects_Files(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	w := site.NewWatcher(s, 0)
+
+	// Redirects beat static files, and the file adds to the config:
+	writeFile(t, filepath.Join(dir, "config.yaml"),
+		"Redirects: [{From: /x.js, To: /y.js}]")
+	rpath := filepath.Join(dir, site.REDIRECTS_FILE)
+	writeFile(t, rpath, "- {From: /foo, To: /x.js}\n- {From: /bar, To: /bar}\n")
+	ev := w.Scan()
+	assert.True(ev.Config, "config change reported")
+	assert.True(ev.Redirects, "redirects file change reported")
+	s, err := site.Load(dir)
+	if !assert.Nil(err, "no error") {
+		return
+	}
+	sitetest.AssertRedirect(t, s, "http://example.com/x.js", 301, "/y.js")
+	sitetest.AssertRedirect(t, s, "http://example.com/foo", 301, "/x.js")
+
+	report, err := site.Check(dir)
+	if assert.Nil(err, "no error checking") &&
+		assert.Equal(1, len(report.Problems), "one problem") {
+		assert.Equal("Redirect loop: /bar -> /bar",
+			report.Problems[0].Error(), "loop reported")
+	}
+
+	// Exports redirect from exact Redirects, even over static files:
+	edir, err := ioutil.TempDir("", "kisipar-site-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(edir)
+	if _, err := s.Export(edir); !assert.Nil(err, "no export error") {
+		return
+	}
+	assert.Contains(readExport(t, edir, "x.js"),
+		`<meta http-equiv="refresh" content="0; url=http://localhost:8020/y.js">`,
+		"redirect exported over static file")
+	assert.Contains(readExport(t, edir, "foo/index.html"),
+		`url=http://localhost:8020/x.js`, "redirect exported as index")
+
+	writeFile(t, rpath, "- {From: /x.js, To: /z.js}\n")
+	_, err = site.Load(dir)
+	if assert.Error(err, "error for duplicate redirect") {
+		assert.Equal("Redirects file "+rpath+" item 0: From /x.js is "+
+			"already redirected.", err.Error(), "error useful")
+	}
+	writeFile(t, rpath, "{a: b}")
+	_, err = site.Load(dir)
+	if assert.Error(err, "error for bad redirects file") {
+		assert.Regexp("^Redirects file "+rpath+": yaml: ", err.Error(),
+			"error useful")
+	}
+
+}
@@ -0,0 +1,140 @@
+// reload.go - hot reloading for the Kisipar site.
+// ---------
+
+package site
+
+import (
+	// Standard library:
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// A LiveSite serves HTTP requests with the current version of a Site, which
+// can be replaced by a freshly loaded one at any time via Reload, without
+// interrupting service.  Requests in flight finish with the version they
+// started with.
+type LiveSite struct {
+
+	// Setup, if not nil, is called with each new version of the Site before
+	// it is swapped in, e.g. to apply settings not found in its config.  If
+	// it returns an error, the reload fails.
+	Setup func(*Site) error
+
+	site    *Site
+	handler http.Handler
+	mutex   sync.RWMutex
+
+	// Only one reload may run at a time.
+	reloading sync.Mutex
+}
+
+// NewLiveSite returns a LiveSite serving the Site, which is then reloaded
+// when its Watcher finds a config change.  If the Site's Server is
+// an http.Server, its Handler is replaced with the LiveSite, so that the
+// running Server always uses the current version; this should be done
+// before serving.
+func NewLiveSite(s *Site) *LiveSite {
+
+	l := &LiveSite{site: s}
+	l.serve(s)
+	if svr, ok := s.Server.(*http.Server); ok && svr.Handler != nil {
+		l.handler = svr.Handler
+		svr.Handler = l
+	} else {
+		l.handler = s.NewServeMux()
+	}
+	return l
+
+}
+
+// serve sets the Site, as served by the LiveSite, to reload itself when its
+// Watcher finds a config change.
+func (l *LiveSite) serve(s *Site) {
+	s.mutex.Lock()
+	s.reload = l.Reload
+	s.mutex.Unlock()
+}
+
+// Site returns the current version of the Site.
+func (l *LiveSite) Site() *Site {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.site
+}
+
+// ServeHTTP serves the request with the current version of the Site.
+func (l *LiveSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mutex.RLock()
+	h := l.handler
+	l.mutex.RUnlock()
+	h.ServeHTTP(w, r)
+}
+
+// Reload loads a complete new version of the Site from its Path -- config,
+// templates and pages -- while the current version keeps serving, then
+// swaps it in.  The new version takes over the current Server.  Any Watcher
+// of the current version is stopped, and if the new version's Watch property
+// is set then it starts its own.
+//
+// If the new version fails to load, the error is logged and returned, and
+// the current version remains in service.  Config changes that require a new
+// Server, such as the Port or TLS settings, do not take effect until the
+// next restart.
+func (l *LiveSite) Reload() error {
+
+	l.reloading.Lock()
+	defer l.reloading.Unlock()
+
+	cur := l.Site()
+	if cur.Path == "" {
+		err := errors.New("Virtual sites can not be reloaded.")
+		log.Printf("%s: reload failed: %s", cur.Name, err)
+		return err
+	}
+
+	fresh, err := Load(cur.Path)
+	if err != nil {
+		err = fmt.Errorf("Reload error at %s: %s", cur.Path, err)
+		log.Printf("%s: reload failed, keeping the current site: %s",
+			cur.Name, err)
+		return err
+	}
+	if l.Setup != nil {
+		if err := l.Setup(fresh); err != nil {
+			err = fmt.Errorf("Reload setup error at %s: %s", cur.Path, err)
+			log.Printf("%s: reload failed, keeping the current site: %s",
+				cur.Name, err)
+			return err
+		}
+	}
+	if fresh.Port != cur.Port || fresh.ServeTLS != cur.ServeTLS ||
+		fresh.CertFile != cur.CertFile || fresh.KeyFile != cur.KeyFile {
+		log.Printf("%s: server config changed, restart required.", cur.Name)
+	}
+
+	// Our fresh Site has its own standard Server, which will never be used
+	// except for its Handler.
+	handler := fresh.Server.(*http.Server).Handler
+	fresh.Server = cur.Server
+
+	l.serve(fresh)
+	if fresh.Watch {
+		fresh.StartWatching()
+	}
+
+	l.mutex.Lock()
+	l.site = fresh
+	l.handler = handler
+	l.mutex.Unlock()
+
+	cur.StopWatching()
+
+	// Browsers in DevMode reload, and thus reconnect to the new version.
+	cur.devEvents().close()
+	log.Printf("%s: reloaded.", fresh.Name)
+	return nil
+
+}
@@ -0,0 +1,226 @@
+// reload_test.go - tests for hot reloading of Kisipar sites.
+// --------------
+
+package site_test
+
+import (
+	// Standard:
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	// Third-party:
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/site"
+)
+
+func Test_NewLiveSite(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+
+	l := site.NewLiveSite(s)
+	assert.True(s == l.Site(), "Site is current")
+
+	req, rec := ReqAndRec(t, "http://example.com/foo")
+	s.ServeHTTP(rec, req)
+	assert.Equal("S:Foo", rec.Body.String(), "Site served via LiveSite")
+
+	req, rec = ReqAndRec(t, "http://example.com/foo")
+	l.ServeHTTP(rec, req)
+	assert.Equal("S:Foo", rec.Body.String(), "LiveSite served directly")
+
+}
+
+func Test_NewLiveSite_CustomServer(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	s.Server = &FakeServer{}
+
+	l := site.NewLiveSite(s)
+	req, rec := ReqAndRec(t, "http://example.com/foo")
+	l.ServeHTTP(rec, req)
+	assert.Equal("S:Foo", rec.Body.String(), "standard handler used")
+
+}
+
+func Test_LiveSite_Reload(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	l := site.NewLiveSite(s)
+
+	writeFile(t, filepath.Join(dir, "config.yaml"), "Name: Reloaded")
+	writeFile(t, filepath.Join(dir, "templates", "single.html"),
+		"R:{{ .Page.Title }}")
+	writeFile(t, filepath.Join(dir, "pages", "bar.md"), "# Bar")
+
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	log.SetFlags(0)
+	defer log.SetOutput(os.Stderr)
+	assert.Nil(l.Reload(), "no error")
+	assert.Equal("Reloaded: reloaded.\n", buf.String(), "reload logged")
+
+	fresh := l.Site()
+	assert.False(fresh == s, "new Site is current")
+	assert.Equal("Reloaded", fresh.Name, "config reloaded")
+	assert.Equal("Watched", s.Name, "old Site not modified")
+	assert.True(fresh.Server == s.Server, "Server taken over")
+
+	// The running Server now uses the new Site:
+	req, rec := ReqAndRec(t, "http://example.com/bar")
+	s.ServeHTTP(rec, req)
+	assert.Equal("R:Bar", rec.Body.String(), "new Site served")
+
+}
+
+func Test_LiveSite_ReloadFailure(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	l := site.NewLiveSite(s)
+
+	writeFile(t, filepath.Join(dir, "config.yaml"), "Name: [ Broken")
+
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	log.SetFlags(0)
+	defer log.SetOutput(os.Stderr)
+	err := l.Reload()
+	if assert.Error(err, "error returned") {
+		assert.Regexp("^Reload error at "+dir+": Config error", err.Error(),
+			"error is useful")
+	}
+	assert.Regexp("^Watched: reload failed, keeping the current site: ",
+		buf.String(), "error logged")
+	assert.True(s == l.Site(), "old Site kept")
+
+	req, rec := ReqAndRec(t, "http://example.com/foo")
+	s.ServeHTTP(rec, req)
+	assert.Equal("S:Foo", rec.Body.String(), "old Site served")
+
+}
+
+func Test_LiveSite_ReloadVirtual(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtual(nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := site.NewLiveSite(s)
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	err = l.Reload()
+	if assert.Error(err, "error returned") {
+		assert.Equal("Virtual sites can not be reloaded.", err.Error(),
+			"error as expected")
+	}
+	assert.True(s == l.Site(), "old Site kept")
+
+}
+
+func Test_LiveSite_ReloadWatch(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	s.StartWatching()
+	l := site.NewLiveSite(s)
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	// Watching stops unless the new config wants it.
+	assert.Nil(l.Reload(), "no error")
+	assert.Nil(s.Watcher, "old Watcher stopped")
+	assert.Nil(l.Site().Watcher, "no new Watcher")
+
+	writeFile(t, filepath.Join(dir, "config.yaml"), "Name: Watched\nWatch: true")
+	assert.Nil(l.Reload(), "no error")
+	fresh := l.Site()
+	defer fresh.StopWatching()
+	if assert.NotNil(fresh.Watcher, "new Watcher started") {
+		assert.True(fresh == fresh.Watcher.Site, "Watcher is for new Site")
+	}
+
+}
+
+func Test_LiveSite_ReloadOnConfigChange(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	l := site.NewLiveSite(s)
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	s.WatchInterval = 10 * time.Millisecond
+	s.StartWatching()
+	defer s.StopWatching()
+
+	writeFile(t, filepath.Join(dir, "config.yaml"), "Name: Changed")
+	deadline := time.Now().Add(5 * time.Second)
+	for l.Site() == s && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	fresh := l.Site()
+	if !assert.False(s == fresh, "Site reloaded") {
+		return
+	}
+	assert.Equal("Changed", fresh.Name, "new config applied")
+
+}
+
+func Test_Watcher_ConfigChangeNotLive(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	log.SetFlags(0)
+	defer log.SetOutput(os.Stderr)
+
+	events := make(chan *site.WatchEvent, 10)
+	w := site.NewWatcher(s, 10*time.Millisecond)
+	w.OnChange = func(ev *site.WatchEvent) { events <- ev }
+	w.Start()
+	defer w.Stop()
+
+	writeFile(t, filepath.Join(dir, "config.yaml"), "Name: Changed")
+	select {
+	case ev := <-events:
+		assert.True(ev.Config, "config change reported")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported")
+	}
+	assert.Contains(buf.String(),
+		"Watched: config changed; reload or restart to apply it.\n",
+		"restart notice logged")
+	assert.Equal("Watched", s.Name, "config not reloaded")
+
+}
@@ -0,0 +1,374 @@
+// routes.go - custom URLs and aliases for the Pages of the Kisipar site.
+// ---------
+
+package site
+
+import (
+	// Standard:
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/page"
+)
+
+// PERMALINK_TOKENS are the tokens a permalink pattern may contain: the
+// year, month and day of the Page's Created time, its Slug or else its file
+// name without the extension, and its section, i.e. the top directory under
+// the PagePath, if any.
+var PERMALINK_TOKENS = []string{":year", ":month", ":day", ":slug", ":section"}
+
+var permalinkTokenRx = regexp.MustCompile(`:[a-z]+`)
+
+// setupPermalinks sets the Site's Permalinks from the config, checking the
+// patterns.
+func (s *Site) setupPermalinks() error {
+
+	links, err := s.configStringMap("Permalinks")
+	if err != nil {
+		return err
+	}
+	for prefix, pattern := range links {
+		if err := checkPermalink(pattern); err != nil {
+			return fmt.Errorf("Config Permalinks %s: %s", prefix, err.Error())
+		}
+	}
+	s.Permalinks = links
+	return nil
+
+}
+
+func checkPermalink(pattern string) error {
+
+	if !strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("Pattern %s does not start with a slash.", pattern)
+	}
+	if strings.Contains(pattern, ".") {
+		return fmt.Errorf("Pattern %s contains a dot.", pattern)
+	}
+	for _, token := range permalinkTokenRx.FindAllString(pattern, -1) {
+		known := false
+		for _, t := range PERMALINK_TOKENS {
+			known = known || token == t
+		}
+		if !known {
+			return fmt.Errorf("Unknown token %s; known tokens: %s.", token,
+				strings.Join(PERMALINK_TOKENS, ", "))
+		}
+	}
+	return nil
+
+}
+
+// pagePath returns the slash-separated path of the Page under the PagePath,
+// with a leading slash, as matched by the Permalinks prefixes.
+func (s *Site) pagePath(p *page.Page) string {
+	rpath := filepath.ToSlash(strings.TrimPrefix(p.Path, s.PagePath))
+	return "/" + strings.TrimPrefix(rpath, "/")
+}
+
+// permalinkFor returns the permalink pattern for the Page, if any.  The
+// longest matching path prefix wins.
+func (s *Site) permalinkFor(p *page.Page) string {
+
+	rpath := s.pagePath(p)
+	found := ""
+	for prefix := range s.Permalinks {
+		if strings.HasPrefix(rpath, prefix) && len(prefix) > len(found) {
+			found = prefix
+		}
+	}
+	if found == "" {
+		return ""
+	}
+	return s.Permalinks[found]
+
+}
+
+// customRoute returns the URL path of the Page as set by its URL or Slug
+// meta or its permalink pattern, or the empty string if it has none.  Index
+// Pages have no permalinks, as they belong to their directories.
+func (s *Site) customRoute(p *page.Page) (string, error) {
+
+	if u := p.MetaString("URL"); u != "" {
+		return checkRoute(p, "URL", path.Clean("/"+u))
+	}
+
+	slug := p.MetaString("Slug")
+	if strings.Contains(slug, "/") {
+		return "", fmt.Errorf("Page %s: Slug %s contains a slash.",
+			p.Path, slug)
+	}
+	if pattern := s.permalinkFor(p); pattern != "" && !p.IsIndex {
+		return s.permalink(p, pattern, slug)
+	}
+	if slug == "" {
+		return "", nil
+	}
+	dir := path.Dir(path.Clean("/" + filepath.ToSlash(s.fileHref(p))))
+	return checkRoute(p, "Slug", path.Join(dir, slug))
+
+}
+
+// permalink returns the URL path of the Page from the pattern.
+func (s *Site) permalink(p *page.Page, pattern, slug string) (string, error) {
+
+	rpath := s.pagePath(p)
+	if slug == "" {
+		slug = strings.TrimSuffix(path.Base(rpath), path.Ext(rpath))
+	}
+	section := ""
+	if parts := strings.SplitN(strings.TrimPrefix(rpath, "/"), "/", 2); len(parts) > 1 {
+		section = parts[0]
+	}
+	var err error
+	route := permalinkTokenRx.ReplaceAllStringFunc(pattern, func(token string) string {
+		switch token {
+		case ":slug":
+			return slug
+		case ":section":
+			return section
+		}
+		created := p.Created()
+		if created == nil {
+			err = fmt.Errorf("Page %s: permalink %s needs a Created time.",
+				p.Path, pattern)
+			return ""
+		}
+		switch token {
+		case ":year":
+			return created.Format("2006")
+		case ":month":
+			return created.Format("01")
+		default:
+			return created.Format("02")
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return checkRoute(p, "Permalink", path.Clean(route))
+
+}
+
+// checkRoute returns the route unless it can not be served as a Page,
+// having a dot in it.
+func checkRoute(p *page.Page, what, route string) (string, error) {
+	if strings.Contains(route, ".") {
+		return "", fmt.Errorf("Page %s: %s %s contains a dot.", p.Path, what,
+			route)
+	}
+	return route, nil
+}
+
+// route returns the slash-separated URL path of the Page, with a leading
+// slash, as it is served.
+func (s *Site) route(p *page.Page) string {
+	return path.Clean("/" + filepath.ToSlash(s.Href(p)))
+}
+
+// setRoutes sets the custom routes and the aliases of the Site's Pages.
+// Every URL path may belong to one Page only: custom routes may not take
+// the paths of Pages served at their file paths, and aliases may not take
+// any Page's path, nor another Page's alias.  Any Page with a bad or
+// colliding route or alias is removed from the Pageset, and the error passed
+// to report with its path.  A contested route goes to the Page which had
+// custom routes or aliases before, so that a new Page can not take it, and
+// otherwise to the first Page in path order.
+func (s *Site) setRoutes(report func(path string, err error)) {
+
+	routes := map[string]string{}
+	aliases := map[string]string{}
+	var pages []*page.Page
+	if s.Pageset != nil {
+		pages = s.Pageset.Pages()
+	}
+	s.routeMutex.RLock()
+	had := map[string]bool{}
+	for _, key := range s.routes {
+		had[key] = true
+	}
+	for _, key := range s.aliases {
+		had[key] = true
+	}
+	s.routeMutex.RUnlock()
+	sort.SliceStable(pages, func(i, j int) bool {
+		return had[pageKey(pages[i])] && !had[pageKey(pages[j])]
+	})
+
+	owners := map[string]string{}
+	custom := map[string]string{}
+	bad := map[string]bool{}
+	drop := func(p *page.Page, err error) {
+		bad[p.Path] = true
+		s.Pageset.RemovePage(pageKey(p))
+		report(p.Path, err)
+	}
+	for _, p := range pages {
+		route, err := s.customRoute(p)
+		if err != nil {
+			drop(p, err)
+		} else if route != "" {
+			custom[p.Path] = route
+		} else if rpath := s.route(p); owners[rpath] == "" {
+			owners[rpath] = p.Path
+		}
+	}
+	for _, p := range pages {
+		route := custom[p.Path]
+		if route == "" {
+			continue
+		}
+		if other := owners[route]; other != "" {
+			drop(p, fmt.Errorf("Page %s: URL %s is already used by %s.",
+				p.Path, route, other))
+			continue
+		}
+		owners[route] = p.Path
+		routes[route] = pageKey(p)
+	}
+	for _, p := range pages {
+		if bad[p.Path] {
+			continue
+		}
+		for _, alias := range p.MetaStringArray("Aliases") {
+			alias = path.Clean("/" + alias)
+			other := owners[alias]
+			if other == p.Path {
+				// It would only redirect to itself.
+				continue
+			} else if other != "" {
+				drop(p, fmt.Errorf("Page %s: alias %s is already used by %s.",
+					p.Path, alias, other))
+				break
+			}
+			owners[alias] = p.Path
+			aliases[alias] = pageKey(p)
+		}
+	}
+
+	// Routes and aliases of dropped Pages go too.
+	for _, m := range []map[string]string{routes, aliases} {
+		for rpath, key := range m {
+			if s.Pageset.Page(key) == nil {
+				delete(m, rpath)
+			}
+		}
+	}
+
+	s.routeMutex.Lock()
+	s.routes = routes
+	s.aliases = aliases
+	s.routeMutex.Unlock()
+
+}
+
+// refreshPage refreshes the Page at key in the Pageset, as per RefreshPage,
+// and sets the routes again if that changed the Page's custom route or
+// Aliases.  Any route errors are logged, as they are no error of the request
+// at hand.
+func (s *Site) refreshPage(key string) error {
+
+	old := s.Pageset.Page(key)
+	err := s.Pageset.RefreshPage(key)
+	fresh := s.Pageset.Page(key)
+	if fresh != old && !reflect.DeepEqual(s.routing(old), s.routing(fresh)) {
+		s.setRoutes(func(path string, err error) {
+			log.Printf("%s: %s", s.Name, err)
+		})
+	}
+	return err
+
+}
+
+// routing returns what the routes depend on for the Page, which may be nil.
+func (s *Site) routing(p *page.Page) []string {
+
+	if p == nil {
+		return nil
+	}
+	route, err := s.customRoute(p)
+	if err != nil {
+		route = err.Error()
+	}
+	return append([]string{route}, p.MetaStringArray("Aliases")...)
+
+}
+
+// pageKey returns the Pageset key of the Page.
+func pageKey(p *page.Page) string {
+	return strings.TrimSuffix(p.Path, filepath.Ext(p.Path))
+}
+
+// routeKey returns the Pageset key of the Page with the custom route rpath,
+// if any.
+func (s *Site) routeKey(rpath string) string {
+	s.routeMutex.RLock()
+	defer s.routeMutex.RUnlock()
+	return s.routes[rpath]
+}
+
+// aliasPage returns the Page with the alias rpath, if any.
+func (s *Site) aliasPage(rpath string) *page.Page {
+
+	s.routeMutex.RLock()
+	key := s.aliases[rpath]
+	s.routeMutex.RUnlock()
+	if key == "" || s.Pageset == nil {
+		return nil
+	}
+	return s.Pageset.Page(key)
+
+}
+
+// aliasPages returns the Pages with aliases, by alias.
+func (s *Site) aliasPages() map[string]*page.Page {
+
+	s.routeMutex.RLock()
+	defer s.routeMutex.RUnlock()
+	pages := map[string]*page.Page{}
+	for alias, key := range s.aliases {
+		if p := s.Pageset.Page(key); p != nil {
+			pages[alias] = p
+		}
+	}
+	return pages
+
+}
+
+// Send a permanent redirect to the Page if the path is one of its Aliases,
+// keeping any query.
+func (s *Site) handleAlias(w http.ResponseWriter, req *http.Request, rpath string) bool {
+
+	p := s.aliasPage(rpath)
+	if p == nil {
+		return false
+	}
+	target := s.route(p)
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
+	}
+	http.Redirect(w, req, target, http.StatusMovedPermanently)
+	return true
+
+}
+
+// aliasHTML returns a page redirecting to the URL, for static hosts which
+// can not send redirects.
+func aliasHTML(url string) []byte {
+	u := html.EscapeString(url)
+	return []byte(`<!DOCTYPE html>
+<html><head><title>` + u + `</title>
+<link rel="canonical" href="` + u + `">
+<meta http-equiv="refresh" content="0; url=` + u + `">
+</head></html>
+`)
+}
@@ -0,0 +1,247 @@
+// routes_test.go - tests for the Kisipar site's custom URLs and aliases.
+// --------------
+
+package site_test
+
+import (
+	// Standard:
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	// Third-party:
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/site"
+)
+
+var routesYaml = `# ROUTES TEST
+MetaSchema: {/: {Strict: true}}
+Permalinks:
+    /blog: /:year/:month/:slug
+    /blog/notes: /notes/:section/:day/:slug
+Pages:
+    /about-us.md: "# About\n\n    URL: /about\n    Aliases: [/old-about, /info/, /about]\n"
+    /misc/thing.md: "# Thing\n\n    Slug: better-thing\n"
+    /blog/index.md: "# Blog\n\n    Slug: news\n"
+    /blog/a-post.md: "# A Post\n\n    Created: 2020-01-02\n"
+    /blog/b-post.md: "# B Post\n\n    Created: 2021-11-12\n    Slug: bee\n"
+    /blog/notes/n.md: "# Note\n\n    Created: 2021-11-12\n"
+    /plain.md: "# Plain"
+`
+
+func Test_Routes(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(routesYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(map[string]string{
+		"/blog":       "/:year/:month/:slug",
+		"/blog/notes": "/notes/:section/:day/:slug",
+	}, s.Permalinks, "permalinks set")
+
+	for key, exp := range map[string]string{
+		"/about-us":     "/about",
+		"/misc/thing":   "/misc/better-thing",
+		"/blog/index":   "/news",
+		"/blog/a-post":  "/2020/01/a-post",
+		"/blog/b-post":  "/2021/11/bee",
+		"/blog/notes/n": "/notes/blog/12/n",
+		"/plain":        "/plain",
+	} {
+		p := s.Pageset.Page(key)
+		if assert.NotNil(p, "page at %s", key) {
+			assert.Equal(exp, s.Href(p), "Href for %s", key)
+			assert.Equal("http://localhost:8020"+exp, s.PageURL(p),
+				"PageURL for %s", key)
+		}
+	}
+
+	handler := s.MainHandler()
+	get := func(url string) (int, string, string) {
+		req, w := ReqAndRec(t, "http://example.com"+url)
+		handler(w, req)
+		return w.Code, w.Header().Get("Location"), w.Body.String()
+	}
+
+	code, _, body := get("/about")
+	assert.Equal(200, code, "page at URL")
+	assert.Contains(body, "About", "page served at URL")
+	code, _, body = get("/2021/11/bee")
+	assert.Equal(200, code, "page at permalink")
+	assert.Contains(body, "B Post", "page served at permalink")
+	code, _, _ = get("/blog/b-post")
+	assert.Equal(404, code, "page not at file path")
+	code, _, _ = get("/plain")
+	assert.Equal(200, code, "plain page at file path")
+
+	code, loc, _ := get("/old-about")
+	assert.Equal(301, code, "alias redirects permanently")
+	assert.Equal("/about", loc, "alias redirects to page")
+	code, loc, _ = get("/info?x=1")
+	assert.Equal(301, code, "cleaned alias redirects")
+	assert.Equal("/about?x=1", loc, "query kept")
+	code, _, _ = get("/about")
+	assert.Equal(200, code, "alias of own URL ignored")
+
+}
+
+func Test_Routes_Errors(t *testing.T) {
+
+	assert := assert.New(t)
+
+	for yaml, exp := range map[string]string{
+		"Permalinks: [x]":           "Config Permalinks is not a map.",
+		"Permalinks: {/blog: x}":    "Config Permalinks /blog: Pattern x does not start with a slash.",
+		"Permalinks: {/blog: /a.b}": "Config Permalinks /blog: Pattern /a.b contains a dot.",
+		"Permalinks: {/blog: /:year/:name}": "Config Permalinks /blog: " +
+			"Unknown token :name; known tokens: :year, :month, :day, :slug, :section.",
+		"Pages: {/a.md: \"# A\\n\\n    URL: /b\\n\", /b.md: \"# B\"}": "" +
+			"Page /a.md: URL /b is already used by /b.md.",
+		"Pages: {/a.md: \"# A\\n\\n    Slug: c\\n\", /b.md: \"# B\\n\\n    URL: /c\\n\"}": "" +
+			"Page /b.md: URL /c is already used by /a.md.",
+		"Pages: {/a.md: \"# A\\n\\n    Aliases: [/b]\\n\", /b.md: \"# B\"}": "" +
+			"Page /a.md: alias /b is already used by /b.md.",
+		"Pages: {/a.md: \"# A\\n\\n    Aliases: /c\\n\", /b.md: \"# B\\n\\n    Aliases: /c\\n\"}": "" +
+			"Page /b.md: alias /c is already used by /a.md.",
+		"Pages: {/a.md: \"# A\\n\\n    URL: /a.html\\n\"}": "" +
+			"Page /a.md: URL /a.html contains a dot.",
+		"Pages: {/a.md: \"# A\\n\\n    Slug: x/y\\n\"}": "" +
+			"Page /a.md: Slug x/y contains a slash.",
+		"Permalinks: {/: /:year/:slug}\nPages: {/a.md: \"# A\"}": "" +
+			"Page /a.md: permalink /:year/:slug needs a Created time.",
+	} {
+		_, err := site.LoadVirtualYaml(yaml)
+		if assert.Error(err, "error for %s", yaml) {
+			assert.Equal(exp, err.Error(), "error useful for %s", yaml)
+		}
+	}
+
+}
+
+func Test_Routes_Files(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	pdir := filepath.Join(dir, "pages")
+
+	// Collisions are load errors:
+	writeFile(t, filepath.Join(pdir, "bar.md"), "# Bar\n\n    URL: /foo\n")
+	_, err := site.Load(dir)
+	if assert.Error(err, "error for collision") {
+		assert.Equal("Page "+filepath.Join(pdir, "bar.md")+": URL /foo is "+
+			"already used by "+filepath.Join(pdir, "foo.md")+".", err.Error(),
+			"error useful")
+	}
+	report, err := site.Check(dir)
+	if assert.Nil(err, "no error checking") &&
+		assert.Equal(1, len(report.Problems), "collision reported") {
+		assert.Equal(2, report.Pages, "all pages counted")
+		assert.Regexp("URL /foo is already used", report.Problems[0].Error(),
+			"collision reported")
+	}
+
+	// The Watcher keeps the routes up to date:
+	os.Remove(filepath.Join(pdir, "bar.md"))
+	s, err = site.Load(dir)
+	if !assert.Nil(err, "no error") {
+		return
+	}
+	w := site.NewWatcher(s, 0)
+	handler := s.MainHandler()
+	get := func(url string) (int, string) {
+		req, w := ReqAndRec(t, "http://example.com"+url)
+		handler(w, req)
+		return w.Code, w.Header().Get("Location")
+	}
+
+	writeFile(t, filepath.Join(pdir, "foo.md"),
+		"# Foo\n\n    Slug: fu\n    Aliases: [/foo]\n")
+	ev := w.Scan()
+	assert.Nil(ev.Errors, "no errors")
+	code, _ := get("/fu")
+	assert.Equal(200, code, "page served at new route")
+	code, loc := get("/foo")
+	assert.Equal(301, code, "old route redirects")
+	assert.Equal("/fu", loc, "old route redirects to new")
+
+	writeFile(t, filepath.Join(pdir, "bar.md"), "# Bar\n\n    URL: /fu\n")
+	ev = w.Scan()
+	if assert.Equal(1, len(ev.Errors), "one error") {
+		assert.Equal("Page "+filepath.Join(pdir, "bar.md")+": URL /fu is "+
+			"already used by "+filepath.Join(pdir, "foo.md")+".",
+			ev.Errors[0].Error(), "error useful")
+	}
+	assert.Nil(s.Pageset.Page(filepath.Join(pdir, "bar")), "page removed")
+	code, _ = get("/fu")
+	assert.Equal(200, code, "old page keeps route")
+
+	// Exports redirect from the aliases:
+	edir, err := ioutil.TempDir("", "kisipar-site-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(edir)
+	if _, err := s.Export(edir); !assert.Nil(err, "no export error") {
+		return
+	}
+	assert.Contains(readExport(t, edir, "fu/index.html"), "S:Foo",
+		"page exported at route")
+	assert.Contains(readExport(t, edir, "foo/index.html"),
+		`<meta http-equiv="refresh" content="0; url=http://localhost:8020/fu">`,
+		"alias exported as redirect")
+
+}
+
+func Test_Routes_Refresh(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir := tempSite(t)
+	defer os.RemoveAll(dir)
+	pdir := filepath.Join(dir, "pages")
+	writeFile(t, filepath.Join(pdir, "foo.md"), "# Foo\n\n    URL: /fu\n")
+	s, err := site.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.MainHandler()
+	get := func(url string) (int, string, string) {
+		req, w := ReqAndRec(t, "http://example.com"+url)
+		handler(w, req)
+		return w.Code, w.Header().Get("Location"), w.Body.String()
+	}
+
+	// Without a Watcher, Pages at custom routes are refreshed too:
+	writeFile(t, filepath.Join(pdir, "foo.md"), "# Fresh Foo\n\n    URL: /fu\n")
+	code, _, body := get("/fu")
+	assert.Equal(200, code, "page at route")
+	assert.Equal("S:Fresh Foo", body, "page at route refreshed")
+
+	// ...and changed routes and aliases are set again:
+	writeFile(t, filepath.Join(pdir, "foo.md"),
+		"# Foo\n\n    URL: /fa\n    Aliases: [/fu]\n")
+	code, loc, _ := get("/fu")
+	assert.Equal(301, code, "old route now redirects")
+	assert.Equal("/fa", loc, "old route redirects to new")
+	code, _, body = get("/fa")
+	assert.Equal(200, code, "page at new route")
+	assert.Equal("S:Foo", body, "page served at new route")
+
+	writeFile(t, filepath.Join(pdir, "foo.md"), "# Foo")
+	code, _, _ = get("/fa")
+	assert.Equal(404, code, "custom route gone")
+	code, _, body = get("/foo")
+	assert.Equal(200, code, "page at file path again")
+	assert.Equal("S:Foo", body, "page served at file path")
+	code, _, _ = get("/fu")
+	assert.Equal(404, code, "alias gone")
+
+}
@@ -0,0 +1,181 @@
+// rss.go - RSS feed generation for the Kisipar site.
+// ------
+//
+// USEFUL: https://www.rssboard.org/rss-specification
+
+package site
+
+import (
+	// Standard:
+	"encoding/xml"
+	"html"
+	"time"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/pageset"
+)
+
+// An RSSFeed is an RSS 2.0 document.  The Atom namespace is used for the
+// self link, the Dublin Core namespace for item authors (RSS itself wants
+// email addresses), and the content module for the full item content.  If
+// any item is a podcast episode, the iTunes and Podcasting 2.0 namespaces
+// are used too.
+type RSSFeed struct {
+	XMLName   xml.Name    `xml:"rss"`
+	Version   string      `xml:"version,attr"`
+	AtomNS    string      `xml:"xmlns:atom,attr"`
+	DCNS      string      `xml:"xmlns:dc,attr"`
+	ContentNS string      `xml:"xmlns:content,attr"`
+	FHNS      string      `xml:"xmlns:fh,attr,omitempty"`
+	ItunesNS  string      `xml:"xmlns:itunes,attr,omitempty"`
+	PodcastNS string      `xml:"xmlns:podcast,attr,omitempty"`
+	Channel   *RSSChannel `xml:"channel"`
+}
+
+// An RSSChannel is the channel of an RSSFeed.
+type RSSChannel struct {
+	Title         string       `xml:"title"`
+	Link          string       `xml:"link"`
+	Description   string       `xml:"description"`
+	AtomLink      []*RSSLink   `xml:"atom:link"`
+	Archive       *FeedArchive `xml:"fh:archive"`
+	LastBuildDate string       `xml:"lastBuildDate"`
+	Copyright     string       `xml:"copyright,omitempty"`
+	*ItunesChannel
+	Item []*RSSItem `xml:"item"`
+}
+
+// An RSSLink is an Atom link of an RSSChannel: to itself, or to its
+// archives.
+type RSSLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// An RSSItem is a single Page in an RSSFeed.  Its Description is the Page's
+// Summary as HTML, or its full content if it has no Summary; the full
+// content is always in the Content.  A podcast episode has an Enclosure.
+type RSSItem struct {
+	Title       string        `xml:"title,omitempty"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description"`
+	Content     string        `xml:"content:encoded"`
+	Creator     []string      `xml:"dc:creator"`
+	GUID        *RSSGUID      `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Enclosure   *RSSEnclosure `xml:"enclosure"`
+	*ItunesItem
+}
+
+// An RSSEnclosure is the media file of an RSSItem.
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// An RSSGUID identifies an RSSItem, here always by its permalink.
+type RSSGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSSFeed returns an RSS 2.0 feed for the Site, with the same items as its
+// Atom Feed.  If a Pageset is provided, that is used for the items;
+// otherwise the main Site Pageset is used.  The item pubDate is the Page's
+// Created time if it has one, otherwise its Time.
+func (s *Site) RSSFeed(ps *pageset.Pageset) *RSSFeed {
+	return s.rssFeed(s.mainFeed(ps))
+}
+
+// rssFeed returns the feed as an RSSFeed.
+func (s *Site) rssFeed(feed *feed) *RSSFeed {
+
+	items, newest := s.feedItems(feed)
+	built := time.Now()
+	if newest != nil {
+		built = *newest
+	}
+
+	c := &RSSChannel{
+		Title:       feed.title,
+		Link:        feed.home,
+		Description: feed.title,
+		AtomLink: []*RSSLink{{
+			Href: s.BaseURL + feed.path(s.RSSFeedPath),
+			Rel:  "self",
+			Type: RSS_CONTENT_TYPE,
+		}},
+		LastBuildDate: built.Format(time.RFC1123Z),
+		Copyright:     s.FeedRights,
+		Item:          make([]*RSSItem, len(items)),
+	}
+	for _, link := range s.feedArchiveLinks(feed, s.RSSFeedPath) {
+		c.AtomLink = append(c.AtomLink, &RSSLink{
+			Href: link.href,
+			Rel:  link.rel,
+			Type: RSS_CONTENT_TYPE,
+		})
+	}
+	if feed.archive > 0 {
+		c.Archive = &FeedArchive{}
+	}
+	for i, item := range items {
+		desc := item.content
+		if item.summary != "" {
+			desc = html.EscapeString(item.summary)
+		}
+		pub := item.updated
+		if item.published != nil {
+			pub = *item.published
+		}
+		c.Item[i] = &RSSItem{
+			Title:       item.title,
+			Link:        item.url,
+			Description: desc,
+			Content:     item.content,
+			Creator:     item.authors,
+			GUID:        &RSSGUID{IsPermaLink: true, Value: item.url},
+			PubDate:     pub.Format(time.RFC1123Z),
+		}
+		if ep := item.episode; ep != nil {
+			c.Item[i].Enclosure = &RSSEnclosure{
+				URL:    ep.media.url,
+				Length: ep.media.length,
+				Type:   ep.media.ctype,
+			}
+			c.Item[i].ItunesItem = s.itunesItem(ep)
+		}
+	}
+
+	f := &RSSFeed{
+		Version:   "2.0",
+		AtomNS:    "http://www.w3.org/2005/Atom",
+		DCNS:      "http://purl.org/dc/elements/1.1/",
+		ContentNS: "http://purl.org/rss/1.0/modules/content/",
+		Channel:   c,
+	}
+	if feed.archive > 0 {
+		f.FHNS = FEED_HISTORY_NS
+	}
+	for _, item := range items {
+		if item.episode != nil {
+			f.ItunesNS = ITUNES_NS
+			f.PodcastNS = PODCAST_NS
+			c.ItunesChannel = s.itunesChannel()
+			break
+		}
+	}
+	return f
+
+}
+
+// rssFeedXML returns the feed as RSS XML.
+func (s *Site) rssFeedXML(f *feed) ([]byte, error) {
+	data, err := xml.MarshalIndent(s.rssFeed(f), "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
@@ -0,0 +1,512 @@
+// schema.go - meta schemas for the Pages of the Kisipar site.
+// ---------
+
+package site
+
+import (
+	// Standard:
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/page"
+	"github.com/biztos/kisipar/utli"
+)
+
+// META_TYPES are the types a MetaKey may have.  Numbers are ints if they
+// have no fractional part, and lists must be actual lists, not strings.
+var META_TYPES = []string{"string", "bool", "int", "float", "time", "list",
+	"map"}
+
+// DEFAULT_META_KEYS are the meta keys Kisipar itself uses, which every
+// MetaSchema knows unless it defines them itself.
+var DEFAULT_META_KEYS = map[string]*MetaKey{
+
+	// Pages:
+	"Title":       {Name: "Title", Type: "string"},
+	"Template":    {Name: "Template", Type: "string"},
+	"Created":     {Name: "Created", Type: "time"},
+	"Updated":     {Name: "Updated", Type: "time"},
+	"Unlisted":    {Name: "Unlisted", Type: "bool"},
+	"Author":      {Name: "Author"},
+	"Description": {Name: "Description"},
+	"Summary":     {Name: "Summary"},
+	"Keywords":    {Name: "Keywords"},
+	"Tags":        {Name: "Tags"},
+
+	// Events:
+	"Start":    {Name: "Start", Type: "time"},
+	"End":      {Name: "End", Type: "time"},
+	"Location": {Name: "Location"},
+	"TimeZone": {Name: "TimeZone", Type: "string"},
+
+	// Routes:
+	"URL":     {Name: "URL", Type: "string"},
+	"Slug":    {Name: "Slug"},
+	"Aliases": {Name: "Aliases"},
+
+	// Feeds:
+	"Authors":      {Name: "Authors"},
+	"Contributors": {Name: "Contributors"},
+	"Rights":       {Name: "Rights"},
+
+	// Podcasts:
+	"Audio":       {Name: "Audio", Type: "string"},
+	"Video":       {Name: "Video", Type: "string"},
+	"Duration":    {Name: "Duration"},
+	"Episode":     {Name: "Episode"},
+	"Season":      {Name: "Season"},
+	"EpisodeType": {Name: "EpisodeType", Type: "string"},
+	"Explicit":    {Name: "Explicit", Type: "bool"},
+	"Transcript":  {Name: "Transcript", Type: "string"},
+
+	// Sitemaps:
+	"ChangeFreq": {Name: "ChangeFreq", Type: "string"},
+	"Priority":   {Name: "Priority"},
+}
+
+// A MetaSchema describes the meta expected of the Pages under its Path.  It
+// is configured under MetaSchema in the config file, by path prefix, e.g.:
+//
+//   MetaSchema:
+//       /blog:
+//           Required: [Created, Author]
+//           Strict: true
+//           Keys:
+//               Created: {Type: time, Formats: ["2006-01-02"]}
+//               Template: {Values: [post, post-wide]}
+//               Draft: {Type: bool}
+//
+// Prefixes are matched as for UnlistedPaths, the longest prefix winning, so
+// a "/" schema applies to all Pages not under another one.
+//
+// Required keys must be present, and if Strict is set, keys neither in Keys
+// nor Required nor DEFAULT_META_KEYS are errors, which catches typos.  An
+// index Page may always have a CASCADE_KEY.  Keys are matched as for
+// page.MetaString, in their exact, lower and upper case forms.
+//
+// Pages are validated, with their cascaded meta, as they are loaded; cf.
+// Site.CheckPage and Check.
+type MetaSchema struct {
+	Path     string
+	Required []string
+	Strict   bool
+	Keys     map[string]*MetaKey
+}
+
+// A MetaKey describes a meta value: its Type, if any, one of META_TYPES;
+// the Values allowed, if limited, compared as strings, and for each item of
+// a list; and for times, the time Formats allowed as layouts for time.Parse,
+// or if none, those of page.MetaTime.
+type MetaKey struct {
+	Name    string
+	Type    string
+	Values  []string
+	Formats []string
+}
+
+// setupMetaSchemas sets the Site's MetaSchemas from the config.
+func (s *Site) setupMetaSchemas() error {
+
+	s.MetaSchemas = []*MetaSchema{}
+	if s.Config.Root == nil {
+		return nil
+	}
+	schemas, err := s.Config.Map("MetaSchema")
+	if err != nil {
+		if isConfigTypeError(err) {
+			return fmt.Errorf("Config MetaSchema is not a map.")
+		}
+		return nil
+	}
+	for prefix, v := range schemas {
+		ms, err := metaSchema(prefix, v)
+		if err != nil {
+			return fmt.Errorf("Config MetaSchema %s: %s", prefix, err.Error())
+		}
+		s.MetaSchemas = append(s.MetaSchemas, ms)
+	}
+	sort.Slice(s.MetaSchemas, func(i, j int) bool {
+		return s.MetaSchemas[i].Path < s.MetaSchemas[j].Path
+	})
+	return nil
+
+}
+
+// metaSchema returns the MetaSchema for the path prefix from its config.
+func metaSchema(prefix string, v interface{}) (*MetaSchema, error) {
+
+	cfg, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not a map.")
+	}
+	ms := &MetaSchema{Path: prefix, Keys: map[string]*MetaKey{}}
+	var err error
+	for k, v := range cfg {
+		switch k {
+		case "Required":
+			ms.Required, err = schemaStrings(k, v)
+		case "Strict":
+			var ok bool
+			if ms.Strict, ok = v.(bool); !ok {
+				err = fmt.Errorf("Strict is not a boolean.")
+			}
+		case "Keys":
+			keys, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Keys is not a map.")
+			}
+			for name, kv := range keys {
+				ms.Keys[name], err = metaKey(name, kv)
+				if err != nil {
+					return nil, err
+				}
+			}
+		default:
+			err = fmt.Errorf("Unknown setting %s.", k)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ms, nil
+
+}
+
+// metaKey returns the MetaKey for the name from its config.
+func metaKey(name string, v interface{}) (*MetaKey, error) {
+
+	mk := &MetaKey{Name: name}
+	if v == nil {
+		return mk, nil
+	}
+	cfg, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Keys.%s is not a map.", name)
+	}
+	var err error
+	for k, v := range cfg {
+		switch k {
+		case "Type":
+			mk.Type, _ = v.(string)
+			if !knownMetaType(mk.Type) {
+				err = fmt.Errorf("Unknown type %q; known types: %s.",
+					fmt.Sprint(v), strings.Join(META_TYPES, ", "))
+			}
+		case "Values":
+			mk.Values, err = schemaStrings(k, v)
+		case "Formats":
+			mk.Formats, err = schemaStrings(k, v)
+		default:
+			err = fmt.Errorf("Unknown setting %s.", k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Keys.%s: %s", name, err.Error())
+		}
+	}
+	return mk, nil
+
+}
+
+func knownMetaType(t string) bool {
+	for _, known := range META_TYPES {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaStrings returns the list v as strings.
+func schemaStrings(name string, v interface{}) ([]string, error) {
+
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not a list.", name)
+	}
+	res := make([]string, len(list))
+	for i, item := range list {
+		res[i] = fmt.Sprint(item)
+	}
+	return res, nil
+
+}
+
+// schemaFor returns the MetaSchema for the Page at path, if any.  The
+// longest matching path prefix wins.
+func (s *Site) schemaFor(path string) *MetaSchema {
+
+	rpath := strings.TrimPrefix(path, s.PagePath)
+	var found *MetaSchema
+	for _, ms := range s.MetaSchemas {
+		if strings.HasPrefix(rpath, ms.Path) &&
+			(found == nil || len(ms.Path) > len(found.Path)) {
+			found = ms
+		}
+	}
+	return found
+
+}
+
+// pageErrors are all the problems found with a Page, which as an error is
+// the first of them.
+type pageErrors []error
+
+func (e pageErrors) Error() string {
+	return e[0].Error()
+}
+
+// CheckPage validates the Page's meta against its MetaSchema, if any, and
+// returns the problems found, in order of meta key.
+func (s *Site) CheckPage(p *page.Page) []error {
+
+	ms := s.schemaFor(p.Path)
+	if ms == nil {
+		return nil
+	}
+	return ms.Validate(p)
+
+}
+
+// Validate returns the problems found with the Page's meta, in order of
+// meta key.
+func (ms *MetaSchema) Validate(p *page.Page) []error {
+
+	problems := map[string]string{}
+	for _, name := range ms.Required {
+		if _, found := lookupMeta(p.Meta, name); !found {
+			problems[name] = "required key missing."
+		}
+	}
+
+	for k, v := range p.Meta {
+		mk := ms.keyFor(k)
+		if mk == nil {
+			if ms.Strict && !(p.IsIndex && matchesMetaKey(k, CASCADE_KEY)) {
+				problems[k] = "unknown key" + ms.suggest(k)
+			}
+			continue
+		}
+		if msg := mk.check(v); msg != "" {
+			problems[k] = msg
+		}
+	}
+
+	keys := make([]string, 0, len(problems))
+	for k := range problems {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	errs := make([]error, len(keys))
+	for i, k := range keys {
+		errs[i] = fmt.Errorf("Page %s: meta %s: %s", p.Path, k, problems[k])
+	}
+	return errs
+
+}
+
+// keyFor returns the MetaKey matching the meta key k, or nil if unknown.
+func (ms *MetaSchema) keyFor(k string) *MetaKey {
+
+	for _, keys := range []map[string]*MetaKey{ms.Keys, DEFAULT_META_KEYS} {
+		if mk := keys[k]; mk != nil {
+			return mk
+		}
+		for name, mk := range keys {
+			if matchesMetaKey(k, name) {
+				return mk
+			}
+		}
+	}
+	for _, name := range ms.Required {
+		if matchesMetaKey(k, name) {
+			return &MetaKey{Name: name}
+		}
+	}
+	return nil
+
+}
+
+// suggest returns the end of the message for an unknown key k: a suggestion
+// if it is within two edits of a known key, or else a period.
+func (ms *MetaSchema) suggest(k string) string {
+
+	names := append([]string{}, ms.Required...)
+	for _, keys := range []map[string]*MetaKey{ms.Keys, DEFAULT_META_KEYS} {
+		for name := range keys {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	best, bestDist := "", 3
+	for _, name := range names {
+		if d := editDistance(strings.ToLower(k), strings.ToLower(name)); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	if best == "" {
+		return "."
+	}
+	return "; did you mean " + best + "?"
+
+}
+
+// check returns a description of the problem with the value v, if any.
+func (mk *MetaKey) check(v interface{}) string {
+
+	switch mk.Type {
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Sprintf("not a string: %v.", v)
+		}
+	case "bool":
+		if _, ok := v.(bool); !ok {
+			return fmt.Sprintf("not a boolean: %v.", v)
+		}
+	case "int":
+		if f, ok := metaNumber(v); !ok || f != float64(int64(f)) {
+			return fmt.Sprintf("not an integer: %v.", v)
+		}
+	case "float":
+		if _, ok := metaNumber(v); !ok {
+			return fmt.Sprintf("not a number: %v.", v)
+		}
+	case "time":
+		if !mk.isTime(v) {
+			return fmt.Sprintf("not a valid time: %v.", v)
+		}
+	case "list":
+		if _, ok := metaList(v); !ok {
+			return fmt.Sprintf("not a list: %v.", v)
+		}
+	case "map":
+		switch v.(type) {
+		case map[string]interface{}, map[interface{}]interface{}:
+		default:
+			return fmt.Sprintf("not a map: %v.", v)
+		}
+	}
+
+	if len(mk.Values) > 0 {
+		items, ok := metaList(v)
+		if !ok {
+			items = []interface{}{v}
+		}
+		for _, item := range items {
+			if !mk.allows(fmt.Sprint(item)) {
+				return fmt.Sprintf("%q not allowed; allowed values: %s.",
+					fmt.Sprint(item), strings.Join(mk.Values, ", "))
+			}
+		}
+	}
+	return ""
+
+}
+
+func (mk *MetaKey) allows(val string) bool {
+	for _, allowed := range mk.Values {
+		if val == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// isTime returns true if v is a time, or a string in one of the Formats.
+func (mk *MetaKey) isTime(v interface{}) bool {
+
+	switch t := v.(type) {
+	case time.Time:
+		return true
+	case string:
+		if len(mk.Formats) == 0 {
+			return utli.ParseTimeString(t) != nil
+		}
+		for _, layout := range mk.Formats {
+			if _, err := time.Parse(layout, t); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+
+}
+
+func metaNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func metaList(v interface{}) ([]interface{}, bool) {
+	switch l := v.(type) {
+	case []interface{}:
+		return l, true
+	case []string:
+		items := make([]interface{}, len(l))
+		for i, s := range l {
+			items[i] = s
+		}
+		return items, true
+	}
+	return nil, false
+}
+
+// matchesMetaKey returns true if the meta key k is the name in any of the
+// forms page.MetaString looks for.
+func matchesMetaKey(k, name string) bool {
+	return k == name || k == strings.ToLower(name) || k == strings.ToUpper(name)
+}
+
+// lookupMeta looks up the name in the meta as page.MetaString does.
+func lookupMeta(meta map[string]interface{}, name string) (interface{}, bool) {
+	for _, k := range []string{name, strings.ToLower(name), strings.ToUpper(name)} {
+		if v, ok := meta[k]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
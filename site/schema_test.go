@@ -0,0 +1,304 @@
+// schema_test.go - tests for the Kisipar site's meta schemas.
+// --------------
+
+package site_test
+
+import (
+	// Standard:
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	// Third-party:
+	"github.com/olebedev/config"
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/page"
+	"github.com/biztos/kisipar/site"
+)
+
+var metaSchemaYaml = `# META SCHEMA TEST
+MetaSchema:
+    /:
+        Keys:
+            Draft: {Type: bool}
+    /blog:
+        Required: [Created, Author]
+        Strict: true
+        Keys:
+            Created: {Type: time, Formats: ["2006-01-02"]}
+            Template: {Values: [post, wide]}
+            Tags: {Type: list, Values: [go, web]}
+            Rating: {Type: int}
+            Score: {Type: float}
+            Extra: {Type: map}
+            Name: {Type: string}
+`
+
+func schemaErrors(t *testing.T, s *site.Site, path, src string) []string {
+
+	p, err := page.LoadVirtualString(path, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := []string{}
+	for _, err := range s.CheckPage(p) {
+		errs = append(errs, err.Error())
+	}
+	return errs
+
+}
+
+func Test_MetaSchema(t *testing.T) {
+
+	assert := assert.New(t)
+
+	cfg, err := config.ParseYaml(metaSchemaYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := site.LoadVirtual(cfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(2, len(s.MetaSchemas), "two schemas") {
+		ms := s.MetaSchemas[1]
+		assert.Equal("/blog", ms.Path, "schemas sorted by path")
+		assert.Equal([]string{"Created", "Author"}, ms.Required, "required")
+		assert.True(ms.Strict, "strict")
+		assert.Equal(&site.MetaKey{Name: "Created", Type: "time",
+			Formats: []string{"2006-01-02"}}, ms.Keys["Created"], "key")
+	}
+
+	good := "# Hi\n\n    Created: 2020-01-02\n    author: Me\n" +
+		"    Tags: [go]\n    Template: wide\n    Rating: 3\n    Score: 1.5\n" +
+		"    Extra: {a: b}\n    Name: x\n    Unlisted: false\n"
+	assert.Equal([]string{}, schemaErrors(t, s, "/blog/good.md", good),
+		"no errors for good meta")
+	assert.Equal([]string{}, schemaErrors(t, s, "/other.md", "# Hi\n\n    Any: thing\n"),
+		"no errors for other path")
+	assert.Equal([]string{
+		"Page /other.md: meta Draft: not a boolean: yes please.",
+	}, schemaErrors(t, s, "/other.md", "# Hi\n\n    Draft: yes please\n"),
+		"top schema applies")
+
+	bad := "# Hi\n\n    Created: 01/02/2020\n    Tempalte: post\n" +
+		"    Tags: [go, rust]\n    Rating: 1.5\n    Score: lots\n" +
+		"    Extra: [a]\n    Name: [x]\n    Unlisted: 1\n    Whatever: 1\n" +
+		"    Template: narrow\n"
+	assert.Equal([]string{
+		"Page /blog/bad.md: meta Author: required key missing.",
+		"Page /blog/bad.md: meta Created: not a valid time: 01/02/2020.",
+		"Page /blog/bad.md: meta Extra: not a map: [a].",
+		"Page /blog/bad.md: meta Name: not a string: [x].",
+		"Page /blog/bad.md: meta Rating: not an integer: 1.5.",
+		"Page /blog/bad.md: meta Score: not a number: lots.",
+		"Page /blog/bad.md: meta Tags: \"rust\" not allowed; " +
+			"allowed values: go, web.",
+		"Page /blog/bad.md: meta Tempalte: unknown key; " +
+			"did you mean Template?",
+		"Page /blog/bad.md: meta Template: \"narrow\" not allowed; " +
+			"allowed values: post, wide.",
+		"Page /blog/bad.md: meta Unlisted: not a boolean: 1.",
+		"Page /blog/bad.md: meta Whatever: unknown key.",
+	}, schemaErrors(t, s, "/blog/bad.md", bad), "all problems found")
+
+	idx := "# Hi\n\n    Created: 2020-01-02\n    Author: Me\n" +
+		"    Cascade: {Author: You}\n"
+	assert.Equal([]string{}, schemaErrors(t, s, "/blog/index.md", idx),
+		"cascade allowed in index")
+	assert.Equal([]string{
+		"Page /blog/post.md: meta Cascade: unknown key.",
+	}, schemaErrors(t, s, "/blog/post.md", idx),
+		"cascade not allowed elsewhere")
+
+	// Times may come from TOML as such:
+	ms := s.MetaSchemas[1]
+	p := &page.Page{Path: "/blog/toml.md", Meta: map[string]interface{}{
+		"Created": time.Now(),
+		"Author":  "Me",
+	}}
+	assert.Equal(0, len(ms.Validate(p)), "time.Time is a time")
+
+	// Without Formats, times are as for MetaTime:
+	ms.Keys["Created"].Formats = nil
+	p.Meta["Created"] = "2020-01-02 03:04:05"
+	assert.Equal(0, len(ms.Validate(p)), "MetaTime format")
+
+}
+
+func Test_MetaSchema_ConfigErrors(t *testing.T) {
+
+	assert := assert.New(t)
+
+	for yaml, exp := range map[string]string{
+		"MetaSchema: [x]":                       "Config MetaSchema is not a map.",
+		"MetaSchema: {/x: 1}":                   "Config MetaSchema /x: not a map.",
+		"MetaSchema: {/x: {Required: x}}":       "Config MetaSchema /x: Required is not a list.",
+		"MetaSchema: {/x: {Strict: x}}":         "Config MetaSchema /x: Strict is not a boolean.",
+		"MetaSchema: {/x: {Keys: x}}":           "Config MetaSchema /x: Keys is not a map.",
+		"MetaSchema: {/x: {Other: x}}":          "Config MetaSchema /x: Unknown setting Other.",
+		"MetaSchema: {/x: {Keys: {A: 1}}}":      "Config MetaSchema /x: Keys.A is not a map.",
+		"MetaSchema: {/x: {Keys: {A: {B: 1}}}}": "Config MetaSchema /x: Keys.A: Unknown setting B.",
+		"MetaSchema: {/x: {Keys: {A: {Values: 1}}}}": "Config MetaSchema /x: " +
+			"Keys.A: Values is not a list.",
+		"MetaSchema: {/x: {Keys: {A: {Type: date}}}}": "Config MetaSchema /x: " +
+			"Keys.A: Unknown type \"date\"; known types: " +
+			"string, bool, int, float, time, list, map.",
+	} {
+		_, err := site.LoadVirtualYaml(yaml)
+		if assert.Error(err, "error for %s", yaml) {
+			assert.Equal(exp, err.Error(), "error useful for %s", yaml)
+		}
+	}
+
+}
+
+func Test_MetaSchema_LoadPages(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir := tempSite(t)
+	defer os.RemoveAll(dir)
+	pdir := filepath.Join(dir, "pages")
+
+	writeFile(t, filepath.Join(dir, "config.yaml"),
+		"MetaSchema: {/: {Required: [Created]}}")
+	_, err := site.Load(dir)
+	if assert.Error(err, "error for invalid page") {
+		assert.Equal("Page "+filepath.Join(pdir, "foo.md")+
+			": meta Created: required key missing.", err.Error(),
+			"error useful")
+	}
+
+	writeFile(t, filepath.Join(pdir, site.CASCADE_FILE), "Created: 2020-01-02")
+	s, err := site.Load(dir)
+	if !assert.Nil(err, "no error with cascaded meta") {
+		return
+	}
+
+	// The Watcher drops invalid pages:
+	w := site.NewWatcher(s, 0)
+	writeFile(t, filepath.Join(pdir, "foo.md"), "# Foo\n\n    Created: never\n")
+	ev := w.Scan()
+	if assert.Equal(1, len(ev.Errors), "one error") {
+		assert.Equal("Page "+filepath.Join(pdir, "foo.md")+
+			": meta Created: not a valid time: never.",
+			ev.Errors[0].Error(), "error useful")
+	}
+	assert.Nil(s.Pageset.Page(filepath.Join(pdir, "foo")), "page removed")
+
+	_, err = site.LoadVirtualYaml(`# INVALID VIRTUAL
+MetaSchema: {/: {Strict: true}}
+Pages:
+    /foo.md: "# Foo\n\n    Craeted: 2020-01-02\n"
+`)
+	if assert.Error(err, "error for invalid virtual page") {
+		assert.Equal("Page /foo.md: meta Craeted: unknown key; "+
+			"did you mean Created?", err.Error(), "error useful")
+	}
+
+}
+
+func Test_MetaSchema_StrictDefaultKeys(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml("MetaSchema: {/: {Strict: true}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := `Title: All Keys
+Template: single
+Created: 2020-01-02
+Updated: 2020-01-03
+Unlisted: false
+Author: Jo
+Description: All the keys.
+Summary: Every one.
+Keywords: keys, all
+Tags: [keys]
+Start: 2020-01-04 10:00:00
+End: 2020-01-04 12:00:00
+Location: Here
+TimeZone: Europe/Budapest
+URL: /keys/all
+Slug: all-keys
+Aliases: [/all]
+Authors: [Jo, Mo]
+Contributors: [Bo]
+Rights: Copyright Jo
+Audio: /ep1.mp3
+Video: /ep1.mp4
+Duration: 1:02:03
+Episode: 1
+Season: 2
+EpisodeType: full
+Explicit: false
+Transcript: /ep1.vtt
+ChangeFreq: weekly
+Priority: 0.5
+`
+	lines := strings.Split(strings.TrimSpace(meta), "\n")
+	assert.Equal(len(site.DEFAULT_META_KEYS), len(lines), "every key used")
+	src := "# All Keys\n\n    " + strings.Join(lines, "\n    ") + "\n"
+	assert.Empty(schemaErrors(t, s, "/all.md", src), "no errors")
+
+}
+
+func Test_MetaSchema_Refresh(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir := tempSite(t)
+	defer os.RemoveAll(dir)
+	pdir := filepath.Join(dir, "pages")
+	writeFile(t, filepath.Join(dir, "config.yaml"),
+		"MetaSchema: {/: {Strict: true}}")
+	s, err := site.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.MainHandler()
+	get := func(url string) int {
+		req, w := ReqAndRec(t, "http://example.com"+url)
+		handler(w, req)
+		return w.Code
+	}
+
+	// Refreshed pages are checked as at load time:
+	writeFile(t, filepath.Join(pdir, "foo.md"),
+		"# Foo\n\n    Craeted: 2020-01-02\n")
+	assert.Equal(500, get("/foo"), "invalid page not served")
+	assert.Nil(s.Pageset.Page(filepath.Join(pdir, "foo")), "page removed")
+	writeFile(t, filepath.Join(pdir, "foo.md"), "# Foo")
+	assert.Equal(200, get("/foo"), "fixed page served")
+
+	// ...and cascade as at load time:
+	writeFile(t, filepath.Join(pdir, "index.md"),
+		"# Top\n\n    Cascade: {Unlisted: true}\n")
+	get("/")
+	writeFile(t, filepath.Join(pdir, "bar.md"), "# Bar")
+	assert.Equal(200, get("/bar"), "new page served")
+	if p := s.Pageset.Page(filepath.Join(pdir, "bar")); assert.NotNil(p) {
+		assert.True(p.Unlisted, "refreshed index cascade applied")
+	}
+
+	// Replacements found by the Watcher are checked too:
+	w := site.NewWatcher(s, 0)
+	writeFile(t, filepath.Join(pdir, "bar.txt"),
+		"# Bar\n\n    Craeted: 2020-01-02\n")
+	w.Scan()
+	os.Remove(filepath.Join(pdir, "bar.md"))
+	ev := w.Scan()
+	if assert.Equal(1, len(ev.Errors), "one error") {
+		assert.Equal("Page "+filepath.Join(pdir, "bar.txt")+
+			": meta Craeted: unknown key; did you mean Created?",
+			ev.Errors[0].Error(), "error useful")
+	}
+	assert.Nil(s.Pageset.Page(filepath.Join(pdir, "bar")), "invalid page left out")
+
+}
@@ -0,0 +1,106 @@
+// search.go - site search for the Kisipar site.
+// ---------
+
+package site
+
+import (
+	// Standard library:
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// A SearchResponse is the JSON response of the site search.
+type SearchResponse struct {
+	Query   string       `json:"query"`
+	Results []*SearchHit `json:"results"`
+}
+
+// A SearchHit is a single result in a SearchResponse.  The Summary is the
+// Page's Summary, or its Description if there is none.
+type SearchHit struct {
+	Title   string  `json:"title"`
+	URL     string  `json:"url"`
+	Summary string  `json:"summary,omitempty"`
+	Score   float64 `json:"score"`
+}
+
+// wantsJSON returns true if the request asks for JSON, via the Accept header
+// or a "format=json" parameter.
+func wantsJSON(req *http.Request) bool {
+	return req.URL.Query().Get("format") == "json" ||
+		strings.Contains(req.Header.Get("Accept"), "application/json")
+}
+
+// Send search results for the "q" parameter if the path matches the
+// SearchPath: through the "search" template if there is one, otherwise, or
+// if requested, as JSON.  Any Page at the SearchPath wins, as it may well
+// predate the search; so does any error finding it.
+func (s *Site) handleSearch(w http.ResponseWriter, req *http.Request, rpath string) bool {
+
+	if s.NoSearch || rpath != s.SearchPath || s.Pageset == nil {
+		return false
+	}
+	if p, err := s.PageForPath(rpath); p != nil || (err != nil && !os.IsNotExist(err)) {
+		return false
+	}
+
+	query := req.URL.Query().Get("q")
+	results := s.Pageset.Search(query)
+
+	tmpl := s.CurrentTemplate()
+	if tmpl != nil {
+		tmpl = tmpl.Lookup("search")
+	}
+	if tmpl == nil || wantsJSON(req) {
+		res := &SearchResponse{Query: query, Results: []*SearchHit{}}
+		for _, r := range results {
+			summary := r.Page.Summary()
+			if summary == "" {
+				summary = r.Page.Description()
+			}
+			res.Results = append(res.Results, &SearchHit{
+				Title:   r.Page.Title(),
+				URL:     s.PageURL(r.Page),
+				Summary: summary,
+				Score:   r.Score,
+			})
+		}
+		data, err := json.Marshal(res)
+		if err != nil {
+			s.sendInternalServerError(w, req, err)
+			return true
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return true
+	}
+
+	dot := &Dot{
+		Request: req,
+		Site:    s,
+		Now:     time.Now(),
+		Status:  http.StatusOK,
+		Query:   query,
+		Results: results,
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, dot); err != nil {
+		s.sendInternalServerError(w, req, err)
+		return true
+	}
+	body := buf.Bytes()
+	if s.DevMode {
+		body = injectDevScript(body, nil)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+	return true
+
+}
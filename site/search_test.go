@@ -0,0 +1,151 @@
+// search_test.go - tests for the Kisipar site search.
+// --------------
+
+package site_test
+
+import (
+	// Standard:
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	// Third-party:
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/site"
+)
+
+var searchYaml = `# SEARCH TEST
+Pages:
+    apple.md: |
+        # Apple Pie
+
+            Summary: Pie with apples.
+
+        Bake the apples.
+    banana.md: |
+        # Banana Bread
+
+            Description: Bread with bananas.
+
+        Mash the bananas; no apples.
+`
+
+func Test_MainHandler_SearchJSON(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(searchYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, rec := ReqAndRec(t, "http://example.com/search?q=apples")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "search served")
+	assert.Equal("application/json", rec.Header().Get("Content-Type"),
+		"JSON without a search template")
+	res := &site.SearchResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), res); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal("apples", res.Query, "query returned")
+	if assert.Equal(2, len(res.Results), "two results") {
+		assert.Equal("Apple Pie", res.Results[0].Title, "ordered")
+		assert.Equal("http://localhost:8020/apple", res.Results[0].URL,
+			"URL set")
+		assert.Equal("Pie with apples.", res.Results[0].Summary,
+			"summary set")
+		assert.Equal("Bread with bananas.", res.Results[1].Summary,
+			"description for summary")
+		assert.True(res.Results[0].Score > 0, "score set")
+	}
+
+	req, rec = ReqAndRec(t, "http://example.com/search")
+	s.ServeHTTP(rec, req)
+	assert.Equal(`{"query":"","results":[]}`, rec.Body.String(),
+		"empty query, empty results")
+
+	s.NoSearch = true
+	req, rec = ReqAndRec(t, "http://example.com/search?q=apples")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "search not served with NoSearch")
+
+}
+
+func Test_MainHandler_SearchTemplate(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "pages", "bar.md"), "# Bar\n\nFoo here.")
+	writeFile(t, filepath.Join(dir, "templates", "search.html"),
+		`Q:{{ .Query }}{{ range .Results }} {{ .Page.Title }}{{ end }}`)
+	s, err := site.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, rec := ReqAndRec(t, "http://example.com/search?q=foo")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "search served")
+	assert.Equal("text/html; charset=utf-8", rec.Header().Get("Content-Type"),
+		"HTML from the search template")
+	assert.Equal("Q:foo Foo Bar", rec.Body.String(), "template rendered")
+
+	req, rec = ReqAndRec(t, "http://example.com/search?q=foo&format=json")
+	s.ServeHTTP(rec, req)
+	assert.Equal("application/json", rec.Header().Get("Content-Type"),
+		"JSON on request")
+
+	req, rec = ReqAndRec(t, "http://example.com/search?q=foo")
+	req.Header.Set("Accept", "application/json")
+	s.ServeHTTP(rec, req)
+	assert.Equal("application/json", rec.Header().Get("Content-Type"),
+		"JSON on Accept")
+
+	// Pages can search too.
+	writeFile(t, filepath.Join(dir, "templates", "single.html"),
+		`{{ range .Site.Pageset.Search "bar" }}{{ .Page.Title }}{{ end }}`)
+	if err := s.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	req, rec = ReqAndRec(t, "http://example.com/foo")
+	s.ServeHTTP(rec, req)
+	assert.Equal("Bar", rec.Body.String(), "search in page template")
+
+}
+
+func Test_MainHandler_SearchPath(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "pages", "search.md"), "# Search Page")
+
+	// Search gives way to a Page at its path:
+	req, rec := ReqAndRec(t, "http://example.com/search?q=foo")
+	s.ServeHTTP(rec, req)
+	assert.Equal("S:Search Page", rec.Body.String(),
+		"page served at SearchPath")
+
+	writeFile(t, filepath.Join(dir, "config.yaml"), "SearchPath: /find")
+	s, err := site.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, rec = ReqAndRec(t, "http://example.com/search")
+	s.ServeHTTP(rec, req)
+	assert.Equal("S:Search Page", rec.Body.String(), "page served at /search")
+
+	req, rec = ReqAndRec(t, "http://example.com/find?q=foo")
+	s.ServeHTTP(rec, req)
+	assert.Regexp(`^\{"query":"foo","results":\[\{"title":"Foo"`,
+		rec.Body.String(), "search served at SearchPath")
+
+}
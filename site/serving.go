@@ -3,6 +3,10 @@
 
 package site
 
+import (
+	"context"
+)
+
 // Serve serves the Site, either in TLS mode or insecure.  For most purposes
 // insecure will be preferable, as you should have another layer between
 // Kisipar and the open internet.
@@ -12,12 +16,20 @@ package site
 // Serve does NOT block to wait for the server to finish, as one may serve
 // multiple Kisipar sites from a single application.  In order to block in
 // the normal fashion, wrap the final Serve call in log.Fatal or similar.
+//
+// If the Site's Watch property is true, a Watcher is started for the
+// duration of the Serve call.
 func (s *Site) Serve() error {
 
 	if s.Server == nil {
 		panic("Serve called but Server is nil.") // ...at least helpful.
 	}
 
+	if s.Watch && !s.watching() {
+		s.StartWatching()
+		defer s.StopWatching()
+	}
+
 	if s.ServeTLS {
 		return s.Server.ListenAndServeTLS(s.CertFile, s.KeyFile)
 
@@ -26,3 +38,17 @@ func (s *Site) Serve() error {
 	}
 
 }
+
+// Shutdown gracefully shuts down the Site's Server, as per
+// http.Server.Shutdown: listeners are closed at once, and open connections
+// are allowed to finish until the context is done.  A running Serve call
+// will then return http.ErrServerClosed.
+func (s *Site) Shutdown(ctx context.Context) error {
+
+	if s.Server == nil {
+		panic("Shutdown called but Server is nil.")
+	}
+
+	return s.Server.Shutdown(ctx)
+
+}
@@ -5,8 +5,10 @@ package site_test
 
 import (
 	// Standard:
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"testing"
 
 	// Third-party:
@@ -19,7 +21,8 @@ import (
 // A fake Server! Because we aren't going to write unit tests for the http
 // package here. :-)
 type FakeServer struct {
-	ServeTLS bool
+	ServeTLS  bool
+	Shutdowns int
 }
 
 func (s *FakeServer) ListenAndServe() error {
@@ -28,6 +31,10 @@ func (s *FakeServer) ListenAndServe() error {
 func (s *FakeServer) ListenAndServeTLS(c, k string) error {
 	return fmt.Errorf("SECURE: %s & %s", c, k)
 }
+func (s *FakeServer) Shutdown(ctx context.Context) error {
+	s.Shutdowns++
+	return ctx.Err()
+}
 
 func Test_ServeWithoutServerPanics(t *testing.T) {
 
@@ -81,3 +88,50 @@ func Test_ServeWithTLS(t *testing.T) {
 	}
 
 }
+
+func Test_ShutdownWithoutServerPanics(t *testing.T) {
+
+	s, err := site.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Server = nil
+
+	AssertPanicsWith(t, func() { s.Shutdown(context.Background()) },
+		"Shutdown called but Server is nil.",
+		"Shutdown without Server panics as expected")
+
+}
+
+func Test_Shutdown(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &FakeServer{}
+	s.Server = fs
+
+	assert.Nil(s.Shutdown(context.Background()), "no error")
+	assert.Equal(1, fs.Shutdowns, "Server shut down")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(context.Canceled, s.Shutdown(ctx), "context error returned")
+
+}
+
+func Test_Shutdown_RealServer(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(s.Shutdown(context.Background()), "no error")
+	assert.Equal(http.ErrServerClosed, s.Serve(), "Serve after Shutdown")
+
+}
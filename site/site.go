@@ -7,12 +7,15 @@ package site
 
 import (
 	// Standard library:
+	"context"
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	// Third-party packages:
@@ -41,18 +44,41 @@ var DEFAULT_PAGE_EXTENSIONS = []string{
 // in the loaded templates.  (Still have the minimalist default though.)
 var DEFAULT_TEMPLATE = assets.MustAssetString("demosite/templates/default.html")
 
+// The DEFAULT_ERROR_TEMPLATE is used for error pages unless the Site has its
+// own, and is loaded under the DEFAULT_ERROR_NAME; cf. Dot.ErrorTemplate.
+var DEFAULT_ERROR_TEMPLATE = assets.MustAssetString("demosite/templates/error.html")
+
+const DEFAULT_ERROR_NAME = "kisipar/error"
+
 var DEFAULT_READ_TIMEOUT = 10 * time.Second
 var DEFAULT_WRITE_TIMEOUT = 10 * time.Second
 var DEFAULT_MAX_HEADER_BYTES = 1 << 20
+var DEFAULT_SHUTDOWN_TIMEOUT = 10 * time.Second
+var DEFAULT_UNKNOWN_HOST_STATUS = http.StatusMisdirectedRequest
 
 var DEFAULT_FEED_PATH = "/feed.xml"
+var DEFAULT_JSON_FEED_PATH = "/feed.json"
+var DEFAULT_RSS_FEED_PATH = "/rss.xml"
+var DEFAULT_TAG_FEED_PATH = "/tags"
 var DEFAULT_FEED_ITEMS = 20
 
+var DEFAULT_SITEMAP_PATH = "/sitemap.xml"
+var DEFAULT_SEARCH_PATH = "/search"
+var DEFAULT_CALENDAR_PATH = "/calendar.ics"
+
+// ROBOTS_PATH is where robots look for robots.txt, so it is not configurable.
+var ROBOTS_PATH = "/robots.txt"
+
+var DEFAULT_WATCH_INTERVAL = time.Second
+
 // A SiteServer can be a custom implementation as long as it provides the
-// standard APIs for serving with and without Transport Layer Security.
+// standard APIs for serving with and without Transport Layer Security, and
+// for graceful shutdown.  After Shutdown, the ListenAndServe functions should
+// return http.ErrServerClosed, as per http.Server.
 type SiteServer interface {
 	ListenAndServe() error
 	ListenAndServeTLS(string, string) error
+	Shutdown(context.Context) error
 }
 
 // A Site represents a Kisipar web site ready for serving.
@@ -70,8 +96,44 @@ type Site struct {
 	// with these extensions are parsed as Pages.
 	PageExtensions []string
 
+	// MarkdownEngine is the name of the engine converting Markdown Pages to
+	// HTML: "blackfriday" (the default) or "commonmark".
+	MarkdownEngine string
+
+	// FrontMatter, if true, accepts front matter at the top of Markdown
+	// Pages as their meta, between "---" lines for YAML or "+++" lines for
+	// TOML.  It is off by default, as "---" is also a horizontal rule.
+	FrontMatter bool
+
+	// MarkdownProfiles are the named sets of Markdown settings for Pages
+	// with certain extensions or paths; cf. MarkdownProfile.
+	MarkdownProfiles []*MarkdownProfile
+
+	// Parsers is the Site's own parser Registry, for its PageExtensions and
+	// Markdown settings, used for all its Pages.
+	Parsers *page.Registry
+
+	// MetaSchemas describe the meta expected of the Pages under certain
+	// paths; cf. MetaSchema.
+	MetaSchemas []*MetaSchema
+
+	// Pages are served at the URL paths given by their file paths, unless
+	// their meta sets another: URL, a whole path such as "/about", or Slug,
+	// replacing the last part of the path, so that "/blog/a-post" with
+	// "Slug: better" is at "/blog/better".  Permalinks are patterns for the
+	// paths of the Pages under certain path prefixes, such as
+	// "/:year/:month/:slug", matched as for UnlistedPaths, the longest
+	// prefix winning; cf. PERMALINK_TOKENS.  A Page's Aliases are old paths
+	// redirecting to it.  No two Pages may share a path; cf. routes.go.
+	Permalinks map[string]string
+
+	// Redirects are the rules sending requests for certain paths elsewhere,
+	// from the config and the REDIRECTS_FILE; cf. Redirect.
+	Redirects []*Redirect
+
 	// UnlistedPaths are the path prefixes under which to automatically set
-	// Pages to Unlisted.
+	// Pages to Unlisted.  For whole directories, the same can be had with
+	// "Unlisted: true" in a CASCADE_FILE, which Pages may override.
 	UnlistedPaths []string
 
 	// ServePageSources determines whether the source files (e.g. "foo.md")
@@ -99,19 +161,99 @@ type Site struct {
 	// this is used to construct a standard BaseURL if none is specified.
 	Host string
 
+	// Aliases are any other host names under which the Site is served, e.g.
+	// "www.example.com".  Together with the Host they are used to route
+	// requests when several Sites share a Port.
+	Aliases []string
+
+	// If DefaultSite is true, the Site serves requests for unknown hosts on
+	// a shared Port.  Otherwise such requests are answered with the
+	// UnknownHostStatus, which may be 404 (Not Found) or 421 (Misdirected
+	// Request).  If zero, DEFAULT_UNKNOWN_HOST_STATUS applies.
+	DefaultSite       bool
+	UnknownHostStatus int
+
 	// The BaseURL is used for generating links to the site's pages.
 	BaseURL string
 
-	// FeedPath is the URL path to the site's Atom feed, if available.
+	// FeedPath is the URL path to the site's Atom feed, if available;
+	// JSONFeedPath and RSSFeedPath are the paths to the same feed in the
+	// JSON Feed and RSS 2.0 formats.  An empty path disables that format.
 	// FeedTitle is the Title to use in the Feed, if not the site's Name.
+	// FeedRights is the copyright statement for the Feed, if any.
 	// FeedItems specifies the maximum number of items to include in the
 	// feed.  To turn off this feature, set NoFeed to a true value.
 	// NOTE: the feed excludes unlisted pages; cf. UnlistedPaths.
-	// TODO: (maybe) support multiple feeds, e.g. "/foo/*" vs "/bar/*"
-	FeedPath  string
-	FeedTitle string
-	FeedItems int
-	NoFeed    bool
+	FeedPath     string
+	JSONFeedPath string
+	RSSFeedPath  string
+	FeedTitle    string
+	FeedRights   string
+	FeedItems    int
+	NoFeed       bool
+
+	// Once there are more listed Pages than FeedItems, the older Pages are
+	// kept in RFC 5005 archives of the main feed, "/feed-1.xml" being the
+	// oldest, linked from the feed.  Each archive holds FeedArchiveItems,
+	// which may not be more than FeedItems, the default.  To turn off
+	// this feature, set NoFeedArchives to a true value.
+	FeedArchiveItems int
+	NoFeedArchives   bool
+
+	// Each directory section and each tag also has its own feed, in each
+	// format, under the same file names as the main feed: for instance
+	// "/blog/feed.xml" for the Pages under "/blog", and "/tags/go/feed.xml"
+	// under the TagFeedPath for the Pages tagged "go".  These are titled
+	// by FeedTitles, keyed by the section or tag path, or else the
+	// FeedTitle and the section index title or the tag.  To turn off either
+	// family, set NoSectionFeeds or NoTagFeeds to a true value.
+	TagFeedPath    string
+	FeedTitles     map[string]string
+	NoSectionFeeds bool
+	NoTagFeeds     bool
+
+	// Pages with Audio or Video in their meta are podcast episodes in the
+	// feeds, and the RSS feeds then describe the podcast with the Owner,
+	// the artwork at PodcastImage, the PodcastCategories (such as
+	// "Technology" or "Society & Culture/Documentary"), PodcastExplicit,
+	// the PodcastType ("episodic" or "serial"), the owner's PodcastEmail,
+	// the PodcastGUID and PodcastLocked.
+	PodcastImage      string
+	PodcastCategories []string
+	PodcastExplicit   bool
+	PodcastType       string
+	PodcastEmail      string
+	PodcastGUID       string
+	PodcastLocked     bool
+
+	// SitemapPath is the URL path to the site's sitemap, which lists all
+	// Pages not Unlisted.  If there are more than SITEMAP_MAX_URLS, it is
+	// a sitemap index, and the parts are numbered: "/sitemap-1.xml" etc.
+	// To turn off this feature, set NoSitemap to a true value.
+	SitemapPath string
+	NoSitemap   bool
+
+	// Unless NoRobots is true, a robots.txt is served at ROBOTS_PATH which
+	// disallows the path prefixes in RobotsDisallow, and nothing else, and
+	// points to the sitemap.
+	RobotsDisallow []string
+	NoRobots       bool
+
+	// SearchPath is the URL path of the site's search, which takes its
+	// query from the "q" parameter and renders the "search" template, or
+	// JSON if there is no such template or it is requested; cf. Dot.Query.
+	// It gives way to any Page at the same path, and is not exported, being
+	// dynamic.  To turn off this feature, set NoSearch to a true value.
+	SearchPath string
+	NoSearch   bool
+
+	// CalendarPath is the URL path of the site's iCalendar file, listing
+	// all the events in the Pageset, if it has any; cf. Pageset.Events.  Each event Page
+	// also has its own at its path plus CALENDAR_EXT, cf. EventCalendarURL.
+	// An empty CalendarPath disables only the site calendar; to turn off
+	// this feature entirely, set NoCalendar to a true value.
+	CalendarPath string
+	NoCalendar   bool
 
 	// The Port determines where the server will listen, and ServeTLS dictates
 	// whether we listen on HTTP or HTTPS.
@@ -128,6 +270,24 @@ type Site struct {
 	WriteTimeout   time.Duration // Config is in seconds.
 	MaxHeaderBytes int
 
+	// ShutdownTimeout is the longest we should wait for open connections to
+	// drain when shutting down gracefully.
+	ShutdownTimeout time.Duration // Config is in seconds.
+
+	// If Watch is true, a Watcher is started when the Site is served, which
+	// polls the Site's files every WatchInterval and updates the Pageset
+	// and Template accordingly.  While a Watcher is running, Pages are not
+	// checked on disk for every request.
+	Watch         bool
+	WatchInterval time.Duration // Config is in seconds.
+
+	// DevMode enables features useful only in development: error details
+	// are shown on error pages, and every HTML page gets a script that
+	// reloads it when the Watcher sees a change, or shows the error in an
+	// overlay.  It should never be set in production, as it exposes internal
+	// information.  Cf. DEV_SCRIPT and DEV_EVENTS_PATH.
+	DevMode bool
+
 	// The Config is used to set the properties above.
 	Config *config.Config
 
@@ -139,8 +299,45 @@ type Site struct {
 	Pageset *pageset.Pageset
 
 	// The Template containing all the shared templates as well as all the
-	// specific page templates.
+	// specific page templates.  As it may be replaced while serving, use
+	// CurrentTemplate to access it in concurrent code.
 	Template *template.Template
+
+	// The Watcher, if running, keeps the Pageset and Template up to date;
+	// cf. Watch.
+	Watcher *Watcher
+
+	// Browsers listening for changes in DevMode.
+	devHub *devHub
+
+	// The reload, if set by a LiveSite, applies config changes found by the
+	// Watcher; cf. configChanged.
+	reload func() error
+
+	// The Markdown parser for the MarkdownEngine or default MarkdownProfile,
+	// if not the common one.
+	mdParser *page.MdParser
+
+	// The meta cascading down from directories, by directory path, from
+	// CASCADE_FILEs and index Pages; cf. cascade.go.
+	metaFiles     map[string]map[string]interface{}
+	indexCascades map[string]map[string]interface{}
+	cascadeMutex  sync.RWMutex
+
+	// The Pageset keys of the Pages with custom routes and aliases, by URL
+	// path; cf. routes.go.
+	routes     map[string]string
+	aliases    map[string]string
+	routeMutex sync.RWMutex
+
+	// The Redirects matching paths exactly, by path; the mutex guards them
+	// and the Redirects, as the Watcher may change them.
+	exactRedirects map[string]*Redirect
+	redirectMutex  sync.RWMutex
+
+	// The mutex guards the Template, Watcher, devHub and reload while
+	// serving.
+	mutex sync.RWMutex
 }
 
 // New initializes a Site at the given directory path.  A config file in YAML
@@ -152,18 +349,55 @@ type Site struct {
 //   Name           # Name of the site; default: Anonymous Kisipar Site
 //   Owner          # Owner of the site; default: Anonymous Kisipar Fan
 //   Host           # Host from which we're serving; default: localhost
+//   Aliases        # other host names for the site, e.g. www.example.com
+//   DefaultSite    # boolean switch to serve unknown hosts on its port
+//   UnknownHostStatus # 404 or 421 for unknown hosts; default: 421
 //   Port           # Port on which to serve; default: 8020
 //   BaseURL        # BaseURL for all site URLs; default: derived.
 //   CertFile       # TLS only: path to the cert file
 //   KeyFile        # TLS only: path to the key file
 //   PagePath       # relative path for pages; default: pages
 //   UnlistedPaths  # path (prefixes) for unlisted pages
+//   MetaSchema     # map of path prefixes to meta schemas; cf. MetaSchema
+//   Permalinks     # map of path prefixes to URL patterns, e.g. /:year/:slug
+//   Redirects      # list of redirect and rewrite rules; cf. Redirect
+//   MarkdownEngine # Markdown engine: blackfriday (default) or commonmark
+//   FrontMatter    # boolean switch to accept front matter in Markdown
+//   MarkdownProfiles # map of named Markdown settings; cf. MarkdownProfile
 //   TemplatePath   # relative path for templates; default: templates
 //   StaticPath     # relative path for static content; default: static
 //   FeedPath       # URL path for Atom feed; standard default: /feed.xml
-//   FeedTitle      # Title for the Atom feed, if not the site Name
-//   FeedItems      # Number of items in the Atom feed; standard default: 20
-//   NoFeed         # boolean switch to disable the Atom feed
+//   JSONFeedPath   # URL path for JSON Feed; default: /feed.json
+//   RSSFeedPath    # URL path for RSS feed; default: /rss.xml
+//   FeedTitle      # Title for the feeds, if not the site Name
+//   FeedRights     # copyright statement for the Atom feeds, if any
+//   FeedItems      # Number of items in the feeds; default: 20
+//   NoFeed         # boolean switch to disable all feeds
+//   FeedArchiveItems # Number of items per feed archive; default: FeedItems
+//   NoFeedArchives # boolean switch to disable feed archives
+//   TagFeedPath    # URL path for tag feeds; default: /tags
+//   FeedTitles     # map of section or tag paths to feed titles
+//   NoSectionFeeds # boolean switch to disable section feeds
+//   NoTagFeeds     # boolean switch to disable tag feeds
+//   PodcastImage   # URL or path of the podcast artwork
+//   PodcastCategories # podcast categories, e.g. "Arts/Books"
+//   PodcastExplicit # boolean switch to mark the podcast explicit
+//   PodcastType    # podcast type: episodic or serial
+//   PodcastEmail   # email of the podcast owner
+//   PodcastGUID    # Podcasting 2.0 GUID of the podcast
+//   PodcastLocked  # boolean switch to lock the podcast against import
+//   SitemapPath    # URL path for the sitemap; default: /sitemap.xml
+//   NoSitemap      # boolean switch to disable the sitemap
+//   RobotsDisallow # path prefixes disallowed in robots.txt
+//   NoRobots       # boolean switch to disable robots.txt
+//   SearchPath     # URL path for site search; default: /search
+//   NoSearch       # boolean switch to disable site search
+//   CalendarPath   # URL path for the event calendar; default: /calendar.ics
+//   NoCalendar     # boolean switch to disable event calendars
+//   ShutdownTimeout # seconds to drain connections on shutdown; default: 10
+//   Watch          # boolean switch to watch files for changes when serving
+//   WatchInterval  # seconds between checks for changes; default: 1
+//   DevMode        # boolean switch to show error details; NOT FOR PROD
 //
 // Sensible, but not necessarily perfect, defaults are calculated as needed;
 // most can be overridden via the package variables.
@@ -257,7 +491,30 @@ func (s *Site) setup() error {
 		pExt = DEFAULT_PAGE_EXTENSIONS
 	}
 	s.PageExtensions = pExt
-	page.LimitExtParsers(pExt)
+
+	// How is the Markdown rendered?  (cf. markdown.go)
+	if err := s.setupMarkdown(); err != nil {
+		return err
+	}
+
+	// Pages get default meta from their directories; cf. cascade.go.
+	s.Parsers.Cascade = s.cascadeFor
+	s.resetCascades(nil)
+
+	// What meta do we expect?  (cf. schema.go)
+	if err := s.setupMetaSchemas(); err != nil {
+		return err
+	}
+
+	// Where are the Pages served?  (cf. routes.go)
+	if err := s.setupPermalinks(); err != nil {
+		return err
+	}
+
+	// And where else?  (cf. redirects.go)
+	if err := s.setupRedirects(); err != nil {
+		return err
+	}
 
 	// Is anything Unlisted based on its path?
 	s.UnlistedPaths, err = s.configStringList("UnlistedPaths")
@@ -273,6 +530,14 @@ func (s *Site) setup() error {
 	s.ReadTimeout = s.cfgDuration("ReadTimeout", DEFAULT_READ_TIMEOUT)
 	s.WriteTimeout = s.cfgDuration("WriteTimeout", DEFAULT_WRITE_TIMEOUT)
 	s.MaxHeaderBytes = s.Config.UInt("MaxHeaderBytes", DEFAULT_MAX_HEADER_BYTES)
+	s.ShutdownTimeout = s.cfgDuration("ShutdownTimeout", DEFAULT_SHUTDOWN_TIMEOUT)
+
+	// Shall we watch for changes?
+	s.Watch = s.Config.UBool("Watch", false)
+	s.WatchInterval = s.cfgDuration("WatchInterval", DEFAULT_WATCH_INTERVAL)
+
+	// Are we developing?
+	s.DevMode = s.Config.UBool("DevMode", false)
 
 	// Are we secure?
 	s.ServeTLS = false
@@ -285,6 +550,19 @@ func (s *Site) setup() error {
 	// Properties used in templates and other magic:
 	s.Name = s.Config.UString("Name", DEFAULT_NAME)
 	s.Host = s.Config.UString("Host", "localhost")
+	s.Aliases, err = s.configStringList("Aliases")
+	if err != nil {
+		return err
+	}
+	s.DefaultSite = s.Config.UBool("DefaultSite", false)
+	s.UnknownHostStatus = s.Config.UInt("UnknownHostStatus", 0)
+	switch s.UnknownHostStatus {
+	case 0, http.StatusNotFound, http.StatusMisdirectedRequest:
+	default:
+		return fmt.Errorf("UnknownHostStatus must be %d or %d, not %d.",
+			http.StatusNotFound, http.StatusMisdirectedRequest,
+			s.UnknownHostStatus)
+	}
 	s.Owner = s.Config.UString("Owner", DEFAULT_OWNER)
 	s.Email = s.Config.UString("Email", "")
 	baseurl := s.Config.UString("BaseURL", "")
@@ -305,8 +583,53 @@ func (s *Site) setup() error {
 	s.NoFeed = s.Config.UBool("NoFeed", false)
 	if !s.NoFeed {
 		s.FeedPath = s.Config.UString("FeedPath", DEFAULT_FEED_PATH)
+		s.JSONFeedPath = s.Config.UString("JSONFeedPath", DEFAULT_JSON_FEED_PATH)
+		s.RSSFeedPath = s.Config.UString("RSSFeedPath", DEFAULT_RSS_FEED_PATH)
 		s.FeedTitle = s.Config.UString("FeedTitle", s.Name)
+		s.FeedRights = s.Config.UString("FeedRights", "")
 		s.FeedItems = s.Config.UInt("FeedItems", DEFAULT_FEED_ITEMS)
+		s.FeedArchiveItems = s.Config.UInt("FeedArchiveItems", 0)
+		s.NoFeedArchives = s.Config.UBool("NoFeedArchives", false)
+		s.TagFeedPath = s.Config.UString("TagFeedPath", DEFAULT_TAG_FEED_PATH)
+		s.NoSectionFeeds = s.Config.UBool("NoSectionFeeds", false)
+		s.NoTagFeeds = s.Config.UBool("NoTagFeeds", false)
+		s.FeedTitles, err = s.configStringMap("FeedTitles")
+		if err != nil {
+			return err
+		}
+		s.PodcastImage = s.Config.UString("PodcastImage", "")
+		s.PodcastCategories, err = s.configStringList("PodcastCategories")
+		if err != nil {
+			return err
+		}
+		s.PodcastExplicit = s.Config.UBool("PodcastExplicit", false)
+		s.PodcastType = s.Config.UString("PodcastType", "")
+		s.PodcastEmail = s.Config.UString("PodcastEmail", "")
+		s.PodcastGUID = s.Config.UString("PodcastGUID", "")
+		s.PodcastLocked = s.Config.UBool("PodcastLocked", false)
+	}
+
+	// And a sitemap, and robots.txt?
+	s.NoSitemap = s.Config.UBool("NoSitemap", false)
+	if !s.NoSitemap {
+		s.SitemapPath = s.Config.UString("SitemapPath", DEFAULT_SITEMAP_PATH)
+	}
+	s.NoRobots = s.Config.UBool("NoRobots", false)
+	s.RobotsDisallow, err = s.configStringList("RobotsDisallow")
+	if err != nil {
+		return err
+	}
+
+	// Shall we search?
+	s.NoSearch = s.Config.UBool("NoSearch", false)
+	if !s.NoSearch {
+		s.SearchPath = s.Config.UString("SearchPath", DEFAULT_SEARCH_PATH)
+	}
+
+	// And the events calendar?
+	s.NoCalendar = s.Config.UBool("NoCalendar", false)
+	if !s.NoCalendar {
+		s.CalendarPath = s.Config.UString("CalendarPath", DEFAULT_CALENDAR_PATH)
 	}
 
 	// The Server needs a sane default of course; in very custom situations,
@@ -370,6 +693,71 @@ func (s *Site) configStringList(key string) ([]string, error) {
 	return list, nil
 }
 
+// configStringMap returns a map of strings from the config key, or an error
+// if the key holds a non-map or there are non-string values.
+func (s *Site) configStringMap(key string) (map[string]string, error) {
+
+	if s.Config.Root == nil {
+		return map[string]string{}, nil
+	}
+
+	v, err := s.Config.Map(key)
+	if err != nil {
+		if isConfigTypeError(err) {
+			return nil, fmt.Errorf("Config %s is not a map.", key)
+		} else {
+			return map[string]string{}, nil
+		}
+	}
+
+	m := make(map[string]string, len(v))
+	for k, val := range v {
+		if str, ok := val.(string); ok {
+			m[k] = str
+		} else {
+			return nil, fmt.Errorf(
+				"Config %s must be a map of strings; %s is %T.",
+				key, k, val)
+		}
+	}
+
+	return m, nil
+}
+
+// CurrentTemplate returns the Site's Template.  Unlike reading the Template
+// property directly, it is safe to use while a Watcher may be replacing it.
+func (s *Site) CurrentTemplate() *template.Template {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.Template
+}
+
+func (s *Site) setTemplate(tmpl *template.Template) {
+	s.mutex.Lock()
+	s.Template = tmpl
+	s.mutex.Unlock()
+}
+
+// HasHost returns true if the host name, as found in a request's Host header,
+// matches the Site's Host or one of its Aliases.  Any port in the host is
+// ignored, and matching is case-insensitive.
+func (s *Site) HasHost(host string) bool {
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+	if strings.EqualFold(host, s.Host) {
+		return true
+	}
+	for _, alias := range s.Aliases {
+		if strings.EqualFold(host, alias) {
+			return true
+		}
+	}
+	return false
+}
+
 // URL returns a full URL for the given path, based on the Site's BaseURL.
 func (s *Site) URL(path string) string {
 
@@ -378,12 +766,22 @@ func (s *Site) URL(path string) string {
 
 }
 
-// Href returns the URL path (realtive URL) for a Page.
+// Href returns the URL path (realtive URL) for a Page: its custom route,
+// if it has one, or else the path given by its file path; cf. Permalinks.
 func (s *Site) Href(p *page.Page) string {
 
 	if p == nil {
 		return ""
 	}
+	if route, err := s.customRoute(p); err == nil && route != "" {
+		return route
+	}
+	return s.fileHref(p)
+
+}
+
+// fileHref returns the URL path for a Page given by its file path.
+func (s *Site) fileHref(p *page.Page) string {
 
 	rpath := strings.TrimPrefix(p.Path, s.PagePath)
 	if p.IsIndex {
@@ -402,14 +800,16 @@ func (s *Site) PageURL(p *page.Page) string {
 		return ""
 	}
 
-	rpath := strings.TrimPrefix(p.Path, s.PagePath)
-	if p.IsIndex {
-		rpath = filepath.Dir(rpath)
-	} else {
-		rpath = strings.TrimSuffix(rpath, filepath.Ext(rpath))
-	}
+	rpath := s.Href(p)
 	return strings.TrimSuffix(s.BaseURL, "/") +
 		"/" +
 		strings.TrimPrefix(rpath, "/")
 
 }
+
+// fileURL returns the full URL for a Page given by its file path, ignoring
+// any custom route.
+func (s *Site) fileURL(p *page.Page) string {
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" +
+		strings.TrimPrefix(s.fileHref(p), "/")
+}
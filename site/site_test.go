@@ -285,6 +285,168 @@ PageExtensions: [foo,1,3.4,x]
 	}
 }
 
+func Test_New_YamlConfig_VirtualHost(t *testing.T) {
+
+	assert := assert.New(t)
+
+	outer, derr := ioutil.TempDir("", "kisipar-site-test-")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	defer os.RemoveAll(outer)
+	cpath := filepath.Join(outer, "config.yaml")
+	cdata := []byte(`# test config
+Name: test
+Host: foo.com
+Aliases: [www.foo.com, foo.net]
+DefaultSite: true
+UnknownHostStatus: 404
+`)
+	if err := ioutil.WriteFile(cpath, cdata, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	s, err := site.New(outer)
+	assert.Nil(err, "no error returned")
+	if assert.NotNil(s, "site returned") {
+		assert.Equal([]string{"www.foo.com", "foo.net"}, s.Aliases,
+			"aliases stick")
+		assert.True(s.DefaultSite, "default site sticks")
+		assert.Equal(404, s.UnknownHostStatus, "status sticks")
+	}
+}
+
+func Test_New_BadUnknownHostStatus(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, derr := ioutil.TempDir("", "kisipar-site-test-")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	defer os.RemoveAll(dir)
+	cpath := filepath.Join(dir, "config.yaml")
+	cdata := []byte("UnknownHostStatus: 500")
+	if err := ioutil.WriteFile(cpath, cdata, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	_, err := site.New(dir)
+	if assert.Error(err, "error returned") {
+		assert.Equal("UnknownHostStatus must be 404 or 421, not 500.",
+			err.Error(), "error useful")
+	}
+}
+
+func Test_New_BadMarkdownEngine(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, derr := ioutil.TempDir("", "kisipar-site-test-")
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	defer os.RemoveAll(dir)
+	cpath := filepath.Join(dir, "config.yaml")
+	cdata := []byte("MarkdownEngine: nonesuch")
+	if err := ioutil.WriteFile(cpath, cdata, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	_, err := site.New(dir)
+	if assert.Error(err, "error returned") {
+		assert.Equal(`Unknown Markdown engine "nonesuch"; `+
+			"known engines: blackfriday, commonmark.",
+			err.Error(), "error useful")
+	}
+}
+
+func Test_MarkdownEngine(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	pdir := filepath.Join(dir, "pages")
+	assert.Equal("blackfriday", s.MarkdownEngine, "default engine")
+	if p := s.Pageset.Page(filepath.Join(pdir, "foo")); assert.NotNil(p) {
+		assert.Equal("<h1>Foo</h1>\n", string(p.Content),
+			"rendered by blackfriday")
+	}
+
+	writeFile(t, filepath.Join(dir, "config.yaml"), "MarkdownEngine: CommonMark")
+	writeFile(t, filepath.Join(pdir, "foo.md"), "# Foo\n\n    Tags: [a]\n\nBar")
+	writeFile(t, filepath.Join(pdir, "plain.txt"), "# Plain\n\nText")
+	s, err := site.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal("CommonMark", s.MarkdownEngine, "engine from config")
+	if p := s.Pageset.Page(filepath.Join(pdir, "foo")); assert.NotNil(p) {
+		assert.Equal("<h1>Foo</h1>\n\n<p>Bar</p>\n", string(p.Content),
+			"rendered by commonmark")
+		assert.Equal([]string{"a"}, p.Tags(), "meta found")
+	}
+	if p := s.Pageset.Page(filepath.Join(pdir, "plain")); assert.NotNil(p) {
+		assert.Equal("<h1>Plain</h1>\n\n<p>Text</p>\n", string(p.Content),
+			"other Markdown extensions rendered by commonmark")
+	}
+
+	// Reloaded and new pages keep the engine.
+	writeFile(t, filepath.Join(pdir, "foo.md"), "# Foo\n\nBaz")
+	writeFile(t, filepath.Join(pdir, "new.md"), "# New\n\nPage")
+	for _, key := range []string{"foo", "new"} {
+		if err := s.Pageset.RefreshPage(filepath.Join(pdir, key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p := s.Pageset.Page(filepath.Join(pdir, "foo")); assert.NotNil(p) {
+		assert.Equal("<h1>Foo</h1>\n\n<p>Baz</p>\n", string(p.Content),
+			"refreshed page rendered by commonmark")
+	}
+	if p := s.Pageset.Page(filepath.Join(pdir, "new")); assert.NotNil(p) {
+		assert.Equal("<h1>New</h1>\n\n<p>Page</p>\n", string(p.Content),
+			"new page rendered by commonmark")
+	}
+
+}
+
+func Test_MarkdownEngine_Virtual(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(`# VIRTUAL COMMONMARK
+MarkdownEngine: commonmark
+Pages:
+    foo.md: "# Foo\n\nBar"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := s.Pageset.Page("foo"); assert.NotNil(p) {
+		assert.Equal("<h1>Foo</h1>\n\n<p>Bar</p>\n", string(p.Content),
+			"virtual page rendered by commonmark")
+	}
+
+}
+
+func Test_HasHost(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Host = "foo.com"
+	s.Aliases = []string{"www.foo.com"}
+
+	assert.True(s.HasHost("foo.com"), "Host matches")
+	assert.True(s.HasHost("FOO.com:8080"), "port and case ignored")
+	assert.True(s.HasHost("foo.com."), "trailing dot ignored")
+	assert.True(s.HasHost("www.foo.com"), "alias matches")
+	assert.False(s.HasHost("bar.foo.com"), "other host does not match")
+	assert.False(s.HasHost(""), "empty host does not match")
+
+}
+
 func Test_URL(t *testing.T) {
 
 	assert := assert.New(t)
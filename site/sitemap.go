@@ -0,0 +1,182 @@
+// sitemap.go - sitemap and robots.txt generation for the Kisipar site.
+// ----------
+// USEFUL: https://www.sitemaps.org/protocol.html
+
+package site
+
+import (
+	// Standard library:
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SITEMAP_MAX_URLS is the most URLs allowed in a single sitemap by the
+// protocol.  Sites with more get a sitemap index; cf. SitemapPath.
+var SITEMAP_MAX_URLS = 50000
+
+// SITEMAP_CHANGE_FREQS are the valid values of a Page's ChangeFreq meta.
+var SITEMAP_CHANGE_FREQS = []string{
+	"always",
+	"hourly",
+	"daily",
+	"weekly",
+	"monthly",
+	"yearly",
+	"never",
+}
+
+// A Sitemap is a sitemap document listing up to SITEMAP_MAX_URLS URLs.
+type Sitemap struct {
+	XMLName xml.Name      `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URL     []*SitemapURL `xml:"url"`
+}
+
+// A SitemapURL is a single URL in a Sitemap.  LastMod is in W3C Datetime
+// format; empty fields are omitted.
+type SitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+// A SitemapIndex lists the parts of a Sitemap too large for one document.
+type SitemapIndex struct {
+	XMLName xml.Name      `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemap []*SitemapURL `xml:"sitemap"`
+}
+
+// SitemapURLs returns the URLs of all Pages in the Site's Pageset not marked
+// Unlisted, in Path order.  The LastMod is the Page's Time, and ChangeFreq
+// and Priority are taken from the Page's meta of the same names if valid.
+// The home page is always included, even if it is a generated index.
+func (s *Site) SitemapURLs() []*SitemapURL {
+
+	urls := []*SitemapURL{}
+	home := s.URL("/")
+	haveHome := false
+	for _, p := range s.Pageset.ByPath() {
+		u := &SitemapURL{Loc: s.PageURL(p)}
+		if ts := p.Time(); ts != nil {
+			u.LastMod = ts.Format(time.RFC3339)
+		}
+		freq := strings.ToLower(p.MetaString("ChangeFreq"))
+		for _, f := range SITEMAP_CHANGE_FREQS {
+			if freq == f {
+				u.ChangeFreq = freq
+				break
+			}
+		}
+		pri := p.MetaString("Priority")
+		if f, err := strconv.ParseFloat(pri, 64); err == nil && f >= 0 && f <= 1 {
+			u.Priority = pri
+		}
+		if u.Loc == home {
+			haveHome = true
+		}
+		urls = append(urls, u)
+	}
+
+	// An Unlisted home page stays out of it, but a generated one is in.
+	if !haveHome {
+		if _, err := s.PageForPath("/"); os.IsNotExist(err) {
+			urls = append([]*SitemapURL{{Loc: home}}, urls...)
+		}
+	}
+	return urls
+
+}
+
+// sitemapPartPath returns the request path of part n of the sitemap: e.g.
+// "/sitemap-1.xml" for the standard SitemapPath.
+func (s *Site) sitemapPartPath(n int) string {
+	ext := path.Ext(s.SitemapPath)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(s.SitemapPath, ext), n, ext)
+}
+
+// isSitemapPath returns true if rpath could be the sitemap or one of its
+// parts, without generating anything.
+func (s *Site) isSitemapPath(rpath string) bool {
+	if s.NoSitemap {
+		return false
+	}
+	if rpath == s.SitemapPath {
+		return true
+	}
+	ext := path.Ext(s.SitemapPath)
+	prefix := strings.TrimSuffix(s.SitemapPath, ext) + "-"
+	return strings.HasPrefix(rpath, prefix) && strings.HasSuffix(rpath, ext)
+}
+
+// sitemapDocs returns the XML of the sitemap documents, keyed by request
+// path.  Normally there is only the SitemapPath, but if there are more than
+// SITEMAP_MAX_URLS then it holds a SitemapIndex, and the URLs are split
+// among the parts.
+func (s *Site) sitemapDocs() (map[string][]byte, error) {
+
+	docs := map[string][]byte{}
+	urls := s.SitemapURLs()
+	if len(urls) <= SITEMAP_MAX_URLS {
+		data, err := xml.MarshalIndent(&Sitemap{URL: urls}, "", "    ")
+		if err != nil {
+			return nil, err
+		}
+		docs[s.SitemapPath] = append([]byte(xml.Header), data...)
+		return docs, nil
+	}
+
+	index := &SitemapIndex{}
+	for n := 1; len(urls) > 0; n++ {
+		part := urls
+		if len(part) > SITEMAP_MAX_URLS {
+			part = part[:SITEMAP_MAX_URLS]
+		}
+		urls = urls[len(part):]
+
+		ref := &SitemapURL{Loc: s.URL(s.sitemapPartPath(n))}
+		var newest time.Time
+		for _, u := range part {
+			if ts, err := time.Parse(time.RFC3339, u.LastMod); err == nil && ts.After(newest) {
+				newest = ts
+				ref.LastMod = u.LastMod
+			}
+		}
+		index.Sitemap = append(index.Sitemap, ref)
+
+		data, err := xml.MarshalIndent(&Sitemap{URL: part}, "", "    ")
+		if err != nil {
+			return nil, err
+		}
+		docs[s.sitemapPartPath(n)] = append([]byte(xml.Header), data...)
+	}
+	data, err := xml.MarshalIndent(index, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	docs[s.SitemapPath] = append([]byte(xml.Header), data...)
+	return docs, nil
+
+}
+
+// robotsTXT returns the Site's robots.txt, which allows everything except
+// the RobotsDisallow prefixes, and points to the sitemap if there is one.
+func (s *Site) robotsTXT() []byte {
+
+	lines := []string{"User-agent: *"}
+	for _, prefix := range s.RobotsDisallow {
+		lines = append(lines, "Disallow: "+prefix)
+	}
+	if len(s.RobotsDisallow) == 0 {
+		lines = append(lines, "Disallow:")
+	}
+	if !s.NoSitemap {
+		lines = append(lines, "", "Sitemap: "+s.URL(s.SitemapPath))
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+
+}
@@ -0,0 +1,245 @@
+// sitemap_test.go - tests for the Kisipar sitemap and robots.txt.
+// ---------------
+
+package site_test
+
+import (
+	// Standard:
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	// Third-party:
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/site"
+)
+
+var sitemapYaml = `# SITEMAP TEST
+Name: Sitemap Test
+UnlistedPaths: ["hidden/"]
+Pages:
+    a.md: |
+        # Alpha
+
+            ChangeFreq: Weekly
+            Priority: 0.8
+    b.md: |
+        # Beta
+
+            ChangeFreq: sometimes
+            Priority: 2
+    c.md: |
+        # Gamma
+
+            Unlisted: true
+    hidden/d.md: "# Delta"
+`
+
+func Test_SitemapURLs(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(sitemapYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastmod := s.Pageset.Page("a").Time().Format(time.RFC3339)
+	assert.Equal([]*site.SitemapURL{
+		{Loc: "http://localhost:8020/"},
+		{
+			Loc:        "http://localhost:8020/a",
+			LastMod:    lastmod,
+			ChangeFreq: "weekly",
+			Priority:   "0.8",
+		},
+		{Loc: "http://localhost:8020/b", LastMod: lastmod},
+	}, s.SitemapURLs(), "listed pages and home in sitemap")
+
+}
+
+func Test_SitemapURLs_HomePage(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(`# HOME TEST
+Pages:
+    /index.md: "# Home"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := s.SitemapURLs()
+	if assert.Equal(1, len(urls), "home page listed once") {
+		assert.Equal("http://localhost:8020/", urls[0].Loc, "home URL")
+		assert.NotEmpty(urls[0].LastMod, "home page has lastmod")
+	}
+
+	s, err = site.LoadVirtualYaml(`# HOME TEST
+Pages:
+    /index.md: |
+        # Home
+
+            Unlisted: true
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(s.SitemapURLs(), "unlisted home page not listed")
+
+}
+
+func Test_MainHandler_Sitemap(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(sitemapYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, rec := ReqAndRec(t, "http://example.com/sitemap.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "sitemap served")
+	assert.Equal("application/xml; charset=utf-8",
+		rec.Header().Get("Content-Type"), "content type set")
+	body := rec.Body.String()
+	assert.Regexp(`^<\?xml version="1.0" encoding="UTF-8"\?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+    <url>
+        <loc>http://localhost:8020/</loc>
+    </url>
+    <url>
+        <loc>http://localhost:8020/a</loc>
+        <lastmod>[^<]+</lastmod>
+        <changefreq>weekly</changefreq>
+        <priority>0.8</priority>
+    </url>`, body, "sitemap as expected")
+	assert.NotContains(body, "/c<", "unlisted page excluded")
+	assert.NotContains(body, "hidden", "unlisted path excluded")
+
+	req, rec = ReqAndRec(t, "http://example.com/sitemap-1.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "no parts for small sitemap")
+
+	s.NoSitemap = true
+	req, rec = ReqAndRec(t, "http://example.com/sitemap.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "sitemap not served with NoSitemap")
+
+}
+
+func Test_MainHandler_SitemapNoPageset(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml("Name: Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Pageset = nil
+
+	req, rec := ReqAndRec(t, "http://example.com/sitemap.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "no sitemap without Pageset")
+
+}
+
+func Test_MainHandler_SitemapIndex(t *testing.T) {
+
+	assert := assert.New(t)
+
+	defer func(max int) { site.SITEMAP_MAX_URLS = max }(site.SITEMAP_MAX_URLS)
+	site.SITEMAP_MAX_URLS = 2
+
+	s, err := site.LoadVirtualYaml(`# SITEMAP INDEX TEST
+SitemapPath: /maps/site.xml
+Pages:
+    a.md: "# A"
+    b.md: "# B"
+    c.md: "# C"
+    d.md: "# D"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, rec := ReqAndRec(t, "http://example.com/maps/site.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "sitemap index served")
+	body := rec.Body.String()
+	assert.Contains(body, `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`,
+		"sitemap index")
+	for _, part := range []string{"1", "2", "3"} {
+		assert.Contains(body, "<loc>http://localhost:8020/maps/site-"+part+
+			".xml</loc>", "part %s listed", part)
+	}
+	assert.Equal(3, strings.Count(body, "<lastmod>"), "parts have lastmod")
+
+	req, rec = ReqAndRec(t, "http://example.com/maps/site-3.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "last part served")
+	assert.Equal(1, strings.Count(rec.Body.String(), "<url>"),
+		"last part has the rest")
+
+	req, rec = ReqAndRec(t, "http://example.com/maps/site-4.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "no such part")
+
+}
+
+func Test_MainHandler_Robots(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(`# ROBOTS TEST
+RobotsDisallow: ["/private/", "/tmp"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, rec := ReqAndRec(t, "http://example.com/robots.txt")
+	s.ServeHTTP(rec, req)
+	assert.Equal(200, rec.Code, "robots.txt served")
+	assert.Equal("text/plain; charset=utf-8",
+		rec.Header().Get("Content-Type"), "content type set")
+	assert.Equal(`User-agent: *
+Disallow: /private/
+Disallow: /tmp
+
+Sitemap: http://localhost:8020/sitemap.xml
+`, rec.Body.String(), "robots.txt as expected")
+
+	s.RobotsDisallow = nil
+	s.NoSitemap = true
+	req, rec = ReqAndRec(t, "http://example.com/robots.txt")
+	s.ServeHTTP(rec, req)
+	assert.Equal("User-agent: *\nDisallow:\n", rec.Body.String(),
+		"everything allowed, no sitemap")
+
+	s.NoRobots = true
+	req, rec = ReqAndRec(t, "http://example.com/robots.txt")
+	s.ServeHTTP(rec, req)
+	assert.Equal(404, rec.Code, "robots.txt not served with NoRobots")
+
+}
+
+func Test_MainHandler_RobotsStaticOverride(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "static", "robots.txt"), "STATIC ROBOTS")
+	writeFile(t, filepath.Join(dir, "static", "sitemap.xml"), "STATIC MAP")
+
+	req, rec := ReqAndRec(t, "http://example.com/robots.txt")
+	s.ServeHTTP(rec, req)
+	assert.Equal("STATIC ROBOTS", rec.Body.String(), "static robots.txt wins")
+
+	req, rec = ReqAndRec(t, "http://example.com/sitemap.xml")
+	s.ServeHTTP(rec, req)
+	assert.Equal("STATIC MAP", rec.Body.String(), "static sitemap wins")
+
+}
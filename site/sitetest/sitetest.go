@@ -0,0 +1,41 @@
+// Package sitetest provides helpers for testing Kisipar sites, e.g. their
+// redirect rules, from Go tests in any package.
+package sitetest
+
+import (
+	// Standard:
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/site"
+)
+
+// AssertRedirect asserts that the Site's MainHandler answers a request for
+// the URL with the status and, unless it is 410 (Gone), the Location.  Any
+// mismatch is reported as a test error, and true is returned if both match.
+func AssertRedirect(t testing.TB, s *site.Site, url string, status int, location string) bool {
+
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	s.MainHandler()(w, req)
+	ok := true
+	if w.Code != status {
+		t.Errorf("status for %s: expected %d, got %d", url, status, w.Code)
+		ok = false
+	}
+	if status != http.StatusGone {
+		if got := w.Header().Get("Location"); got != location {
+			t.Errorf("location for %s: expected %q, got %q",
+				url, location, got)
+			ok = false
+		}
+	}
+	return ok
+
+}
@@ -0,0 +1,59 @@
+// sitetest_test.go - tests for the Kisipar site test helpers.
+// ----------------
+
+package sitetest_test
+
+import (
+	// Standard:
+	"fmt"
+	"testing"
+
+	// Third-party:
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/site"
+	"github.com/biztos/kisipar/site/sitetest"
+)
+
+// A RecordingT records errors instead of failing the test.
+type RecordingT struct {
+	testing.TB
+	Errors []string
+}
+
+func (t *RecordingT) Helper() {}
+
+func (t *RecordingT) Errorf(format string, args ...interface{}) {
+	t.Errors = append(t.Errors, fmt.Sprintf(format, args...))
+}
+
+var redirectsYaml = `# SITETEST
+Redirects:
+    - {From: /old, To: /new}
+    - {From: /gone, Status: 410}
+`
+
+func Test_AssertRedirect(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtualYaml(redirectsYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := &RecordingT{TB: t}
+	assert.True(sitetest.AssertRedirect(rt, s, "http://x.com/old", 301,
+		"/new"), "redirect matched")
+	assert.True(sitetest.AssertRedirect(rt, s, "http://x.com/gone", 410,
+		"/any"), "gone matched without location")
+	assert.Empty(rt.Errors, "no errors")
+
+	assert.False(sitetest.AssertRedirect(rt, s, "http://x.com/old", 302,
+		"/other"), "mismatch")
+	assert.Equal([]string{
+		"status for http://x.com/old: expected 302, got 301",
+		`location for http://x.com/old: expected "/other", got "/new"`,
+	}, rt.Errors, "errors recorded")
+
+}
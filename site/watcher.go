@@ -0,0 +1,459 @@
+// watcher.go - file watching for the Kisipar site.
+// ----------
+// NOTE: this polls, which is not the most efficient thing in the world, but
+// it works everywhere and is cheap enough for the small sites we expect.
+
+package site
+
+import (
+	// Standard library:
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	// Kisipar packages:
+	"github.com/biztos/kisipar/page"
+)
+
+// fileState is what we remember about each watched file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// A WatchEvent describes the changes found by a Watcher in a single scan.
+// All paths are file paths, including the Site's Path, and include added,
+// modified and removed files.  Assets are non-Page files under the PagePath.
+// Redirects is set if the REDIRECTS_FILE changed.
+//
+// Errors collects any errors encountered while applying the changes, such
+// as Page parse errors or Template errors.  Such errors do not stop the
+// Watcher: the Page is removed, or the old Template kept, until the next
+// change fixes it.
+type WatchEvent struct {
+	Pages     []string
+	Assets    []string
+	Templates []string
+	Static    []string
+	Config    bool
+	Redirects bool
+	Errors    []error
+}
+
+// Empty returns true if the WatchEvent holds no changes.
+func (e *WatchEvent) Empty() bool {
+	return len(e.Pages) == 0 && len(e.Assets) == 0 &&
+		len(e.Templates) == 0 && len(e.Static) == 0 && !e.Config &&
+		!e.Redirects
+}
+
+// A Watcher polls a Site's PagePath, TemplatePath, StaticPath, config file
+// and REDIRECTS_FILE for changes.  Changed Pages are reloaded into the
+// Site's Pageset, any Template change causes the whole set of templates to
+// be reloaded, and a changed REDIRECTS_FILE sets the Redirects again.
+// Static changes are only reported, as static files are always read from
+// disk.  A config change requires a full reload of the Site: if it is
+// served by a LiveSite, a running Watcher triggers one, otherwise it logs
+// that a reload or restart is needed.
+type Watcher struct {
+
+	// The Site being watched.
+	Site *Site
+
+	// The Interval between scans when running.
+	Interval time.Duration
+
+	// OnChange, if not nil, is called after every scan that found changes.
+	// It is called from the Watcher's goroutine and should not block.
+	OnChange func(*WatchEvent)
+
+	files     map[string]fileState
+	scanMutex sync.Mutex
+
+	stop  chan bool
+	done  chan bool
+	mutex sync.Mutex
+}
+
+// NewWatcher returns a Watcher for the Site, taking an initial inventory of
+// its files; subsequent changes are found by Scan.  The Watcher is not
+// started.
+func NewWatcher(s *Site, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = DEFAULT_WATCH_INTERVAL
+	}
+	w := &Watcher{
+		Site:     s,
+		Interval: interval,
+	}
+	w.files = w.inventory()
+	return w
+}
+
+// Start starts polling in the background.  It has no effect if the Watcher
+// is already running.
+func (w *Watcher) Start() {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.stop != nil {
+		return
+	}
+	w.stop = make(chan bool)
+	w.done = make(chan bool)
+	go w.run(w.stop, w.done)
+}
+
+// Stop stops polling, waiting for any scan in progress to finish.  It has no
+// effect if the Watcher is not running.
+func (w *Watcher) Stop() {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.stop = nil
+	w.done = nil
+}
+
+func (w *Watcher) run(stop, done chan bool) {
+
+	defer close(done)
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ev := w.Scan()
+			for _, err := range ev.Errors {
+				log.Printf("%s: watcher: %s", w.Site.Name, err)
+			}
+			if ev.Config {
+				w.Site.configChanged()
+			}
+			w.Site.devNotify(ev)
+			if !ev.Empty() && w.OnChange != nil {
+				w.OnChange(ev)
+			}
+		}
+	}
+}
+
+// Scan checks the Site's files once, applies any Page and Template changes
+// found to the Site, and returns a WatchEvent describing the changes.
+func (w *Watcher) Scan() *WatchEvent {
+
+	w.scanMutex.Lock()
+	defer w.scanMutex.Unlock()
+
+	s := w.Site
+	ev := &WatchEvent{}
+	files := w.inventory()
+
+	changed := []string{}
+	removed := []string{}
+	for path, st := range files {
+		if old, ok := w.files[path]; !ok || old != st {
+			changed = append(changed, path)
+		}
+	}
+	for path := range w.files {
+		if _, ok := files[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(removed)
+	w.files = files
+
+	recascade := false
+	for _, path := range append(changed, removed...) {
+		switch w.classify(path) {
+		case "config":
+			ev.Config = true
+		case "redirects":
+			ev.Redirects = true
+		case "page":
+			ev.Pages = append(ev.Pages, path)
+			recascade = recascade || isIndexPath(path)
+		case "asset":
+			ev.Assets = append(ev.Assets, path)
+			recascade = recascade || filepath.Base(path) == CASCADE_FILE
+		case "template":
+			ev.Templates = append(ev.Templates, path)
+		case "static":
+			ev.Static = append(ev.Static, path)
+		}
+	}
+
+	// Pages are updated one by one; removals come last so that a "foo.txt"
+	// replacing a "foo.md" is not clobbered.
+	if s.Pageset != nil {
+		for _, path := range changed {
+			if w.classify(path) == "page" {
+				if err := w.loadPage(path); err != nil {
+					ev.Errors = append(ev.Errors, err)
+				}
+			}
+		}
+		for _, path := range removed {
+			if w.classify(path) == "page" {
+				if err := w.removePage(path); err != nil {
+					ev.Errors = append(ev.Errors, err)
+				}
+			}
+		}
+
+		// Changed cascades may change any Page below them.
+		if recascade {
+			ev.Errors = append(ev.Errors, w.recascade()...)
+		}
+
+		// Any Page may have taken or given up a route.
+		if len(ev.Pages) > 0 || recascade {
+			s.setRoutes(func(path string, err error) {
+				ev.Errors = append(ev.Errors, err)
+			})
+		}
+	}
+
+	// A bad REDIRECTS_FILE leaves the Redirects as they were.
+	if ev.Redirects {
+		if err := s.setupRedirects(); err != nil {
+			ev.Errors = append(ev.Errors, err)
+		}
+	}
+
+	// Templates are only meaningful as a set.
+	if len(ev.Templates) > 0 {
+		if err := s.LoadTemplates(); err != nil {
+			ev.Errors = append(ev.Errors,
+				fmt.Errorf("Template error: %s", err.Error()))
+		}
+	}
+
+	return ev
+
+}
+
+func (w *Watcher) loadPage(path string) error {
+
+	s := w.Site
+	key := strings.TrimSuffix(path, filepath.Ext(path))
+	p, err := s.loadPage(path)
+	if err != nil {
+		// As with RefreshPage, a bad page is no page at all.
+		if cur := s.Pageset.Page(key); cur != nil && cur.Path == path {
+			s.Pageset.RemovePage(key)
+		}
+		if _, ok := err.(pageErrors); ok {
+			return err
+		}
+		return fmt.Errorf("Page error for %s: %s", path, err.Error())
+	}
+	s.Pageset.AddPage(p)
+	return nil
+
+}
+
+// recascade reloads the CASCADE_FILEs and the index Page cascades, and then
+// any Pages whose cascaded meta has changed.  If a CASCADE_FILE can not be
+// loaded, the error is returned and nothing is changed until it is fixed.
+func (w *Watcher) recascade() []error {
+
+	s := w.Site
+	metaFiles := []string{}
+	for path := range w.files {
+		if w.classify(path) == "asset" && filepath.Base(path) == CASCADE_FILE {
+			metaFiles = append(metaFiles, path)
+		}
+	}
+	sort.Strings(metaFiles)
+	if err := s.resetCascades(metaFiles); err != nil {
+		return []error{err}
+	}
+
+	errs := []error{}
+	pages := map[string]*page.Page{}
+	paths := []string{}
+	for _, p := range s.Pageset.Pages() {
+		if !p.Virtual {
+			pages[p.Path] = p
+			paths = append(paths, p.Path)
+		}
+	}
+	sortIndexFirst(paths)
+	for _, path := range paths {
+		p := pages[path]
+		cascade := s.cascadeFor(path)
+		if len(p.Cascade) == 0 && len(cascade) == 0 ||
+			reflect.DeepEqual(p.Cascade, cascade) {
+			if err := s.setIndexCascade(p); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := w.loadPage(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+
+}
+
+func (w *Watcher) removePage(path string) error {
+
+	s := w.Site
+	key := strings.TrimSuffix(path, filepath.Ext(path))
+	if cur := s.Pageset.Page(key); cur == nil || cur.Path != path {
+		return nil
+	}
+	s.Pageset.RemovePage(key)
+
+	// There might be another source for the same key, e.g. "foo.txt" after
+	// removing "foo.md".
+	p, err := s.Parsers.LoadAnyWith(key, s.loadPage)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if _, ok := err.(pageErrors); ok {
+			return err
+		}
+		return fmt.Errorf("Page error for %s: %s", key, err.Error())
+	}
+	s.Pageset.AddPage(p)
+	return nil
+
+}
+
+// classify returns the kind of file at path: config, redirects, page, asset,
+// template, static, or the empty string if it is not something we watch.
+func (w *Watcher) classify(path string) string {
+
+	s := w.Site
+	sep := string(os.PathSeparator)
+	if s.Path != "" && path == filepath.Join(s.Path, "config.yaml") {
+		return "config"
+	}
+	if s.Path != "" && path == filepath.Join(s.Path, REDIRECTS_FILE) {
+		return "redirects"
+	}
+	if s.PagePath != "" && strings.HasPrefix(path, s.PagePath+sep) {
+		ext := filepath.Ext(path)
+		for _, e := range s.PageExtensions {
+			if ext == e {
+				return "page"
+			}
+		}
+		return "asset"
+	}
+	if s.TemplatePath != "" && strings.HasPrefix(path, s.TemplatePath+sep) {
+		return "template"
+	}
+	if s.StaticPath != "" && strings.HasPrefix(path, s.StaticPath+sep) {
+		return "static"
+	}
+	return ""
+}
+
+// inventory returns the current state of all watched files.  Files that
+// can not be read, including missing directories, are simply omitted.
+func (w *Watcher) inventory() map[string]fileState {
+
+	s := w.Site
+	files := map[string]fileState{}
+	if s.Path == "" {
+		return files
+	}
+
+	for _, name := range []string{"config.yaml", REDIRECTS_FILE} {
+		cpath := filepath.Join(s.Path, name)
+		if info, err := os.Stat(cpath); err == nil {
+			files[cpath] = fileState{info.ModTime(), info.Size()}
+		}
+	}
+
+	visit := func(path string, f os.FileInfo, err error) error {
+		if err != nil || f.IsDir() {
+			return nil
+		}
+		files[path] = fileState{f.ModTime(), f.Size()}
+		return nil
+	}
+	for _, dir := range []string{s.PagePath, s.TemplatePath, s.StaticPath} {
+		if dir != "" {
+			filepath.Walk(dir, visit)
+		}
+	}
+
+	return files
+
+}
+
+// configChanged reloads the Site in the background if it is served by a
+// LiveSite, and otherwise logs that the change does not take effect yet.
+// The reload stops the Watcher, so it must not wait for it.
+func (s *Site) configChanged() {
+
+	s.mutex.RLock()
+	reload := s.reload
+	s.mutex.RUnlock()
+
+	if reload == nil {
+		log.Printf("%s: config changed; reload or restart to apply it.",
+			s.Name)
+		return
+	}
+	log.Printf("%s: config changed, reloading.", s.Name)
+	go reload()
+}
+
+// StartWatching starts a Watcher for the Site with its WatchInterval, unless
+// one is already running, and returns the running Watcher.
+func (s *Site) StartWatching() *Watcher {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.Watcher == nil {
+		s.Watcher = NewWatcher(s, s.WatchInterval)
+	}
+	s.Watcher.Start()
+	return s.Watcher
+}
+
+// StopWatching stops the Site's Watcher, if any.  Pages are then checked on
+// disk for every request, as usual.
+func (s *Site) StopWatching() {
+
+	s.mutex.Lock()
+	w := s.Watcher
+	s.Watcher = nil
+	s.mutex.Unlock()
+
+	if w != nil {
+		w.Stop()
+	}
+}
+
+// watching returns true if a Watcher is keeping the Site up to date.
+func (s *Site) watching() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.Watcher != nil
+}
@@ -0,0 +1,339 @@
+// watcher_test.go - tests for the Kisipar site file watcher.
+// ---------------
+
+package site_test
+
+import (
+	// Standard:
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	// Third-party:
+	"github.com/stretchr/testify/assert"
+
+	// Kisipar:
+	"github.com/biztos/kisipar/site"
+	"github.com/biztos/kisipar/site/sitetest"
+)
+
+// tempSite creates a temp site directory with one page, one template and
+// one static file, for tests that change it before loading.
+func tempSite(t *testing.T) string {
+
+	dir, err := ioutil.TempDir("", "kisipar-site-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sub := range []string{"pages", "templates", "static"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(dir, "config.yaml"), "Name: Watched")
+	writeFile(t, filepath.Join(dir, "pages", "foo.md"), "# Foo")
+	writeFile(t, filepath.Join(dir, "templates", "single.html"), "S:{{ .Page.Title }}")
+	writeFile(t, filepath.Join(dir, "static", "x.js"), "x")
+	return dir
+}
+
+// watchSite creates and loads a temp site as made by tempSite.
+func watchSite(t *testing.T) (string, *site.Site) {
+
+	dir := tempSite(t)
+	s, err := site.Load(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return dir, s
+}
+
+// writeFile writes the file and pushes its mod time forward, so changes are
+// seen even on filesystems with coarse timestamps.
+func writeFile(t *testing.T, path, content string) {
+
+	if err := ioutil.WriteFile(path, []byte(content), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(time.Hour)
+	if info, err := os.Stat(path); err == nil && !info.ModTime().Before(mtime) {
+		mtime = info.ModTime().Add(time.Second)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_Watcher_NoChanges(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+
+	w := site.NewWatcher(s, 0)
+	assert.Equal(site.DEFAULT_WATCH_INTERVAL, w.Interval, "default interval")
+	ev := w.Scan()
+	assert.True(ev.Empty(), "no changes found")
+	assert.Nil(ev.Errors, "no errors")
+
+}
+
+func Test_Watcher_VirtualSite(t *testing.T) {
+
+	assert := assert.New(t)
+
+	s, err := site.LoadVirtual(nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := site.NewWatcher(s, time.Second).Scan()
+	assert.True(ev.Empty(), "no changes found")
+
+}
+
+func Test_Watcher_Pages(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	pdir := filepath.Join(dir, "pages")
+	w := site.NewWatcher(s, time.Second)
+
+	// Change one, add one, add a non-page.
+	writeFile(t, filepath.Join(pdir, "foo.md"), "# Foo Changed")
+	writeFile(t, filepath.Join(pdir, "bar.md"), "# Bar")
+	writeFile(t, filepath.Join(pdir, "bar.js"), "x")
+	ev := w.Scan()
+	assert.Equal([]string{
+		filepath.Join(pdir, "bar.md"),
+		filepath.Join(pdir, "foo.md"),
+	}, ev.Pages, "pages reported")
+	assert.Equal([]string{filepath.Join(pdir, "bar.js")}, ev.Assets,
+		"assets reported")
+	assert.Nil(ev.Errors, "no errors")
+	if p := s.Pageset.Page(filepath.Join(pdir, "foo")); assert.NotNil(p) {
+		assert.Equal("Foo Changed", p.Title(), "changed page reloaded")
+	}
+	if p := s.Pageset.Page(filepath.Join(pdir, "bar")); assert.NotNil(p) {
+		assert.Equal("Bar", p.Title(), "new page loaded")
+	}
+
+	// Replace one with another extension, remove another.
+	writeFile(t, filepath.Join(pdir, "foo.txt"), "# Foo Text")
+	os.Remove(filepath.Join(pdir, "foo.md"))
+	os.Remove(filepath.Join(pdir, "bar.md"))
+	ev = w.Scan()
+	assert.Equal(3, len(ev.Pages), "pages reported")
+	assert.Nil(ev.Errors, "no errors")
+	if p := s.Pageset.Page(filepath.Join(pdir, "foo")); assert.NotNil(p) {
+		assert.Equal("Foo Text", p.Title(), "replacement page loaded")
+	}
+	assert.Nil(s.Pageset.Page(filepath.Join(pdir, "bar")), "page removed")
+
+}
+
+func Test_Watcher_PageError(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	pdir := filepath.Join(dir, "pages")
+	w := site.NewWatcher(s, time.Second)
+
+	writeFile(t, filepath.Join(pdir, "foo.md"), "# Bad!\n\n    foo: { x [ y,\n")
+	ev := w.Scan()
+	if assert.Equal(1, len(ev.Errors), "one error") {
+		assert.Regexp("^Page error for .*foo.md: yaml", ev.Errors[0].Error(),
+			"error is useful")
+	}
+	assert.Nil(s.Pageset.Page(filepath.Join(pdir, "foo")), "bad page removed")
+
+	writeFile(t, filepath.Join(pdir, "foo.md"), "# Good Again")
+	ev = w.Scan()
+	assert.Nil(ev.Errors, "no errors after fix")
+	assert.NotNil(s.Pageset.Page(filepath.Join(pdir, "foo")), "page is back")
+
+}
+
+func Test_Watcher_UnlistedPaths(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	s.UnlistedPaths = []string{"/hidden/"}
+	hdir := filepath.Join(dir, "pages", "hidden")
+	if err := os.Mkdir(hdir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	w := site.NewWatcher(s, time.Second)
+
+	writeFile(t, filepath.Join(hdir, "secret.md"), "# Secret")
+	w.Scan()
+	if p := s.Pageset.Page(filepath.Join(hdir, "secret")); assert.NotNil(p) {
+		assert.True(p.Unlisted, "page unlisted by path")
+	}
+
+}
+
+func Test_Watcher_Templates(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	tpath := filepath.Join(dir, "templates", "single.html")
+	w := site.NewWatcher(s, time.Second)
+
+	writeFile(t, tpath, "CHANGED:{{ .Page.Title }}")
+	ev := w.Scan()
+	assert.Equal([]string{tpath}, ev.Templates, "template reported")
+	assert.Nil(ev.Errors, "no errors")
+
+	req, rec := ReqAndRec(t, "http://example.com/foo")
+	s.ServeHTTP(rec, req)
+	assert.Equal("CHANGED:Foo", rec.Body.String(), "new template used")
+
+	// A broken template leaves the old set in place.
+	writeFile(t, tpath, "{{ .Broken ")
+	ev = w.Scan()
+	if assert.Equal(1, len(ev.Errors), "one error") {
+		assert.Regexp("^Template error: ", ev.Errors[0].Error(),
+			"error is useful")
+	}
+	req, rec = ReqAndRec(t, "http://example.com/foo")
+	s.ServeHTTP(rec, req)
+	assert.Equal("CHANGED:Foo", rec.Body.String(), "old template kept")
+
+}
+
+func Test_Watcher_StaticAndConfig(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	w := site.NewWatcher(s, time.Second)
+
+	spath := filepath.Join(dir, "static", "x.js")
+	os.Remove(spath)
+	writeFile(t, filepath.Join(dir, "config.yaml"), "Name: Changed")
+	ev := w.Scan()
+	assert.Equal([]string{spath}, ev.Static, "static removal reported")
+	assert.True(ev.Config, "config change reported")
+	assert.Equal("Watched", s.Name, "config not reloaded")
+
+}
+
+func Test_Watcher_Redirects(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	w := site.NewWatcher(s, time.Second)
+	rpath := filepath.Join(dir, site.REDIRECTS_FILE)
+
+	writeFile(t, rpath, "- {From: /old, To: /foo}\n")
+	ev := w.Scan()
+	assert.True(ev.Redirects, "redirects change reported")
+	assert.False(ev.Config, "redirects file is not config")
+	assert.Nil(ev.Errors, "no errors")
+	sitetest.AssertRedirect(t, s, "http://example.com/old", 301, "/foo")
+
+	writeFile(t, rpath, "- {From: /old, To: /bar, Status: 302}\n")
+	w.Scan()
+	sitetest.AssertRedirect(t, s, "http://example.com/old", 302, "/bar")
+
+	// A bad file keeps the Redirects as they were:
+	writeFile(t, rpath, "- {From: old, To: /baz}\n")
+	ev = w.Scan()
+	if assert.Equal(1, len(ev.Errors), "one error") {
+		assert.Equal("Redirects file "+rpath+" item 0: old does not start "+
+			"with a slash.", ev.Errors[0].Error(), "error useful")
+	}
+	sitetest.AssertRedirect(t, s, "http://example.com/old", 302, "/bar")
+
+	os.Remove(rpath)
+	ev = w.Scan()
+	assert.True(ev.Redirects, "redirects removal reported")
+	assert.Empty(s.Redirects, "redirects removed")
+
+}
+
+func Test_Watcher_StartStop(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	s.WatchInterval = 10 * time.Millisecond
+
+	events := make(chan *site.WatchEvent, 10)
+	w := s.StartWatching()
+	w.OnChange = func(ev *site.WatchEvent) { events <- ev }
+	assert.True(w == s.StartWatching(), "same watcher if already running")
+
+	writeFile(t, filepath.Join(dir, "pages", "foo.md"), "# Foo Watched")
+	select {
+	case ev := <-events:
+		assert.Equal(1, len(ev.Pages), "page change reported")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported")
+	}
+
+	s.StopWatching()
+	assert.Nil(s.Watcher, "Watcher removed")
+	s.StopWatching() // no-op
+	w.Stop()         // no-op
+
+}
+
+func Test_PageForPath_Watching(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	pdir := filepath.Join(dir, "pages")
+	s.Watcher = site.NewWatcher(s, time.Second)
+
+	// Changes on disk are not seen until the Watcher scans.
+	writeFile(t, filepath.Join(pdir, "foo.md"), "# Foo Changed")
+	writeFile(t, filepath.Join(pdir, "bar.md"), "# Bar")
+	p, err := s.PageForPath("/foo")
+	if assert.Nil(err, "no error") {
+		assert.Equal("Foo", p.Title(), "old page returned")
+	}
+	_, err = s.PageForPath("/bar")
+	assert.True(os.IsNotExist(err), "new page not found")
+
+	s.Watcher.Scan()
+	p, err = s.PageForPath("/foo")
+	if assert.Nil(err, "no error") {
+		assert.Equal("Foo Changed", p.Title(), "new page returned")
+	}
+	_, err = s.PageForPath("/bar")
+	assert.Nil(err, "new page found")
+
+}
+
+func Test_Serve_Watch(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir, s := watchSite(t)
+	defer os.RemoveAll(dir)
+	s.Server = &FakeServer{}
+	s.Watch = true
+
+	assert.Error(s.Serve(), "error returned")
+	assert.Nil(s.Watcher, "Watcher stopped after Serve")
+
+}
@@ -18,6 +18,7 @@ var TIME_PARSING_FORMAT_STRINGS = []string{
 	// (These are not only useful, they are probably more common than the
 	// standard set of fomats.)
 	"2006-01-02",              //  obvious way to do a European timestamp
+	"2006-1-2",                // YAML allows this, and so do we
 	"2006.01.02",              // it's also done like this quite often
 	"20060102",                // did they seriously forget this?
 	"2006-01-02 15:04:05 MST", // very useful format!
@@ -45,6 +46,15 @@ var TIME_PARSING_FORMAT_STRINGS = []string{
 
 }
 
+// DATE_PARSING_FORMAT_STRINGS contains the formats of
+// TIME_PARSING_FORMAT_STRINGS that hold only a date, and no time of day.
+var DATE_PARSING_FORMAT_STRINGS = []string{
+	"2006-01-02",
+	"2006-1-2",
+	"2006.01.02",
+	"20060102",
+}
+
 // ParseTimeString attempts to parse s into a time, trying each format in the
 // TIME_PARSING_FORMAT_STRINGS in order.  If no parse is successful, nil is
 // returned.
@@ -58,3 +68,28 @@ func ParseTimeString(s string) *time.Time {
 	}
 	return nil
 }
+
+// ParseTimeStringInLocation is like ParseTimeString, but times without
+// zone information are taken to be in the given Location.
+func ParseTimeStringInLocation(s string, loc *time.Location) *time.Time {
+
+	for _, f := range TIME_PARSING_FORMAT_STRINGS {
+		t, err := time.ParseInLocation(f, s, loc)
+		if err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+// IsDateString returns true if s parses as a date only, with one of the
+// DATE_PARSING_FORMAT_STRINGS.
+func IsDateString(s string) bool {
+
+	for _, f := range DATE_PARSING_FORMAT_STRINGS {
+		if _, err := time.Parse(f, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -44,3 +44,42 @@ func Test_ParseTimeString(t *testing.T) {
 	got := defparsed.String()
 	assert.Equal(exp, got, "default string parsed correctly")
 }
+
+func Test_ParseTimeStringInLocation(t *testing.T) {
+
+	assert := assert.New(t)
+
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database: " + err.Error())
+	}
+
+	parsed := utli.ParseTimeStringInLocation("2017-07-14 15:04:05", loc)
+	if assert.NotNil(parsed, "time returned on good parse") {
+		assert.Equal("2017-07-14 19:04:05 +0000 UTC", parsed.UTC().String(),
+			"time without zone in location")
+	}
+
+	parsed = utli.ParseTimeStringInLocation("2017-07-14T15:04:05+02:00", loc)
+	if assert.NotNil(parsed, "time returned on good parse") {
+		assert.Equal("2017-07-14 13:04:05 +0000 UTC", parsed.UTC().String(),
+			"time with zone not moved")
+	}
+
+	assert.Nil(utli.ParseTimeStringInLocation("2015/07/14", loc),
+		"nil returned on failed parse")
+
+}
+
+func Test_IsDateString(t *testing.T) {
+
+	assert := assert.New(t)
+
+	assert.True(utli.IsDateString("2017-07-14"), "dash date")
+	assert.True(utli.IsDateString("2017-7-4"), "short dash date")
+	assert.True(utli.IsDateString("2017.07.14"), "dot date")
+	assert.True(utli.IsDateString("20170714"), "compact date")
+	assert.False(utli.IsDateString("2017-07-14 15:04:05"), "date and time")
+	assert.False(utli.IsDateString("nope"), "not a date")
+
+}